@@ -1,14 +1,31 @@
 package agent
 
 import (
+	"context"
 	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
-
+	"sync"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent/checkpoint"
+	"github.com/this-is-alpha-iota/clyde/agent/customtools"
+	"github.com/this-is-alpha-iota/clyde/agent/hooks"
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+	"github.com/this-is-alpha-iota/clyde/agent/lsp"
 	"github.com/this-is-alpha-iota/clyde/agent/mcp"
+	"github.com/this-is-alpha-iota/clyde/agent/plan"
 	"github.com/this-is-alpha-iota/clyde/agent/prompts"
 	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/redact"
+	"github.com/this-is-alpha-iota/clyde/agent/repomap"
+	"github.com/this-is-alpha-iota/clyde/agent/sandbox"
 	"github.com/this-is-alpha-iota/clyde/agent/skills"
+	"github.com/this-is-alpha-iota/clyde/agent/todo"
 	"github.com/this-is-alpha-iota/clyde/agent/tools"
+	"github.com/this-is-alpha-iota/clyde/agent/workspace"
 	// Blank-import all tool packages so their init() functions register tools
 	// into the global registry. This is the ONLY place this import exists —
 	// external consumers never need to do it.
@@ -49,6 +66,66 @@ type Config struct {
 	// ToolResultThreshold is the character count above which tool results are
 	// intelligently summarized during compaction. 0 uses DefaultToolResultThreshold (2000).
 	ToolResultThreshold int
+	// MicroCompactPercent is the context usage (percent of ContextWindowSize)
+	// above which stale tool results are pruned without an LLM call.
+	// 0 uses DefaultMicroCompactPercent (60).
+	MicroCompactPercent int
+	// MicroCompactKeepTurns is the number of recent assistant turns whose tool
+	// results are never pruned. 0 uses DefaultMicroCompactKeepTurns (8).
+	MicroCompactKeepTurns int
+	// ApplyPatchFuzz is how loosely apply_patch matches context lines when a
+	// call does not say (0 = exact … 3 = also ignore inner whitespace and
+	// punctuation). nil uses the default (2, ignore indentation).
+	ApplyPatchFuzz *int
+	// ReadFileMaxLines is how many lines read_file returns when a call gives
+	// no limit. 0 uses the default (2000).
+	ReadFileMaxLines int
+	// CheckpointDir is where file snapshots are stored before the agent edits
+	// files (normally <repo>/.clyde/checkpoints/<session-id>). Empty disables
+	// checkpointing.
+	CheckpointDir string
+	// LSPCommand is the language server behind the lsp_* tools and the
+	// diagnostics reported after file edits (e.g. "gopls"). It starts on
+	// first use. Empty, or a command not found on PATH, disables LSP support.
+	LSPCommand string
+	// RepoMapTokens, when positive, adds a repository map (an outline of the
+	// packages, types and functions in the working directory's repository) of
+	// roughly this many tokens to the system prompt, built on the first
+	// message. 0 disables it; the repo_map tool is available either way.
+	RepoMapTokens int
+	// RedactSecrets controls whether secrets (API keys, tokens, private keys,
+	// high-entropy strings, the values below) are replaced with placeholders
+	// in user messages and tool results before they enter the history or
+	// reach any callback. Default true; set false to disable.
+	RedactSecrets *bool
+	// RedactAllowlist lists strings that are never redacted: a match
+	// containing any of them is kept (e.g. a test fixture key).
+	RedactAllowlist []string
+	// RedactValues are exact values to redact, keyed by the name shown in
+	// the placeholder (e.g. other credentials from the config file). APIKey
+	// and BraveSearchAPIKey are always included.
+	RedactValues map[string]string
+	// WorkspaceRoots are extra directories the file tools may write to and
+	// read from without approval, besides the repository root of the working
+	// directory (absolute, relative, or starting with "~/"). Add "/" to lift
+	// the restriction.
+	WorkspaceRoots []string
+	// OutsideReads is what happens when a file tool reads outside the
+	// workspace roots: "ask" (default) needs the user's approval through the
+	// permission callback, "allow" permits it. Writes outside are always
+	// denied.
+	OutsideReads string
+	// TaskModel is the model sub-agents started by the task tool use when the
+	// call names none (e.g. a faster, cheaper model for searches). Empty uses
+	// ModelID.
+	TaskModel string
+	// AskUserDefault is the answer ask_user gets when there is no ask-user
+	// callback, i.e. no user to ask (CLI mode). Empty tells the model to
+	// proceed with its best judgment.
+	AskUserDefault string
+	// PlanMode starts the agent in plan mode: read-only tools and a planning
+	// instruction, until a submitted plan is approved (see SetPlanMode).
+	PlanMode bool
 }
 
 // ProgressCallback receives tool progress lines (the → lines).
@@ -94,100 +171,211 @@ type AssistantMessageCallback func(text string)
 // toolUseID is the unique ID, and input is the tool's input parameters.
 type ToolUseCallback func(displayMsg string, toolName string, toolUseID string, input map[string]interface{})
 
+// PermissionCallback asks the user to approve a tool call that needs it
+// (e.g. run_bash with unsandboxed: true). request describes what the call
+// will do. Returning false denies the call; without a callback, such calls
+// are always denied.
+type PermissionCallback func(toolName string, request string) bool
+
+// maxStopHookBlocks is how many times Stop hooks may send one turn back to
+// the model before it ends regardless, so a hook that always blocks cannot
+// loop forever.
+const maxStopHookBlocks = 5
+
 // Agent handles conversation and tool execution
 type Agent struct {
 	apiClient          *providers.Client
 	systemPrompt       string
 	history            []providers.Message
-	progressCallback   ProgressCallback
-	outputCallback     OutputCallback
-	thinkingCallback   ThinkingCallback
-	diagnosticCallback DiagnosticCallback
-	spinnerCallback    SpinnerCallback
-	errorCallback      ErrorCallback
-	userMsgCallback    UserMessageCallback
-	assistantMsgCallback AssistantMessageCallback
-	toolUseCallback      ToolUseCallback
-	compactionCallback CompactionCallback
+	eventHandlers      []EventHandler // See WithEventHandler; the With*Callback options add to it
+	eventSeq           int            // Events emitted so far, for EventMeta.ID
+	turnSeq            int            // HandleMessage calls so far, for EventMeta.Turn
+	stopReason         string         // Stop reason of the current turn's last API response
+	permissionCallback   PermissionCallback
 	lastUsage          providers.Usage // Token usage from the most recent API response
 	contextWindowSize  int             // Model context window size in tokens (for diagnostic display)
 	reserveTokens      int             // Tokens to reserve for response; triggers compaction when exceeded
 	compactIncludeRecentContext bool   // Feed recent kept messages into compaction phases
 	toolResultThreshold        int    // Char threshold for intelligent tool-result summarization
+	microCompactPercent        int    // Context % that triggers stale tool-result pruning
+	microCompactKeepTurns      int    // Recent assistant turns exempt from pruning
 	mcpServer          *mcp.PlaywrightServer // MCP server (nil if not enabled)
 	skillsRegistry     *skills.Registry      // Agent Skills registry (nil if no skills found)
+	checkpoints        *checkpoint.Store     // File snapshots for undo (nil if disabled)
+	lspServer          *lsp.Server           // Language server (nil if not enabled)
+	repoMapTokens      int                   // Repository map budget (0 = off)
+	repoMap            string                // Repository map added to the system prompt, once built
+	repoMapBuilt       bool                  // The map was built (or failed) on the first message
+	redactor           *redact.Redactor      // Secret redaction (nil if disabled)
+	workspace          *workspace.Policy     // Paths file tools may use (nil = unrestricted)
+	hooks              *hooks.Hooks          // User scripts run around the loop (nil if none)
+	untrusted          []untrustedConfig     // Project hooks and tools awaiting the user's approval
+	redactions         int                   // Secrets redacted so far
+	turn               *checkpoint.Turn      // Checkpoint of the message being handled (nil outside HandleMessage)
+	allowedTools       map[string]bool       // Tools the model may call (nil = all registered tools)
+	maxTurns           int                   // API calls allowed per message (0 = unlimited)
+	taskModel          string                // Model for task sub-agents ("" = same model)
+	parent             *Agent                // Agent that started this one with the task tool (nil if none)
+	subAgentCallback   SubAgentCallback
+	todos              []todo.Item           // Todo list kept with todo_write
+	todoCallback       TodoCallback
+	askUserDefault     string                // ask_user answer when no user is available ("" = proceed with best judgment)
+	askUserCallback    AskUserCallback
+	planMode           bool                  // Read-only tools and the planning prompt (see SetPlanMode)
+	pendingPlan        *plan.Plan            // Plan submitted in plan mode, awaiting approval
+	planCallback       PlanCallback
+	queueMu            sync.Mutex            // Guards queue, which Queue fills from other goroutines
+	queue              []string              // User messages typed during a turn, not yet delivered
+	queueCallback      QueueCallback
 }
 
 // AgentOption is a functional option for configuring an Agent
 type AgentOption func(*Agent)
 
+// The With*Callback options below are event handlers (see WithEventHandler)
+// that pass on the events they are about. Only the progress, spinner and
+// error callbacks see sub-agents' events too.
+
 // WithProgressCallback sets the callback for tool progress lines (→ lines).
 func WithProgressCallback(cb ProgressCallback) AgentOption {
-	return func(a *Agent) {
-		a.progressCallback = cb
-	}
+	return WithEventHandler(func(e Event) {
+		if call, ok := e.(ToolCallEvent); ok && call.Display != "" {
+			cb(call.Display, call.ToolUseID)
+		}
+	})
 }
 
 // WithOutputCallback sets the callback for tool output bodies (full text).
 func WithOutputCallback(cb OutputCallback) AgentOption {
-	return func(a *Agent) {
-		a.outputCallback = cb
-	}
+	return WithEventHandler(func(e Event) {
+		if result, ok := e.(ToolResultEvent); ok && result.TaskID == "" && result.Output != "" && !result.Image {
+			cb(result.Output, result.ToolUseID)
+		}
+	})
 }
 
 // WithThinkingCallback sets the callback for thinking trace display.
 // The callback receives the full, untruncated thinking text.
 func WithThinkingCallback(cb ThinkingCallback) AgentOption {
-	return func(a *Agent) {
-		a.thinkingCallback = cb
-	}
+	return WithEventHandler(func(e Event) {
+		if thinking, ok := e.(ThinkingDeltaEvent); ok && thinking.TaskID == "" {
+			cb(thinking.Text, thinking.Signature)
+		}
+	})
 }
 
 // WithDiagnosticCallback sets the callback for diagnostic messages
 // (cache stats, token counts, redacted thinking notes, etc.).
 func WithDiagnosticCallback(cb DiagnosticCallback) AgentOption {
-	return func(a *Agent) {
-		a.diagnosticCallback = cb
-	}
+	return WithEventHandler(func(e Event) {
+		if diag, ok := e.(DiagnosticEvent); ok && diag.TaskID == "" {
+			cb(diag.Message)
+		}
+	})
 }
 
 // WithSpinnerCallback sets the spinner callback for starting/stopping
-// the loading spinner during operations.
+// the loading spinner during operations: started for each API call, stopped
+// when it returns.
 func WithSpinnerCallback(cb SpinnerCallback) AgentOption {
-	return func(a *Agent) {
-		a.spinnerCallback = cb
-	}
+	waiting := false
+	return WithEventHandler(func(e Event) {
+		switch e.(type) {
+		case APIRequestEvent:
+			waiting = true
+			cb(true, "Thinking...")
+		case UsageEvent, TurnEndEvent:
+			if waiting {
+				waiting = false
+				cb(false, "")
+			}
+		}
+	})
 }
 
 // WithErrorCallback sets the error callback
 func WithErrorCallback(cb ErrorCallback) AgentOption {
-	return func(a *Agent) {
-		a.errorCallback = cb
-	}
+	return WithEventHandler(func(e Event) {
+		if ev, ok := e.(ErrorEvent); ok {
+			cb(ev.Err)
+		}
+	})
 }
 
 // WithUserMessageCallback sets the callback for user messages.
-// Called once per HandleMessage invocation with the user's input text.
+// Called once per HandleMessage invocation with the user's input text,
+// and for messages added during it (queued messages, Stop hook feedback).
 func WithUserMessageCallback(cb UserMessageCallback) AgentOption {
-	return func(a *Agent) {
-		a.userMsgCallback = cb
-	}
+	return WithEventHandler(func(e Event) {
+		if msg, ok := e.(UserMessageEvent); ok && msg.TaskID == "" {
+			cb(msg.Text)
+		}
+	})
 }
 
 // WithAssistantMessageCallback sets the callback for assistant text responses.
 // Called once per HandleMessage invocation with the final text response.
 func WithAssistantMessageCallback(cb AssistantMessageCallback) AgentOption {
-	return func(a *Agent) {
-		a.assistantMsgCallback = cb
-	}
+	return WithEventHandler(func(e Event) {
+		if msg, ok := e.(AssistantMessageEvent); ok && msg.TaskID == "" {
+			cb(msg.Text)
+		}
+	})
 }
 
 // WithToolUseCallback sets the callback for tool_use block metadata.
 // Called once per tool_use block with the display message, tool name,
 // tool use ID, and input parameters.
 func WithToolUseCallback(cb ToolUseCallback) AgentOption {
+	return WithEventHandler(func(e Event) {
+		if call, ok := e.(ToolCallEvent); ok && call.TaskID == "" {
+			cb(call.Display, call.Name, call.ToolUseID, call.Input)
+		}
+	})
+}
+
+// WithWorkspacePolicy restricts the paths file tools may use (nil removes
+// the restriction). New sets one up from Config.
+func WithWorkspacePolicy(p *workspace.Policy) AgentOption {
+	return func(a *Agent) {
+		a.workspace = p
+	}
+}
+
+// WithHooks runs h around tool calls, prompts, stopping and compaction (nil
+// disables hooks). New loads them from .clyde/hooks.json, once the user
+// approves the file.
+func WithHooks(h *hooks.Hooks) AgentOption {
+	return func(a *Agent) {
+		a.hooks = h
+	}
+}
+
+// WithTools limits the tools the model sees and may call to names (e.g. a
+// read-only set). Without it, every registered tool is available.
+func WithTools(names ...string) AgentOption {
 	return func(a *Agent) {
-		a.toolUseCallback = cb
+		a.allowedTools = make(map[string]bool, len(names))
+		for _, name := range names {
+			a.allowedTools[name] = true
+		}
+	}
+}
+
+// WithMaxTurns limits how many API calls HandleMessage makes for one
+// message. The model is asked for its final answer on the last one, and
+// HandleMessage fails if it calls tools anyway. 0 means no limit.
+func WithMaxTurns(n int) AgentOption {
+	return func(a *Agent) {
+		a.maxTurns = n
+	}
+}
+
+// WithPermissionCallback sets the callback that approves or denies tool
+// calls requiring the user's permission.
+func WithPermissionCallback(cb PermissionCallback) AgentOption {
+	return func(a *Agent) {
+		a.permissionCallback = cb
 	}
 }
 
@@ -209,6 +397,23 @@ func WithReserveTokens(tokens int) AgentOption {
 	}
 }
 
+// WithRepoMap adds a repository map of roughly tokens tokens to the system
+// prompt, built on the first message (see Config.RepoMapTokens). 0 disables
+// it.
+func WithRepoMap(tokens int) AgentOption {
+	return func(a *Agent) {
+		a.repoMapTokens = tokens
+	}
+}
+
+// WithRedactor replaces secrets in user messages and tool results using r
+// (nil disables redaction). New sets one up from Config.
+func WithRedactor(r *redact.Redactor) AgentOption {
+	return func(a *Agent) {
+		a.redactor = r
+	}
+}
+
 // New creates a new Agent from a Config. This is the primary public
 // constructor. It internally:
 //   - Creates the API client (with optional thinking configuration)
@@ -252,25 +457,114 @@ func New(cfg Config, opts ...AgentOption) *Agent {
 		reserveTokens:              cfg.ReserveTokens,
 		compactIncludeRecentContext: includeRecent,
 		toolResultThreshold:        cfg.ToolResultThreshold,
+		microCompactPercent:        cfg.MicroCompactPercent,
+		microCompactKeepTurns:      cfg.MicroCompactKeepTurns,
+		repoMapTokens:              cfg.RepoMapTokens,
+		taskModel:                  cfg.TaskModel,
+		askUserDefault:             cfg.AskUserDefault,
+		planMode:                   cfg.PlanMode,
+	}
+	if cfg.CheckpointDir != "" {
+		a.checkpoints = checkpoint.Open(cfg.CheckpointDir)
+	}
+	if cfg.RedactSecrets == nil || *cfg.RedactSecrets {
+		a.redactor = newRedactor(cfg)
+	}
+	// Keep the file tools inside the repository unless configured otherwise
+	root := ignore.New(".").Root()
+	policy, policyErr := workspace.New(root, cfg.WorkspaceRoots, cfg.OutsideReads)
+	if policyErr != nil {
+		policy, _ = workspace.New(root, nil, workspace.ReadsAsk)
+	}
+	policy.Protect(filepath.Join(root, sandbox.ConfigFile))
+	a.workspace = policy
+	// Read once, so neither commands nor tools can loosen it mid-session
+	tools.LoadSandbox(root)
+	// Tool defaults are process-wide; -1 and 0 restore the built-in ones
+	patchFuzz := -1
+	if cfg.ApplyPatchFuzz != nil {
+		patchFuzz = *cfg.ApplyPatchFuzz
 	}
+	tools.SetApplyPatchFuzz(patchFuzz)
+	tools.SetReadFileMaxLines(cfg.ReadFileMaxLines)
+	h, hooksErr := hooks.Load(".")
+	a.hooks = h
 
 	// Apply functional options
 	for _, opt := range opts {
 		opt(a)
 	}
+	if policyErr != nil {
+		a.emit(ErrorEvent{Err: fmt.Errorf("workspace policy: %w (using the repository root only)", policyErr)})
+	}
+	if hooksErr != nil {
+		a.emit(ErrorEvent{Err: fmt.Errorf("hooks disabled: %w", hooksErr)})
+	}
+	// Project hooks run commands, so they wait for the user's approval
+	if h != nil && a.hooks == h {
+		a.hooks = nil
+		path, data := h.Source()
+		a.requireTrust(untrustedConfig{
+			name:     "hooks",
+			key:      path,
+			data:     data,
+			request:  trustRequest(fmt.Sprintf("Enable the hooks in %s? They run these commands with your permissions (asked again whenever the file changes):", path), h.Commands()),
+			enable:   func() { a.hooks = h },
+			disabled: fmt.Sprintf("🪝 Hooks disabled: %s is not approved. Start the REPL in this project to review and approve it.", path),
+		})
+	}
 
 	// Setup Playwright MCP if configured
 	if cfg.MCPPlaywright {
 		server := mcp.NewPlaywrightServer(cfg.MCPPlaywrightArgs)
 		if err := mcp.RegisterPlaywrightTools(server); err != nil {
-			if a.errorCallback != nil {
-				a.errorCallback(fmt.Errorf("failed to register Playwright MCP tools: %w", err))
-			}
+			a.emit(ErrorEvent{Err: fmt.Errorf("failed to register Playwright MCP tools: %w", err)})
 		} else {
 			a.mcpServer = server
 		}
 	}
 
+	// Register the user's custom tools (~/.clyde/tools/*.yaml), and the
+	// project's (.clyde/tools/*.yaml) once the user approves them
+	dirs := customtools.Dirs()
+	defs, loadErrs := customtools.Load(dirs...)
+	for _, err := range loadErrs {
+		a.emit(ErrorEvent{Err: err})
+	}
+	if project := customtools.FromDir(defs, dirs[0]); len(project) > 0 {
+		userDefs, _ := customtools.Load(dirs[1:]...)
+		a.registerCustomTools(userDefs)
+		var commands []string
+		for _, def := range project {
+			run := def.Command
+			if def.Script != "" {
+				run = def.Script
+			}
+			commands = append(commands, def.Name+": "+run)
+		}
+		a.requireTrust(untrustedConfig{
+			name:     "custom tools",
+			key:      dirs[0],
+			data:     customtools.Content(project),
+			request:  trustRequest(fmt.Sprintf("Enable the custom tools in %s? The model can then run these commands with your permissions (asked again whenever they change):", dirs[0]), commands),
+			enable:   func() { a.registerCustomTools(defs) },
+			disabled: fmt.Sprintf("🧰 Custom tools in %s disabled: they are not approved. Start the REPL in this project to review and approve them.", dirs[0]),
+		})
+	} else {
+		a.registerCustomTools(defs)
+	}
+
+	// Setup the language server if configured and installed
+	if cfg.LSPCommand != "" {
+		command := strings.Fields(cfg.LSPCommand)[0]
+		if _, err := exec.LookPath(command); err == nil {
+			a.lspServer = lsp.NewServer(cfg.LSPCommand, ".")
+			lsp.RegisterTools(a.lspServer)
+		} else {
+			a.emit(DiagnosticEvent{Message: fmt.Sprintf("🔍 LSP disabled: %s not found on PATH", command)})
+		}
+	}
+
 	// Discover and load Agent Skills
 	reg := skills.NewRegistry()
 	reg.Load()
@@ -280,14 +574,40 @@ func New(cfg Config, opts ...AgentOption) *Agent {
 	}
 	// Log any warnings from skill discovery
 	for _, w := range reg.Warnings() {
-		if a.errorCallback != nil {
-			a.errorCallback(fmt.Errorf("%s", w))
-		}
+		a.emit(ErrorEvent{Err: fmt.Errorf("%s", w)})
 	}
 
 	return a
 }
 
+// registerCustomTools registers defs in place of the custom tools
+// registered before, reporting errors and the tools' names.
+func (a *Agent) registerCustomTools(defs []*customtools.Definition) {
+	names, errs := customtools.Register(defs)
+	for _, err := range errs {
+		a.emit(ErrorEvent{Err: err})
+	}
+	if len(names) > 0 {
+		a.emit(DiagnosticEvent{Message: fmt.Sprintf("🧰 Custom tools: %s", strings.Join(names, ", "))})
+	}
+}
+
+// newRedactor builds the secret redactor for a Config.
+func newRedactor(cfg Config) *redact.Redactor {
+	r := redact.New(cfg.RedactAllowlist)
+	names := make([]string, 0, len(cfg.RedactValues))
+	for name := range cfg.RedactValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.AddSecret(name, cfg.RedactValues[name])
+	}
+	r.AddSecret("api-key", cfg.APIKey)
+	r.AddSecret("brave-search-api-key", cfg.BraveSearchAPIKey)
+	return r
+}
+
 // NewAgent creates a new agent with an explicit API client and system prompt.
 // This is a lower-level constructor primarily for tests and advanced library
 // consumers who need full control over the client and prompt. For typical
@@ -307,16 +627,24 @@ func NewAgent(apiClient *providers.Client, systemPrompt string, opts ...AgentOpt
 	return agent
 }
 
-// Close releases resources owned by the agent (e.g. MCP server subprocess).
-// It is safe to call multiple times. If the agent was created without MCP,
-// Close is a no-op.
+// Close releases resources owned by the agent (e.g. MCP and language server
+// subprocesses). It is safe to call multiple times. If the agent was created
+// without either, Close is a no-op.
 func (a *Agent) Close() error {
+	if a.lspServer != nil {
+		a.lspServer.Close()
+	}
 	if a.mcpServer != nil {
 		return a.mcpServer.Close()
 	}
 	return nil
 }
 
+// Checkpoints returns the file checkpoint store (nil if checkpointing is disabled).
+func (a *Agent) Checkpoints() *checkpoint.Store {
+	return a.checkpoints
+}
+
 // SkillsRegistry returns the Agent Skills registry (may be nil if no skills found).
 func (a *Agent) SkillsRegistry() *skills.Registry {
 	return a.skillsRegistry
@@ -339,9 +667,7 @@ func (a *Agent) ReloadSkills() {
 	}
 	// Log warnings
 	for _, w := range reg.Warnings() {
-		if a.errorCallback != nil {
-			a.errorCallback(fmt.Errorf("%s", w))
-		}
+		a.emit(ErrorEvent{Err: fmt.Errorf("%s", w)})
 	}
 }
 
@@ -374,62 +700,124 @@ func (a *Agent) LastUsage() Usage {
 
 // HandleMessage processes a user message and returns the response
 func (a *Agent) HandleMessage(userInput string) (string, error) {
+	a.turnSeq++
+	// Keep secrets the user pasted out of the history and the session
+	userInput = a.redact(userInput, "your message")
+	a.emit(TurnStartEvent{Message: userInput})
+
+	a.stopReason = ""
+	response, err := a.handleMessage(userInput)
+	a.emit(TurnEndEvent{Response: response, Err: err, StopReason: a.stopReason})
+	return response, err
+}
+
+// handleMessage runs a turn for HandleMessage, between its start and end
+// events.
+func (a *Agent) handleMessage(userInput string) (string, error) {
+
+	// Ask about project hooks and tools before any of them can run
+	a.approveProjectConfig()
+
+	// A plan left unapproved is superseded by whatever this message asks
+	a.pendingPlan = nil
+
+	// Let UserPromptSubmit hooks refuse or rewrite the message
+	submitted := a.runHooks(hooks.Input{Event: hooks.UserPromptSubmit, Prompt: userInput})
+	if submitted.Blocked() {
+		return "", fmt.Errorf("message blocked by a %s hook: %s", hooks.UserPromptSubmit, submitted.Reason)
+	}
+	if submitted.Prompt != "" {
+		userInput = a.redact(submitted.Prompt, "hook output")
+	}
+
 	// Add user message to history
+	content := userInput
+	if submitted.Context != "" {
+		content += "\n\n<hook_context>\n" + a.redact(submitted.Context, "hook output") + "\n</hook_context>"
+	}
 	a.history = append(a.history, providers.Message{
 		Role:    "user",
-		Content: userInput,
+		Content: content,
 	})
 
 	// Emit user message callback for session persistence
-	if a.userMsgCallback != nil {
-		a.userMsgCallback(userInput)
+	a.emit(UserMessageEvent{Text: userInput})
+
+	// Group every file the agent writes while handling this message into one
+	// checkpoint, so /undo reverts the whole turn. A sub-agent writes into
+	// the checkpoint of the message that started it.
+	turn := a.turn
+	if a.checkpoints != nil {
+		turn = a.checkpoints.Begin(userInput)
+		a.turn = turn
+		defer func() {
+			a.turn = nil
+			if err := turn.Seal(); err != nil {
+				a.emit(ErrorEvent{Err: fmt.Errorf("checkpoint failed: %w", err)})
+			}
+		}()
 	}
 
-	// Get all registered tools
-	allTools := tools.GetAllTools()
+	// Get the registered tools this agent may use, and the planning
+	// instruction in plan mode
+	allTools := a.availableTools()
+	if a.repoMapTokens > 0 && !a.repoMapBuilt {
+		a.repoMap = a.buildRepoMap()
+		a.repoMapBuilt = true
+	}
+	systemPrompt := a.systemPrompt + a.repoMap
+	if a.planMode {
+		systemPrompt += planModePrompt
+	}
+
+	// Times a Stop hook has sent this turn back to the model
+	stopHookBlocks := 0
+
+	// API calls made for this message, against maxTurns
+	turns := 0
 
 	// Conversation loop - continue until we get a text response
 	for {
+		// Cheap pass first: prune stale tool results without an LLM call.
+		// MicroCompact lowers the last usage figure by its estimate of the
+		// tokens freed, so the check below sees what is left.
+		if a.ShouldMicroCompact() {
+			a.MicroCompact()
+		}
+
 		// Check compaction threshold before API call.
 		// If input tokens have exceeded (contextWindowSize - reserveTokens),
 		// compact the history to free up context space.
 		if a.ShouldCompact() {
 			if err := a.Compact(); err != nil {
-				if a.errorCallback != nil {
-					a.errorCallback(fmt.Errorf("compaction failed: %w", err))
-				}
+				a.emit(ErrorEvent{Err: fmt.Errorf("compaction failed: %w", err)})
 				// Continue without compaction — better to try with full context
 				// than to fail entirely
 			}
 		}
 
-		// Start spinner while waiting for API response
-		if a.spinnerCallback != nil {
-			a.spinnerCallback(true, "Thinking...")
-		}
-
-		resp, err := a.apiClient.Call(a.systemPrompt, a.history, allTools)
-
-		// Stop spinner once API responds
-		if a.spinnerCallback != nil {
-			a.spinnerCallback(false, "")
-		}
+		// Announce the call, e.g. to start a spinner while waiting
+		a.emit(APIRequestEvent{Model: a.apiClient.ModelID(), Messages: len(a.history)})
 
+		resp, err := a.apiClient.Call(systemPrompt, a.history, allTools)
 		if err != nil {
 			return fmt.Sprintf("Error: %v", err), err
 		}
+		turns++
 
 		// Store usage for context tracking
 		a.lastUsage = resp.Usage
+		a.stopReason = resp.StopReason
+		a.emit(UsageEvent{Model: a.apiClient.ModelID(), Usage: resp.Usage})
 
 		// Emit cache and diagnostic information unconditionally.
 		// The CLI layer filters based on its own log level.
-		if resp.Usage.CacheReadInputTokens > 0 && a.diagnosticCallback != nil {
+		if resp.Usage.CacheReadInputTokens > 0 {
 			totalInputTokens := resp.Usage.InputTokens + resp.Usage.CacheReadInputTokens
 
 			// Cache token fraction
-			a.diagnosticCallback(fmt.Sprintf("💾 Cache: %d/%d tokens",
-				resp.Usage.CacheReadInputTokens, totalInputTokens))
+			a.emit(DiagnosticEvent{Message: fmt.Sprintf("💾 Cache: %d/%d tokens",
+				resp.Usage.CacheReadInputTokens, totalInputTokens)})
 
 			// Detailed cache info with creation tokens and context %
 			detail := fmt.Sprintf("💾 Cache: %d/%d tokens | Creation: %d tokens",
@@ -443,15 +831,13 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 				detail += fmt.Sprintf(" | Context: %d%% (%d/%d)",
 					pct, totalInputTokens, a.contextWindowSize)
 			}
-			a.diagnosticCallback(detail)
+			a.emit(DiagnosticEvent{Message: detail})
 		}
 
 		// Token usage diagnostics
-		if a.diagnosticCallback != nil {
-			a.diagnosticCallback(fmt.Sprintf("🔍 Tokens: input=%d output=%d cache_read=%d cache_create=%d",
-				resp.Usage.InputTokens, resp.Usage.OutputTokens,
-				resp.Usage.CacheReadInputTokens, resp.Usage.CacheCreationInputTokens))
-		}
+		a.emit(DiagnosticEvent{Message: fmt.Sprintf("🔍 Tokens: input=%d output=%d cache_read=%d cache_create=%d",
+			resp.Usage.InputTokens, resp.Usage.OutputTokens,
+			resp.Usage.CacheReadInputTokens, resp.Usage.CacheCreationInputTokens)})
 
 		var assistantContent []providers.ContentBlock
 		var textResponses []string
@@ -468,19 +854,18 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 			case "text":
 				if block.Text != "" {
 					textResponses = append(textResponses, block.Text)
+					a.emit(TextDeltaEvent{Text: block.Text})
 				}
 			case "tool_use":
 				toolUseBlocks = append(toolUseBlocks, block)
 			case "thinking":
 				// Emit full thinking trace unconditionally
-				if block.Thinking != "" && a.thinkingCallback != nil {
-					a.thinkingCallback(block.Thinking, block.Signature)
+				if block.Thinking != "" {
+					a.emit(ThinkingDeltaEvent{Text: block.Thinking, Signature: block.Signature})
 				}
 			case "redacted_thinking":
 				// Redacted thinking — note it via diagnostics
-				if a.diagnosticCallback != nil {
-					a.diagnosticCallback("🔒 Redacted thinking block (encrypted by safety system)")
-				}
+				a.emit(DiagnosticEvent{Message: "🔒 Redacted thinking block (encrypted by safety system)"})
 			}
 		}
 
@@ -494,19 +879,47 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 		// If no tool use, return text responses
 		if len(toolUseBlocks) == 0 {
 			response := strings.Join(textResponses, "\n")
+
+			// A Stop hook can send the turn back with feedback (e.g. "tests
+			// are failing") instead of letting it end here.
+			stop := a.runHooks(hooks.Input{Event: hooks.Stop, Response: response, StopHookActive: stopHookBlocks > 0})
+			if stop.Blocked() && stopHookBlocks >= maxStopHookBlocks {
+				a.emit(DiagnosticEvent{Message: fmt.Sprintf("🪝 %s hooks blocked %d times this turn; ending it anyway", hooks.Stop, stopHookBlocks+1)})
+			} else if stop.Blocked() {
+				if response != "" {
+					a.emit(AssistantMessageEvent{Text: response})
+				}
+				feedback := a.redact(fmt.Sprintf("A %s hook did not let you finish yet: %s", hooks.Stop, stop.Reason), "hook output")
+				a.history = append(a.history, providers.Message{
+					Role:    "user",
+					Content: feedback,
+				})
+				a.emit(UserMessageEvent{Text: feedback})
+				stopHookBlocks++
+				continue
+			}
+
 			// Emit assistant message callback for session persistence
-			if a.assistantMsgCallback != nil && response != "" {
-				a.assistantMsgCallback(response)
+			if response != "" {
+				a.emit(AssistantMessageEvent{Text: response})
 			}
 			return response, nil
 		}
 
+		// The model was told it had no turns left but still called tools
+		if a.maxTurns > 0 && turns >= a.maxTurns {
+			return "", fmt.Errorf("stopped after %d turns without a final answer (the model kept calling tools)", turns)
+		}
+
 		// Execute tools
 		var toolResults []providers.ContentBlock
 		var pendingImages []providers.ContentBlock
 
 		for _, toolBlock := range toolUseBlocks {
 			reg, err := tools.GetTool(toolBlock.Name)
+			if err == nil && !a.toolAllowed(toolBlock.Name) {
+				err = fmt.Errorf("%s is not available here. Use one of: %s", toolBlock.Name, strings.Join(toolNames(allTools), ", "))
+			}
 			if err != nil {
 				// Unknown tool
 				toolResults = append(toolResults, providers.ContentBlock{
@@ -518,28 +931,78 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 				continue
 			}
 
-			// Emit progress message unconditionally (the → lines)
-			if reg.Display != nil && a.progressCallback != nil {
-				displayMsg := reg.Display(toolBlock.Input)
-				if displayMsg != "" {
-					a.progressCallback(displayMsg, toolBlock.ID)
+			// PreToolUse hooks may rewrite the input, approve or block the call.
+			// The input map is shared with the history, so a rewrite is what
+			// the model sees it called.
+			pre := a.runHooks(hooks.Input{Event: hooks.PreToolUse, ToolName: toolBlock.Name, ToolUseID: toolBlock.ID, ToolInput: toolBlock.Input})
+			if pre.ToolInput != nil {
+				for k := range toolBlock.Input {
+					delete(toolBlock.Input, k)
+				}
+				for k, v := range pre.ToolInput {
+					toolBlock.Input[k] = v
 				}
 			}
 
-			// Emit tool_use metadata for session persistence
-			if a.toolUseCallback != nil {
-				displayMsg := ""
-				if reg.Display != nil {
-					displayMsg = reg.Display(toolBlock.Input)
+			// Emit the call with its progress line (the → lines) and the
+			// metadata needed for session persistence
+			displayMsg := ""
+			if reg.Display != nil {
+				displayMsg = reg.Display(toolBlock.Input)
+			}
+			a.emit(ToolCallEvent{ToolUseID: toolBlock.ID, Name: toolBlock.Name, Input: toolBlock.Input, Display: displayMsg})
+
+			if pre.Blocked() {
+				blocked := fmt.Sprintf("Blocked by a %s hook: %s", hooks.PreToolUse, pre.Reason)
+				toolResults = append(toolResults, a.deniedResult(toolBlock.ID, blocked))
+				continue
+			}
+			approved := pre.Decision == hooks.Approve
+
+			// Ask before calls that need the user's approval, unless a hook
+			// approved the call
+			if reg.Permission != nil && !approved {
+				if request := reg.Permission(toolBlock.Input); request != "" && !a.askPermission(toolBlock.Name, request) {
+					denied := fmt.Sprintf("Permission denied: the user did not approve this %s call. Continue without it, or ask the user how to proceed.", toolBlock.Name)
+					toolResults = append(toolResults, a.deniedResult(toolBlock.ID, denied))
+					continue
+				}
+			}
+
+			// Keep file tools inside the workspace
+			var writePaths []string
+			if reg.WritePaths != nil {
+				writePaths = reg.WritePaths(toolBlock.Input)
+			}
+			if err := a.checkWorkspace(toolBlock.Name, reg, toolBlock.Input, writePaths, approved); err != nil {
+				toolResults = append(toolResults, a.deniedResult(toolBlock.ID, err.Error()))
+				continue
+			}
+			// Never write redaction placeholders over the secrets they hide
+			if a.redactor != nil && len(writePaths) > 0 && inputHasPlaceholder(toolBlock.Input) {
+				toolResults = append(toolResults, a.deniedResult(toolBlock.ID, redactedWriteError))
+				continue
+			}
+
+			// Snapshot files before the tool modifies them
+			if turn != nil {
+				for _, path := range writePaths {
+					if err := turn.Snapshot(toolBlock.ID, path); err != nil {
+						a.emit(ErrorEvent{Err: fmt.Errorf("checkpoint failed: %w", err)})
+					}
 				}
-				a.toolUseCallback(displayMsg, toolBlock.Name, toolBlock.ID, toolBlock.Input)
 			}
 
 			// Execute the tool
-			output, err := reg.Execute(toolBlock.Input, a.apiClient, a.history)
+			var output string
+			if execute, ok := agentTools[toolBlock.Name]; ok {
+				output, err = execute(a, toolBlock.ID, toolBlock.Input)
+			} else {
+				output, err = reg.Execute(toolBlock.Input, a.apiClient, a.history)
+			}
 
 			var resultContent string
-			var isError bool
+			var isError, isImage bool
 			if err != nil {
 				resultContent = err.Error()
 				isError = true
@@ -568,18 +1031,39 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 
 						// Update result content to confirmation message
 						resultContent = fmt.Sprintf("Image loaded successfully (%s, %s KB)", mediaType, sizeKB)
+						isImage = true
 					}
 				}
 			}
 
-			// Emit tool output body unconditionally (full, untruncated).
-			// The CLI layer handles truncation and display filtering.
-			if resultContent != "" && !strings.HasPrefix(resultContent, "Image loaded") {
-				if a.outputCallback != nil {
-					a.outputCallback(resultContent, toolBlock.ID)
+			// Report compile errors in the files just written, so the model
+			// sees them without running a build.
+			if !isError && len(writePaths) > 0 {
+				if diags := a.editDiagnostics(writePaths); diags != "" {
+					resultContent += "\n\n" + diags
 				}
 			}
 
+			// PostToolUse hooks see the result and may add to it, or block to
+			// turn it into an error the model has to deal with.
+			post := a.runHooks(hooks.Input{Event: hooks.PostToolUse, ToolName: toolBlock.Name, ToolUseID: toolBlock.ID,
+				ToolInput: toolBlock.Input, ToolOutput: resultContent, IsError: isError})
+			if post.Context != "" {
+				resultContent += "\n\n" + post.Context
+			}
+			if post.Blocked() {
+				resultContent += fmt.Sprintf("\n\n%s hook feedback: %s", hooks.PostToolUse, post.Reason)
+				isError = true
+			}
+
+			// Replace secrets (e.g. from `cat .env`) before the output is
+			// displayed, persisted or sent back to the API.
+			resultContent = a.redact(resultContent, toolBlock.Name+" output")
+
+			// Emit tool output body unconditionally (full, untruncated).
+			// The CLI layer handles truncation and display filtering.
+			a.emit(ToolResultEvent{ToolUseID: toolBlock.ID, Output: resultContent, IsError: isError, Image: isImage})
+
 			toolResults = append(toolResults, providers.ContentBlock{
 				Type:      "tool_result",
 				ToolUseID: toolBlock.ID,
@@ -593,6 +1077,17 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 			toolResults = append(toolResults, pendingImages...)
 		}
 
+		// Messages the user typed meanwhile go out with the tool results
+		toolResults = a.deliverQueued(toolResults)
+
+		// Ask for the final answer when the next call is the last one allowed
+		if a.maxTurns > 0 && turns == a.maxTurns-1 {
+			toolResults = append(toolResults, providers.ContentBlock{
+				Type: "text",
+				Text: "You have one turn left. Do not call any more tools: reply now with your final answer, based on what you have found so far, and say what is still unverified.",
+			})
+		}
+
 		// Add tool results to history
 		a.history = append(a.history, providers.Message{
 			Role:    "user",
@@ -601,6 +1096,220 @@ func (a *Agent) HandleMessage(userInput string) (string, error) {
 	}
 }
 
+// agentExecutor runs a tool that needs the agent itself rather than just
+// its input, such as task, which starts a sub-agent.
+type agentExecutor func(a *Agent, toolUseID string, input map[string]interface{}) (string, error)
+
+// agentTools maps tool names to the agent executors that run them in place
+// of their registry Execute.
+var agentTools = make(map[string]agentExecutor)
+
+// registerAgentTool registers a tool whose calls HandleMessage runs with
+// execute. The registry entry carries its schema and display like any other
+// tool; its Execute only reports that the tool needs an agent.
+func registerAgentTool(tool providers.Tool, execute agentExecutor, display tools.DisplayFunc) {
+	agentTools[tool.Name] = execute
+	tools.Register(tool, func(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
+		return "", fmt.Errorf("%s can only run inside an agent", tool.Name)
+	}, display)
+}
+
+// availableTools returns the registered tools the model may call.
+func (a *Agent) availableTools() []providers.Tool {
+	var allowed []providers.Tool
+	for _, tool := range tools.GetAllTools() {
+		if a.toolAllowed(tool.Name) {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
+}
+
+// toolAllowed reports whether the model may call the named tool: one that
+// WithTools allows and, in plan mode, one of the plan mode tools.
+// submit_plan is only offered in plan mode.
+func (a *Agent) toolAllowed(name string) bool {
+	if a.allowedTools != nil && !a.allowedTools[name] {
+		return false
+	}
+	if a.planMode {
+		return isPlanModeTool(name)
+	}
+	return name != submitPlanTool.Name
+}
+
+// toolNames returns the sorted names of tools.
+func toolNames(list []providers.Tool) []string {
+	names := make([]string, len(list))
+	for i, tool := range list {
+		names[i] = tool.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// askPermission asks the permission callback to approve a tool call and
+// records the decision as a diagnostic. Calls are denied when no callback
+// is set (e.g. in non-interactive mode).
+func (a *Agent) askPermission(toolName, request string) bool {
+	approved := a.permissionCallback != nil && a.permissionCallback(toolName, request)
+	decision := "denied"
+	if approved {
+		decision = "approved"
+	} else if a.permissionCallback == nil {
+		decision = "denied (no user to ask)"
+	}
+	a.emit(DiagnosticEvent{Message: fmt.Sprintf("🔐 Permission %s for %s: %s", decision, toolName, strings.Join(strings.Fields(request), " "))})
+	return approved
+}
+
+// deniedResult reports a tool call that was not run, both as an event and
+// as an error tool_result.
+func (a *Agent) deniedResult(toolUseID, message string) providers.ContentBlock {
+	a.emit(ToolResultEvent{ToolUseID: toolUseID, Output: message, IsError: true})
+	return providers.ContentBlock{
+		Type:      "tool_result",
+		ToolUseID: toolUseID,
+		Content:   message,
+		IsError:   true,
+	}
+}
+
+// checkWorkspace applies the workspace policy to a tool call: writes outside
+// the roots are refused, and reads outside them need the user's approval
+// unless the policy allows them or a hook approved the call.
+func (a *Agent) checkWorkspace(toolName string, reg *tools.Registration, input map[string]interface{}, writePaths []string, approved bool) error {
+	if a.workspace == nil {
+		return nil
+	}
+	for _, path := range writePaths {
+		if err := a.workspace.CheckWrite(path); err != nil {
+			return err
+		}
+	}
+	if reg.ReadPaths == nil || approved {
+		return nil
+	}
+	for _, path := range reg.ReadPaths(input) {
+		if request := a.workspace.ReadRequest(path); request != "" && !a.askPermission(toolName, request) {
+			return a.workspace.ReadDenied(path)
+		}
+	}
+	return nil
+}
+
+// runHooks runs the configured hooks for an event and logs each run as a
+// diagnostic.
+func (a *Agent) runHooks(input hooks.Input) hooks.Result {
+	if a.hooks == nil {
+		return hooks.Result{}
+	}
+	// UserPromptSubmit and Stop are about the user's conversation, not a
+	// sub-agent's delegated prompt and report
+	if a.parent != nil && (input.Event == hooks.UserPromptSubmit || input.Event == hooks.Stop) {
+		return hooks.Result{}
+	}
+	result := a.hooks.Run(input)
+	for _, line := range result.Log {
+		a.emit(DiagnosticEvent{Message: "🪝 " + line})
+	}
+	return result
+}
+
+// redactedWriteError refuses a file edit containing a redaction placeholder.
+const redactedWriteError = "Write refused: the input contains a [REDACTED:...] placeholder. Secrets in tool output are replaced by placeholders, so writing one back would overwrite the real value in the file.\n" +
+	"Suggestions:\n" +
+	"  - Edit only the lines around the secret (patch_file with a smaller old_text), leaving it untouched\n" +
+	"  - Or ask the user to make this change"
+
+// inputHasPlaceholder reports whether any string in a tool input contains a
+// redaction placeholder.
+func inputHasPlaceholder(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return redact.HasPlaceholder(v)
+	case map[string]interface{}:
+		for _, item := range v {
+			if inputHasPlaceholder(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if inputHasPlaceholder(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redact replaces secrets in text coming from source (e.g. "run_bash
+// output") and reports how many it found.
+func (a *Agent) redact(text, source string) string {
+	if a.redactor == nil || text == "" {
+		return text
+	}
+	redacted, counts := a.redactor.Redact(text)
+	if n := counts.Total(); n > 0 {
+		a.redactions += n
+		noun := "secrets"
+		if n == 1 {
+			noun = "secret"
+		}
+		a.emit(DiagnosticEvent{Message: fmt.Sprintf("🔒 Redacted %d %s from %s (%s)", n, noun, source, counts)})
+	}
+	return redacted
+}
+
+// Redactions returns how many secrets have been redacted so far.
+func (a *Agent) Redactions() int {
+	return a.redactions
+}
+
+// editDiagnostics asks the language server for errors and warnings in
+// files a tool just wrote. It returns "" when LSP is disabled, none of the
+// files are in a language the server handles, or the server is unavailable.
+func (a *Agent) editDiagnostics(paths []string) string {
+	if a.lspServer == nil {
+		return ""
+	}
+	handled := false
+	for _, p := range paths {
+		if a.lspServer.Handles(p) {
+			handled = true
+		}
+	}
+	if !handled {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	diags, err := a.lspServer.Diagnostics(ctx, paths, 5*time.Second)
+	if err != nil {
+		a.emit(DiagnosticEvent{Message: fmt.Sprintf("🔍 LSP diagnostics unavailable: %v", err)})
+		return ""
+	}
+	if len(diags) == 0 {
+		return ""
+	}
+	return a.lspServer.FormatDiagnostics(diags)
+}
+
+// buildRepoMap renders the repository map for the system prompt. It is kept
+// out of the history, so it is neither saved in the session nor pinned
+// through compaction, and is rebuilt on resume. Returns "" if the map cannot
+// be built.
+func (a *Agent) buildRepoMap() string {
+	repoMap, err := repomap.Generate(".", a.repoMapTokens)
+	if err != nil {
+		a.emit(ErrorEvent{Err: fmt.Errorf("repository map failed: %w", err)})
+		return ""
+	}
+	a.emit(DiagnosticEvent{Message: fmt.Sprintf("🗺️ Repo map: ~%d tokens added to the system prompt", len(repoMap)/4)})
+	return "\n\n<repository_map>\n" + repoMap + "\n</repository_map>"
+}
+
 // GetHistory returns the conversation history
 func (a *Agent) GetHistory() []providers.Message {
 	return a.history
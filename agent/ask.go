@@ -0,0 +1,124 @@
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+func init() {
+	registerAgentTool(askUserTool, executeAskUser, displayAskUser)
+}
+
+var askUserTool = providers.Tool{
+	Name: "ask_user",
+	Description: "Ask the user a question and wait for the answer, without ending your turn. " +
+		"Use it when you need a decision only the user can make (which of several valid approaches to take, whether a destructive step is wanted, missing requirements) " +
+		"and guessing wrong would waste significant work. Offer options when the choices are known; the user can still answer in their own words. " +
+		"Do not use it for things you can find out with other tools, or to ask for confirmation of routine steps. " +
+		"When no user is available you get a default answer or are told to proceed with your best judgment.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"question": map[string]interface{}{
+				"type":        "string",
+				"description": "The question, with the context the user needs to answer it",
+			},
+			"options": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": fmt.Sprintf("Possible answers, shown numbered (at most %d). Omit for a free-form answer.", maxAskUserOptions),
+			},
+		},
+		"required": []string{"question"},
+	},
+}
+
+// maxAskUserOptions caps the options of an ask_user call.
+const maxAskUserOptions = 9
+
+// noUserAnswer is the ask_user result when nobody can answer and no default
+// answer is configured.
+const noUserAnswer = "No user is available to answer (non-interactive run). Proceed with your best judgment, and state the assumptions you made in your final reply."
+
+// AskUserCallback asks the user a question from the ask_user tool, with the
+// numbered options to choose from (none for a free-form answer), and returns
+// the answer as typed. A number picks the option with that number. An error
+// (e.g. Ctrl+C) means the user dismissed the question.
+type AskUserCallback func(question string, options []string) (string, error)
+
+// WithAskUserCallback sets the callback that puts ask_user questions to the
+// user. Without it, ask_user answers with Config.AskUserDefault, or tells the
+// model that no user is available.
+func WithAskUserCallback(cb AskUserCallback) AgentOption {
+	return func(a *Agent) {
+		a.askUserCallback = cb
+	}
+}
+
+func executeAskUser(a *Agent, toolUseID string, input map[string]interface{}) (string, error) {
+	question, _ := input["question"].(string)
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return "", fmt.Errorf("ask_user requires a question")
+	}
+	options, err := askUserOptions(input["options"])
+	if err != nil {
+		return "", err
+	}
+
+	if a.askUserCallback == nil {
+		if a.askUserDefault != "" {
+			return fmt.Sprintf("No user is available to answer; the configured default answer is: %s", a.askUserDefault), nil
+		}
+		return noUserAnswer, nil
+	}
+
+	answer, err := a.askUserCallback(question, options)
+	if err != nil {
+		return "", fmt.Errorf("the user dismissed the question (%v). Proceed with your best judgment, or ask again in your final reply", err)
+	}
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return "The user gave no answer. Proceed with your best judgment, and state the assumptions you made in your final reply.", nil
+	}
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(options) {
+		answer = options[n-1]
+	}
+	return fmt.Sprintf("The user answered: %s", answer), nil
+}
+
+// askUserOptions validates the options input of an ask_user call.
+func askUserOptions(value interface{}) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("options must be an array of strings")
+	}
+	if len(list) > maxAskUserOptions {
+		return nil, fmt.Errorf("ask_user takes at most %d options, got %d; ask a more open question instead", maxAskUserOptions, len(list))
+	}
+	options := make([]string, 0, len(list))
+	for i, v := range list {
+		option, _ := v.(string)
+		option = strings.Join(strings.Fields(option), " ")
+		if option == "" {
+			return nil, fmt.Errorf("option %d is empty", i+1)
+		}
+		options = append(options, option)
+	}
+	return options, nil
+}
+
+func displayAskUser(input map[string]interface{}) string {
+	question, _ := input["question"].(string)
+	question = strings.Join(strings.Fields(question), " ")
+	if question == "" {
+		return "→ Asking the user"
+	}
+	return fmt.Sprintf("→ Asking the user: %s", question)
+}
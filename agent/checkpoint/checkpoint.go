@@ -0,0 +1,427 @@
+// Package checkpoint snapshots files before the agent modifies them, so agent
+// edits can be undone without git and without touching anything else in the
+// working tree.
+//
+// A store is a directory (normally <repo>/.clyde/checkpoints/<session-id>/)
+// holding one subdirectory per turn — one user message and everything the
+// agent did in response:
+//
+//	0001/
+//	  manifest.json   turn metadata and one entry per snapshotted file
+//	  files/0, 1, …   prior contents of each file
+//
+// A file is snapshotted the first time it is written in a turn; later writes
+// in the same turn reuse that snapshot, so undo always returns to the state
+// before the turn began. Undo only ever touches files the agent wrote, and
+// skips any file that was changed by someone else after the agent's edit;
+// the snapshots of skipped files stay in the store.
+package checkpoint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// manifestFile is the name of the per-turn metadata file.
+const manifestFile = "manifest.json"
+
+// Store is a checkpoint directory. The directory is created lazily on the
+// first snapshot, so turns without edits leave nothing behind.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// FileSnapshot records one file's state before a turn modified it.
+type FileSnapshot struct {
+	// Path is the absolute path of the file.
+	Path string `json:"path"`
+	// Existed is false when the turn created the file; undo deletes it.
+	Existed bool `json:"existed"`
+	// Mode is the file's permission bits before the edit.
+	Mode os.FileMode `json:"mode,omitempty"`
+	// Blob is the name of the file under files/ holding the prior contents.
+	Blob string `json:"blob,omitempty"`
+	// AfterHash is the SHA-256 of the file when the turn ended. Undo refuses
+	// to overwrite a file whose current contents no longer match it.
+	AfterHash string `json:"after_hash,omitempty"`
+	// Deleted is true when the file did not exist when the turn ended.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Turn is one checkpoint: the files a single turn modified.
+type Turn struct {
+	// ID is the turn's sequence number within the store (1, 2, …).
+	ID int `json:"id"`
+	// Label is a short description, normally the user's message.
+	Label string `json:"label"`
+	// Time is when the first file in the turn was snapshotted.
+	Time time.Time `json:"time"`
+	// Files lists the snapshotted files in the order they were first written.
+	Files []FileSnapshot `json:"files"`
+	// ToolUseIDs lists every tool call in the turn that wrote a file.
+	ToolUseIDs []string `json:"tool_use_ids"`
+	// Undone is true once the turn was undone with files left over: Files
+	// then lists only the skipped ones, whose snapshots are kept for manual
+	// recovery. Undone turns are not undone again.
+	Undone bool `json:"undone,omitempty"`
+
+	store *Store
+	dir   string
+	saved bool
+}
+
+// UndoResult reports what an undo did.
+type UndoResult struct {
+	Turn Turn
+	// Restored lists paths returned to their state before the turn.
+	Restored []string
+	// Skipped lists files left alone, as "path: reason".
+	Skipped []string
+	// Kept is the checkpoint directory still holding the snapshots of the
+	// skipped files, or "" when nothing was skipped and it was removed.
+	Kept string
+}
+
+// Open returns a store rooted at dir. Nothing is created until a turn
+// snapshots its first file.
+func Open(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Dir returns the store's directory.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Begin starts a new turn. The turn is persisted only once it snapshots a
+// file; the ID is assigned then, so empty turns do not consume IDs.
+func (s *Store) Begin(label string) *Turn {
+	return &Turn{Label: label, store: s}
+}
+
+// Snapshot records path's current contents before toolUseID writes to it.
+// Only the first write to a path in a turn is snapshotted. A path that does
+// not exist yet is recorded as created by the turn.
+func (t *Turn) Snapshot(toolUseID, path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", path, err)
+	}
+
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	if !t.saved {
+		if err := t.allocate(); err != nil {
+			return err
+		}
+	}
+	if toolUseID != "" && !containsString(t.ToolUseIDs, toolUseID) {
+		t.ToolUseIDs = append(t.ToolUseIDs, toolUseID)
+	}
+	for _, f := range t.Files {
+		if f.Path == abs {
+			return t.writeManifest()
+		}
+	}
+
+	snap := FileSnapshot{Path: abs}
+	info, err := os.Stat(abs)
+	switch {
+	case err == nil && info.IsDir():
+		return fmt.Errorf("%s is a directory", path)
+	case err == nil:
+		content, err := os.ReadFile(abs)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		snap.Existed = true
+		snap.Mode = info.Mode().Perm()
+		snap.Blob = strconv.Itoa(len(t.Files))
+		if err := os.WriteFile(filepath.Join(t.dir, "files", snap.Blob), content, 0600); err != nil {
+			return fmt.Errorf("save snapshot of %s: %w", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	t.Files = append(t.Files, snap)
+	return t.writeManifest()
+}
+
+// Seal records each file's state at the end of the turn and drops files the
+// turn did not actually change (for example, a patch that failed). A turn
+// left with no changed files is removed entirely.
+func (t *Turn) Seal() error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+
+	if !t.saved {
+		return nil
+	}
+
+	var kept []FileSnapshot
+	for _, f := range t.Files {
+		hash, exists, err := hashFile(f.Path)
+		if err != nil {
+			return err
+		}
+		if !exists && !f.Existed {
+			continue // created then removed (or never created): nothing to undo
+		}
+		if exists && f.Existed {
+			before, _, err := hashFile(filepath.Join(t.dir, "files", f.Blob))
+			if err != nil {
+				return err
+			}
+			if before == hash {
+				continue // unchanged
+			}
+		}
+		f.AfterHash = hash
+		f.Deleted = !exists
+		kept = append(kept, f)
+	}
+
+	if len(kept) == 0 {
+		t.saved = false
+		return os.RemoveAll(t.dir)
+	}
+	t.Files = kept
+	return t.writeManifest()
+}
+
+// allocate assigns the next turn ID and creates the turn directory.
+// Must be called with the store mutex held.
+func (t *Turn) allocate() error {
+	turns, err := t.store.list()
+	if err != nil {
+		return err
+	}
+	t.ID = 1
+	if len(turns) > 0 {
+		t.ID = turns[len(turns)-1].ID + 1
+	}
+	t.Time = time.Now()
+	t.dir = filepath.Join(t.store.dir, fmt.Sprintf("%04d", t.ID))
+	if err := os.MkdirAll(filepath.Join(t.dir, "files"), 0755); err != nil {
+		return fmt.Errorf("create checkpoint directory: %w", err)
+	}
+	// Keep checkpoints out of version control without editing the
+	// project's own .gitignore.
+	ignore := filepath.Join(t.store.dir, ".gitignore")
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		os.WriteFile(ignore, []byte("*\n"), 0644)
+	}
+	t.saved = true
+	return nil
+}
+
+// writeManifest persists the turn metadata. Must be called with the store
+// mutex held.
+func (t *Turn) writeManifest() error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(t.dir, manifestFile), data, 0644)
+}
+
+// List returns the store's turns, oldest first.
+func (s *Store) List() ([]Turn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// list implements List. Must be called with the store mutex held.
+func (s *Store) list() ([]Turn, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoint directory: %w", err)
+	}
+
+	var turns []Turn
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		dir := filepath.Join(s.dir, e.Name())
+		data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+		if err != nil {
+			continue // interrupted before the first manifest write
+		}
+		var t Turn
+		if err := json.Unmarshal(data, &t); err != nil {
+			continue
+		}
+		t.store, t.dir, t.saved = s, dir, true
+		turns = append(turns, t)
+	}
+	sort.Slice(turns, func(i, j int) bool { return turns[i].ID < turns[j].ID })
+	return turns, nil
+}
+
+// UndoLast reverts the most recent turn not undone yet and removes its
+// checkpoint (see undo). Returns an error if there is nothing to undo.
+func (s *Store) UndoLast() (*UndoResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	turns, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(turns) - 1; i >= 0; i-- {
+		if !turns[i].Undone {
+			return s.undo(turns[i])
+		}
+	}
+	return nil, fmt.Errorf("nothing to undo: no checkpoints recorded")
+}
+
+// UndoToolUses reverts, newest first, every turn not undone yet that
+// contains one of the given tool calls, and removes those checkpoints. Used
+// when the conversation is rewound past those calls. Returns one result per
+// reverted turn.
+func (s *Store) UndoToolUses(toolUseIDs map[string]bool) ([]UndoResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	turns, err := s.list()
+	if err != nil {
+		return nil, err
+	}
+	var results []UndoResult
+	for i := len(turns) - 1; i >= 0; i-- {
+		if turns[i].Undone {
+			continue
+		}
+		match := false
+		for _, id := range turns[i].ToolUseIDs {
+			if toolUseIDs[id] {
+				match = true
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		res, err := s.undo(turns[i])
+		if err != nil {
+			return results, err
+		}
+		results = append(results, *res)
+	}
+	return results, nil
+}
+
+// undo restores every file in t and deletes the checkpoint. Files changed
+// since the turn ended are skipped, never overwritten, and so are the files
+// of a turn that was never sealed, since there is no record of the agent's
+// edit to compare against. When anything is skipped, the checkpoint is kept
+// with just the skipped files and marked undone, so their snapshots can
+// still be recovered. Must be called with the store mutex held.
+func (s *Store) undo(t Turn) (*UndoResult, error) {
+	res := &UndoResult{Turn: t}
+	var kept []FileSnapshot
+	skip := func(f FileSnapshot, format string, args ...interface{}) {
+		res.Skipped = append(res.Skipped, f.Path+": "+fmt.Sprintf(format, args...))
+		kept = append(kept, f)
+	}
+	for i := len(t.Files) - 1; i >= 0; i-- {
+		f := t.Files[i]
+		if f.AfterHash == "" && !f.Deleted {
+			skip(f, "the turn did not finish, so changes since the agent's edit cannot be detected")
+			continue
+		}
+		hash, exists, err := hashFile(f.Path)
+		if err != nil {
+			skip(f, "%v", err)
+			continue
+		}
+		if exists == f.Deleted || (exists && hash != f.AfterHash) {
+			skip(f, "modified since the agent's edit")
+			continue
+		}
+
+		if !f.Existed {
+			if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+				skip(f, "%v", err)
+				continue
+			}
+			res.Restored = append(res.Restored, f.Path)
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(t.dir, "files", f.Blob))
+		if err != nil {
+			skip(f, "snapshot missing: %v", err)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			skip(f, "%v", err)
+			continue
+		}
+		if err := os.WriteFile(f.Path, content, f.Mode); err != nil {
+			skip(f, "%v", err)
+			continue
+		}
+		os.Chmod(f.Path, f.Mode)
+		res.Restored = append(res.Restored, f.Path)
+	}
+
+	if len(kept) > 0 {
+		// Files were walked newest first; keep the manifest's order
+		for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+			kept[i], kept[j] = kept[j], kept[i]
+		}
+		t.Files, t.Undone = kept, true
+		if err := t.writeManifest(); err != nil {
+			return res, fmt.Errorf("failed to update checkpoint %d: %w", t.ID, err)
+		}
+		res.Kept = t.dir
+		return res, nil
+	}
+	if err := os.RemoveAll(t.dir); err != nil {
+		return res, fmt.Errorf("failed to remove checkpoint %d: %w", t.ID, err)
+	}
+	return res, nil
+}
+
+// hashFile returns the hex SHA-256 of a file and whether it exists.
+func hashFile(path string) (string, bool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), true, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,242 @@
+package checkpoint
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ── helpers ──────────────────────────────────────────────────────────────
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// ── tests ────────────────────────────────────────────────────────────────
+
+func TestUndoLast_RestoresModifiedAndCreated(t *testing.T) {
+	work := t.TempDir()
+	store := Open(filepath.Join(t.TempDir(), "checkpoints"))
+
+	edited := filepath.Join(work, "main.go")
+	created := filepath.Join(work, "new.go")
+	write(t, edited, "original\n")
+
+	turn := store.Begin("refactor main")
+	if err := turn.Snapshot("toolu_1", edited); err != nil {
+		t.Fatal(err)
+	}
+	write(t, edited, "first edit\n")
+	// Second write in the same turn must not replace the original snapshot.
+	if err := turn.Snapshot("toolu_2", edited); err != nil {
+		t.Fatal(err)
+	}
+	write(t, edited, "second edit\n")
+	if err := turn.Snapshot("toolu_3", created); err != nil {
+		t.Fatal(err)
+	}
+	write(t, created, "package x\n")
+	if err := turn.Seal(); err != nil {
+		t.Fatal(err)
+	}
+
+	turns, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 1 || len(turns[0].Files) != 2 || len(turns[0].ToolUseIDs) != 3 {
+		t.Fatalf("unexpected checkpoints: %+v", turns)
+	}
+
+	res, err := store.UndoLast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, edited); got != "original\n" {
+		t.Errorf("main.go = %q, want original", got)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Error("file created during the turn should be removed")
+	}
+	if len(res.Restored) != 2 || len(res.Skipped) != 0 {
+		t.Errorf("result = %+v", res)
+	}
+
+	if _, err := store.UndoLast(); err == nil {
+		t.Error("second undo should report nothing to undo")
+	}
+}
+
+func TestUndoLast_SkipsFilesModifiedSince(t *testing.T) {
+	work := t.TempDir()
+	store := Open(filepath.Join(t.TempDir(), "checkpoints"))
+	path := filepath.Join(work, "a.txt")
+	write(t, path, "v1\n")
+
+	turn := store.Begin("edit")
+	turn.Snapshot("toolu_1", path)
+	write(t, path, "v2\n")
+	turn.Seal()
+
+	write(t, path, "user's own change\n")
+
+	res, err := store.UndoLast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, path); got != "user's own change\n" {
+		t.Errorf("user's change was overwritten: %q", got)
+	}
+	if len(res.Skipped) != 1 || !strings.Contains(res.Skipped[0], "modified since") {
+		t.Errorf("Skipped = %v", res.Skipped)
+	}
+
+	// The skipped file's snapshot is kept, and the turn is not undone again
+	turns, _ := store.List()
+	if len(turns) != 1 || !turns[0].Undone || len(turns[0].Files) != 1 || res.Kept != turns[0].dir {
+		t.Fatalf("turns = %+v, kept = %q", turns, res.Kept)
+	}
+	if got := read(t, filepath.Join(res.Kept, "files", turns[0].Files[0].Blob)); got != "v1\n" {
+		t.Errorf("kept snapshot = %q", got)
+	}
+	if _, err := store.UndoLast(); err == nil {
+		t.Error("an undone turn should not be undone again")
+	}
+}
+
+func TestUndoLast_SkipsUnsealedTurn(t *testing.T) {
+	work := t.TempDir()
+	store := Open(filepath.Join(t.TempDir(), "checkpoints"))
+	edited := filepath.Join(work, "a.txt")
+	created := filepath.Join(work, "b.txt")
+	write(t, edited, "v1\n")
+
+	// The process stopped before the turn was sealed
+	turn := store.Begin("edit")
+	turn.Snapshot("toolu_1", edited)
+	turn.Snapshot("toolu_2", created)
+	write(t, edited, "v2 then the user's change\n")
+	write(t, created, "new\n")
+
+	res, err := store.UndoLast()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read(t, edited) != "v2 then the user's change\n" || read(t, created) != "new\n" {
+		t.Error("files of an unsealed turn should be left alone")
+	}
+	if len(res.Restored) != 0 || len(res.Skipped) != 2 || !strings.Contains(res.Skipped[0], "did not finish") || res.Kept == "" {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestSeal_DropsUnchangedFiles(t *testing.T) {
+	work := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	store := Open(dir)
+	path := filepath.Join(work, "a.txt")
+	write(t, path, "same\n")
+
+	// A snapshot whose tool call failed leaves the file unchanged.
+	turn := store.Begin("failed patch")
+	turn.Snapshot("toolu_1", path)
+	if err := turn.Seal(); err != nil {
+		t.Fatal(err)
+	}
+
+	turns, _ := store.List()
+	if len(turns) != 0 {
+		t.Errorf("turn without changes should be dropped, got %+v", turns)
+	}
+}
+
+func TestBegin_NoSnapshotCreatesNothing(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	store := Open(dir)
+	if err := store.Begin("just a question").Seal(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("store directory should not be created for turns without edits")
+	}
+}
+
+func TestUndoToolUses_RevertsMatchingTurnsNewestFirst(t *testing.T) {
+	work := t.TempDir()
+	store := Open(filepath.Join(t.TempDir(), "checkpoints"))
+	path := filepath.Join(work, "a.txt")
+	other := filepath.Join(work, "b.txt")
+	write(t, path, "v1\n")
+	write(t, other, "untouched by later turns\n")
+
+	t1 := store.Begin("turn one")
+	t1.Snapshot("toolu_1", other)
+	write(t, other, "changed in turn one\n")
+	t1.Seal()
+
+	t2 := store.Begin("turn two")
+	t2.Snapshot("toolu_2", path)
+	write(t, path, "v2\n")
+	t2.Seal()
+
+	t3 := store.Begin("turn three")
+	t3.Snapshot("toolu_3", path)
+	write(t, path, "v3\n")
+	t3.Seal()
+
+	results, err := store.UndoToolUses(map[string]bool{"toolu_2": true, "toolu_3": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Turn.ID != 3 || results[1].Turn.ID != 2 {
+		t.Fatalf("results = %+v", results)
+	}
+	if got := read(t, path); got != "v1\n" {
+		t.Errorf("a.txt = %q, want v1", got)
+	}
+	if got := read(t, other); got != "changed in turn one\n" {
+		t.Errorf("unrelated turn was reverted: %q", got)
+	}
+	turns, _ := store.List()
+	if len(turns) != 1 || turns[0].ID != 1 {
+		t.Errorf("remaining checkpoints = %+v, want turn 1 only", turns)
+	}
+}
+
+func TestStore_IDsContinueAcrossOpens(t *testing.T) {
+	work := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	path := filepath.Join(work, "a.txt")
+	write(t, path, "v1\n")
+
+	turn := Open(dir).Begin("first run")
+	turn.Snapshot("toolu_1", path)
+	write(t, path, "v2\n")
+	turn.Seal()
+
+	// A resumed session reopens the same store.
+	turn = Open(dir).Begin("second run")
+	turn.Snapshot("toolu_2", path)
+	write(t, path, "v3\n")
+	turn.Seal()
+
+	if turn.ID != 2 {
+		t.Errorf("turn ID = %d, want 2", turn.ID)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".gitignore")); err != nil {
+		t.Error("store should ignore itself in git")
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"os/exec"
 	"strings"
 
+	"github.com/this-is-alpha-iota/clyde/agent/hooks"
+	"github.com/this-is-alpha-iota/clyde/agent/plan"
 	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/todo"
 )
 
 // DefaultReserveTokens is the default number of tokens to reserve for the
@@ -22,9 +25,11 @@ type CompactionCallback func(marker string, summary string)
 // WithCompactionCallback sets the callback for compaction events.
 // Called with the compaction marker ("🗜️ Compacting...") and the summary text.
 func WithCompactionCallback(cb CompactionCallback) AgentOption {
-	return func(a *Agent) {
-		a.compactionCallback = cb
-	}
+	return WithEventHandler(func(e Event) {
+		if c, ok := e.(CompactionEvent); ok && c.TaskID == "" {
+			cb(c.Message, c.Summary)
+		}
+	})
 }
 
 // ShouldCompact checks whether the conversation history has grown large enough
@@ -58,7 +63,8 @@ func (a *Agent) ShouldCompact() bool {
 // Compact performs conversation compaction. It:
 //  1. Identifies the first (pinned) user message
 //  2. Runs a multi-phase summarization workflow
-//  3. Replaces history with: first user message + summary + recent messages
+//  3. Replaces history with: first user message + summary + approved plan +
+//     recent messages
 //  4. Emits callbacks for session persistence
 //
 // Returns an error if summarization fails.
@@ -88,15 +94,18 @@ func (a *Agent) Compact() error {
 	toSummarize := a.history[firstUserIdx+1 : summarizeEnd]
 	keptMessages := a.history[summarizeEnd:]
 
-	// Step 3: Emit compaction marker
-	if a.compactionCallback != nil {
-		a.compactionCallback("🗜️ Compacting conversation history...", "")
-	}
-	if a.diagnosticCallback != nil {
-		a.diagnosticCallback(fmt.Sprintf("🗜️ Compacting: %d messages → summary + %d recent messages",
-			len(a.history), keepCount))
+	// A PreCompact hook can veto compaction (e.g. to archive the history
+	// first, or to keep it intact while debugging).
+	if pre := a.runHooks(hooks.Input{Event: hooks.PreCompact, Trigger: "auto"}); pre.Blocked() {
+		a.emit(DiagnosticEvent{Message: fmt.Sprintf("🗜️ Compaction skipped by a %s hook: %s", hooks.PreCompact, pre.Reason)})
+		return nil
 	}
 
+	// Step 3: Emit compaction marker
+	a.emit(CompactionEvent{Message: "🗜️ Compacting conversation history..."})
+	a.emit(DiagnosticEvent{Message: fmt.Sprintf("🗜️ Compacting: %d messages → summary + %d recent messages",
+		len(a.history), keepCount)})
+
 	// Step 4: Run multi-phase compaction workflow.
 	// In multi-turn conversations the most recent user message captures the
 	// current objective, which may differ from the original mission.
@@ -107,15 +116,13 @@ func (a *Agent) Compact() error {
 	if lastUserIdx > firstUserIdx {
 		currentObjective = messageText(lastUserMsg)
 	}
-	summary, err := a.runCompactionWorkflow(firstUserMsg, currentObjective, toSummarize, keptMessages)
+	summary, err := a.runCompactionWorkflow(firstUserMsg, currentObjective, toSummarize, keptMessages, a.todos)
 	if err != nil {
 		return fmt.Errorf("compaction failed: %w", err)
 	}
 
-	// Step 5: Emit the summary via callback for session persistence
-	if a.compactionCallback != nil {
-		a.compactionCallback("", summary)
-	}
+	// Step 5: Emit the summary for session persistence
+	a.emit(CompactionEvent{Summary: summary})
 
 	// Step 6: Replace history with compacted version.
 	// Structure: [first user msg] [assistant ack] [summary as user] [assistant ack] [kept messages...]
@@ -142,6 +149,15 @@ func (a *Agent) Compact() error {
 		Content: "I've reviewed the compaction summary and understand the context. I'll continue from where we left off.",
 	})
 
+	// The latest approved plan stays pinned, verbatim, unless it is among
+	// the kept messages anyway
+	if pinned, planIdx := a.findApprovedPlan(); planIdx > firstUserIdx && planIdx < summarizeEnd {
+		newHistory = append(newHistory, pinned, providers.Message{
+			Role:    "assistant",
+			Content: plan.ApprovedAck,
+		})
+	}
+
 	// Append recent kept messages
 	newHistory = append(newHistory, keptMessages...)
 
@@ -173,6 +189,18 @@ func (a *Agent) findFirstUserMessage() (providers.Message, int) {
 	return providers.Message{}, -1
 }
 
+// findApprovedPlan locates the user message pinning the most recently
+// approved plan (see ApprovePlan).
+func (a *Agent) findApprovedPlan() (providers.Message, int) {
+	for i := len(a.history) - 1; i >= 0; i-- {
+		msg := a.history[i]
+		if text, ok := msg.Content.(string); ok && msg.Role == "user" && strings.HasPrefix(text, ApprovedPlanPrefix) {
+			return msg, i
+		}
+	}
+	return providers.Message{}, -1
+}
+
 // FindLastUserMessage locates the most recent user text message in history.
 // In multi-turn conversations this captures the current objective, which may
 // differ from the original mission. Exported for testing.
@@ -235,6 +263,7 @@ func (a *Agent) runCompactionWorkflow(
 	currentObjective string,
 	toSummarize []providers.Message,
 	keptMessages []providers.Message,
+	todos []todo.Item,
 ) (string, error) {
 
 	missionText := messageText(firstUserMsg)
@@ -313,12 +342,18 @@ func (a *Agent) runCompactionWorkflow(
 			"Return a concise Markdown section with:\n"+
 			"- **Significant Outputs**: Key results from tool executions (test results, errors encountered, search findings)\n"+
 			"- **Errors Resolved**: Any errors that were encountered and how they were fixed\n"+
-			"Skip routine outputs (simple file reads, directory listings). Focus on outputs that informed decisions.",
+			"Skip routine outputs (simple file reads, directory listings). Focus on outputs that informed decisions.\n"+
+			"The most recent run_tests summary is attached verbatim after your section; do not repeat it.",
 		missionText, currentObjective, convText, recentCtx,
 	)
 	if err != nil {
 		return "", fmt.Errorf("phase 4 (tool-results) failed: %w", err)
 	}
+	// The latest structured test summary is already compact; keep it exact
+	// rather than trusting a paraphrase of which tests fail and where.
+	if tests := latestToolResult(toSummarize, "run_tests"); tests != "" {
+		toolSynthesis += "\n\n**Latest Test Results** (run_tests, verbatim):\n```\n" + tests + "\n```"
+	}
 	a.emitCompactionDebug("Phase 4 output", toolSynthesis)
 
 	// Phase 5: Handoff drafting — assemble everything into a structured document
@@ -334,6 +369,15 @@ func (a *Agent) runCompactionWorkflow(
 		goals, decisions, fileState, toolSynthesis, gitState,
 	)
 
+	// The todo list is the model's own plan; hand it over exactly
+	todoInstruction := ""
+	if len(todos) > 0 {
+		assemblyInput += "\n\n### Todo List (" + todo.Summary(todos) + ", [~] = in progress)\n" + todo.Checklist(todos)
+		todoInstruction = "\n\nIMPORTANT: A 'Todo List' section is provided — the agent's own task list at compaction time. " +
+			"The Next Steps section MUST list every item that is not done ([~] and [ ] items), copied verbatim with its id, in order, " +
+			"before any further steps you infer. Do not mark items done or drop them."
+	}
+
 	// Add recent context for bridging if enabled
 	bridgeInstruction := ""
 	if a.compactIncludeRecentContext && recentCtx != "" {
@@ -350,7 +394,8 @@ func (a *Agent) runCompactionWorkflow(
 		"## Key Decisions\n(from phase 2)\n\n" +
 		"## Current State\n(from phase 3 — include git SHA/branch if available)\n\n" +
 		"## Next Steps\n(infer from the conversation what should happen next)\n\n" +
-		"## Critical Context\n(anything a future reader must know — errors, gotchas, important details)\n\n" +
+		"## Critical Context\n(anything a future reader must know — errors, gotchas, important details; " +
+		"copy any **Latest Test Results** block from the tool output synthesis here verbatim)\n\n" +
 		"Be concise but thorough. This document replaces the conversation history, so nothing important should be lost.\n" +
 		"Do NOT include the original user message — it is preserved separately."
 	if currentObjective != "" {
@@ -358,7 +403,7 @@ func (a *Agent) runCompactionWorkflow(
 			"representing the user's most recent request. Your Goal section MUST clearly state this current objective " +
 			"as the active focus. The Next Steps section should be derived from the current objective, not the original mission."
 	}
-	phase5System += bridgeInstruction
+	phase5System += todoInstruction + bridgeInstruction
 
 	handoff, err := a.compactionPhaseCall(
 		phase5System,
@@ -416,6 +461,7 @@ func (a *Agent) compactionPhaseCall(
 	if err != nil {
 		return "", err
 	}
+	a.emit(UsageEvent{Model: a.apiClient.ModelID(), Usage: resp.Usage})
 
 	var parts []string
 	for _, block := range resp.Content {
@@ -429,23 +475,19 @@ func (a *Agent) compactionPhaseCall(
 	return strings.Join(parts, "\n"), nil
 }
 
-// emitCompactionProgress sends a compaction progress message via the callback.
+// emitCompactionProgress sends a compaction progress message as an event.
 func (a *Agent) emitCompactionProgress(msg string) {
-	if a.compactionCallback != nil {
-		a.compactionCallback(msg, "")
-	}
+	a.emit(CompactionEvent{Message: msg})
 }
 
-// emitCompactionDebug sends intermediate compaction output via the diagnostic callback.
+// emitCompactionDebug sends intermediate compaction output as a diagnostic.
 func (a *Agent) emitCompactionDebug(label, content string) {
-	if a.diagnosticCallback != nil {
-		// Truncate for diagnostic display (full content is in the final handoff)
-		preview := content
-		if len(preview) > 500 {
-			preview = preview[:500] + "..."
-		}
-		a.diagnosticCallback(fmt.Sprintf("🗜️ %s:\n%s", label, preview))
+	// Truncate for diagnostic display (full content is in the final handoff)
+	preview := content
+	if len(preview) > 500 {
+		preview = preview[:500] + "..."
 	}
+	a.emit(DiagnosticEvent{Message: fmt.Sprintf("🗜️ %s:\n%s", label, preview)})
 }
 
 // --- Git state capture ---
@@ -551,6 +593,8 @@ func (a *Agent) serializeMessagesWithSummarization(
 		threshold = DefaultToolResultThreshold
 	}
 
+	verbatim := verbatimToolResults(msgs)
+
 	var sb strings.Builder
 	for _, msg := range msgs {
 		role := msg.Role
@@ -567,14 +611,12 @@ func (a *Agent) serializeMessagesWithSummarization(
 				case "tool_result":
 					resultText := ""
 					if s, ok := block.Content.(string); ok {
-						if len(s) > threshold {
+						if len(s) > threshold && !verbatim[block.ToolUseID] {
 							// Attempt intelligent summarization
 							summarized, err := a.summarizeToolResult(s, missionText, keptMessages)
 							if err != nil {
 								// Fallback to hard truncation
-								if a.diagnosticCallback != nil {
-									a.diagnosticCallback(fmt.Sprintf("🗜️ Tool result summarization failed, falling back to truncation: %v", err))
-								}
+								a.emit(DiagnosticEvent{Message: fmt.Sprintf("🗜️ Tool result summarization failed, falling back to truncation: %v", err)})
 								resultText = hardTruncate(s, threshold)
 							} else {
 								resultText = summarized
@@ -593,6 +635,53 @@ func (a *Agent) serializeMessagesWithSummarization(
 	return sb.String()
 }
 
+// verbatimTools are tools whose results are already compact summaries;
+// compaction passes them through instead of summarizing them again.
+var verbatimTools = map[string]bool{
+	"run_tests": true,
+}
+
+// verbatimToolResults returns the tool_use IDs of calls to verbatimTools.
+func verbatimToolResults(msgs []providers.Message) map[string]bool {
+	ids := make(map[string]bool)
+	for _, msg := range msgs {
+		blocks, ok := msg.Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+		for _, b := range blocks {
+			if b.Type == "tool_use" && verbatimTools[b.Name] {
+				ids[b.ID] = true
+			}
+		}
+	}
+	return ids
+}
+
+// latestToolResult returns the text of the most recent result of the named
+// tool in msgs, or "" if it was not called.
+func latestToolResult(msgs []providers.Message, toolName string) string {
+	ids := make(map[string]bool)
+	latest := ""
+	for _, msg := range msgs {
+		blocks, ok := msg.Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+		for _, b := range blocks {
+			switch {
+			case b.Type == "tool_use" && b.Name == toolName:
+				ids[b.ID] = true
+			case b.Type == "tool_result" && ids[b.ToolUseID]:
+				if s, ok := b.Content.(string); ok {
+					latest = s
+				}
+			}
+		}
+	}
+	return latest
+}
+
 // serializeMessagesHard converts messages to text with hard truncation only.
 // Used by the exported SerializeMessages and as a non-LLM fallback.
 func serializeMessagesHard(msgs []providers.Message, threshold int) string {
@@ -687,6 +776,7 @@ func (a *Agent) summarizeToolResult(
 	if err != nil {
 		return "", fmt.Errorf("tool result summarization API call failed: %w", err)
 	}
+	a.emit(UsageEvent{Model: a.apiClient.ModelID(), Usage: resp.Usage})
 
 	var parts []string
 	for _, block := range resp.Content {
@@ -703,9 +793,7 @@ func (a *Agent) summarizeToolResult(
 	// Append metadata note
 	summarized += fmt.Sprintf("\n\n[Summarized: original %d chars → %d chars]", len(toolOutput), len(summarized))
 
-	if a.diagnosticCallback != nil {
-		a.diagnosticCallback(fmt.Sprintf("🗜️ Summarized tool result: %d chars → %d chars", len(toolOutput), len(summarized)))
-	}
+	a.emit(DiagnosticEvent{Message: fmt.Sprintf("🗜️ Summarized tool result: %d chars → %d chars", len(toolOutput), len(summarized))})
 
 	return summarized, nil
 }
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -29,6 +30,17 @@ type Config struct {
 	ReserveTokens        int    // Tokens to reserve for response; triggers compaction (0 = default 16000)
 	CompactIncludeRecentContext *bool // Feed recent messages into compaction (nil = default true)
 	ToolResultThreshold        int   // Chars above which tool results are LLM-summarized (0 = default 2000)
+	MicroCompactPercent        int   // Context % that triggers stale tool-result pruning (0 = default 60)
+	MicroCompactKeepTurns      int   // Recent assistant turns exempt from pruning (0 = default 8)
+	ApplyPatchFuzz             *int  // Default apply_patch fuzz level, 0-3 (nil = default 2)
+	ReadFileMaxLines           int   // Lines read_file returns without a limit (0 = default 2000)
+	RepoMapTokens              int   // Repository map budget for the system prompt (0 = off)
+	RedactSecrets              *bool    // Redact secrets in messages and tool results (nil = default true)
+	RedactAllowlist            []string // Strings never redacted (comma-separated in the file)
+	WorkspaceRoots             []string // Extra roots for the file tools (comma-separated in the file)
+	OutsideReads               string   // Reads outside the workspace: "ask" (default) or "allow"
+	TaskModel                  string   // Model for task sub-agents (empty = ModelID)
+	AskUserDefault             string   // ask_user answer when no user is available (empty = best judgment)
 }
 
 // LoadFromFile loads configuration from a specific file path
@@ -99,6 +111,96 @@ func LoadFromFile(path string) (*Config, error) {
 		toolResultThreshold = trt
 	}
 
+	// Parse optional micro-compaction settings
+	microCompactPercent := 0
+	if mcpStr := os.Getenv("MICRO_COMPACT_PERCENT"); mcpStr != "" {
+		pct, err := strconv.Atoi(mcpStr)
+		if err != nil {
+			return nil, fmt.Errorf("MICRO_COMPACT_PERCENT must be a number, got %q: %w", mcpStr, err)
+		}
+		if pct < 10 || pct > 95 {
+			return nil, fmt.Errorf("MICRO_COMPACT_PERCENT must be between 10 and 95, got %d", pct)
+		}
+		microCompactPercent = pct
+	}
+	microCompactKeepTurns := 0
+	if mktStr := os.Getenv("MICRO_COMPACT_KEEP_TURNS"); mktStr != "" {
+		mkt, err := strconv.Atoi(mktStr)
+		if err != nil {
+			return nil, fmt.Errorf("MICRO_COMPACT_KEEP_TURNS must be a number, got %q: %w", mktStr, err)
+		}
+		if mkt < 1 {
+			return nil, fmt.Errorf("MICRO_COMPACT_KEEP_TURNS must be >= 1, got %d", mkt)
+		}
+		microCompactKeepTurns = mkt
+	}
+
+	// Parse optional default fuzz level for apply_patch
+	var applyPatchFuzz *int
+	if apfStr := os.Getenv("APPLY_PATCH_FUZZ"); apfStr != "" {
+		apf, err := strconv.Atoi(apfStr)
+		if err != nil {
+			return nil, fmt.Errorf("APPLY_PATCH_FUZZ must be a number, got %q: %w", apfStr, err)
+		}
+		if apf < 0 || apf > 3 {
+			return nil, fmt.Errorf("APPLY_PATCH_FUZZ must be between 0 and 3, got %d", apf)
+		}
+		applyPatchFuzz = &apf
+	}
+
+	// Parse optional default line limit for read_file
+	readFileMaxLines := 0
+	if rfmStr := os.Getenv("READ_FILE_MAX_LINES"); rfmStr != "" {
+		rfm, err := strconv.Atoi(rfmStr)
+		if err != nil {
+			return nil, fmt.Errorf("READ_FILE_MAX_LINES must be a number, got %q: %w", rfmStr, err)
+		}
+		if rfm < 1 {
+			return nil, fmt.Errorf("READ_FILE_MAX_LINES must be >= 1, got %d", rfm)
+		}
+		readFileMaxLines = rfm
+	}
+
+	// Parse optional repository map budget for the system prompt
+	repoMapTokens := 0
+	if rmtStr := os.Getenv("REPO_MAP_TOKENS"); rmtStr != "" {
+		rmt, err := strconv.Atoi(rmtStr)
+		if err != nil {
+			return nil, fmt.Errorf("REPO_MAP_TOKENS must be a number, got %q: %w", rmtStr, err)
+		}
+		if rmt != 0 && (rmt < 500 || rmt > 16000) {
+			return nil, fmt.Errorf("REPO_MAP_TOKENS must be 0 (off) or between 500 and 16000, got %d", rmt)
+		}
+		repoMapTokens = rmt
+	}
+
+	// Parse optional secret redaction settings
+	var redactSecrets *bool
+	if val := os.Getenv("REDACT_SECRETS"); val != "" {
+		b := val != "false" && val != "0"
+		redactSecrets = &b
+	}
+	var redactAllowlist []string
+	if val := os.Getenv("REDACT_ALLOWLIST"); val != "" {
+		redactAllowlist = strings.Split(val, ",")
+	}
+
+	// Parse optional workspace policy settings
+	var workspaceRoots []string
+	if val := os.Getenv("WORKSPACE_ROOTS"); val != "" {
+		workspaceRoots = strings.Split(val, ",")
+	}
+	outsideReads := strings.ToLower(os.Getenv("OUTSIDE_READS"))
+	if outsideReads != "" && outsideReads != "ask" && outsideReads != "allow" {
+		return nil, fmt.Errorf("OUTSIDE_READS must be \"ask\" or \"allow\", got %q", outsideReads)
+	}
+
+	// Model for task sub-agents (empty = the main model)
+	taskModel := os.Getenv("TASK_MODEL")
+
+	// Answer to ask_user questions when no user is available (CLI mode)
+	askUserDefault := os.Getenv("ASK_USER_DEFAULT")
+
 	return &Config{
 		APIKey:               apiKey,
 		BraveSearchAPIKey:    os.Getenv("BRAVE_SEARCH_API_KEY"),
@@ -112,5 +214,16 @@ func LoadFromFile(path string) (*Config, error) {
 		ReserveTokens:        reserveTokens,
 		CompactIncludeRecentContext: compactIncludeRecentContext,
 		ToolResultThreshold:        toolResultThreshold,
+		MicroCompactPercent:        microCompactPercent,
+		MicroCompactKeepTurns:      microCompactKeepTurns,
+		ApplyPatchFuzz:             applyPatchFuzz,
+		ReadFileMaxLines:           readFileMaxLines,
+		RepoMapTokens:              repoMapTokens,
+		RedactSecrets:              redactSecrets,
+		RedactAllowlist:            redactAllowlist,
+		WorkspaceRoots:             workspaceRoots,
+		OutsideReads:               outsideReads,
+		TaskModel:                  taskModel,
+		AskUserDefault:             askUserDefault,
 	}, nil
 }
@@ -0,0 +1,381 @@
+// Package customtools registers tools declared in YAML, so teams can wrap
+// internal CLIs without writing Go. Each file in <repo>/.clyde/tools/ or
+// ~/.clyde/tools/ (*.yaml or *.yml) declares one tool:
+//
+//	name: deploy_status
+//	description: Show the current deploy status of a service.
+//	input_schema:
+//	  type: object
+//	  properties:
+//	    service: {type: string, description: 'Service name, e.g. "billing"'}
+//	    env: {type: string, enum: [staging, production]}
+//	  required: [service]
+//	command: deployctl status --service {{service}} --env {{env}}
+//	timeout: 30
+//	display: "Checking deploys of {{service}}"
+//
+// The tool runs either command, a bash command line in which {{param}} is
+// replaced with the shell-quoted input value, or script, an executable path
+// relative to the YAML file. The input is also passed as JSON on stdin
+// (input: stdin, the default) or as CLYDE_INPUT_<PARAM> environment
+// variables (input: env). Tools run in the project's sandbox when it is
+// enabled, and the agent registers a project's tools only once the user
+// has approved them.
+package customtools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is where custom tools are declared, relative to the repository root
+// or the home directory.
+const Dir = ".clyde/tools"
+
+// DefaultTimeout is how long a tool may run when it sets no timeout.
+const DefaultTimeout = 60 * time.Second
+
+// Input modes.
+const (
+	InputStdin = "stdin"
+	InputEnv   = "env"
+)
+
+// Definition is one declared tool.
+type Definition struct {
+	Name        string                 `yaml:"name"`
+	Description string                 `yaml:"description"`
+	InputSchema map[string]interface{} `yaml:"input_schema"`
+	// Command is a bash command line; {{param}} is replaced with the
+	// shell-quoted value of the input parameter ('' when absent), so
+	// placeholders must not be put inside quotes.
+	Command string `yaml:"command"`
+	// Script is an executable, relative to the YAML file, run with no
+	// arguments. Exactly one of Command and Script is set.
+	Script string `yaml:"script"`
+	// Input is InputStdin (default) or InputEnv.
+	Input string `yaml:"input"`
+	// Timeout in seconds (0 = DefaultTimeout).
+	Timeout int `yaml:"timeout"`
+	// Display is the progress line; {{param}} is replaced with the raw value.
+	Display string `yaml:"display"`
+
+	// Path is the file the tool was declared in.
+	Path string `yaml:"-"`
+}
+
+var (
+	validName   = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	placeholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	envUnsafe   = regexp.MustCompile(`[^A-Z0-9_]`)
+)
+
+// registered remembers which registry entries are custom tools, so they can
+// be replaced on reload while built-in tools cannot be shadowed.
+var registered = make(map[string]bool)
+
+// Dirs returns the directories to scan for the working directory, in
+// priority order: the repository's first, then the user's.
+func Dirs() []string {
+	dirs := []string{filepath.Join(ignore.New(".").Root(), filepath.FromSlash(Dir))}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, filepath.FromSlash(Dir)))
+	}
+	return dirs
+}
+
+// Load reads the tool declarations in dirs. A name declared in an earlier
+// directory wins. Invalid files are reported and skipped; missing
+// directories are not an error.
+func Load(dirs ...string) ([]*Definition, []error) {
+	var defs []*Definition
+	var errs []error
+	seen := make(map[string]string)
+	for _, dir := range dirs {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		yml, _ := filepath.Glob(filepath.Join(dir, "*.yml"))
+		files = append(files, yml...)
+		sort.Strings(files)
+		for _, path := range files {
+			def, err := LoadFile(path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if first, ok := seen[def.Name]; ok {
+				if filepath.Dir(first) == dir {
+					errs = append(errs, fmt.Errorf("custom tool %s: %q is already declared in %s", path, def.Name, first))
+				}
+				continue
+			}
+			seen[def.Name] = path
+			defs = append(defs, def)
+		}
+	}
+	return defs, errs
+}
+
+// LoadFile reads and validates one tool declaration.
+func LoadFile(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("custom tool %s: %w", path, err)
+	}
+	var def Definition
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		return nil, fmt.Errorf("custom tool %s: invalid YAML: %w", path, err)
+	}
+	def.Path = path
+	if err := def.validate(); err != nil {
+		return nil, fmt.Errorf("custom tool %s: %w", path, err)
+	}
+	return &def, nil
+}
+
+// validate checks a definition and fills in defaults.
+func (d *Definition) validate() error {
+	if !validName.MatchString(d.Name) {
+		return fmt.Errorf("name %q must be 1-64 letters, digits, underscores or hyphens", d.Name)
+	}
+	if strings.TrimSpace(d.Description) == "" {
+		return fmt.Errorf("description is required")
+	}
+	if d.InputSchema == nil {
+		d.InputSchema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+	if d.InputSchema["type"] != "object" {
+		return fmt.Errorf("input_schema must have type: object")
+	}
+	switch {
+	case strings.TrimSpace(d.Command) == "" && d.Script == "":
+		return fmt.Errorf("either command or script is required")
+	case d.Command != "" && d.Script != "":
+		return fmt.Errorf("set command or script, not both")
+	case d.Script != "":
+		if !filepath.IsAbs(d.Script) {
+			d.Script = filepath.Join(filepath.Dir(d.Path), d.Script)
+		}
+		info, err := os.Stat(d.Script)
+		if err != nil {
+			return fmt.Errorf("script: %w", err)
+		}
+		if info.IsDir() || info.Mode()&0111 == 0 {
+			return fmt.Errorf("script %s is not executable (chmod +x it)", d.Script)
+		}
+	}
+	switch d.Input {
+	case "":
+		d.Input = InputStdin
+	case InputStdin, InputEnv:
+	default:
+		return fmt.Errorf("input must be %q or %q, got %q", InputStdin, InputEnv, d.Input)
+	}
+	if d.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	properties, _ := d.InputSchema["properties"].(map[string]interface{})
+	for _, template := range []string{d.Command, d.Display} {
+		for _, m := range placeholder.FindAllStringSubmatch(template, -1) {
+			if _, ok := properties[m[1]]; !ok {
+				return fmt.Errorf("{{%s}} is not a property in input_schema", m[1])
+			}
+		}
+	}
+	return nil
+}
+
+// FromDir returns the definitions declared in dir.
+func FromDir(defs []*Definition, dir string) []*Definition {
+	var in []*Definition
+	for _, def := range defs {
+		if filepath.Dir(def.Path) == dir {
+			in = append(in, def)
+		}
+	}
+	return in
+}
+
+// Content returns what running the definitions depends on: each
+// declaration file and script, with its path. The user approves this
+// before a project's tools are registered.
+func Content(defs []*Definition) []byte {
+	var b bytes.Buffer
+	for _, def := range defs {
+		for _, path := range []string{def.Path, def.Script} {
+			if path == "" {
+				continue
+			}
+			data, _ := os.ReadFile(path)
+			fmt.Fprintf(&b, "%s\n%d\n%s\n", path, len(data), data)
+		}
+	}
+	return b.Bytes()
+}
+
+// Register adds the definitions to the tool registry, replacing the custom
+// tools registered before (those no longer declared are removed), and
+// returns the names it registered. A definition named like a built-in tool
+// is skipped with an error.
+func Register(defs []*Definition) ([]string, []error) {
+	for name := range registered {
+		tools.Unregister(name)
+		delete(registered, name)
+	}
+	var names []string
+	var errs []error
+	for _, def := range defs {
+		if _, err := tools.GetTool(def.Name); err == nil && !registered[def.Name] {
+			errs = append(errs, fmt.Errorf("custom tool %s: %q is a built-in tool name", def.Path, def.Name))
+			continue
+		}
+		tool := providers.Tool{
+			Name:        def.Name,
+			Description: def.Description,
+			InputSchema: def.InputSchema,
+		}
+		tools.Register(tool, def.execute, def.display)
+		registered[def.Name] = true
+		names = append(names, def.Name)
+	}
+	return names, errs
+}
+
+// execute runs the tool with the model's input.
+func (d *Definition) execute(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
+	if required, ok := d.InputSchema["required"].([]interface{}); ok {
+		var missing []string
+		for _, name := range required {
+			if _, ok := input[fmt.Sprint(name)]; !ok {
+				missing = append(missing, fmt.Sprint(name))
+			}
+		}
+		if len(missing) > 0 {
+			return "", fmt.Errorf("%s requires %s. Check the tool's input schema and call it again.", d.Name, strings.Join(missing, ", "))
+		}
+	}
+
+	timeout := DefaultTimeout
+	if d.Timeout > 0 {
+		timeout = time.Duration(d.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	sb, err := tools.Sandbox(d.Name)
+	if err != nil {
+		return "", err
+	}
+	name, args := d.Script, []string(nil)
+	if d.Script == "" {
+		name, args = "bash", []string{"-c", expand(d.Command, input, shellQuote)}
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	if sb != nil {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("cannot run %s: %w", d.Name, err)
+		}
+		cmd = sb.CommandContext(ctx, dir, name, args...)
+	}
+	cmd.Env = append(os.Environ(), "CLYDE_TOOL_NAME="+d.Name)
+	if d.Input == InputEnv {
+		names := make([]string, 0, len(input))
+		for name := range input {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key := "CLYDE_INPUT_" + envUnsafe.ReplaceAllString(strings.ToUpper(name), "_")
+			cmd.Env = append(cmd.Env, key+"="+format(input[name]))
+		}
+	} else {
+		payload, err := json.Marshal(input)
+		if err != nil {
+			return "", fmt.Errorf("cannot encode the input for %s: %w", d.Name, err)
+		}
+		cmd.Stdin = bytes.NewReader(payload)
+	}
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if sb != nil {
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		if note := sb.Explain(string(output), exitCode); note != "" {
+			output = append(output, "\n"+note...)
+		}
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("%s timed out after %s\n\nOutput so far:\n%s\n\nSuggestions:\n"+
+			"  - Narrow the request if the tool supports it\n"+
+			"  - The timeout is set in %s", d.Name, timeout, output, d.Path)
+	}
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("%s failed with exit code %d\n\nOutput:\n%s\n\nSuggestions:\n"+
+				"  - Check the input values against the tool's description\n"+
+				"  - The tool is defined in %s", d.Name, exitErr.ExitCode(), output, d.Path)
+		}
+		return "", fmt.Errorf("cannot run %s: %w (defined in %s)", d.Name, err, d.Path)
+	}
+	if len(output) == 0 {
+		return "(no output)", nil
+	}
+	return string(output), nil
+}
+
+// display formats the progress line.
+func (d *Definition) display(input map[string]interface{}) string {
+	if d.Display == "" {
+		return "→ Running " + d.Name
+	}
+	return "→ " + expand(d.Display, input, func(s string) string { return s })
+}
+
+// expand replaces {{param}} in template with the input values.
+func expand(template string, input map[string]interface{}, quote func(string) string) string {
+	return placeholder.ReplaceAllStringFunc(template, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		return quote(format(input[name]))
+	})
+}
+
+// format turns an input value into text: strings as they are, numbers
+// without exponents, and arrays or objects as JSON.
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// shellQuote quotes s as a single bash word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
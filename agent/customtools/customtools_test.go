@@ -0,0 +1,173 @@
+package customtools
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+func writeTool(t *testing.T, dir, file, yaml string) string {
+	t.Helper()
+	os.MkdirAll(dir, 0755)
+	path := filepath.Join(dir, file)
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	project, user := t.TempDir(), t.TempDir()
+	writeTool(t, project, "a.yaml", "name: greet\ndescription: Project greeting\ncommand: echo hi\n")
+	writeTool(t, project, "b.yml", "name: count\ndescription: Count\ncommand: wc -c\n")
+	writeTool(t, user, "greet.yaml", "name: greet\ndescription: User greeting\ncommand: echo hello\n")
+	writeTool(t, user, "other.yaml", "name: other\ndescription: Other\nscript: run.sh\n")
+	writeTool(t, user, "notes.txt", "not a tool")
+	os.WriteFile(filepath.Join(user, "run.sh"), []byte("#!/bin/sh\necho ran\n"), 0755)
+
+	defs, errs := Load(project, user, filepath.Join(project, "missing"))
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	var names []string
+	for _, d := range defs {
+		names = append(names, d.Name)
+	}
+	if strings.Join(names, ",") != "greet,count,other" || defs[0].Description != "Project greeting" {
+		t.Errorf("loaded %v", names)
+	}
+	if defs[2].Script != filepath.Join(user, "run.sh") || defs[2].Input != InputStdin {
+		t.Errorf("script = %q, input = %q", defs[2].Script, defs[2].Input)
+	}
+	if defs[0].InputSchema["type"] != "object" {
+		t.Errorf("default schema = %v", defs[0].InputSchema)
+	}
+
+	writeTool(t, project, "c.yaml", "name: greet\ndescription: Again\ncommand: echo\n")
+	if _, errs := Load(project); len(errs) != 1 || !strings.Contains(errs[0].Error(), `"greet" is already declared in `+filepath.Join(project, "a.yaml")) {
+		t.Errorf("duplicate errors = %v", errs)
+	}
+}
+
+func TestLoadFile_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "plain.sh"), []byte("echo"), 0644)
+	for yaml, want := range map[string]string{
+		"name: bad name\ndescription: x\ncommand: true":                     "must be 1-64 letters",
+		"name: x\ncommand: true":                                            "description is required",
+		"name: x\ndescription: x":                                           "either command or script is required",
+		"name: x\ndescription: x\ncommand: a\nscript: b":                    "not both",
+		"name: x\ndescription: x\nscript: plain.sh":                         "is not executable",
+		"name: x\ndescription: x\nscript: nope.sh":                          "no such file",
+		"name: x\ndescription: x\ncommand: true\ninput: args":               `input must be "stdin" or "env"`,
+		"name: x\ndescription: x\ncommand: true\ntimeout: -5":               "timeout must not be negative",
+		"name: x\ndescription: x\ncommand: echo {{who}}":                    "{{who}} is not a property",
+		"name: x\ndescription: x\ninput_schema: {type: string}\ncommand: a": "type: object",
+		"name: [x": "invalid YAML",
+	} {
+		path := writeTool(t, dir, "tool.yaml", yaml)
+		if _, err := LoadFile(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: error = %v, want %q", yaml, err, want)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	dir := t.TempDir()
+	load := func(yaml string) *Definition {
+		t.Helper()
+		def, err := LoadFile(writeTool(t, dir, "tool.yaml", yaml))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return def
+	}
+	schema := "input_schema:\n  type: object\n  properties:\n    who: {type: string}\n    n: {type: integer}\n    tags: {type: array}\n  required: [who]\n"
+
+	t.Run("Command template quotes values", func(t *testing.T) {
+		def := load("name: greet\ndescription: x\n" + schema + "command: printf '%s|' {{who}} {{ n }} {{tags}} {{who}}\ndisplay: Greeting {{who}}\n")
+		out, err := def.execute(map[string]interface{}{"who": "it's me; rm -rf /", "n": float64(3), "tags": []interface{}{"a"}}, nil, nil)
+		if err != nil || out != `it's me; rm -rf /|3|["a"]|it's me; rm -rf /|` {
+			t.Errorf("output = %q, %v", out, err)
+		}
+		if got := def.display(map[string]interface{}{"who": "bob"}); got != "→ Greeting bob" {
+			t.Errorf("display = %q", got)
+		}
+		if _, err := def.execute(map[string]interface{}{}, nil, nil); err == nil || !strings.Contains(err.Error(), "greet requires who") {
+			t.Errorf("missing required input: %v", err)
+		}
+	})
+
+	t.Run("Stdin and env input", func(t *testing.T) {
+		def := load("name: echo_input\ndescription: x\n" + schema + "command: cat; echo; echo \"$CLYDE_TOOL_NAME\"\n")
+		out, err := def.execute(map[string]interface{}{"who": "ann", "n": float64(1)}, nil, nil)
+		if err != nil || out != "{\"n\":1,\"who\":\"ann\"}\necho_input\n" {
+			t.Errorf("stdin output = %q, %v", out, err)
+		}
+		if got := def.display(nil); got != "→ Running echo_input" {
+			t.Errorf("default display = %q", got)
+		}
+
+		def = load("name: env_input\ndescription: x\n" + schema + "input: env\ncommand: echo \"$CLYDE_INPUT_WHO/$CLYDE_INPUT_N/$CLYDE_INPUT_TAGS\"\n")
+		out, err = def.execute(map[string]interface{}{"who": "ann", "n": float64(1.5), "tags": []interface{}{"x", "y"}}, nil, nil)
+		if err != nil || out != "ann/1.5/[\"x\",\"y\"]\n" {
+			t.Errorf("env output = %q, %v", out, err)
+		}
+	})
+
+	t.Run("Script, failures and timeouts", func(t *testing.T) {
+		os.WriteFile(filepath.Join(dir, "tool.sh"), []byte("#!/bin/sh\nread line\necho \"got $line\"\n"), 0755)
+		def := load("name: scripted\ndescription: x\nscript: tool.sh\n")
+		if out, err := def.execute(map[string]interface{}{"k": "v"}, nil, nil); err != nil || out != "got {\"k\":\"v\"}\n" {
+			t.Errorf("script output = %q, %v", out, err)
+		}
+
+		def = load("name: failing\ndescription: x\ncommand: echo broken >&2; exit 3\n")
+		_, err := def.execute(map[string]interface{}{}, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "failing failed with exit code 3\n\nOutput:\nbroken") || !strings.Contains(err.Error(), def.Path) {
+			t.Errorf("failure = %v", err)
+		}
+
+		def = load("name: slow\ndescription: x\ncommand: echo started; sleep 10\ntimeout: 1\n")
+		_, err = def.execute(map[string]interface{}{}, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "slow timed out after 1s\n\nOutput so far:\nstarted") {
+			t.Errorf("timeout = %v", err)
+		}
+
+		def = load("name: quiet\ndescription: x\ncommand: \"true\"\n")
+		if out, err := def.execute(map[string]interface{}{}, nil, nil); out != "(no output)" || err != nil {
+			t.Errorf("empty output = %q, %v", out, err)
+		}
+	})
+}
+
+func TestRegister(t *testing.T) {
+	dir := t.TempDir()
+	custom, _ := LoadFile(writeTool(t, dir, "a.yaml", "name: customtools_test_tool\ndescription: First\ncommand: echo 1\n"))
+	shadow, _ := LoadFile(writeTool(t, dir, "b.yaml", "name: read_file\ndescription: Shadow\ncommand: echo 2\n"))
+	defer delete(tools.Registry, "customtools_test_tool")
+
+	names, errs := Register([]*Definition{custom, shadow})
+	if len(names) != 1 || names[0] != "customtools_test_tool" || len(errs) != 1 || !strings.Contains(errs[0].Error(), `"read_file" is a built-in tool name`) {
+		t.Errorf("errors = %v", errs)
+	}
+	if reg, _ := tools.GetTool("read_file"); reg.Tool.Description == "Shadow" {
+		t.Error("built-in tool was replaced")
+	}
+
+	// Reloading replaces the custom tool
+	custom.Description = "Second"
+	if _, errs := Register([]*Definition{custom}); len(errs) != 0 {
+		t.Errorf("re-registering: %v", errs)
+	}
+	reg, err := tools.GetTool("customtools_test_tool")
+	if err != nil || reg.Tool.Description != "Second" {
+		t.Fatalf("registered tool = %+v, %v", reg, err)
+	}
+	if out, err := reg.Execute(map[string]interface{}{}, nil, nil); err != nil || out != "1\n" {
+		t.Errorf("execute = %q, %v", out, err)
+	}
+}
@@ -0,0 +1,216 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Event is one thing that happened while the agent worked. Each kind is its
+// own type, so handlers switch on it:
+//
+//	switch e := e.(type) {
+//	case agent.ToolCallEvent:
+//		fmt.Println(e.Display)
+//	case agent.TurnEndEvent:
+//		...
+//	}
+//
+// A turn produces, in order: TurnStartEvent, then for each API call
+// APIRequestEvent, UsageEvent (missing if the call failed), ThinkingDeltaEvent
+// and TextDeltaEvent for the response blocks, and ToolCallEvent/ToolResultEvent
+// for each tool it runs, and finally TurnEndEvent. UserMessageEvent,
+// AssistantMessageEvent, CompactionEvent, DiagnosticEvent and ErrorEvent
+// come in between as they happen.
+type Event interface {
+	// Meta returns the event's ID, time, turn and task.
+	Meta() EventMeta
+	withMeta(m EventMeta) Event
+}
+
+// EventMeta is what every event carries besides its data.
+type EventMeta struct {
+	// ID identifies the event within the agent's stream: "evt-1", "evt-2",
+	// ... in the order the events were emitted.
+	ID string
+	// Time is when the event was emitted.
+	Time time.Time
+	// Turn numbers the HandleMessage calls, from 1. Events emitted outside
+	// one (e.g. setup warnings from New) have 0.
+	Turn int
+	// TaskID is the tool_use_id of the task call whose sub-agent emitted the
+	// event, or empty for the agent's own events. See WithEventHandler.
+	TaskID string
+}
+
+// Meta returns the event's metadata.
+func (m EventMeta) Meta() EventMeta { return m }
+
+// TurnStartEvent starts a HandleMessage call.
+type TurnStartEvent struct {
+	EventMeta
+	Message string // The user's message, with secrets redacted
+}
+
+// APIRequestEvent is sent before each API call.
+type APIRequestEvent struct {
+	EventMeta
+	Model    string
+	Messages int // Messages in the history sent
+}
+
+// UsageEvent reports the token usage of an API response. Compaction's own
+// calls (summaries, tool result condensing) report theirs too, without an
+// APIRequestEvent.
+type UsageEvent struct {
+	EventMeta
+	Model string // Model that answered (sub-agents may use another)
+	Usage Usage
+}
+
+// ThinkingDeltaEvent carries thinking from a response. The API client does
+// not stream, so each delta is a whole thinking block.
+type ThinkingDeltaEvent struct {
+	EventMeta
+	Text      string
+	Signature string // Needed to send the block back to the API
+}
+
+// TextDeltaEvent carries text from a response, including text the model
+// writes before calling tools. Like ThinkingDeltaEvent, each delta is a
+// whole block.
+type TextDeltaEvent struct {
+	EventMeta
+	Text string
+}
+
+// ToolCallEvent is sent before a tool runs, after PreToolUse hooks.
+type ToolCallEvent struct {
+	EventMeta
+	ToolUseID string
+	Name      string
+	Input     map[string]interface{}
+	Display   string // Progress line, e.g. "→ Reading file: main.go" (may be empty)
+}
+
+// ToolResultEvent carries the result of a tool call, as sent to the model,
+// including calls that were denied or blocked.
+type ToolResultEvent struct {
+	EventMeta
+	ToolUseID string
+	Output    string
+	IsError   bool
+	Image     bool // The tool loaded an image; Output only describes it
+}
+
+// CompactionEvent reports compaction: a progress line in Message (e.g.
+// "🗜️ Compacting conversation history..."), then the handoff summary in
+// Summary once it is done.
+type CompactionEvent struct {
+	EventMeta
+	Message string
+	Summary string
+}
+
+// ErrorEvent reports an error the agent continued after (e.g. a failed
+// checkpoint or compaction). Errors that end a turn are in TurnEndEvent.
+type ErrorEvent struct {
+	EventMeta
+	Err error
+}
+
+// TurnEndEvent ends a HandleMessage call with what it returned.
+type TurnEndEvent struct {
+	EventMeta
+	Response   string
+	Err        error
+	StopReason string // Of the turn's last API response (e.g. "end_turn", "max_tokens"); empty if none
+}
+
+// UserMessageEvent is sent when user text is added to the history: the
+// message of a turn, messages queued during it, and Stop hook feedback.
+type UserMessageEvent struct {
+	EventMeta
+	Text string
+}
+
+// AssistantMessageEvent carries the model's final text for a turn (and the
+// text a Stop hook sent back).
+type AssistantMessageEvent struct {
+	EventMeta
+	Text string
+}
+
+// DiagnosticEvent carries diagnostic information, such as cache and token
+// statistics, hook runs and redactions. The caller decides what to show.
+type DiagnosticEvent struct {
+	EventMeta
+	Message string
+}
+
+func (e TurnStartEvent) withMeta(m EventMeta) Event        { e.EventMeta = m; return e }
+func (e APIRequestEvent) withMeta(m EventMeta) Event       { e.EventMeta = m; return e }
+func (e UsageEvent) withMeta(m EventMeta) Event            { e.EventMeta = m; return e }
+func (e ThinkingDeltaEvent) withMeta(m EventMeta) Event    { e.EventMeta = m; return e }
+func (e TextDeltaEvent) withMeta(m EventMeta) Event        { e.EventMeta = m; return e }
+func (e ToolCallEvent) withMeta(m EventMeta) Event         { e.EventMeta = m; return e }
+func (e ToolResultEvent) withMeta(m EventMeta) Event       { e.EventMeta = m; return e }
+func (e CompactionEvent) withMeta(m EventMeta) Event       { e.EventMeta = m; return e }
+func (e ErrorEvent) withMeta(m EventMeta) Event            { e.EventMeta = m; return e }
+func (e TurnEndEvent) withMeta(m EventMeta) Event          { e.EventMeta = m; return e }
+func (e UserMessageEvent) withMeta(m EventMeta) Event      { e.EventMeta = m; return e }
+func (e AssistantMessageEvent) withMeta(m EventMeta) Event { e.EventMeta = m; return e }
+func (e DiagnosticEvent) withMeta(m EventMeta) Event       { e.EventMeta = m; return e }
+
+// EventHandler receives the agent's events. Handlers run synchronously on
+// the goroutine that calls HandleMessage (or New, for setup warnings), in
+// the order they were added.
+type EventHandler func(e Event)
+
+// WithEventHandler adds a handler for every event the agent emits. The
+// With*Callback options for progress, output, thinking, diagnostics, the
+// spinner, errors, user and assistant messages, tool calls and compaction
+// are handlers too, each picking the events it needs.
+//
+// The events of sub-agents started by the task tool are passed on with
+// their TaskID set, so handlers that only want the agent's own skip events
+// with a TaskID. Their tool progress lines are nested under the task's
+// ("→ ↳ Reading file: ...").
+func WithEventHandler(h EventHandler) AgentOption {
+	return func(a *Agent) {
+		a.eventHandlers = append(a.eventHandlers, h)
+	}
+}
+
+// emit stamps e with the next ID, the time and the current turn, and passes
+// it to the handlers. TaskID is kept.
+func (a *Agent) emit(e Event) {
+	if len(a.eventHandlers) == 0 {
+		return
+	}
+	a.eventSeq++
+	m := e.Meta()
+	m.ID = fmt.Sprintf("evt-%d", a.eventSeq)
+	m.Time = time.Now()
+	m.Turn = a.turnSeq
+	e = e.withMeta(m)
+	for _, h := range a.eventHandlers {
+		h(e)
+	}
+}
+
+// forwardEvents passes the events of a sub-agent started by the task call
+// toolUseID on to a's handlers, marked with the task.
+func (a *Agent) forwardEvents(toolUseID string) EventHandler {
+	return func(e Event) {
+		m := e.Meta()
+		if m.TaskID == "" {
+			m.TaskID = toolUseID
+		}
+		if call, ok := e.(ToolCallEvent); ok && call.Display != "" {
+			call.Display = "→ ↳ " + strings.TrimPrefix(call.Display, "→ ")
+			e = call
+		}
+		a.emit(e.withMeta(m))
+	}
+}
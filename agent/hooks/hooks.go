@@ -0,0 +1,394 @@
+// Package hooks runs user scripts around the agent loop: before and after
+// each tool call, when a prompt is submitted, when the agent is about to
+// stop, and before compaction. Hooks can enforce team rules, such as
+// formatting every edited Go file, refusing `git push`, or logging every
+// command.
+//
+// Hooks are configured per project in <repo>/.clyde/hooks.json:
+//
+//	{
+//	  "PreToolUse": [
+//	    {"matcher": "run_bash", "command": "scripts/no-push.sh"}
+//	  ],
+//	  "PostToolUse": [
+//	    {"matcher": "write_file|patch_file", "command": "gofmt -w \"$(jq -r .tool_input.path)\"", "timeout": 30}
+//	  ]
+//	}
+//
+// Each hook is a bash command run from the repository root with the event
+// as JSON on stdin (see Input). Its exit code decides what happens:
+//
+//   - 0: success. If stdout is a JSON object it is read as an Output;
+//     otherwise stdout is only logged.
+//   - 2: block. stderr (or stdout) is the reason, which is passed back to
+//     the model.
+//   - anything else, or a timeout: the hook failed. The failure is logged
+//     and the agent carries on.
+//
+// Hooks run commands from the repository, so the agent only enables them
+// once the user has approved the file's current content (see package trust).
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+)
+
+// ConfigFile is the per-project hooks configuration, relative to the
+// repository root.
+const ConfigFile = ".clyde/hooks.json"
+
+// Events.
+const (
+	// PreToolUse runs before a tool call. It can block the call, approve
+	// it (skipping permission prompts), or replace its input.
+	PreToolUse = "PreToolUse"
+	// PostToolUse runs after a tool call with its output. It can add
+	// context to the result, or block to mark the result as an error.
+	PostToolUse = "PostToolUse"
+	// UserPromptSubmit runs before a user message is added to the
+	// conversation. It can block the message, replace it, or add context.
+	UserPromptSubmit = "UserPromptSubmit"
+	// Stop runs when the agent is about to return its final answer. Blocking
+	// sends the reason back to the model and the turn continues.
+	Stop = "Stop"
+	// PreCompact runs before the conversation is compacted. Blocking skips
+	// the compaction.
+	PreCompact = "PreCompact"
+)
+
+// Decisions a hook can return.
+const (
+	Approve = "approve"
+	Block   = "block"
+)
+
+// DefaultTimeout is how long a hook may run when it sets no timeout.
+const DefaultTimeout = 60 * time.Second
+
+// maxLogOutput caps the hook output quoted in a log line.
+const maxLogOutput = 2000
+
+// Hook is one configured command.
+type Hook struct {
+	// Matcher is a regular expression matched against the whole tool name
+	// (PreToolUse and PostToolUse only). Empty or "*" matches every tool.
+	Matcher string `json:"matcher,omitempty"`
+	// Command is run with bash -c.
+	Command string `json:"command"`
+	// Timeout in seconds (0 = DefaultTimeout).
+	Timeout int `json:"timeout,omitempty"`
+
+	matcher *regexp.Regexp
+}
+
+// Input is the JSON a hook receives on stdin. Fields that do not apply to
+// the event are omitted.
+type Input struct {
+	Event     string                 `json:"hook_event_name"`
+	Cwd       string                 `json:"cwd"`
+	ToolName  string                 `json:"tool_name,omitempty"`
+	ToolUseID string                 `json:"tool_use_id,omitempty"`
+	ToolInput map[string]interface{} `json:"tool_input,omitempty"`
+	// ToolOutput and IsError describe the result (PostToolUse).
+	ToolOutput string `json:"tool_output,omitempty"`
+	IsError    bool   `json:"is_error,omitempty"`
+	// Prompt is the user's message (UserPromptSubmit).
+	Prompt string `json:"prompt,omitempty"`
+	// Response is the final answer (Stop); StopHookActive is set when the
+	// turn is already continuing because a Stop hook blocked, so hooks can
+	// avoid looping forever.
+	Response       string `json:"response,omitempty"`
+	StopHookActive bool   `json:"stop_hook_active,omitempty"`
+	// Trigger says why compaction is running (PreCompact).
+	Trigger string `json:"trigger,omitempty"`
+}
+
+// Output is the JSON a hook may print on stdout.
+type Output struct {
+	// Decision is Approve, Block, or empty.
+	Decision string `json:"decision,omitempty"`
+	// Reason explains the decision; for Block it is passed to the model.
+	Reason string `json:"reason,omitempty"`
+	// ToolInput replaces the tool's input (PreToolUse).
+	ToolInput map[string]interface{} `json:"tool_input,omitempty"`
+	// Prompt replaces the user's message (UserPromptSubmit).
+	Prompt string `json:"prompt,omitempty"`
+	// AdditionalContext is added to the tool result (PostToolUse) or the
+	// user's message (UserPromptSubmit).
+	AdditionalContext string `json:"additional_context,omitempty"`
+}
+
+// Result combines the outputs of every hook that ran for an event.
+type Result struct {
+	// Decision is Block if any hook blocked (later hooks then do not run),
+	// else Approve if any hook approved, else empty.
+	Decision string
+	// Reason is the blocking hook's reason, or the approving hooks' reasons.
+	Reason string
+	// ToolInput is the replacement tool input (nil = unchanged). Each hook
+	// sees the input as changed by the hooks before it.
+	ToolInput map[string]interface{}
+	// Prompt is the replacement prompt ("" = unchanged).
+	Prompt string
+	// Context is the additional context of all hooks, one per line.
+	Context string
+	// Log has one line per hook run, for diagnostics and the session log.
+	Log []string
+}
+
+// Blocked reports whether a hook blocked the event.
+func (r Result) Blocked() bool {
+	return r.Decision == Block
+}
+
+// Hooks is a loaded configuration.
+type Hooks struct {
+	events map[string][]Hook
+	root   string
+	path   string // the file Load read, and its content
+	data   []byte
+}
+
+// Load reads the hooks configuration of the repository containing dir. It
+// returns nil (and no error) when the project has none.
+func Load(dir string) (*Hooks, error) {
+	root := ignore.New(dir).Root()
+	path := filepath.Join(root, filepath.FromSlash(ConfigFile))
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	h, err := Parse(data, root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	h.path, h.data = path, data
+	return h, nil
+}
+
+// Source returns the file the hooks were loaded from and its content, or
+// "" and nil for hooks built with Parse.
+func (h *Hooks) Source() (string, []byte) {
+	return h.path, h.data
+}
+
+// Commands describes each hook, e.g. "PreToolUse (run_bash): scripts/no-push.sh",
+// in event order.
+func (h *Hooks) Commands() []string {
+	var lines []string
+	for _, event := range []string{UserPromptSubmit, PreToolUse, PostToolUse, Stop, PreCompact} {
+		for _, hook := range h.events[event] {
+			name := event
+			if hook.Matcher != "" && hook.Matcher != "*" {
+				name += " (" + hook.Matcher + ")"
+			}
+			lines = append(lines, name+": "+hook.Command)
+		}
+	}
+	return lines
+}
+
+// Parse reads a hooks configuration. Hooks run in root.
+func Parse(data []byte, root string) (*Hooks, error) {
+	var events map[string][]Hook
+	if err := json.Unmarshal(data, &events); err != nil {
+		return nil, err
+	}
+	for event, list := range events {
+		switch event {
+		case PreToolUse, PostToolUse, UserPromptSubmit, Stop, PreCompact:
+		default:
+			return nil, fmt.Errorf("unknown event %q (expected %s, %s, %s, %s or %s)",
+				event, PreToolUse, PostToolUse, UserPromptSubmit, Stop, PreCompact)
+		}
+		for i := range list {
+			hook := &list[i]
+			if strings.TrimSpace(hook.Command) == "" {
+				return nil, fmt.Errorf("%s hook %d has no command", event, i+1)
+			}
+			if hook.Timeout < 0 {
+				return nil, fmt.Errorf("%s hook %d: timeout must not be negative", event, i+1)
+			}
+			if hook.Matcher != "" && hook.Matcher != "*" {
+				re, err := regexp.Compile("^(?:" + hook.Matcher + ")$")
+				if err != nil {
+					return nil, fmt.Errorf("%s hook %d: invalid matcher: %w", event, i+1, err)
+				}
+				hook.matcher = re
+			}
+		}
+	}
+	return &Hooks{events: events, root: root}, nil
+}
+
+// Count returns the number of configured hooks.
+func (h *Hooks) Count() int {
+	n := 0
+	for _, list := range h.events {
+		n += len(list)
+	}
+	return n
+}
+
+// Run runs the hooks for input.Event, in order, that match input.ToolName.
+func (h *Hooks) Run(input Input) Result {
+	var result Result
+	input.Cwd = h.root
+	var approvals []string
+	for _, hook := range h.events[input.Event] {
+		if hook.matcher != nil && !hook.matcher.MatchString(input.ToolName) {
+			continue
+		}
+		out, line := hook.run(input)
+		result.Log = append(result.Log, line)
+		if out == nil {
+			continue
+		}
+		if out.ToolInput != nil && input.Event == PreToolUse {
+			input.ToolInput = out.ToolInput
+			result.ToolInput = out.ToolInput
+		}
+		if out.Prompt != "" && input.Event == UserPromptSubmit {
+			input.Prompt = out.Prompt
+			result.Prompt = out.Prompt
+		}
+		if out.AdditionalContext != "" {
+			result.Context = strings.TrimPrefix(result.Context+"\n"+out.AdditionalContext, "\n")
+		}
+		switch out.Decision {
+		case Block:
+			result.Decision = Block
+			result.Reason = out.Reason
+			if result.Reason == "" {
+				result.Reason = "blocked by hook: " + hook.Command
+			}
+			return result
+		case Approve:
+			result.Decision = Approve
+			if out.Reason != "" {
+				approvals = append(approvals, out.Reason)
+			}
+		}
+	}
+	result.Reason = strings.Join(approvals, "; ")
+	return result
+}
+
+// run executes the hook and returns its output (nil if it failed or had
+// nothing to say) and a log line.
+func (hook Hook) run(input Input) (*Output, string) {
+	name := fmt.Sprintf("%s hook %q", input.Event, hook.Command)
+	if input.ToolName != "" {
+		name += " for " + input.ToolName
+	}
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Sprintf("%s failed: %v", name, err)
+	}
+
+	timeout := DefaultTimeout
+	if hook.Timeout > 0 {
+		timeout = time.Duration(hook.Timeout) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "bash", "-c", hook.Command)
+	cmd.Dir = input.Cwd
+	cmd.Env = append(os.Environ(), "CLYDE_PROJECT_DIR="+input.Cwd, "CLYDE_HOOK_EVENT="+input.Event)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+
+	outText := strings.TrimSpace(stdout.String())
+	errText := strings.TrimSpace(stderr.String())
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Sprintf("%s timed out after %s", name, timeout)
+	}
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Sprintf("%s failed: %v", name, err)
+		}
+		if exitErr.ExitCode() == 2 {
+			reason := errText
+			if reason == "" {
+				reason = outText
+			}
+			return &Output{Decision: Block, Reason: reason}, fmt.Sprintf("%s blocked: %s", name, quote(reason))
+		}
+		detail := errText
+		if detail == "" {
+			detail = outText
+		}
+		return nil, fmt.Sprintf("%s failed (exit %d): %s", name, exitErr.ExitCode(), quote(detail))
+	}
+
+	if strings.HasPrefix(outText, "{") {
+		var out Output
+		if err := json.Unmarshal([]byte(outText), &out); err != nil {
+			return nil, fmt.Sprintf("%s printed invalid JSON: %v", name, err)
+		}
+		if out.Decision != "" && out.Decision != Approve && out.Decision != Block {
+			return nil, fmt.Sprintf("%s returned unknown decision %q (expected %q or %q)", name, out.Decision, Approve, Block)
+		}
+		return &out, fmt.Sprintf("%s: %s", name, describe(out))
+	}
+	if outText == "" {
+		return nil, name + " ok"
+	}
+	return nil, fmt.Sprintf("%s: %s", name, quote(outText))
+}
+
+// describe summarizes a hook's JSON output for the log.
+func describe(out Output) string {
+	var parts []string
+	if out.Decision != "" {
+		part := "approved"
+		if out.Decision == Block {
+			part = "blocked"
+		}
+		if out.Reason != "" {
+			part += " (" + quote(out.Reason) + ")"
+		}
+		parts = append(parts, part)
+	}
+	if out.ToolInput != nil {
+		parts = append(parts, "replaced the tool input")
+	}
+	if out.Prompt != "" {
+		parts = append(parts, "replaced the prompt")
+	}
+	if out.AdditionalContext != "" {
+		parts = append(parts, "added context: "+quote(out.AdditionalContext))
+	}
+	if len(parts) == 0 {
+		return "ok"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// quote flattens hook output to one capped line.
+func quote(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxLogOutput {
+		s = s[:maxLogOutput] + "…"
+	}
+	return s
+}
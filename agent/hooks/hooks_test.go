@@ -0,0 +1,123 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parse(t *testing.T, config string) *Hooks {
+	t.Helper()
+	h, err := Parse([]byte(config), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, tc := range []struct{ config, want string }{
+		{`{"PreToolUse": [{"command": "true"}], "OnSave": []}`, `unknown event "OnSave"`},
+		{`{"Stop": [{"command": " "}]}`, "Stop hook 1 has no command"},
+		{`{"PreToolUse": [{"matcher": "(", "command": "true"}]}`, "invalid matcher"},
+		{`{"PreCompact": [{"command": "true", "timeout": -1}]}`, "timeout must not be negative"},
+		{`[]`, "cannot unmarshal"},
+	} {
+		if _, err := Parse([]byte(tc.config), "."); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Parse(%s) error = %v, want %q", tc.config, err, tc.want)
+		}
+	}
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	if h, err := Load(dir); h != nil || err != nil {
+		t.Errorf("Load without a config = %v, %v", h, err)
+	}
+	os.MkdirAll(filepath.Join(dir, ".clyde"), 0755)
+	os.WriteFile(filepath.Join(dir, ConfigFile), []byte(`{"Stop": [{"command": "true"}, {"command": "true"}]}`), 0644)
+	if h, err := Load(filepath.Join(dir, ".clyde")); err != nil || h.Count() != 2 || h.root != dir {
+		t.Errorf("Load = %v, %v", h, err)
+	}
+}
+
+func TestRun_ExitCodesAndOutput(t *testing.T) {
+	h := parse(t, `{
+	  "PreToolUse": [
+	    {"matcher": "run_bash", "command": "grep -q 'git push' && { echo 'pushing is not allowed' >&2; exit 2; }; exit 0"},
+	    {"matcher": "read_.*|list_files", "command": "echo '{\"decision\": \"approve\", \"reason\": \"reads are fine\"}'"},
+	    {"matcher": "write_file", "command": "echo '{\"tool_input\": {\"path\": \"safe.txt\", \"content\": \"x\"}}'"},
+	    {"matcher": "write_file", "command": "cat > \"$CLYDE_PROJECT_DIR/seen.json\"; echo logged"}
+	  ],
+	  "PostToolUse": [
+	    {"command": "echo oops >&2; exit 1"},
+	    {"command": "echo '{\"additional_context\": \"formatted\"}'"},
+	    {"command": "echo '{\"decision\": \"maybe\"}'"},
+	    {"command": "echo '{not json'"}
+	  ],
+	  "UserPromptSubmit": [
+	    {"command": "echo '{\"prompt\": \"rewritten\", \"additional_context\": \"branch: main\"}'"},
+	    {"command": "grep -q rewritten && echo '{\"additional_context\": \"saw rewrite\"}'"}
+	  ],
+	  "Stop": [{"command": "sleep 5", "timeout": 1}]
+	}`)
+
+	r := h.Run(Input{Event: PreToolUse, ToolName: "run_bash", ToolInput: map[string]interface{}{"command": "git push origin main"}})
+	if !r.Blocked() || r.Reason != "pushing is not allowed" {
+		t.Errorf("git push: %+v", r)
+	}
+	if len(r.Log) != 1 || r.Log[0] != `PreToolUse hook "grep -q 'git push' && { echo 'pushing is not allowed' >&2; exit 2; }; exit 0" for run_bash blocked: pushing is not allowed` {
+		t.Errorf("log = %q", r.Log)
+	}
+	if r := h.Run(Input{Event: PreToolUse, ToolName: "run_bash", ToolInput: map[string]interface{}{"command": "ls"}}); r.Decision != "" || len(r.Log) != 1 {
+		t.Errorf("ls: %+v", r)
+	}
+
+	r = h.Run(Input{Event: PreToolUse, ToolName: "read_file"})
+	if r.Decision != Approve || r.Reason != "reads are fine" {
+		t.Errorf("read_file: %+v", r)
+	}
+	if r := h.Run(Input{Event: PreToolUse, ToolName: "read_filex"}); r.Decision != Approve {
+		t.Errorf("matcher should use the regexp: %+v", r)
+	}
+	if r := h.Run(Input{Event: PreToolUse, ToolName: "xread_file"}); len(r.Log) != 0 {
+		t.Errorf("matcher should be anchored: %+v", r)
+	}
+
+	r = h.Run(Input{Event: PreToolUse, ToolName: "write_file", ToolUseID: "toolu_1", ToolInput: map[string]interface{}{"path": "/etc/passwd"}})
+	if r.ToolInput["path"] != "safe.txt" || r.Log[1] != `PreToolUse hook "cat > \"$CLYDE_PROJECT_DIR/seen.json\"; echo logged" for write_file: logged` {
+		t.Errorf("write_file: %+v", r)
+	}
+	seen, _ := os.ReadFile(filepath.Join(h.root, "seen.json"))
+	if want := `{"hook_event_name":"PreToolUse","cwd":"` + h.root + `","tool_name":"write_file","tool_use_id":"toolu_1","tool_input":{"content":"x","path":"safe.txt"}}`; string(seen) != want {
+		t.Errorf("second hook saw\n%s\nwant\n%s", seen, want)
+	}
+
+	r = h.Run(Input{Event: PostToolUse, ToolName: "write_file", ToolOutput: "ok"})
+	if r.Blocked() || r.Context != "formatted" {
+		t.Errorf("PostToolUse: %+v", r)
+	}
+	for i, want := range []string{
+		`failed (exit 1): oops`,
+		`added context: formatted`,
+		`returned unknown decision "maybe"`,
+		`printed invalid JSON`,
+	} {
+		if !strings.Contains(r.Log[i], want) {
+			t.Errorf("log[%d] = %q, want %q", i, r.Log[i], want)
+		}
+	}
+
+	r = h.Run(Input{Event: UserPromptSubmit, Prompt: "original"})
+	if r.Prompt != "rewritten" || r.Context != "branch: main\nsaw rewrite" {
+		t.Errorf("UserPromptSubmit: %+v", r)
+	}
+
+	r = h.Run(Input{Event: Stop, Response: "done"})
+	if r.Blocked() || len(r.Log) != 1 || !strings.Contains(r.Log[0], "timed out after 1s") {
+		t.Errorf("Stop: %+v", r)
+	}
+	if r := h.Run(Input{Event: PreCompact}); len(r.Log) != 0 {
+		t.Errorf("no PreCompact hooks configured: %+v", r)
+	}
+}
@@ -0,0 +1,308 @@
+// Package ignore decides which files the agent's search tools should skip.
+// It implements .gitignore semantics (also applied to .clydeignore files),
+// plus a fixed set of directories that are never worth searching: version
+// control metadata, dependency trees and clyde's own session data.
+//
+// A Matcher is rooted at the enclosing repository (the nearest ancestor with
+// a .git entry), so a search started in a subdirectory still honors the
+// repository's top-level ignore files. Nested ignore files are picked up by
+// Walk as it descends.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Files lists the ignore files read in every directory, in order; rules in
+// later files take precedence.
+var Files = []string{".gitignore", ".clydeignore"}
+
+// skipDirs are directory names skipped everywhere, regardless of ignore files.
+var skipDirs = map[string]bool{
+	".git":         true,
+	".hg":          true,
+	".svn":         true,
+	"node_modules": true,
+	"vendor":       true,
+	"__pycache__":  true,
+}
+
+// skipClydeDirs are subdirectories of .clyde holding agent state rather
+// than project files.
+var skipClydeDirs = map[string]bool{
+	"sessions":    true,
+	"checkpoints": true,
+}
+
+// AddToGitignore appends entry, under a "# comment" line, to the .gitignore
+// in repoRoot (creating it) unless the file already mentions it. Clyde uses
+// it for the state it keeps inside repositories.
+func AddToGitignore(repoRoot, entry, comment string) error {
+	gitignorePath := filepath.Join(repoRoot, ".gitignore")
+
+	// Read existing .gitignore
+	content, err := os.ReadFile(gitignorePath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read .gitignore: %w", err)
+	}
+
+	// Check if already present
+	if strings.Contains(string(content), entry) {
+		return nil // already there
+	}
+
+	// Append the entry
+	f, err := os.OpenFile(gitignorePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open .gitignore: %w", err)
+	}
+	defer f.Close()
+
+	// Ensure we start on a new line
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		if _, err := f.WriteString("\n"); err != nil {
+			return err
+		}
+	}
+
+	// Add comment and entry
+	_, err = f.WriteString("\n# " + comment + "\n" + entry + "\n")
+	return err
+}
+
+// rule is one line of an ignore file.
+type rule struct {
+	// base is the slash-separated directory of the ignore file, relative to
+	// the matcher root ("" for the root itself).
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// Matcher reports whether paths are ignored.
+type Matcher struct {
+	root   string
+	rules  []rule
+	loaded map[string]bool
+}
+
+// New returns a matcher for searches starting at dir. Ignore files are
+// loaded from the repository root down to dir.
+func New(dir string) *Matcher {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		abs = dir
+	}
+	if info, err := os.Stat(abs); err == nil && !info.IsDir() {
+		abs = filepath.Dir(abs)
+	}
+
+	root := abs
+	for d := abs; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			root = d
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+
+	m := &Matcher{root: root, loaded: make(map[string]bool)}
+	m.load(root)
+	if rel, err := filepath.Rel(root, abs); err == nil && rel != "." {
+		d := root
+		for _, part := range strings.Split(rel, string(filepath.Separator)) {
+			d = filepath.Join(d, part)
+			m.load(d)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(root, ".git", "info", "exclude")); err == nil {
+		m.rules = append(parseRules(string(data), ""), m.rules...)
+	}
+	return m
+}
+
+// Root returns the directory ignore rules are resolved against.
+func (m *Matcher) Root() string {
+	return m.root
+}
+
+// load reads the ignore files in dir, once.
+func (m *Matcher) load(dir string) {
+	if m.loaded[dir] {
+		return
+	}
+	m.loaded[dir] = true
+	rel, err := filepath.Rel(m.root, dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return
+	}
+	base := filepath.ToSlash(rel)
+	if base == "." {
+		base = ""
+	}
+	for _, name := range Files {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		m.rules = append(m.rules, parseRules(string(data), base)...)
+	}
+}
+
+// parseRules parses the contents of one ignore file located at base.
+func parseRules(data, base string) []rule {
+	var rules []rule
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Trailing spaces are ignored unless escaped.
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		r := rule{base: base}
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		r.pattern = line
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// Ignored reports whether path (absolute, or relative to the working
+// directory) is ignored. The last matching rule wins, as in git.
+func (m *Matcher) Ignored(p string, isDir bool) bool {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return false
+	}
+	if isDir && SkipDir(abs) {
+		return true
+	}
+	rel, err := filepath.Rel(m.root, abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	ignored := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			sub = rel[len(r.base)+1:]
+		}
+		target := sub
+		if !r.anchored {
+			target = path.Base(sub)
+		}
+		if Match(r.pattern, target) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// SkipDir reports whether a directory is always skipped: VCS metadata,
+// dependency trees (node_modules, vendor) and clyde's session and
+// checkpoint stores.
+func SkipDir(dir string) bool {
+	name := filepath.Base(dir)
+	if skipDirs[name] {
+		return true
+	}
+	return skipClydeDirs[name] && filepath.Base(filepath.Dir(dir)) == ".clyde"
+}
+
+// Walk walks the tree at root like filepath.WalkDir, skipping ignored files
+// and directories (unless m is nil) and loading nested ignore files on the
+// way down. The root itself is always visited.
+func Walk(root string, m *Matcher, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(p, d, err)
+		}
+		if p != root && m != nil && m.Ignored(p, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && m != nil {
+			if abs, err := filepath.Abs(p); err == nil {
+				m.load(abs)
+			}
+		}
+		return fn(p, d, nil)
+	})
+}
+
+// Match reports whether a slash-separated name matches a glob pattern in
+// which "*", "?" and "[...]" match within one path segment and "**" matches
+// any number of whole segments (including none).
+func Match(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse runs of "**" and try every split point.
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
@@ -0,0 +1,140 @@
+package ignore
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// ── helpers ──────────────────────────────────────────────────────────────
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// walked returns the files Walk visits under root, relative and sorted.
+func walked(t *testing.T, root string, m *Matcher) []string {
+	t.Helper()
+	var files []string
+	err := Walk(root, m, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(root, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// ── tests ────────────────────────────────────────────────────────────────
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"src/**/test/*.go", "src/test/x.go", true},
+		{"src/**/test/*.go", "src/a/b/test/x.go", true},
+		{"src/**/test/*.go", "src/a/b/test/sub/x.go", false},
+		{"build/**", "build/out/bin", true},
+		{"a/*/c", "a/b/c", true},
+		{"a/*/c", "a/b/x/c", false},
+		{"file?.txt", "file1.txt", true},
+		{"[abc].txt", "d.txt", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWalk_HonorsIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, ".git"), 0755)
+	write(t, filepath.Join(root, ".gitignore"), "*.log\n/build/\nsecret*\n!secret_ok.txt\n")
+	write(t, filepath.Join(root, ".clydeignore"), "fixtures/\n")
+	write(t, filepath.Join(root, "main.go"), "")
+	write(t, filepath.Join(root, "debug.log"), "")
+	write(t, filepath.Join(root, "build/out.bin"), "")
+	write(t, filepath.Join(root, "pkg/build/keep.go"), "") // /build/ is anchored to the root
+	write(t, filepath.Join(root, "secret.txt"), "")
+	write(t, filepath.Join(root, "secret_ok.txt"), "")
+	write(t, filepath.Join(root, "testdata/fixtures/big.json"), "")
+	write(t, filepath.Join(root, "node_modules/dep/index.js"), "")
+	write(t, filepath.Join(root, "vendor/x/y.go"), "")
+	write(t, filepath.Join(root, ".clyde/sessions/s1/a.md"), "")
+	write(t, filepath.Join(root, ".clyde/skills/s.md"), "")
+	// Nested ignore files apply below their directory only.
+	write(t, filepath.Join(root, "web/.gitignore"), "dist\n")
+	write(t, filepath.Join(root, "web/dist/app.js"), "")
+	write(t, filepath.Join(root, "dist/keep.txt"), "")
+
+	got := walked(t, root, New(root))
+	want := []string{
+		".clyde/skills/s.md",
+		".clydeignore",
+		".gitignore",
+		"dist/keep.txt",
+		"main.go",
+		"pkg/build/keep.go",
+		"secret_ok.txt",
+		"web/.gitignore",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("walked %v\nwant   %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("walked[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNew_SubdirectoryUsesRepositoryRules(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, ".git"), 0755)
+	write(t, filepath.Join(root, ".gitignore"), "*.gen.go\n")
+	write(t, filepath.Join(root, "pkg/api/types.gen.go"), "")
+	write(t, filepath.Join(root, "pkg/api/types.go"), "")
+
+	sub := filepath.Join(root, "pkg")
+	m := New(sub)
+	if m.Root() != root {
+		t.Errorf("Root() = %q, want %q", m.Root(), root)
+	}
+	got := walked(t, sub, m)
+	if len(got) != 1 || got[0] != "api/types.go" {
+		t.Errorf("walked %v, want [api/types.go]", got)
+	}
+}
+
+func TestWalk_NilMatcherVisitsEverything(t *testing.T) {
+	root := t.TempDir()
+	write(t, filepath.Join(root, ".gitignore"), "*.log\n")
+	write(t, filepath.Join(root, "a.log"), "")
+	write(t, filepath.Join(root, "node_modules/x.js"), "")
+
+	if got := walked(t, root, nil); len(got) != 3 {
+		t.Errorf("walked %v, want all 3 files", got)
+	}
+}
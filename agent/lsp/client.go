@@ -0,0 +1,308 @@
+// Package lsp is a minimal Language Server Protocol client. It lets the
+// agent ask a language server (gopls by default) for definitions,
+// references, hover information, symbols, renames and diagnostics instead
+// of navigating code with plain-text search.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client is a JSON-RPC 2.0 client for a language server running as a
+// subprocess. Unlike the MCP client, messages use LSP's Content-Length
+// framing and the server talks back on its own (diagnostics, progress,
+// configuration requests), so a background goroutine reads every message
+// and routes responses to their waiting callers.
+type Client struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	nextID int
+
+	writeMu sync.Mutex // serialises writes to stdin
+	mu      sync.Mutex // guards nextID, pending, readErr and onNotify
+	pending map[int]chan *message
+	readErr error
+	done    chan struct{}
+
+	// onNotify receives server notifications (e.g. publishDiagnostics).
+	onNotify func(method string, params json.RawMessage)
+}
+
+// NewClient spawns the language server subprocess in dir and starts reading
+// its output. The caller must call Close() when done.
+func NewClient(dir, command string, args ...string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("lsp: stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		stdin.Close()
+		return nil, fmt.Errorf("lsp: stdout pipe: %w", err)
+	}
+	// Language servers log to stderr; none of it is useful to the model.
+	cmd.Stderr = io.Discard
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("lsp: start %q: %w", command, err)
+	}
+
+	c := &Client{
+		cmd:     cmd,
+		stdin:   stdin,
+		nextID:  1,
+		pending: make(map[int]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(bufio.NewReaderSize(stdout, 64*1024))
+	return c, nil
+}
+
+// OnNotification sets the handler for server notifications. It must be set
+// before Initialize so no early diagnostics are missed.
+func (c *Client) OnNotification(fn func(method string, params json.RawMessage)) {
+	c.mu.Lock()
+	c.onNotify = fn
+	c.mu.Unlock()
+}
+
+// readLoop reads messages until the server exits, dispatching responses to
+// pending calls, answering server requests and forwarding notifications.
+func (c *Client) readLoop(r *bufio.Reader) {
+	tp := textproto.NewReader(r)
+	var err error
+	for {
+		var msg *message
+		msg, err = readMessage(tp, r)
+		if err != nil {
+			break
+		}
+		switch {
+		case msg.Method != "" && len(msg.ID) > 0:
+			c.answer(msg)
+		case msg.Method != "":
+			c.mu.Lock()
+			notify := c.onNotify
+			c.mu.Unlock()
+			if notify != nil {
+				notify(msg.Method, msg.Params)
+			}
+		default:
+			id, convErr := strconv.Atoi(string(msg.ID))
+			if convErr != nil {
+				continue
+			}
+			c.mu.Lock()
+			ch := c.pending[id]
+			delete(c.pending, id)
+			c.mu.Unlock()
+			if ch != nil {
+				ch <- msg
+			}
+		}
+	}
+
+	c.mu.Lock()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("lsp: server closed stdout")
+	}
+	c.readErr = err
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// readMessage reads one Content-Length framed message.
+func readMessage(tp *textproto.Reader, r *bufio.Reader) (*message, error) {
+	header, err := tp.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(header.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("lsp: bad Content-Length header %q", header.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("lsp: malformed message: %w", err)
+	}
+	return &msg, nil
+}
+
+// answer replies to a request sent by the server. Clients must answer every
+// request; the few servers commonly send get an empty success.
+func (c *Client) answer(req *message) {
+	resp := outgoing{JSONRPC: "2.0", ID: req.ID}
+	switch req.Method {
+	case "workspace/configuration":
+		// One (null) configuration value per requested item.
+		var params struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(req.Params, &params)
+		resp.Result = make([]interface{}, len(params.Items))
+	case "window/workDoneProgress/create", "client/registerCapability",
+		"client/unregisterCapability", "window/showMessageRequest":
+		resp.Result = json.RawMessage("null")
+	case "workspace/applyEdit":
+		// Edits are applied by the rename tool itself, never by the server.
+		resp.Result = map[string]interface{}{"applied": false}
+	default:
+		resp.Error = &RPCError{Code: codeMethodNotFound, Message: "method not supported: " + req.Method}
+	}
+	c.write(resp)
+}
+
+// write sends one framed message to the server's stdin.
+func (c *Client) write(msg outgoing) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("lsp: marshal %s: %w", msg.Method, err)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.stdin, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err = c.stdin.Write(data)
+	return err
+}
+
+// Call sends a request and decodes its result into result (which may be nil).
+func (c *Client) Call(ctx context.Context, method string, params, result interface{}) error {
+	c.mu.Lock()
+	if c.readErr != nil {
+		err := c.readErr
+		c.mu.Unlock()
+		return err
+	}
+	id := c.nextID
+	c.nextID++
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	err := c.write(outgoing{
+		JSONRPC: "2.0",
+		ID:      json.RawMessage(strconv.Itoa(id)),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		c.forget(id)
+		return fmt.Errorf("lsp: %s: %w", method, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		c.forget(id)
+		// Tell the server to stop working on it; the response is dropped.
+		c.Notify("$/cancelRequest", map[string]int{"id": id})
+		return fmt.Errorf("lsp: %s: %w", method, ctx.Err())
+	case <-c.done:
+		c.mu.Lock()
+		err := c.readErr
+		c.mu.Unlock()
+		return fmt.Errorf("lsp: %s: %w", method, err)
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("lsp: %s: %w", method, resp.Error)
+		}
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("lsp: unmarshal %s result: %w", method, err)
+		}
+		return nil
+	}
+}
+
+// forget drops a pending call whose response is no longer wanted.
+func (c *Client) forget(id int) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// Notify sends a JSON-RPC notification (no response expected).
+func (c *Client) Notify(method string, params interface{}) error {
+	return c.write(outgoing{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// Initialize performs the LSP initialize handshake for a workspace rooted at
+// rootURI. It offers UTF-8 positions; the result says what the server chose.
+func (c *Client) Initialize(ctx context.Context, rootURI string) (*InitializeResult, error) {
+	params := map[string]interface{}{
+		"processId":  nil,
+		"clientInfo": map[string]string{"name": "clyde", "version": "1.0.0"},
+		"rootUri":    rootURI,
+		"workspaceFolders": []map[string]string{
+			{"uri": rootURI, "name": "workspace"},
+		},
+		"capabilities": map[string]interface{}{
+			"general": map[string]interface{}{
+				"positionEncodings": []string{"utf-8", "utf-16"},
+			},
+			"textDocument": map[string]interface{}{
+				"synchronization":    map[string]interface{}{"didSave": true},
+				"hover":              map[string]interface{}{"contentFormat": []string{"plaintext", "markdown"}},
+				"definition":         map[string]interface{}{},
+				"references":         map[string]interface{}{},
+				"rename":             map[string]interface{}{},
+				"documentSymbol":     map[string]interface{}{"hierarchicalDocumentSymbolSupport": true},
+				"publishDiagnostics": map[string]interface{}{"versionSupport": true},
+			},
+			"workspace": map[string]interface{}{
+				"symbol":           map[string]interface{}{},
+				"workspaceFolders": true,
+				"configuration":    true,
+			},
+		},
+	}
+
+	var result InitializeResult
+	if err := c.Call(ctx, "initialize", params, &result); err != nil {
+		return nil, err
+	}
+	if err := c.Notify("initialized", map[string]interface{}{}); err != nil {
+		return nil, fmt.Errorf("lsp: initialized: %w", err)
+	}
+	return &result, nil
+}
+
+// Close asks the server to shut down, then kills it if it does not exit
+// promptly.
+func (c *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if c.Call(ctx, "shutdown", nil, nil) == nil {
+		c.Notify("exit", nil)
+	}
+	c.stdin.Close()
+
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+	}
+	if c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	return c.cmd.Wait()
+}
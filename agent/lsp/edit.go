@@ -0,0 +1,93 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+// fileEdits groups a workspace edit's text edits by local path.
+func fileEdits(edit *WorkspaceEdit) map[string][]TextEdit {
+	byPath := make(map[string][]TextEdit)
+	for uri, edits := range edit.Changes {
+		p := URIToPath(uri)
+		byPath[p] = append(byPath[p], edits...)
+	}
+	for _, dc := range edit.DocumentChanges {
+		p := URIToPath(dc.TextDocument.URI)
+		byPath[p] = append(byPath[p], dc.Edits...)
+	}
+	return byPath
+}
+
+// EditedPaths returns the files a workspace edit touches, sorted.
+func EditedPaths(edit *WorkspaceEdit) []string {
+	var paths []string
+	for p := range fileEdits(edit) {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// ApplyEdit writes a workspace edit to disk and tells the server about the
+// new contents. Every file is edited in memory first, so a bad edit leaves
+// all files untouched, and the files are then written as one transaction
+// (tools.CommitFileChanges): all of them or none, through symlinks. It
+// returns the number of edits applied per path.
+func (s *Server) ApplyEdit(ctx context.Context, edit *WorkspaceEdit) (map[string]int, error) {
+	byPath := fileEdits(edit)
+	paths := EditedPaths(edit)
+	var changes []tools.FileChange
+	counts := make(map[string]int)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot edit '%s': %w", path, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot edit '%s': %w", path, err)
+		}
+		text := string(data)
+
+		// Apply from the end so earlier offsets stay valid.
+		edits := byPath[path]
+		sort.SliceStable(edits, func(i, j int) bool {
+			a, b := edits[i].Range.Start, edits[j].Range.Start
+			if a.Line != b.Line {
+				return a.Line > b.Line
+			}
+			return a.Character > b.Character
+		})
+		prevStart := len(text) + 1
+		for _, e := range edits {
+			start := s.byteOffset(text, e.Range.Start)
+			end := s.byteOffset(text, e.Range.End)
+			if start > end || end > prevStart {
+				return nil, fmt.Errorf("server returned overlapping edits for '%s'; no files were modified", path)
+			}
+			text = text[:start] + e.NewText + text[end:]
+			prevStart = start
+		}
+		changes = append(changes, tools.FileChange{
+			Path:     path,
+			Content:  []byte(text),
+			Mode:     info.Mode().Perm(),
+			Existed:  true,
+			Original: data,
+		})
+		counts[path] = len(edits)
+	}
+
+	if err := tools.CommitFileChanges(changes); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		s.Sync(ctx, path)
+	}
+	return counts, nil
+}
@@ -0,0 +1,449 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+// The test binary doubles as a fake language server: with FAKE_LSP=1 set,
+// TestMain serves LSP on stdin/stdout instead of running tests.
+func TestMain(m *testing.M) {
+	if os.Getenv("FAKE_LSP") == "1" {
+		fakeServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// ── fake server ──────────────────────────────────────────────────────────
+
+var wordRe = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// fakeServer understands just enough Go-shaped text to answer each request
+// deterministically: "func name(" declares a function, identifiers are
+// words, and any line mentioning undefined_thing has a compile error.
+func fakeServer() {
+	r := bufio.NewReader(os.Stdin)
+	tp := textproto.NewReader(r)
+	docs := map[string]string{}
+
+	send := func(v interface{}) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(os.Stdout, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	}
+	reply := func(id json.RawMessage, result interface{}) {
+		send(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+	}
+	publish := func(uri string) {
+		diags := []Diagnostic{}
+		for i, line := range strings.Split(docs[uri], "\n") {
+			if col := strings.Index(line, "undefined_thing"); col >= 0 {
+				diags = append(diags, Diagnostic{
+					Range:    Range{Start: Position{i, col}, End: Position{i, col + 15}},
+					Severity: 1,
+					Message:  "undefined: undefined_thing",
+				})
+			}
+			if strings.Contains(line, "// hint") {
+				diags = append(diags, Diagnostic{Range: Range{Start: Position{i, 0}}, Severity: 4, Message: "a hint"})
+			}
+		}
+		send(map[string]interface{}{"jsonrpc": "2.0", "method": "textDocument/publishDiagnostics",
+			"params": PublishDiagnosticsParams{URI: uri, Diagnostics: diags}})
+	}
+	wordAt := func(uri string, pos Position) string {
+		lines := strings.Split(docs[uri], "\n")
+		if pos.Line >= len(lines) {
+			return ""
+		}
+		for _, loc := range wordRe.FindAllStringIndex(lines[pos.Line], -1) {
+			if loc[0] <= pos.Character && pos.Character < loc[1] {
+				return lines[pos.Line][loc[0]:loc[1]]
+			}
+		}
+		return ""
+	}
+	occurrences := func(uri, word string) []Location {
+		var locs []Location
+		for i, line := range strings.Split(docs[uri], "\n") {
+			for _, loc := range wordRe.FindAllStringIndex(line, -1) {
+				if line[loc[0]:loc[1]] == word {
+					locs = append(locs, Location{URI: uri, Range: Range{Start: Position{i, loc[0]}, End: Position{i, loc[1]}}})
+				}
+			}
+		}
+		return locs
+	}
+
+	for {
+		msg, err := readMessage(tp, r)
+		if err != nil {
+			return
+		}
+		var p struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+			Position       Position `json:"position"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+			Query   string `json:"query"`
+			NewName string `json:"newName"`
+		}
+		json.Unmarshal(msg.Params, &p)
+		uri := p.TextDocument.URI
+
+		switch msg.Method {
+		case "initialize":
+			reply(msg.ID, map[string]interface{}{
+				"capabilities": map[string]interface{}{"positionEncoding": "utf-8"},
+				"serverInfo":   map[string]string{"name": "fake-lsp"},
+			})
+		case "initialized":
+			// Servers send requests of their own; the client must answer.
+			send(map[string]interface{}{"jsonrpc": "2.0", "id": "srv-1", "method": "workspace/configuration",
+				"params": map[string]interface{}{"items": []interface{}{map[string]string{"section": "gopls"}}}})
+		case "textDocument/didOpen":
+			docs[uri] = p.TextDocument.Text
+			publish(uri)
+		case "textDocument/didChange":
+			docs[uri] = p.ContentChanges[len(p.ContentChanges)-1].Text
+			publish(uri)
+		case "textDocument/definition":
+			word := wordAt(uri, p.Position)
+			var result []Location
+			for i, line := range strings.Split(docs[uri], "\n") {
+				if col := strings.Index(line, "func "+word+"("); col >= 0 {
+					start := Position{i, col + 5}
+					result = append(result, Location{URI: uri, Range: Range{Start: start, End: Position{i, col + 5 + len(word)}}})
+				}
+			}
+			reply(msg.ID, result)
+		case "textDocument/references":
+			reply(msg.ID, occurrences(uri, wordAt(uri, p.Position)))
+		case "textDocument/hover":
+			if word := wordAt(uri, p.Position); word != "" {
+				reply(msg.ID, Hover{Contents: json.RawMessage(fmt.Sprintf(`{"kind":"markdown","value":"func %s() int"}`, word))})
+			} else {
+				reply(msg.ID, nil)
+			}
+		case "textDocument/documentSymbol":
+			var symbols []DocumentSymbol
+			for i, line := range strings.Split(docs[uri], "\n") {
+				if strings.HasPrefix(line, "func ") {
+					name := wordRe.FindString(line[5:])
+					symbols = append(symbols, DocumentSymbol{Name: name, Detail: "func()", Kind: 12,
+						Range: Range{Start: Position{i, 0}, End: Position{i + 2, 1}}})
+				}
+			}
+			reply(msg.ID, symbols)
+		case "workspace/symbol":
+			var symbols []SymbolInformation
+			for u, text := range docs {
+				for i, line := range strings.Split(text, "\n") {
+					if strings.HasPrefix(line, "func ") && strings.Contains(line, p.Query) {
+						symbols = append(symbols, SymbolInformation{Name: wordRe.FindString(line[5:]), Kind: 12,
+							ContainerName: "main", Location: Location{URI: u, Range: Range{Start: Position{i, 5}}}})
+					}
+				}
+			}
+			reply(msg.ID, symbols)
+		case "textDocument/rename":
+			var edits []TextEdit
+			for _, loc := range occurrences(uri, wordAt(uri, p.Position)) {
+				edits = append(edits, TextEdit{Range: loc.Range, NewText: p.NewName})
+			}
+			reply(msg.ID, WorkspaceEdit{Changes: map[string][]TextEdit{uri: edits}})
+		case "shutdown":
+			reply(msg.ID, nil)
+		case "exit":
+			return
+		default:
+			if len(msg.ID) > 0 && msg.Method != "" {
+				reply(msg.ID, nil)
+			}
+		}
+	}
+}
+
+// ── helpers ──────────────────────────────────────────────────────────────
+
+const sample = `package main
+
+func helper() int { return 1 }
+
+func main() {
+	helper()
+	_ = helper() + 2
+}
+`
+
+// startFake returns a Server backed by the fake server and a workspace
+// containing main.go.
+func startFake(t *testing.T) (*Server, string) {
+	t.Helper()
+	t.Setenv("FAKE_LSP", "1")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte(sample), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(exe, dir)
+	s.extensions = []string{".go"}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func call(t *testing.T, name string, input map[string]interface{}) (string, error) {
+	t.Helper()
+	reg, err := tools.GetTool(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.WritePaths != nil {
+		reg.WritePaths(input)
+	}
+	return reg.Execute(input, nil, nil)
+}
+
+// ── tests ────────────────────────────────────────────────────────────────
+
+func TestServer_Navigation(t *testing.T) {
+	s, path := startFake(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if s.IsRunning() {
+		t.Fatal("server should start lazily")
+	}
+	locs, err := s.Definition(ctx, path, 6, 2)
+	if err != nil {
+		t.Fatalf("Definition: %v", err)
+	}
+	if !s.IsRunning() {
+		t.Error("server should be running after first request")
+	}
+	if len(locs) != 1 || URIToPath(locs[0].URI) != path || locs[0].Range.Start != (Position{2, 5}) {
+		t.Errorf("Definition = %+v", locs)
+	}
+
+	refs, err := s.References(ctx, path, 3, 6)
+	if err != nil || len(refs) != 3 {
+		t.Errorf("References = %d, %v; want 3", len(refs), err)
+	}
+
+	hover, err := s.Hover(ctx, path, 6, 3)
+	if err != nil || hover != "func helper() int" {
+		t.Errorf("Hover = %q, %v", hover, err)
+	}
+}
+
+func TestTools(t *testing.T) {
+	s, path := startFake(t)
+	RegisterTools(s)
+
+	t.Run("Definition by symbol name", func(t *testing.T) {
+		got, err := call(t, "lsp_definition", map[string]interface{}{"path": path, "line": float64(6), "symbol": "helper"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, path+":3:6: func helper() int { return 1 }") {
+			t.Errorf("got:\n%s", got)
+		}
+	})
+
+	t.Run("References", func(t *testing.T) {
+		got, err := call(t, "lsp_references", map[string]interface{}{"path": path, "line": float64(3), "symbol": "helper"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "Found 3 references to 'helper'") || !strings.Contains(got, path+":7:6: _ = helper() + 2") {
+			t.Errorf("got:\n%s", got)
+		}
+	})
+
+	t.Run("Symbol missing from the line", func(t *testing.T) {
+		_, err := call(t, "lsp_hover", map[string]interface{}{"path": path, "line": float64(1), "symbol": "helper"})
+		if err == nil || !strings.Contains(err.Error(), "does not appear on line 1") {
+			t.Errorf("expected symbol error, got %v", err)
+		}
+	})
+
+	t.Run("Document and workspace symbols", func(t *testing.T) {
+		got, err := call(t, "lsp_document_symbols", map[string]interface{}{"path": path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "  function helper func() — line 3-5\n  function main func() — line 5-7\n") {
+			t.Errorf("got:\n%s", got)
+		}
+		got, err = call(t, "lsp_workspace_symbols", map[string]interface{}{"query": "help"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "function main.helper — "+path+":3") {
+			t.Errorf("got:\n%s", got)
+		}
+	})
+
+	t.Run("Read paths", func(t *testing.T) {
+		for _, name := range []string{"lsp_definition", "lsp_references", "lsp_hover", "lsp_document_symbols", "lsp_rename"} {
+			reg, _ := tools.GetTool(name)
+			if got := reg.ReadPaths(map[string]interface{}{"path": "/etc/passwd", "line": float64(1)}); len(got) != 1 || got[0] != "/etc/passwd" {
+				t.Errorf("%s read paths = %q", name, got)
+			}
+		}
+	})
+
+	t.Run("Rename edits the file", func(t *testing.T) {
+		input := map[string]interface{}{"path": path, "line": float64(3), "symbol": "helper", "new_name": "assist"}
+		reg, _ := tools.GetTool("lsp_rename")
+		if paths := reg.WritePaths(input); len(paths) != 1 || paths[0] != path {
+			t.Fatalf("WritePaths = %v, want [%s]", paths, path)
+		}
+		got, err := reg.Execute(input, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "3 edits in 1 files") {
+			t.Errorf("got:\n%s", got)
+		}
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), "helper") || strings.Count(string(data), "assist") != 3 {
+			t.Errorf("file after rename:\n%s", data)
+		}
+	})
+}
+
+func TestServer_ApplyEdit(t *testing.T) {
+	s, path := startFake(t)
+	dir := filepath.Dir(path)
+	real := filepath.Join(dir, "real.go")
+	link := filepath.Join(dir, "link.go")
+	os.WriteFile(real, []byte("package main\n\nvar x = helper()\n"), 0644)
+	if err := os.Symlink(real, link); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	rename := func(line, col int) TextEdit {
+		return TextEdit{Range: Range{Start: Position{line, col}, End: Position{line, col + 6}}, NewText: "assist"}
+	}
+
+	// An overlapping edit to one file leaves every file untouched
+	bad := &WorkspaceEdit{Changes: map[string][]TextEdit{
+		pathToURI(path): {rename(2, 5)},
+		pathToURI(link): {rename(2, 8), rename(2, 9)},
+	}}
+	if _, err := s.ApplyEdit(ctx, bad); err == nil || !strings.Contains(err.Error(), "no files were modified") {
+		t.Fatalf("expected overlapping edits to fail, got %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != sample {
+		t.Errorf("main.go changed by a failed edit:\n%s", data)
+	}
+
+	good := &WorkspaceEdit{Changes: map[string][]TextEdit{
+		pathToURI(path): {rename(2, 5)},
+		pathToURI(link): {rename(2, 8)},
+	}}
+	counts, err := s.ApplyEdit(ctx, good)
+	if err != nil || counts[path] != 1 || counts[link] != 1 {
+		t.Fatalf("ApplyEdit = %v, %v", counts, err)
+	}
+	if data, _ := os.ReadFile(real); string(data) != "package main\n\nvar x = assist()\n" {
+		t.Errorf("real.go after the edit:\n%s", data)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("link.go should still be a symlink: %v", err)
+	}
+}
+
+func TestServer_Diagnostics(t *testing.T) {
+	s, path := startFake(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	diags, err := s.Diagnostics(ctx, []string{path, filepath.Join(filepath.Dir(path), "README.md")}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.FormatDiagnostics(diags); !strings.HasSuffix(got, ": no errors or warnings.") {
+		t.Errorf("clean file: %q", got)
+	}
+
+	broken := strings.Replace(sample, "\thelper()\n", "\tundefined_thing() // hint\n", 1)
+	os.WriteFile(path, []byte(broken), 0644)
+	diags, err = s.Diagnostics(ctx, []string{path}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.FormatDiagnostics(diags)
+	if !strings.Contains(got, "reported 1 problems:\n  "+path+":6:2: error: undefined: undefined_thing") {
+		t.Errorf("broken file: %q", got)
+	}
+	if strings.Contains(got, "a hint") {
+		t.Errorf("hints should be omitted: %q", got)
+	}
+}
+
+func TestServer_MissingBinary(t *testing.T) {
+	s := NewServer("clyde-no-such-language-server", t.TempDir())
+	RegisterTools(s)
+	path := filepath.Join(t.TempDir(), "x.go")
+	os.WriteFile(path, []byte("package x\n"), 0644)
+
+	_, err := call(t, "lsp_hover", map[string]interface{}{"path": path, "line": float64(1), "column": float64(1)})
+	if err == nil || !strings.Contains(err.Error(), "is not available") || !strings.Contains(err.Error(), "Suggestions:") {
+		t.Errorf("expected actionable error, got %v", err)
+	}
+}
+
+func TestFindSymbol(t *testing.T) {
+	tests := []struct {
+		line, symbol string
+		want         int
+	}{
+		{"\thelper()", "helper", 2},
+		{"x := helpers + helper", "helper", 16}, // prefers the whole identifier
+		{"héllo := helper", "helper", 10},       // columns count characters
+		{"nothing here", "helper", 0},
+	}
+	for _, tt := range tests {
+		if got := findSymbol(tt.line, tt.symbol); got != tt.want {
+			t.Errorf("findSymbol(%q, %q) = %d, want %d", tt.line, tt.symbol, got, tt.want)
+		}
+	}
+}
+
+func TestColumnEncoding(t *testing.T) {
+	s := &Server{}
+	line := "s := \"😀\" + x"
+	// The emoji is one character but two UTF-16 units.
+	if got := s.encodeColumn(line, 12); got != 12 {
+		t.Errorf("utf-16 encodeColumn = %d, want 12", got)
+	}
+	if got := s.decodeColumn(line, 12); got != 12 {
+		t.Errorf("utf-16 decodeColumn = %d, want 12", got)
+	}
+	s.utf8 = true
+	if got := s.encodeColumn(line, 12); got != 14 {
+		t.Errorf("utf-8 encodeColumn = %d, want 14", got)
+	}
+}
@@ -0,0 +1,538 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+// maxLocations caps reference and symbol listings.
+const maxLocations = 200
+
+// positionProperties are the inputs shared by the position-based tools.
+func positionProperties() map[string]interface{} {
+	return map[string]interface{}{
+		"path": map[string]interface{}{
+			"type":        "string",
+			"description": "File containing the symbol.",
+		},
+		"line": map[string]interface{}{
+			"type":        "integer",
+			"description": "1-based line number of the symbol.",
+		},
+		"symbol": map[string]interface{}{
+			"type":        "string",
+			"description": "The identifier on that line (used to find the column). Example: 'NewServer'.",
+		},
+		"column": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional 1-based column instead of symbol.",
+		},
+	}
+}
+
+func positionTool(name, description string, extra map[string]interface{}, required ...string) providers.Tool {
+	props := positionProperties()
+	for k, v := range extra {
+		props[k] = v
+	}
+	return providers.Tool{
+		Name:        name,
+		Description: description,
+		InputSchema: map[string]interface{}{
+			"type":       "object",
+			"properties": props,
+			"required":   append([]string{"path", "line"}, required...),
+		},
+	}
+}
+
+var (
+	definitionTool = positionTool("lsp_definition",
+		"Go to definition using the language server: finds where the symbol at a position is declared, across packages and modules. More precise than grep for Go code.", nil)
+	referencesTool = positionTool("lsp_references",
+		"Find all references to the symbol at a position using the language server, including its declaration. Unlike grep, ignores unrelated identifiers with the same name.", nil)
+	hoverTool = positionTool("lsp_hover",
+		"Show the type signature and documentation of the symbol at a position using the language server.", nil)
+	renameTool = positionTool("lsp_rename",
+		"Rename the symbol at a position everywhere it is used, using the language server. Edits every affected file safely; prefer this over multi_patch for renaming identifiers.",
+		map[string]interface{}{
+			"new_name": map[string]interface{}{
+				"type":        "string",
+				"description": "The new identifier.",
+			},
+		}, "new_name")
+	documentSymbolsTool = providers.Tool{
+		Name:        "lsp_document_symbols",
+		Description: "List the symbols (types, functions, methods, fields, constants) declared in a file with their line numbers, using the language server. A cheap outline before reading a large file.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "The file to outline.",
+				},
+			},
+			"required": []string{"path"},
+		},
+	}
+	workspaceSymbolsTool = providers.Tool{
+		Name:        "lsp_workspace_symbols",
+		Description: "Search declarations across the whole workspace by name (fuzzy), using the language server. Example: 'NewServer', 'Handler'.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "Symbol name or fragment to search for.",
+				},
+			},
+			"required": []string{"query"},
+		},
+	}
+)
+
+// requestTimeout bounds a single tool call. The first call also pays for
+// the server loading the workspace.
+const requestTimeout = 60 * time.Second
+
+// RegisterTools registers the lsp_* tools into clyde's tool registry. Each
+// tool delegates to server, which is started lazily on the first call.
+func RegisterTools(server *Server) {
+	tools.Register(definitionTool, func(input map[string]interface{}, _ *providers.Client, _ []providers.Message) (string, error) {
+		ctx, cancel, path, line, col, err := positionInput(server, input)
+		if err != nil {
+			return "", err
+		}
+		defer cancel()
+		locs, err := server.Definition(ctx, path, line, col)
+		if err != nil {
+			return "", server.explain(err)
+		}
+		if len(locs) == 0 {
+			return fmt.Sprintf("No definition found for %s. Check the line and symbol, or use grep.", describePosition(input)), nil
+		}
+		return fmt.Sprintf("Definition of %s:\n\n%s", describePosition(input), server.formatLocations(locs)), nil
+	}, displayPosition("definition of"))
+
+	tools.Register(referencesTool, func(input map[string]interface{}, _ *providers.Client, _ []providers.Message) (string, error) {
+		ctx, cancel, path, line, col, err := positionInput(server, input)
+		if err != nil {
+			return "", err
+		}
+		defer cancel()
+		locs, err := server.References(ctx, path, line, col)
+		if err != nil {
+			return "", server.explain(err)
+		}
+		if len(locs) == 0 {
+			return fmt.Sprintf("No references found for %s.", describePosition(input)), nil
+		}
+		files := make(map[string]bool)
+		for _, l := range locs {
+			files[l.URI] = true
+		}
+		return fmt.Sprintf("Found %d references to %s in %d files:\n\n%s",
+			len(locs), describePosition(input), len(files), server.formatLocations(locs)), nil
+	}, displayPosition("references to"))
+
+	tools.Register(hoverTool, func(input map[string]interface{}, _ *providers.Client, _ []providers.Message) (string, error) {
+		ctx, cancel, path, line, col, err := positionInput(server, input)
+		if err != nil {
+			return "", err
+		}
+		defer cancel()
+		text, err := server.Hover(ctx, path, line, col)
+		if err != nil {
+			return "", server.explain(err)
+		}
+		if text == "" {
+			return fmt.Sprintf("No type information for %s.", describePosition(input)), nil
+		}
+		return text, nil
+	}, displayPosition("hover"))
+
+	tools.Register(documentSymbolsTool, func(input map[string]interface{}, _ *providers.Client, _ []providers.Message) (string, error) {
+		path, _ := input["path"].(string)
+		if path == "" {
+			return "", fmt.Errorf("path is required. Example: lsp_document_symbols(\"server.go\")")
+		}
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("file '%s' does not exist. Use glob or list_files to find it", path)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		symbols, err := server.DocumentSymbols(ctx, path)
+		if err != nil {
+			return "", server.explain(err)
+		}
+		if len(symbols) == 0 {
+			return fmt.Sprintf("No symbols found in %s.", path), nil
+		}
+		var out []string
+		out = append(out, fmt.Sprintf("Symbols in %s:", path), "")
+		writeSymbols(&out, symbols, 1)
+		return strings.Join(out, "\n") + "\n", nil
+	}, func(input map[string]interface{}) string {
+		path, _ := input["path"].(string)
+		return fmt.Sprintf("→ LSP: symbols in %s", path)
+	})
+
+	tools.Register(workspaceSymbolsTool, func(input map[string]interface{}, _ *providers.Client, _ []providers.Message) (string, error) {
+		query, _ := input["query"].(string)
+		if query == "" {
+			return "", fmt.Errorf("query is required. Example: lsp_workspace_symbols(\"NewServer\")")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		symbols, err := server.WorkspaceSymbols(ctx, query)
+		if err != nil {
+			return "", server.explain(err)
+		}
+		if len(symbols) == 0 {
+			return fmt.Sprintf("No symbols matching '%s' in the workspace.", query), nil
+		}
+		var out []string
+		out = append(out, fmt.Sprintf("Found %d symbols matching '%s':", len(symbols), query), "")
+		for i, sym := range symbols {
+			if i == maxLocations {
+				out = append(out, fmt.Sprintf("... %d more not shown (use a more specific query)", len(symbols)-maxLocations))
+				break
+			}
+			name := sym.Name
+			if sym.ContainerName != "" {
+				name = sym.ContainerName + "." + name
+			}
+			out = append(out, fmt.Sprintf("  %s %s — %s:%d", KindName(sym.Kind), name,
+				relPath(URIToPath(sym.Location.URI)), sym.Location.Range.Start.Line+1))
+		}
+		return strings.Join(out, "\n") + "\n", nil
+	}, func(input map[string]interface{}) string {
+		query, _ := input["query"].(string)
+		return fmt.Sprintf("→ LSP: workspace symbols '%s'", query)
+	})
+
+	// Renames are computed when the agent asks which files the call will
+	// write (so they can be checkpointed first) and applied on execution.
+	renames := &renameCache{edits: make(map[string]*WorkspaceEdit)}
+	tools.Register(renameTool, func(input map[string]interface{}, _ *providers.Client, _ []providers.Message) (string, error) {
+		newName, _ := input["new_name"].(string)
+		if newName == "" {
+			return "", fmt.Errorf("new_name is required. Example: lsp_rename(\"server.go\", 12, symbol: \"start\", new_name: \"launch\")")
+		}
+		edit, err := renames.take(server, input)
+		if err != nil {
+			return "", err
+		}
+		if len(EditedPaths(edit)) == 0 {
+			return "", fmt.Errorf("the language server found nothing to rename at %s", describePosition(input))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		counts, err := server.ApplyEdit(ctx, edit)
+		if err != nil {
+			return "", err
+		}
+		total := 0
+		for _, n := range counts {
+			total += n
+		}
+		var out []string
+		out = append(out, fmt.Sprintf("✓ Renamed %s to '%s': %d edits in %d files:", describePosition(input), newName, total, len(counts)))
+		for _, p := range EditedPaths(edit) {
+			out = append(out, fmt.Sprintf("  %s (%d edits)", relPath(p), counts[p]))
+		}
+		return strings.Join(out, "\n"), nil
+	}, func(input map[string]interface{}) string {
+		newName, _ := input["new_name"].(string)
+		return displayPosition("rename")(input) + " → " + newName
+	})
+	tools.RegisterWritePaths(renameTool.Name, func(input map[string]interface{}) []string {
+		edit, err := renames.prepare(server, input)
+		if err != nil {
+			return nil
+		}
+		return EditedPaths(edit)
+	})
+
+	// The file-based tools read their path (and the server the rest of the
+	// workspace, which it was started in)
+	for _, tool := range []providers.Tool{definitionTool, referencesTool, hoverTool, documentSymbolsTool, renameTool} {
+		tools.RegisterReadPaths(tool.Name, pathInput)
+	}
+}
+
+// pathInput returns the file a tool call reads.
+func pathInput(input map[string]interface{}) []string {
+	if path, ok := input["path"].(string); ok && path != "" {
+		return []string{path}
+	}
+	return nil
+}
+
+// renameCache holds rename edits computed for checkpointing until the tool
+// call that needs them runs.
+type renameCache struct {
+	mu    sync.Mutex
+	edits map[string]*WorkspaceEdit
+}
+
+func renameKey(input map[string]interface{}) string {
+	data, _ := json.Marshal(input)
+	return string(data)
+}
+
+// prepare asks the server for the rename edit and caches it.
+func (c *renameCache) prepare(server *Server, input map[string]interface{}) (*WorkspaceEdit, error) {
+	ctx, cancel, path, line, col, err := positionInput(server, input)
+	if err != nil {
+		return nil, err
+	}
+	defer cancel()
+	newName, _ := input["new_name"].(string)
+	if newName == "" {
+		return nil, fmt.Errorf("new_name is required")
+	}
+	edit, err := server.Rename(ctx, path, line, col, newName)
+	if err != nil {
+		return nil, server.explain(err)
+	}
+	c.mu.Lock()
+	c.edits[renameKey(input)] = edit
+	c.mu.Unlock()
+	return edit, nil
+}
+
+// take returns the cached edit for input, computing it if needed.
+func (c *renameCache) take(server *Server, input map[string]interface{}) (*WorkspaceEdit, error) {
+	key := renameKey(input)
+	c.mu.Lock()
+	edit := c.edits[key]
+	delete(c.edits, key)
+	c.mu.Unlock()
+	if edit != nil {
+		return edit, nil
+	}
+	return c.prepare(server, input)
+}
+
+// positionInput validates the shared path/line/symbol/column inputs and
+// resolves them to a 1-based line and character column.
+func positionInput(server *Server, input map[string]interface{}) (context.Context, context.CancelFunc, string, int, int, error) {
+	path, _ := input["path"].(string)
+	if path == "" {
+		return nil, nil, "", 0, 0, fmt.Errorf("path is required. Example: lsp_definition(\"main.go\", 42, symbol: \"run\")")
+	}
+	lineVal, ok := input["line"].(float64)
+	if !ok {
+		return nil, nil, "", 0, 0, fmt.Errorf("line is required (1-based). Use grep or read_file with line_numbers to find it")
+	}
+	line := int(lineVal)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, "", 0, 0, fmt.Errorf("file '%s' does not exist. Use glob or list_files to find it", path)
+	}
+	lines := strings.Split(string(data), "\n")
+	if line < 1 || line > len(lines) {
+		return nil, nil, "", 0, 0, fmt.Errorf("line %d is out of range: '%s' has %d lines", line, path, len(lines))
+	}
+	text := lines[line-1]
+
+	col := 0
+	if c, ok := input["column"].(float64); ok {
+		col = int(c)
+	}
+	if symbol, _ := input["symbol"].(string); symbol != "" && col == 0 {
+		col = findSymbol(text, symbol)
+		if col == 0 {
+			return nil, nil, "", 0, 0, fmt.Errorf("symbol '%s' does not appear on line %d of '%s':\n  %d | %s", symbol, line, path, line, strings.TrimRight(text, "\r"))
+		}
+	}
+	if col == 0 {
+		return nil, nil, "", 0, 0, fmt.Errorf("symbol or column is required to locate the identifier on line %d:\n  %d | %s", line, line, strings.TrimRight(text, "\r"))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	return ctx, cancel, path, line, col, nil
+}
+
+// findSymbol returns the 1-based character column of symbol on line,
+// preferring a whole-identifier match, or 0 if it does not appear.
+func findSymbol(line, symbol string) int {
+	isIdent := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	first := -1
+	for from := 0; ; {
+		i := strings.Index(line[from:], symbol)
+		if i < 0 {
+			break
+		}
+		i += from
+		if first < 0 {
+			first = i
+		}
+		before, _ := utf8.DecodeLastRuneInString(line[:i])
+		after, _ := utf8.DecodeRuneInString(line[i+len(symbol):])
+		if !isIdent(before) && !isIdent(after) {
+			first = i
+			break
+		}
+		from = i + 1
+	}
+	if first < 0 {
+		return 0
+	}
+	return len([]rune(line[:first])) + 1
+}
+
+// describePosition names a position for messages: "'Foo' (main.go:12)".
+func describePosition(input map[string]interface{}) string {
+	path, _ := input["path"].(string)
+	line, _ := input["line"].(float64)
+	if symbol, _ := input["symbol"].(string); symbol != "" {
+		return fmt.Sprintf("'%s' (%s:%d)", symbol, path, int(line))
+	}
+	col, _ := input["column"].(float64)
+	return fmt.Sprintf("%s:%d:%d", path, int(line), int(col))
+}
+
+func displayPosition(action string) tools.DisplayFunc {
+	return func(input map[string]interface{}) string {
+		return fmt.Sprintf("→ LSP: %s %s", action, describePosition(input))
+	}
+}
+
+// formatLocations renders locations as "path:line:col: source line".
+func (s *Server) formatLocations(locs []Location) string {
+	sort.SliceStable(locs, func(i, j int) bool {
+		if locs[i].URI != locs[j].URI {
+			return locs[i].URI < locs[j].URI
+		}
+		return locs[i].Range.Start.Line < locs[j].Range.Start.Line
+	})
+	files := make(map[string][]string)
+	var out []string
+	for i, l := range locs {
+		if i == maxLocations {
+			out = append(out, fmt.Sprintf("... %d more not shown", len(locs)-maxLocations))
+			break
+		}
+		path := URIToPath(l.URI)
+		lines, ok := files[path]
+		if !ok {
+			if data, err := os.ReadFile(path); err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			files[path] = lines
+		}
+		text := ""
+		col := l.Range.Start.Character + 1
+		if l.Range.Start.Line < len(lines) {
+			src := lines[l.Range.Start.Line]
+			col = s.decodeColumn(src, l.Range.Start.Character)
+			text = strings.TrimSpace(strings.TrimRight(src, "\r"))
+		}
+		out = append(out, fmt.Sprintf("  %s:%d:%d: %s", relPath(path), l.Range.Start.Line+1, col, text))
+	}
+	return strings.Join(out, "\n")
+}
+
+// writeSymbols renders a symbol outline, indenting children.
+func writeSymbols(out *[]string, symbols []DocumentSymbol, level int) {
+	for _, sym := range symbols {
+		line := fmt.Sprintf("%s%s %s", strings.Repeat("  ", level), KindName(sym.Kind), sym.Name)
+		if sym.Detail != "" {
+			line += " " + sym.Detail
+		}
+		if sym.ContainerName != "" {
+			line += " (in " + sym.ContainerName + ")"
+		}
+		line += fmt.Sprintf(" — line %d", sym.Range.Start.Line+1)
+		if sym.Range.End.Line > sym.Range.Start.Line {
+			line += fmt.Sprintf("-%d", sym.Range.End.Line+1)
+		}
+		*out = append(*out, line)
+		writeSymbols(out, sym.Children, level+1)
+	}
+}
+
+// explain turns a server start failure into actionable suggestions.
+func (s *Server) explain(err error) error {
+	if s.startErr == nil {
+		return err
+	}
+	return fmt.Errorf("%s", strings.Join([]string{
+		fmt.Sprintf("language server '%s' is not available: %v", s.command, err),
+		"",
+		"Suggestions:",
+		"  - Install it (for gopls: go install golang.org/x/tools/gopls@latest)",
+		"  - Set LSP_COMMAND to a different server, or LSP_COMMAND=off to disable the lsp_* tools",
+		"  - Fall back to grep and read_file for now",
+	}, "\n"))
+}
+
+// FormatDiagnostics renders the errors and warnings from Diagnostics for a
+// tool result, or a one-line all-clear. Informational hints are omitted.
+func (s *Server) FormatDiagnostics(diags map[string][]Diagnostic) string {
+	var paths []string
+	for p := range diags {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	const perFile = 20
+	var out []string
+	problems := 0
+	for _, p := range paths {
+		items := diags[p]
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Range.Start.Line < items[j].Range.Start.Line })
+		shown := 0
+		for _, d := range items {
+			if d.Severity > 2 {
+				continue
+			}
+			problems++
+			if shown == perFile {
+				continue
+			}
+			shown++
+			severity := severityNames[d.Severity]
+			if severity == "" {
+				severity = "error"
+			}
+			out = append(out, fmt.Sprintf("  %s:%d:%d: %s: %s", relPath(p), d.Range.Start.Line+1, d.Range.Start.Character+1, severity, d.Message))
+		}
+	}
+	name := filepath.Base(s.command)
+	if problems == 0 {
+		return fmt.Sprintf("%s: no errors or warnings.", name)
+	}
+	header := fmt.Sprintf("%s reported %d problems:", name, problems)
+	if len(out) < problems {
+		out = append(out, fmt.Sprintf("  ... %d more not shown", problems-len(out)))
+	}
+	return header + "\n" + strings.Join(out, "\n")
+}
+
+// relPath shortens path relative to the working directory when it is
+// inside it.
+func relPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
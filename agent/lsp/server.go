@@ -0,0 +1,621 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// DefaultCommand is the language server used when none is configured.
+const DefaultCommand = "gopls"
+
+// languageIDs maps file extensions to LSP language identifiers. A server
+// only receives files whose extension it was configured for.
+var languageIDs = map[string]string{
+	".go":   "go",
+	".mod":  "go.mod",
+	".py":   "python",
+	".ts":   "typescript",
+	".tsx":  "typescriptreact",
+	".js":   "javascript",
+	".jsx":  "javascriptreact",
+	".rs":   "rust",
+	".c":    "c",
+	".h":    "c",
+	".cpp":  "cpp",
+	".java": "java",
+	".rb":   "ruby",
+}
+
+// defaultExtensions lists the file types each well-known server handles.
+var defaultExtensions = map[string][]string{
+	"gopls":                      {".go"},
+	"pyright-langserver":         {".py"},
+	"pylsp":                      {".py"},
+	"typescript-language-server": {".ts", ".tsx", ".js", ".jsx"},
+	"rust-analyzer":              {".rs"},
+	"clangd":                     {".c", ".h", ".cpp"},
+}
+
+// document is a file the server has been told about.
+type document struct {
+	version int
+	text    string
+}
+
+// diagnosticSet is the latest diagnostics published for one document.
+type diagnosticSet struct {
+	seq   int // incremented on every publish, to detect fresh results
+	items []Diagnostic
+}
+
+// Server manages the lifecycle of a language server subprocess. It starts
+// lazily on first use, keeps the server's view of files in sync with disk
+// and collects the diagnostics it publishes.
+type Server struct {
+	command    string
+	args       []string
+	root       string
+	extensions []string
+
+	client   *Client // nil until EnsureRunning
+	once     sync.Once
+	startErr error
+	utf8     bool // positions are UTF-8 byte offsets rather than UTF-16 units
+
+	mu     sync.Mutex // guards docs, diags and closed
+	docs   map[string]*document
+	diags  map[string]*diagnosticSet
+	update chan struct{} // closed and replaced on every publish
+	closed bool
+}
+
+// NewServer creates a manager for the language server started by command
+// (e.g. "gopls", or "pyright-langserver --stdio") for the workspace at root.
+// The server is NOT started until EnsureRunning is called.
+func NewServer(command, root string) *Server {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		fields = []string{DefaultCommand}
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	exts := defaultExtensions[filepath.Base(fields[0])]
+	if exts == nil {
+		exts = []string{".go"}
+	}
+	return &Server{
+		command:    fields[0],
+		args:       fields[1:],
+		root:       root,
+		extensions: exts,
+		docs:       make(map[string]*document),
+		diags:      make(map[string]*diagnosticSet),
+		update:     make(chan struct{}),
+	}
+}
+
+// Command returns the executable the server runs.
+func (s *Server) Command() string {
+	return s.command
+}
+
+// Handles reports whether path is a file type this server understands.
+func (s *Server) Handles(path string) bool {
+	ext := filepath.Ext(path)
+	for _, e := range s.extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// EnsureRunning starts the server if it hasn't been started yet. Only the
+// first call starts it; later calls return the same result immediately.
+func (s *Server) EnsureRunning(ctx context.Context) error {
+	s.once.Do(func() {
+		s.startErr = s.start(ctx)
+	})
+	return s.startErr
+}
+
+// start launches the subprocess and performs the initialize handshake.
+func (s *Server) start(ctx context.Context) error {
+	startCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	client, err := NewClient(s.root, s.command, s.args...)
+	if err != nil {
+		return err
+	}
+	client.OnNotification(s.handleNotification)
+
+	result, err := client.Initialize(startCtx, pathToURI(s.root))
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("lsp: initialize %s: %w", s.command, err)
+	}
+	s.utf8 = result.Capabilities.PositionEncoding == "utf-8"
+	s.client = client
+	return nil
+}
+
+// handleNotification records published diagnostics.
+func (s *Server) handleNotification(method string, params json.RawMessage) {
+	if method != "textDocument/publishDiagnostics" {
+		return
+	}
+	var p PublishDiagnosticsParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return
+	}
+	s.mu.Lock()
+	set := s.diags[p.URI]
+	if set == nil {
+		set = &diagnosticSet{}
+		s.diags[p.URI] = set
+	}
+	set.seq++
+	set.items = p.Diagnostics
+	close(s.update)
+	s.update = make(chan struct{})
+	s.mu.Unlock()
+}
+
+// IsRunning returns true if the server has been started and not yet closed.
+func (s *Server) IsRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.client != nil && !s.closed
+}
+
+// Close shuts the server down. It is safe to call multiple times.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed || s.client == nil {
+		s.closed = true
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	s.client.Close()
+	return nil
+}
+
+// ready starts the server if needed and returns its client.
+func (s *Server) ready(ctx context.Context) (*Client, error) {
+	if err := s.EnsureRunning(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return nil, fmt.Errorf("lsp: server has been closed")
+	}
+	return s.client, nil
+}
+
+// Sync tells the server about the current contents of path: didOpen the
+// first time, didChange whenever the file changed on disk since. It returns
+// the file's text.
+func (s *Server) Sync(ctx context.Context, path string) (string, error) {
+	text, _, err := s.sync(ctx, path)
+	return text, err
+}
+
+// sync is Sync, also reporting whether the server was sent anything.
+func (s *Server) sync(ctx context.Context, path string) (string, bool, error) {
+	client, err := s.ready(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false, err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", false, err
+	}
+	text := string(data)
+	uri := pathToURI(abs)
+
+	s.mu.Lock()
+	doc := s.docs[uri]
+	if doc != nil && doc.text == text {
+		s.mu.Unlock()
+		return text, false, nil
+	}
+	if doc == nil {
+		doc = &document{}
+		s.docs[uri] = doc
+	}
+	doc.version++
+	doc.text = text
+	version := doc.version
+	s.mu.Unlock()
+
+	if version == 1 {
+		lang := languageIDs[filepath.Ext(abs)]
+		if lang == "" {
+			lang = strings.TrimPrefix(filepath.Ext(abs), ".")
+		}
+		err = client.Notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": TextDocumentItem{URI: uri, LanguageID: lang, Version: version, Text: text},
+		})
+	} else {
+		err = client.Notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+			"contentChanges": []map[string]string{{"text": text}},
+		})
+	}
+	return text, true, err
+}
+
+// positionParams syncs path and converts a 1-based line and character
+// column into request parameters.
+func (s *Server) positionParams(ctx context.Context, path string, line, col int) (TextDocumentPositionParams, error) {
+	text, err := s.Sync(ctx, path)
+	if err != nil {
+		return TextDocumentPositionParams{}, err
+	}
+	abs, _ := filepath.Abs(path)
+	lines := strings.Split(text, "\n")
+	if line < 1 || line > len(lines) {
+		return TextDocumentPositionParams{}, fmt.Errorf("line %d is out of range: '%s' has %d lines", line, path, len(lines))
+	}
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: pathToURI(abs)},
+		Position:     Position{Line: line - 1, Character: s.encodeColumn(lines[line-1], col)},
+	}, nil
+}
+
+// Definition returns where the symbol at a position is defined.
+func (s *Server) Definition(ctx context.Context, path string, line, col int) ([]Location, error) {
+	params, err := s.positionParams(ctx, path, line, col)
+	if err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := s.client.Call(ctx, "textDocument/definition", params, &raw); err != nil {
+		return nil, err
+	}
+	return decodeLocations(raw)
+}
+
+// References returns every use of the symbol at a position, including its
+// declaration.
+func (s *Server) References(ctx context.Context, path string, line, col int) ([]Location, error) {
+	params, err := s.positionParams(ctx, path, line, col)
+	if err != nil {
+		return nil, err
+	}
+	req := map[string]interface{}{
+		"textDocument": params.TextDocument,
+		"position":     params.Position,
+		"context":      map[string]bool{"includeDeclaration": true},
+	}
+	var locs []Location
+	if err := s.client.Call(ctx, "textDocument/references", req, &locs); err != nil {
+		return nil, err
+	}
+	return locs, nil
+}
+
+// Hover returns the type and documentation of the symbol at a position as
+// plain text ("" if the server has nothing to say).
+func (s *Server) Hover(ctx context.Context, path string, line, col int) (string, error) {
+	params, err := s.positionParams(ctx, path, line, col)
+	if err != nil {
+		return "", err
+	}
+	var hover *Hover
+	if err := s.client.Call(ctx, "textDocument/hover", params, &hover); err != nil {
+		return "", err
+	}
+	if hover == nil {
+		return "", nil
+	}
+	return hoverText(hover.Contents), nil
+}
+
+// DocumentSymbols returns the symbol outline of a file.
+func (s *Server) DocumentSymbols(ctx context.Context, path string) ([]DocumentSymbol, error) {
+	if _, err := s.Sync(ctx, path); err != nil {
+		return nil, err
+	}
+	abs, _ := filepath.Abs(path)
+	var symbols []DocumentSymbol
+	params := map[string]interface{}{"textDocument": TextDocumentIdentifier{URI: pathToURI(abs)}}
+	if err := s.client.Call(ctx, "textDocument/documentSymbol", params, &symbols); err != nil {
+		return nil, err
+	}
+	// Flat SymbolInformation results carry a location instead of a range.
+	for i := range symbols {
+		if symbols[i].Location != nil {
+			symbols[i].Range = symbols[i].Location.Range
+		}
+	}
+	return symbols, nil
+}
+
+// WorkspaceSymbols searches symbols across the workspace.
+func (s *Server) WorkspaceSymbols(ctx context.Context, query string) ([]SymbolInformation, error) {
+	client, err := s.ready(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var symbols []SymbolInformation
+	if err := client.Call(ctx, "workspace/symbol", map[string]string{"query": query}, &symbols); err != nil {
+		return nil, err
+	}
+	return symbols, nil
+}
+
+// Rename computes the edits that rename the symbol at a position. The
+// edits are returned, not applied; see ApplyEdit.
+func (s *Server) Rename(ctx context.Context, path string, line, col int, newName string) (*WorkspaceEdit, error) {
+	params, err := s.positionParams(ctx, path, line, col)
+	if err != nil {
+		return nil, err
+	}
+	req := map[string]interface{}{
+		"textDocument": params.TextDocument,
+		"position":     params.Position,
+		"newName":      newName,
+	}
+	var edit *WorkspaceEdit
+	if err := s.client.Call(ctx, "textDocument/rename", req, &edit); err != nil {
+		return nil, err
+	}
+	if edit == nil {
+		return &WorkspaceEdit{}, nil
+	}
+	return edit, nil
+}
+
+// Diagnostics syncs the given files and waits (up to timeout) for the
+// server to publish fresh diagnostics for them. Files the server does not
+// handle are ignored. The result maps each path to its diagnostics.
+func (s *Server) Diagnostics(ctx context.Context, paths []string, timeout time.Duration) (map[string][]Diagnostic, error) {
+	type pending struct {
+		path, uri string
+		seq       int
+	}
+	var waiting []pending
+	for _, p := range paths {
+		if !s.Handles(p) {
+			continue
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		uri := pathToURI(abs)
+		s.mu.Lock()
+		seq := 0
+		if set := s.diags[uri]; set != nil {
+			seq = set.seq
+		}
+		s.mu.Unlock()
+		_, changed, err := s.sync(ctx, abs)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			// Nothing new to analyze: the last published set is current.
+			seq = -1
+		}
+		waiting = append(waiting, pending{path: p, uri: uri, seq: seq})
+	}
+	if len(waiting) == 0 {
+		return nil, nil
+	}
+
+	// Wait until every file has a publish newer than its sync, then linger
+	// briefly: servers often publish parse errors first and type errors a
+	// moment later.
+	deadline := time.After(timeout)
+	const settle = 300 * time.Millisecond
+	var quiet <-chan time.Time
+	for {
+		s.mu.Lock()
+		fresh := true
+		for _, w := range waiting {
+			if w.seq < 0 {
+				continue
+			}
+			if set := s.diags[w.uri]; set == nil || set.seq <= w.seq {
+				fresh = false
+			}
+		}
+		update := s.update
+		s.mu.Unlock()
+		if fresh && quiet == nil {
+			quiet = time.After(settle)
+		}
+
+		select {
+		case <-update:
+			if quiet != nil {
+				quiet = time.After(settle)
+			}
+			continue
+		case <-quiet:
+		case <-deadline:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		break
+	}
+
+	result := make(map[string][]Diagnostic)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, w := range waiting {
+		if set := s.diags[w.uri]; set != nil {
+			result[w.path] = set.items
+		}
+	}
+	return result, nil
+}
+
+// --- positions and URIs ---
+
+// encodeColumn converts a 1-based character column on line into the
+// server's zero-based position encoding.
+func (s *Server) encodeColumn(line string, col int) int {
+	if col < 1 {
+		col = 1
+	}
+	prefix := line
+	n := 0
+	for i := range line {
+		if n == col-1 {
+			prefix = line[:i]
+			break
+		}
+		n++
+	}
+	if s.utf8 {
+		return len(prefix)
+	}
+	return len(utf16.Encode([]rune(prefix)))
+}
+
+// decodeColumn converts a zero-based position character on line into a
+// 1-based character column.
+func (s *Server) decodeColumn(line string, char int) int {
+	if s.utf8 {
+		if char > len(line) {
+			char = len(line)
+		}
+		return utf8.RuneCountInString(line[:char]) + 1
+	}
+	units := 0
+	col := 1
+	for _, r := range line {
+		if units >= char {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+		col++
+	}
+	return col
+}
+
+// byteOffset converts a position into a byte offset in text.
+func (s *Server) byteOffset(text string, pos Position) int {
+	offset := 0
+	for i := 0; i < pos.Line; i++ {
+		nl := strings.IndexByte(text[offset:], '\n')
+		if nl < 0 {
+			return len(text)
+		}
+		offset += nl + 1
+	}
+	line := text[offset:]
+	if nl := strings.IndexByte(line, '\n'); nl >= 0 {
+		line = line[:nl]
+	}
+	col := s.decodeColumn(line, pos.Character)
+	n := 1
+	for i := range line {
+		if n == col {
+			return offset + i
+		}
+		n++
+	}
+	return offset + len(line)
+}
+
+// pathToURI converts an absolute path to a file:// URI.
+func pathToURI(path string) string {
+	path = filepath.ToSlash(path)
+	if runtime.GOOS == "windows" {
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
+
+// URIToPath converts a file:// URI back to a local path.
+func URIToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path)
+}
+
+// decodeLocations accepts the shapes textDocument/definition may return:
+// a Location, a list of Locations, or a list of LocationLinks.
+func decodeLocations(raw json.RawMessage) ([]Location, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '{' {
+		var loc Location
+		if err := json.Unmarshal(raw, &loc); err != nil {
+			return nil, err
+		}
+		return []Location{loc}, nil
+	}
+	var items []struct {
+		Location
+		TargetURI            string `json:"targetUri"`
+		TargetSelectionRange *Range `json:"targetSelectionRange"`
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	var locs []Location
+	for _, it := range items {
+		if it.TargetURI != "" && it.TargetSelectionRange != nil {
+			locs = append(locs, Location{URI: it.TargetURI, Range: *it.TargetSelectionRange})
+			continue
+		}
+		locs = append(locs, it.Location)
+	}
+	return locs, nil
+}
+
+// hoverText flattens hover contents (MarkupContent, MarkedString or a list
+// of them) into plain text.
+func hoverText(raw json.RawMessage) string {
+	var markup MarkupContent
+	if json.Unmarshal(raw, &markup) == nil && markup.Value != "" {
+		return strings.TrimSpace(markup.Value)
+	}
+	var plain string
+	if json.Unmarshal(raw, &plain) == nil {
+		return strings.TrimSpace(plain)
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		var parts []string
+		for _, item := range list {
+			if text := hoverText(item); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package lsp
+
+import "encoding/json"
+
+// --- JSON-RPC 2.0 framing ---
+
+// message is any JSON-RPC 2.0 message: a request (ID and Method), a
+// notification (Method only) or a response (ID and Result or Error). Servers
+// send all three, so the client decodes into one shape and dispatches.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// outgoing is a request, notification or response written by the client.
+type outgoing struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError is a JSON-RPC 2.0 error object.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string { return e.Message }
+
+// codeMethodNotFound answers server requests the client does not implement.
+const codeMethodNotFound = -32601
+
+// --- LSP protocol types (the subset clyde uses) ---
+
+// Position is a zero-based line and character offset. Characters are counted
+// in the encoding negotiated at initialize (UTF-16 unless the server accepts
+// UTF-8).
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a half-open span between two positions.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location is a range inside a document.
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// TextDocumentIdentifier names a document by URI.
+type TextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// TextDocumentItem is an opened document with its full text.
+type TextDocumentItem struct {
+	URI        string `json:"uri"`
+	LanguageID string `json:"languageId"`
+	Version    int    `json:"version"`
+	Text       string `json:"text"`
+}
+
+// TextDocumentPositionParams identifies a position in a document.
+type TextDocumentPositionParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// TextEdit replaces a range of a document with new text.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// TextDocumentEdit is a set of edits to one document version.
+type TextDocumentEdit struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Edits        []TextEdit             `json:"edits"`
+}
+
+// WorkspaceEdit is the result of a rename: edits across documents, either
+// as a URI-keyed map or as a list of document edits.
+type WorkspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes,omitempty"`
+	DocumentChanges []TextDocumentEdit    `json:"documentChanges,omitempty"`
+}
+
+// MarkupContent is formatted hover text.
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Hover is the result of textDocument/hover. Contents is kept raw because
+// servers may send MarkupContent, a MarkedString or an array of them.
+type Hover struct {
+	Contents json.RawMessage `json:"contents"`
+	Range    *Range          `json:"range,omitempty"`
+}
+
+// DocumentSymbol is one node of a document's symbol outline.
+type DocumentSymbol struct {
+	Name     string           `json:"name"`
+	Detail   string           `json:"detail,omitempty"`
+	Kind     int              `json:"kind"`
+	Range    Range            `json:"range"`
+	Children []DocumentSymbol `json:"children,omitempty"`
+	// Location is set instead of Range by servers answering with the older
+	// flat SymbolInformation shape.
+	Location      *Location `json:"location,omitempty"`
+	ContainerName string    `json:"containerName,omitempty"`
+}
+
+// SymbolInformation is a workspace symbol search result.
+type SymbolInformation struct {
+	Name          string   `json:"name"`
+	Kind          int      `json:"kind"`
+	Location      Location `json:"location"`
+	ContainerName string   `json:"containerName,omitempty"`
+}
+
+// Diagnostic is a compile error, warning or hint reported by the server.
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity,omitempty"` // 1 error, 2 warning, 3 info, 4 hint
+	Source   string `json:"source,omitempty"`
+	Message  string `json:"message"`
+}
+
+// PublishDiagnosticsParams is sent by the server whenever a document's
+// diagnostics change.
+type PublishDiagnosticsParams struct {
+	URI         string       `json:"uri"`
+	Version     *int         `json:"version,omitempty"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+// InitializeResult is the server's response to "initialize".
+type InitializeResult struct {
+	Capabilities struct {
+		PositionEncoding string `json:"positionEncoding,omitempty"`
+	} `json:"capabilities"`
+	ServerInfo *struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	} `json:"serverInfo,omitempty"`
+}
+
+// symbolKinds names the LSP SymbolKind values.
+var symbolKinds = map[int]string{
+	1: "file", 2: "module", 3: "namespace", 4: "package", 5: "class",
+	6: "method", 7: "property", 8: "field", 9: "constructor", 10: "enum",
+	11: "interface", 12: "function", 13: "variable", 14: "constant",
+	15: "string", 16: "number", 17: "boolean", 18: "array", 19: "object",
+	20: "key", 21: "null", 22: "enum member", 23: "struct", 24: "event",
+	25: "operator", 26: "type parameter",
+}
+
+// KindName returns a readable name for an LSP SymbolKind.
+func KindName(kind int) string {
+	if name, ok := symbolKinds[kind]; ok {
+		return name
+	}
+	return "symbol"
+}
+
+// severityNames names the LSP DiagnosticSeverity values.
+var severityNames = map[int]string{1: "error", 2: "warning", 3: "info", 4: "hint"}
@@ -0,0 +1,236 @@
+package agent
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+// DefaultMicroCompactPercent is the default context usage (as a percentage of
+// the context window) above which micro-compaction prunes stale tool results.
+// It sits well below the full compaction threshold so the cheap pass gets a
+// chance to free space before the five-phase LLM workflow is needed.
+const DefaultMicroCompactPercent = 60
+
+// DefaultMicroCompactKeepTurns is the default number of recent assistant turns
+// whose tool results are never pruned by micro-compaction.
+const DefaultMicroCompactKeepTurns = 8
+
+// microCompactMinChars is the size below which a tool result is left alone.
+// Replacing a short result with a stub saves nothing.
+const microCompactMinChars = 500
+
+// elidedPrefix marks a tool result that micro-compaction already replaced.
+const elidedPrefix = "[elided: "
+
+// microCompactCharsPerToken approximates the tokens freed by pruning from
+// the characters removed, until the next API response measures them.
+const microCompactCharsPerToken = 4
+
+// ShouldMicroCompact reports whether the last API response used enough of the
+// context window to justify pruning stale tool results. It mirrors
+// ShouldCompact but fires at a lower threshold (MicroCompactPercent of the
+// context window, capped below the full compaction threshold).
+func (a *Agent) ShouldMicroCompact() bool {
+	if a.contextWindowSize == 0 {
+		return false
+	}
+
+	totalInput := a.lastUsage.InputTokens + a.lastUsage.CacheReadInputTokens
+	if totalInput == 0 {
+		return false
+	}
+
+	percent := a.microCompactPercent
+	if percent == 0 {
+		percent = DefaultMicroCompactPercent
+	}
+	threshold := a.contextWindowSize * percent / 100
+
+	reserve := a.reserveTokens
+	if reserve == 0 {
+		reserve = DefaultReserveTokens
+	}
+	if full := a.contextWindowSize - reserve; threshold > full {
+		threshold = full
+	}
+
+	return totalInput > threshold
+}
+
+// MicroCompact replaces the bodies of stale tool results with short stubs
+// such as "[elided: read_file main.go, 412 lines; re-read if needed]".
+// No LLM call is made. A tool result is stale when:
+//   - it was produced before the last MicroCompactKeepTurns assistant turns
+//     (with 8, the result of the 8th-to-last turn is kept and the 9th-to-last
+//     one elided), or
+//   - it is a read_file result for a path (and line range) that was read
+//     again later.
+//
+// Only tool_result content is rewritten; tool_use blocks, IDs and message
+// order are untouched, so tool_use/tool_result pairing stays valid. Results
+// of verbatimTools are never elided.
+// The last usage figure is lowered by an estimate of the tokens freed, so
+// ShouldCompact can tell whether pruning was enough.
+// Returns the number of tool results that were elided.
+func (a *Agent) MicroCompact() int {
+	keepTurns := a.microCompactKeepTurns
+	if keepTurns == 0 {
+		keepTurns = DefaultMicroCompactKeepTurns
+	}
+
+	// Index every tool_use by ID with the assistant turn that issued it.
+	type toolCall struct {
+		name  string
+		input map[string]interface{}
+		turn  int
+	}
+	calls := make(map[string]toolCall)
+	latestRead := make(map[string]string) // readKey → most recent read_file tool_use ID
+	turn := 0
+	for _, msg := range a.history {
+		if msg.Role != "assistant" {
+			continue
+		}
+		turn++
+		blocks, ok := msg.Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+		for _, b := range blocks {
+			if b.Type != "tool_use" {
+				continue
+			}
+			calls[b.ID] = toolCall{name: b.Name, input: b.Input, turn: turn}
+			if b.Name == "read_file" {
+				if key := readKey(b.Input); key != "" {
+					latestRead[key] = b.ID
+				}
+			}
+		}
+	}
+	totalTurns := turn
+
+	elided := 0
+	savedChars := 0
+	for i, msg := range a.history {
+		if msg.Role != "user" {
+			continue
+		}
+		blocks, ok := msg.Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+
+		var rewritten []providers.ContentBlock
+		for j, b := range blocks {
+			if b.Type != "tool_result" {
+				continue
+			}
+			text, ok := b.Content.(string)
+			if !ok || len(text) < microCompactMinChars || strings.HasPrefix(text, elidedPrefix) {
+				continue
+			}
+			call, ok := calls[b.ToolUseID]
+			if !ok || verbatimTools[call.name] {
+				// Results that are already summaries (run_tests) are kept
+				// for compaction to pass through verbatim
+				continue
+			}
+
+			// The last keepTurns turns are totalTurns-keepTurns+1 … totalTurns
+			stale := totalTurns-call.turn >= keepTurns
+			if !stale && call.name == "read_file" {
+				if key := readKey(call.input); key != "" {
+					stale = latestRead[key] != b.ToolUseID
+				}
+			}
+			if !stale {
+				continue
+			}
+
+			// Copy on first write so callers holding the old slice are unaffected.
+			if rewritten == nil {
+				rewritten = make([]providers.ContentBlock, len(blocks))
+				copy(rewritten, blocks)
+			}
+			stub := elidedStub(call.name, call.input, text)
+			rewritten[j].Content = stub
+			elided++
+			savedChars += len(text) - len(stub)
+		}
+
+		if rewritten != nil {
+			a.history[i] = providers.Message{Role: msg.Role, Content: rewritten}
+		}
+	}
+
+	if elided > 0 {
+		freed := savedChars / microCompactCharsPerToken
+		if freed > a.lastUsage.InputTokens {
+			freed -= a.lastUsage.InputTokens
+			a.lastUsage.InputTokens = 0
+			a.lastUsage.CacheReadInputTokens = max(a.lastUsage.CacheReadInputTokens-freed, 0)
+		} else {
+			a.lastUsage.InputTokens -= freed
+		}
+		a.emit(DiagnosticEvent{Message: fmt.Sprintf("🗜️ Micro-compaction: elided %d stale tool results (%d chars freed)",
+			elided, savedChars)})
+	}
+
+	return elided
+}
+
+// readKey identifies what a read_file call read: the cleaned path plus the
+// requested line range, so reading one page does not supersede another.
+func readKey(input map[string]interface{}) string {
+	p, ok := input["path"].(string)
+	if !ok || p == "" {
+		return ""
+	}
+	offset, _ := input["offset"].(float64)
+	if offset <= 1 {
+		offset = 0
+	}
+	limit, _ := input["limit"].(float64)
+	return fmt.Sprintf("%s#%d:%d", filepath.Clean(p), int(offset), int(limit))
+}
+
+// elidedStub builds the placeholder that replaces a pruned tool result.
+// The stub names the tool and its key argument so the model knows exactly
+// what to call again if it still needs the content.
+func elidedStub(toolName string, input map[string]interface{}, original string) string {
+	lines := strings.Count(strings.TrimRight(original, "\n"), "\n") + 1
+
+	desc := toolName
+	if arg := toolCallSubject(input); arg != "" {
+		desc += " " + arg
+	}
+
+	action := "re-run"
+	if toolName == "read_file" {
+		action = "re-read"
+	}
+	return fmt.Sprintf("%s%s, %d lines; %s if needed]", elidedPrefix, desc, lines, action)
+}
+
+// toolCallSubject returns the most identifying input argument of a tool call
+// (file path, command, pattern, URL or query), shortened to a single line.
+func toolCallSubject(input map[string]interface{}) string {
+	for _, key := range []string{"path", "command", "pattern", "url", "query"} {
+		s, ok := input[key].(string)
+		if !ok || s == "" {
+			continue
+		}
+		if idx := strings.IndexByte(s, '\n'); idx >= 0 {
+			s = s[:idx] + " …"
+		}
+		if r := []rune(s); len(r) > 80 {
+			s = string(r[:77]) + "..."
+		}
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+// Package plan holds the structured plan the agent submits with the
+// submit_plan tool at the end of a plan mode turn, for the user to approve
+// or send back for revision.
+package plan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ApprovedPrefix starts the user message that pins an approved plan in the
+// history, followed by a blank line and the plan's Markdown.
+const ApprovedPrefix = "[System: Approved Plan]"
+
+// ApprovedAck is the assistant message that follows a pinned plan.
+const ApprovedAck = "The plan is approved. I'll implement it step by step."
+
+// Plan is a proposed change, as submitted by the model.
+type Plan struct {
+	Title        string   `json:"title"`
+	Summary      string   `json:"summary"`
+	Steps        []string `json:"steps"`
+	Files        []string `json:"files,omitempty"`
+	Risks        []string `json:"risks,omitempty"`
+	Verification string   `json:"verification,omitempty"`
+}
+
+// Parse validates the input of a submit_plan call: a title, a summary and
+// at least one step are required; files, risks and verification are
+// optional.
+func Parse(input map[string]interface{}) (Plan, error) {
+	var p Plan
+	p.Title = oneLine(input["title"])
+	p.Summary = text(input["summary"])
+	p.Verification = text(input["verification"])
+	if p.Title == "" {
+		return Plan{}, fmt.Errorf("the plan has no title")
+	}
+	if p.Summary == "" {
+		return Plan{}, fmt.Errorf("the plan has no summary: say what will change and why, in a few sentences")
+	}
+
+	var err error
+	if p.Steps, err = list(input["steps"], "steps"); err != nil {
+		return Plan{}, err
+	}
+	if len(p.Steps) == 0 {
+		return Plan{}, fmt.Errorf("the plan has no steps: list the changes in the order you will make them")
+	}
+	if p.Files, err = list(input["files"], "files"); err != nil {
+		return Plan{}, err
+	}
+	if p.Risks, err = list(input["risks"], "risks"); err != nil {
+		return Plan{}, err
+	}
+	return p, nil
+}
+
+// Markdown renders the plan as the document shown to the user, saved in the
+// session and pinned in the history once approved.
+func (p Plan) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Plan: %s\n\n%s\n\n## Steps\n\n", p.Title, p.Summary)
+	for i, step := range p.Steps {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, step)
+	}
+	if len(p.Files) > 0 {
+		sb.WriteString("\n## Files\n\n")
+		for _, file := range p.Files {
+			fmt.Fprintf(&sb, "- `%s`\n", file)
+		}
+	}
+	if len(p.Risks) > 0 {
+		sb.WriteString("\n## Risks\n\n")
+		for _, risk := range p.Risks {
+			fmt.Fprintf(&sb, "- %s\n", risk)
+		}
+	}
+	if p.Verification != "" {
+		fmt.Fprintf(&sb, "\n## Verification\n\n%s\n", p.Verification)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// list validates an optional array of strings, collapsing whitespace in
+// each entry.
+func list(value interface{}, name string) ([]string, error) {
+	if value == nil {
+		return nil, nil
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of strings", name)
+	}
+	var entries []string
+	for i, v := range values {
+		entry := oneLine(v)
+		if entry == "" {
+			return nil, fmt.Errorf("%s entry %d is empty", name, i+1)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// oneLine returns a string value with its whitespace collapsed.
+func oneLine(value interface{}) string {
+	s, _ := value.(string)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// text returns a string value trimmed, keeping its line breaks.
+func text(value interface{}) string {
+	s, _ := value.(string)
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,47 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse(map[string]interface{}{
+		"title":        " Add a\nTASK_MODEL key ",
+		"summary":      "Read the key in both loaders.\n\nDefault to the main model.",
+		"steps":        []interface{}{"Add the field", "Read  TASK_MODEL"},
+		"files":        []interface{}{"agent/config/config.go"},
+		"verification": "go test ./...",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Plan: Add a TASK_MODEL key\n\n" +
+		"Read the key in both loaders.\n\nDefault to the main model.\n\n" +
+		"## Steps\n\n1. Add the field\n2. Read TASK_MODEL\n\n" +
+		"## Files\n\n- `agent/config/config.go`\n\n" +
+		"## Verification\n\ngo test ./..."
+	if got := p.Markdown(); got != want {
+		t.Errorf("markdown = %q\nwant %q", got, want)
+	}
+
+	valid := func(key string, value interface{}) map[string]interface{} {
+		input := map[string]interface{}{"title": "t", "summary": "s", "steps": []interface{}{"a"}}
+		input[key] = value
+		return input
+	}
+	for _, tc := range []struct {
+		input map[string]interface{}
+		want  string
+	}{
+		{valid("title", " "), "no title"},
+		{valid("summary", nil), "no summary"},
+		{valid("steps", []interface{}{}), "no steps"},
+		{valid("steps", "1. a"), "steps must be an array"},
+		{valid("risks", []interface{}{"ok", ""}), "risks entry 2 is empty"},
+	} {
+		if _, err := Parse(tc.input); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Parse(%v) error = %v, want %q", tc.input, err, tc.want)
+		}
+	}
+}
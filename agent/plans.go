@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/this-is-alpha-iota/clyde/agent/plan"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+func init() {
+	registerAgentTool(submitPlanTool, executeSubmitPlan, displaySubmitPlan)
+}
+
+// Plan is a structured plan submitted in plan mode.
+type Plan = plan.Plan
+
+// PlanCallback receives a plan when the model submits it in plan mode
+// (approved false), and again when ApprovePlan approves it. Used by the CLI
+// to show plans and save them to the session.
+type PlanCallback func(p Plan, approved bool)
+
+// WithPlanCallback sets the callback for submitted and approved plans.
+func WithPlanCallback(cb PlanCallback) AgentOption {
+	return func(a *Agent) {
+		a.planCallback = cb
+	}
+}
+
+// ApprovedPlanPrefix starts the user message that pins an approved plan in
+// the history. Compaction keeps the latest such message verbatim.
+const ApprovedPlanPrefix = plan.ApprovedPrefix
+
+// planModeTools are the tools offered in plan mode: the read-only tools
+// sub-agents get by default, plus asking the user, the todo list and
+// submit_plan.
+var planModeTools = append(append([]string(nil), readOnlyTaskTools...),
+	"ask_user", "todo_read", "todo_write", "submit_plan")
+
+// planModePrompt is appended to the system prompt in plan mode.
+const planModePrompt = `
+
+PLAN MODE IS ON. The user wants you to investigate and propose before anything is changed. Only read-only tools are available: explore the code, the tests and the documentation as much as the task needs, and use ask_user for decisions only the user can make. Do not try to edit files or run commands, even through other means. When you understand the change, call submit_plan with a concrete plan: the files and functions involved, the changes in the order you will make them, the risks, and how you will verify the result. Then end your turn with a one-line note. The user will approve the plan, which turns plan mode off, or reply with revisions, in which case submit a revised plan. If the request is only a question, answer it without a plan.`
+
+var submitPlanTool = providers.Tool{
+	Name: "submit_plan",
+	Description: "Submit your implementation plan for the user's approval. Only available in plan mode. " +
+		"Call it once your investigation is complete, then end your turn; do not start implementing. " +
+		"Steps must be concrete (files, functions, what changes) and in order.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "A short title for the change",
+			},
+			"summary": map[string]interface{}{
+				"type":        "string",
+				"description": "What will change and why, in a few sentences, including what you found while investigating",
+			},
+			"steps": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "The changes, in the order you will make them",
+			},
+			"files": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Files that will be created or changed",
+			},
+			"risks": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Risks, open questions and behavior changes the user should know about",
+			},
+			"verification": map[string]interface{}{
+				"type":        "string",
+				"description": "How you will verify the change (tests to run or add, manual checks)",
+			},
+		},
+		"required": []string{"title", "summary", "steps"},
+	},
+}
+
+// SetPlanMode turns plan mode on or off. In plan mode the model only gets
+// read-only tools and submit_plan, and a planning instruction is added to
+// the system prompt.
+func (a *Agent) SetPlanMode(on bool) {
+	a.planMode = on
+	if !on {
+		a.pendingPlan = nil
+	}
+}
+
+// PlanMode reports whether plan mode is on.
+func (a *Agent) PlanMode() bool {
+	return a.planMode
+}
+
+// PendingPlan returns the plan submitted during the last message, awaiting
+// approval, or nil if there is none.
+func (a *Agent) PendingPlan() *Plan {
+	if a.pendingPlan == nil {
+		return nil
+	}
+	p := *a.pendingPlan
+	return &p
+}
+
+// ApprovePlan approves the pending plan: plan mode is turned off and the
+// plan is pinned in the history, so the next message can ask the model to
+// implement it.
+func (a *Agent) ApprovePlan() (Plan, error) {
+	if a.pendingPlan == nil {
+		return Plan{}, fmt.Errorf("there is no plan to approve: the last message did not end with submit_plan")
+	}
+	if len(a.history) > 0 && a.history[len(a.history)-1].Role != "assistant" {
+		return Plan{}, fmt.Errorf("the plan cannot be approved before its turn has finished")
+	}
+	p := *a.pendingPlan
+	a.SetPlanMode(false)
+	a.history = append(a.history,
+		providers.Message{Role: "user", Content: ApprovedPlanPrefix + "\n\n" + p.Markdown()},
+		providers.Message{Role: "assistant", Content: plan.ApprovedAck},
+	)
+	if a.planCallback != nil {
+		a.planCallback(p, true)
+	}
+	return p, nil
+}
+
+// isPlanModeTool reports whether the named tool is offered in plan mode.
+func isPlanModeTool(name string) bool {
+	for _, n := range planModeTools {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func executeSubmitPlan(a *Agent, toolUseID string, input map[string]interface{}) (string, error) {
+	if !a.planMode {
+		return "", fmt.Errorf("submit_plan is only available in plan mode")
+	}
+	p, err := plan.Parse(input)
+	if err != nil {
+		return "", err
+	}
+	a.pendingPlan = &p
+	if a.planCallback != nil {
+		a.planCallback(p, false)
+	}
+	return "Plan submitted. The user will review it when your turn ends: end it now with a one-line note, and do not start implementing.", nil
+}
+
+func displaySubmitPlan(input map[string]interface{}) string {
+	title, _ := input["title"].(string)
+	if title == "" {
+		return "→ Submitting plan"
+	}
+	return fmt.Sprintf("→ Submitting plan: %s", title)
+}
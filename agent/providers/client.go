@@ -40,6 +40,23 @@ func (c *Client) WithThinking(thinking *ThinkingConfig) *Client {
 	}
 }
 
+// WithModel returns a new client that sends requests to modelID instead,
+// keeping the other settings.
+func (c *Client) WithModel(modelID string) *Client {
+	return &Client{
+		apiKey:    c.apiKey,
+		apiURL:    c.apiURL,
+		modelID:   modelID,
+		maxTokens: c.maxTokens,
+		thinking:  c.thinking,
+	}
+}
+
+// ModelID returns the model the client sends requests to.
+func (c *Client) ModelID() string {
+	return c.modelID
+}
+
 // Call sends a request to the Claude API with the given messages and tools
 func (c *Client) Call(systemPrompt string, messages []Message, tools []Tool) (*Response, error) {
 	reqBody := Request{
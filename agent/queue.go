@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/this-is-alpha-iota/clyde/agent/hooks"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+// QueueCallback is called when the queue of user messages changes: after
+// Queue adds one (delivered is empty), and when queued messages are sent to
+// the model with tool results. queued holds the messages still waiting.
+type QueueCallback func(delivered []string, queued []string)
+
+// WithQueueCallback sets the callback for queued user messages. Used by the
+// CLI to show the queue on the spinner line.
+func WithQueueCallback(cb QueueCallback) AgentOption {
+	return func(a *Agent) {
+		a.queueCallback = cb
+	}
+}
+
+// Queue adds a message the user typed while a turn is running. It is sent
+// to the model as user text next to the next tool results, so the model can
+// change course mid-turn; if the turn ends first, it is held for the caller
+// to send as the next message (see TakeQueued). Safe to call from another
+// goroutine than HandleMessage.
+func (a *Agent) Queue(text string) {
+	a.queueMu.Lock()
+	a.queue = append(a.queue, text)
+	queued := append([]string(nil), a.queue...)
+	a.queueMu.Unlock()
+	if a.queueCallback != nil {
+		a.queueCallback(nil, queued)
+	}
+}
+
+// Queued returns the messages waiting to be delivered.
+func (a *Agent) Queued() []string {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+	return append([]string(nil), a.queue...)
+}
+
+// TakeQueued removes and returns the messages waiting to be delivered, e.g.
+// those held when a turn ended before its next tool results.
+func (a *Agent) TakeQueued() []string {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+	queued := a.queue
+	a.queue = nil
+	return queued
+}
+
+// deliverQueued appends the queued messages to the tool results about to be
+// sent, as user text blocks, and reports them like user messages so they
+// are saved in the session. UserPromptSubmit hooks see each message as they
+// would a typed one: a blocked message is dropped with a diagnostic, and a
+// rewritten one is delivered as rewritten.
+func (a *Agent) deliverQueued(toolResults []providers.ContentBlock) []providers.ContentBlock {
+	queued := a.TakeQueued()
+	if len(queued) == 0 {
+		return toolResults
+	}
+	var delivered []string
+	for _, text := range queued {
+		text = a.redact(text, "your message")
+		submitted := a.runHooks(hooks.Input{Event: hooks.UserPromptSubmit, Prompt: text})
+		if submitted.Blocked() {
+			a.emit(DiagnosticEvent{Message: fmt.Sprintf("🪝 Queued message blocked by a %s hook: %s", hooks.UserPromptSubmit, submitted.Reason)})
+			continue
+		}
+		if submitted.Prompt != "" {
+			text = a.redact(submitted.Prompt, "hook output")
+		}
+		content := text
+		if submitted.Context != "" {
+			content += "\n\n<hook_context>\n" + a.redact(submitted.Context, "hook output") + "\n</hook_context>"
+		}
+		toolResults = append(toolResults, providers.ContentBlock{Type: "text", Text: content})
+		a.emit(UserMessageEvent{Text: text})
+		delivered = append(delivered, text)
+	}
+	if a.queueCallback != nil {
+		a.queueCallback(delivered, nil)
+	}
+	return toolResults
+}
@@ -0,0 +1,262 @@
+// Package redact replaces secrets in text with placeholders such as
+// [REDACTED:github-token], so tool output like `cat .env` or `env` never
+// reaches the API or the session files verbatim.
+//
+// Secrets are found by known key formats (Anthropic, OpenAI, AWS, GitHub,
+// Slack, Google, Stripe, JWTs, private key blocks), by secret-looking
+// assignments (API_TOKEN=…, "password": "…"), by high-entropy tokens outside
+// checksums (go.sum, lockfile integrity hashes), and by exact values
+// registered with AddSecret (e.g. the API key in the config).
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// minSecretLength is the shortest registered value that is redacted; shorter
+// values would match ordinary text.
+const minSecretLength = 8
+
+// pattern finds one kind of secret. When group is set, only that
+// submatch is replaced (the rest, e.g. a variable name, is kept).
+type pattern struct {
+	kind  string
+	re    *regexp.Regexp
+	group int
+}
+
+// patterns are applied in order; earlier, more specific ones win.
+var patterns = []pattern{
+	{kind: "private-key", re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----(?s:.*?)(-----END [A-Z ]*PRIVATE KEY( BLOCK)?-----|\z)`)},
+	{kind: "anthropic-key", re: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_\-]{20,}`)},
+	{kind: "openai-key", re: regexp.MustCompile(`\bsk-(?:proj-|svcacct-)?[A-Za-z0-9_\-]{20,}`)},
+	{kind: "aws-access-key", re: regexp.MustCompile(`\b(?:AKIA|ASIA)[A-Z0-9]{16}\b`)},
+	{kind: "github-token", re: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{kind: "slack-token", re: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9\-]{10,}`)},
+	{kind: "google-api-key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{kind: "stripe-key", re: regexp.MustCompile(`\b[rs]k_(?:live|test)_[0-9A-Za-z]{16,}\b`)},
+	{kind: "jwt", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]{10,}\.eyJ[A-Za-z0-9_\-]{10,}\.[A-Za-z0-9_\-]{10,}`)},
+	{kind: "auth-header", group: 1, re: regexp.MustCompile(`(?i)\bauthorization:\s*(?:bearer|basic|token)\s+([A-Za-z0-9._~+/=\-]{16,})`)},
+	{kind: "url-password", group: 1, re: regexp.MustCompile(`\b[a-z][a-z0-9+.\-]*://[^\s:/@\[\]]+:([^\s/@\[\]]{6,})@`)},
+	// Environment-style assignments: API_TOKEN=..., PASSWORD=..., export
+	// DB_PASSWORD="...".
+	{kind: "secret-value", group: 1, re: regexp.MustCompile(`\b(?:[A-Z0-9_]*_)?(?:SECRET|TOKEN|PASSWORD|PASSWD|API_KEY|APIKEY|ACCESS_KEY|PRIVATE_KEY|CREDENTIALS?)[A-Z0-9_]*\s*=\s*["']?([^\s"'$<>{}\[\]]{8,})`)},
+	// Quoted JSON/YAML values: "password": "...", client_secret: '...'.
+	{kind: "secret-value", group: 1, re: regexp.MustCompile(`(?i)["']?\b[a-z0-9_\-]*(?:secret|token|password|passwd|api_?key|access_?key)["']?\s*:\s*["']([^\s"'$<>{}\[\]]{8,})["']`)},
+}
+
+// candidate matches tokens checked for high entropy.
+var candidate = regexp.MustCompile(`[A-Za-z0-9_\-+]{32,}={0,2}`)
+
+// checksum matches content hashes that look random but are not secrets:
+// go.sum's h1: hashes and the sha*- integrity values of package-lock.json
+// and yarn.lock. High-entropy tokens inside them are left alone.
+var checksum = regexp.MustCompile(`\b(?:h1:|sha1-|sha256-|sha384-|sha512-)[A-Za-z0-9+/]{20,}={0,2}`)
+
+// example matches values that are documentation placeholders rather than
+// secrets (TS_AGENT_API_KEY=sk-ant-your-key-here).
+var example = regexp.MustCompile(`(?i)your|example|placeholder|changeme|xxxx|\*\*\*`)
+
+// Counts is the number of redactions per kind of secret.
+type Counts map[string]int
+
+// Total returns the number of redactions.
+func (c Counts) Total() int {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// String summarizes the counts, e.g. "2 secret-value, 1 github-token".
+func (c Counts) String() string {
+	kinds := make([]string, 0, len(c))
+	for kind := range c {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if c[kinds[i]] != c[kinds[j]] {
+			return c[kinds[i]] > c[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d %s", c[kind], kind)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Redactor replaces secrets in text. The zero value is not usable; create
+// one with New.
+type Redactor struct {
+	allow   []string
+	secrets []secret
+}
+
+// secret is an exact value to redact.
+type secret struct {
+	name  string
+	value string
+}
+
+// New returns a Redactor. A match containing any allowlist entry (e.g.
+// "EXAMPLE", or a whole test fixture key) is left as it is.
+func New(allowlist []string) *Redactor {
+	r := &Redactor{}
+	for _, a := range allowlist {
+		if a = strings.TrimSpace(a); a != "" {
+			r.allow = append(r.allow, a)
+		}
+	}
+	return r
+}
+
+// AddSecret registers an exact value to redact as [REDACTED:name]. Values
+// shorter than 8 characters, and values already registered, are ignored.
+func (r *Redactor) AddSecret(name, value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < minSecretLength || r.allowed(value) {
+		return
+	}
+	for _, s := range r.secrets {
+		if s.value == value {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, secret{name: name, value: value})
+	// Longer values first, so a secret containing another is replaced whole.
+	sort.SliceStable(r.secrets, func(i, j int) bool { return len(r.secrets[i].value) > len(r.secrets[j].value) })
+}
+
+// Redact returns text with secrets replaced by placeholders, and how many
+// of each kind were replaced.
+func (r *Redactor) Redact(text string) (string, Counts) {
+	counts := Counts{}
+	for _, s := range r.secrets {
+		if n := strings.Count(text, s.value); n > 0 {
+			text = strings.ReplaceAll(text, s.value, placeholder(s.name))
+			counts[s.name] += n
+		}
+	}
+	for _, p := range patterns {
+		text = r.replace(text, p, counts)
+	}
+	text = r.replaceHighEntropy(text, counts)
+	return text, counts
+}
+
+// replaceHighEntropy replaces high-entropy tokens outside checksums.
+func (r *Redactor) replaceHighEntropy(text string, counts Counts) string {
+	sums := checksum.FindAllStringIndex(text, -1)
+	inChecksum := func(start, end int) bool {
+		for _, s := range sums {
+			if start < s[1] && end > s[0] {
+				return true
+			}
+		}
+		return false
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range candidate.FindAllStringIndex(text, -1) {
+		token := text[m[0]:m[1]]
+		if !highEntropy(token) || r.allowed(token) || inChecksum(m[0], m[1]) {
+			continue
+		}
+		b.WriteString(text[last:m[0]])
+		b.WriteString(placeholder("high-entropy"))
+		counts["high-entropy"]++
+		last = m[1]
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// replace applies one pattern, replacing the whole match or its group.
+func (r *Redactor) replace(text string, p pattern, counts Counts) string {
+	matches := p.re.FindAllStringSubmatchIndex(text, -1)
+	if matches == nil {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if p.group > 0 {
+			start, end = m[2*p.group], m[2*p.group+1]
+		}
+		if start < 0 {
+			continue
+		}
+		secret := text[start:end]
+		if strings.Contains(secret, "[REDACTED:") || example.MatchString(secret) || r.allowed(secret) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(placeholder(p.kind))
+		counts[p.kind]++
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// allowed reports whether a match contains an allowlist entry.
+func (r *Redactor) allowed(match string) bool {
+	for _, a := range r.allow {
+		if strings.Contains(match, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func placeholder(kind string) string {
+	return placeholderPrefix + kind + "]"
+}
+
+// placeholderPrefix starts every placeholder.
+const placeholderPrefix = "[REDACTED:"
+
+// HasPlaceholder reports whether text contains a redaction placeholder,
+// e.g. because the model copied redacted output into a file edit.
+func HasPlaceholder(text string) bool {
+	return strings.Contains(text, placeholderPrefix)
+}
+
+// highEntropy reports whether a token looks randomly generated: it mixes
+// upper case, lower case and digits, and its characters are spread out
+// enough (Shannon entropy of at least 4.4 bits per character, where long
+// CamelCase identifiers stay around 4.3). Hex strings such as commit hashes
+// and UUIDs have no upper case and are left alone.
+func highEntropy(token string) bool {
+	var upper, lower, digit bool
+	freq := make(map[rune]int)
+	for _, c := range token {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+		freq[c]++
+	}
+	if !upper || !lower || !digit {
+		return false
+	}
+	entropy := 0.0
+	n := float64(len(token))
+	for _, count := range freq {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= 4.4
+}
@@ -0,0 +1,274 @@
+package repomap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxOutline truncates long signatures in the map.
+const maxOutline = 160
+
+// CtagsCommand is the Universal Ctags binary used for non-Go files. It must
+// support --output-format=json; other ctags implementations are treated as
+// unavailable.
+var CtagsCommand = "ctags"
+
+// languages maps file extensions to the languages the map outlines.
+var languages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".mjs":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".scala": "scala",
+	".swift": "swift",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "c++",
+	".cpp":   "c++",
+	".hpp":   "c++",
+	".cs":    "c#",
+	".php":   "php",
+	".lua":   "lua",
+}
+
+// language returns the language of a file name, or "" if it is not outlined.
+func language(name string) string {
+	return languages[strings.ToLower(filepath.Ext(name))]
+}
+
+// parseGo outlines a Go file: its package, top-level types, functions,
+// methods, and exported constants and variables.
+func parseGo(path string) (*File, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, path, src, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		Package: node.Name.Name,
+		Test:    strings.HasSuffix(path, "_test.go"),
+	}
+	declared := make(map[*ast.Ident]bool)
+	add := func(name *ast.Ident, kind, outline string) {
+		declared[name] = true
+		f.Symbols = append(f.Symbols, Symbol{
+			Name:     name.Name,
+			Kind:     kind,
+			Line:     fset.Position(name.Pos()).Line,
+			Outline:  truncate(outline),
+			Exported: name.IsExported(),
+		})
+	}
+
+	for _, decl := range node.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			kind := "func"
+			if d.Recv != nil {
+				kind = "method"
+			}
+			sig := *d
+			sig.Doc, sig.Body = nil, nil
+			add(d.Name, kind, render(fset, &sig))
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					outline := "type " + s.Name.Name + typeParams(fset, s) + " "
+					if s.Assign.IsValid() {
+						outline += "= "
+					}
+					add(s.Name, "type", outline+describeType(fset, s.Type))
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range s.Names {
+						if name.IsExported() {
+							add(name, kind, kind+" "+name.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// References: every identifier used but not declared here, including the
+	// selector in pkg.Name and x.Method.
+	refs := make(map[string]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && !declared[id] && id.Name != "_" {
+			refs[id.Name] = true
+		}
+		return true
+	})
+	f.Refs = sortedKeys(refs)
+	return f, nil
+}
+
+// describeType summarizes a type for the outline: structs and interfaces by
+// kind only (their fields would crowd out everything else), other types in
+// full.
+func describeType(fset *token.FileSet, expr ast.Expr) string {
+	switch expr.(type) {
+	case *ast.StructType:
+		return "struct"
+	case *ast.InterfaceType:
+		return "interface"
+	}
+	return render(fset, expr)
+}
+
+// typeParams renders a generic type's parameter list, e.g. "[T any]".
+func typeParams(fset *token.FileSet, s *ast.TypeSpec) string {
+	if s.TypeParams == nil {
+		return ""
+	}
+	var params []string
+	for _, field := range s.TypeParams.List {
+		var names []string
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		params = append(params, strings.Join(names, ", ")+" "+render(fset, field.Type))
+	}
+	return "[" + strings.Join(params, ", ") + "]"
+}
+
+// render prints an AST node on a single line.
+func render(fset *token.FileSet, node interface{}) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// truncate shortens an outline line to maxOutline characters.
+func truncate(s string) string {
+	if r := []rune(s); len(r) > maxOutline {
+		return string(r[:maxOutline-1]) + "…"
+	}
+	return s
+}
+
+// ctagsKinds are the ctags kinds shown in the map; fields, variables and
+// the like would crowd out the declarations that matter.
+var ctagsKinds = map[string]bool{
+	"class": true, "interface": true, "struct": true, "enum": true,
+	"trait": true, "module": true, "namespace": true, "type": true,
+	"typedef": true, "function": true, "method": true, "implementation": true,
+	"object": true, "protocol": true, "union": true,
+}
+
+// ctagsTag is one line of ctags' JSON output.
+type ctagsTag struct {
+	Type      string `json:"_type"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Line      int    `json:"line"`
+	Kind      string `json:"kind"`
+	Signature string `json:"signature"`
+	Scope     string `json:"scope"`
+}
+
+// identifier matches identifiers in languages without a native parser.
+var identifier = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// runCtags outlines non-Go files (paths relative to root) in one ctags run.
+// It reports false when ctags is missing or does not speak JSON.
+func runCtags(root string, paths []string) ([]*File, bool) {
+	if _, err := exec.LookPath(CtagsCommand); err != nil {
+		return nil, false
+	}
+	cmd := exec.Command(CtagsCommand, "--output-format=json", "--fields=+nKS",
+		"--sort=no", "-f", "-", "-L", "-")
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, false
+	}
+
+	files := make(map[string]*File, len(paths))
+	for _, p := range paths {
+		files[p] = &File{Path: p}
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var tag ctagsTag
+		if json.Unmarshal(scanner.Bytes(), &tag) != nil || tag.Type != "tag" || !ctagsKinds[tag.Kind] {
+			continue
+		}
+		f := files[filepath.ToSlash(tag.Path)]
+		if f == nil {
+			continue
+		}
+		name := tag.Name
+		if tag.Scope != "" {
+			name = tag.Scope + "." + tag.Name
+		}
+		f.Symbols = append(f.Symbols, Symbol{
+			Name:     tag.Name,
+			Kind:     tag.Kind,
+			Line:     tag.Line,
+			Outline:  truncate(tag.Kind + " " + name + tag.Signature),
+			Exported: !strings.HasPrefix(tag.Name, "_"),
+		})
+	}
+
+	result := make([]*File, 0, len(files))
+	for _, f := range files {
+		sort.SliceStable(f.Symbols, func(i, j int) bool { return f.Symbols[i].Line < f.Symbols[j].Line })
+		if data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(f.Path))); err == nil {
+			declared := make(map[string]bool, len(f.Symbols))
+			for _, s := range f.Symbols {
+				declared[s.Name] = true
+			}
+			refs := make(map[string]bool)
+			for _, id := range identifier.FindAll(data, -1) {
+				if name := string(id); !declared[name] {
+					refs[name] = true
+				}
+			}
+			f.Refs = sortedKeys(refs)
+		}
+		result = append(result, f)
+	}
+	return result, true
+}
+
+// sortedKeys returns a set's members in order.
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,187 @@
+package repomap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// charsPerToken approximates tokens from characters for the budget.
+	charsPerToken = 4
+	// maxSymbolsPerFile caps one file's share of the map.
+	maxSymbolsPerFile = 15
+)
+
+// sortFiles orders files by path.
+func sortFiles(files []*File) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+}
+
+// ranking holds reference scores for files and their symbols.
+type ranking struct {
+	files   map[*File]float64
+	symbols map[*File]map[string]float64
+}
+
+// rank scores every declaration by how many other files refer to its name.
+// A name declared in several files (String, Close, New) splits its weight
+// between them, so common method names do not dominate the map. A file's
+// score is the sum of its symbols' scores.
+func (m *Map) rank() ranking {
+	defs := make(map[string][]*File)
+	for _, f := range m.Files {
+		if f.Test {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, s := range f.Symbols {
+			if !seen[s.Name] {
+				seen[s.Name] = true
+				defs[s.Name] = append(defs[s.Name], f)
+			}
+		}
+	}
+
+	r := ranking{files: make(map[*File]float64), symbols: make(map[*File]map[string]float64)}
+	for _, f := range m.Files {
+		for _, name := range f.Refs {
+			owners := defs[name]
+			for _, g := range owners {
+				if g == f {
+					continue
+				}
+				w := 1 / float64(len(owners))
+				r.files[g] += w
+				if r.symbols[g] == nil {
+					r.symbols[g] = make(map[string]float64)
+				}
+				r.symbols[g][name] += w
+			}
+		}
+	}
+	return r
+}
+
+// symbolScore breaks ties in favour of exported declarations.
+func (r ranking) symbolScore(f *File, s Symbol) float64 {
+	score := r.symbols[f][s.Name]
+	if s.Exported {
+		score += 0.5
+	}
+	return score
+}
+
+// Render formats the map for the model, most referenced files first,
+// keeping within roughly maxTokens. A non-empty focus (a slash-separated
+// directory or file relative to the root) limits the map to that subtree.
+func (m *Map) Render(focus string, maxTokens int) string {
+	focus = strings.Trim(focus, "/")
+	if focus == "." {
+		focus = ""
+	}
+
+	var files []*File
+	symbols := 0
+	for _, f := range m.Files {
+		if f.Test || len(f.Symbols) == 0 {
+			continue
+		}
+		if focus != "" && f.Path != focus && !strings.HasPrefix(f.Path, focus+"/") {
+			continue
+		}
+		files = append(files, f)
+		symbols += len(f.Symbols)
+	}
+
+	var notes []string
+	if m.Unparsed > 0 {
+		notes = append(notes, fmt.Sprintf("%d non-Go source %s not outlined: install Universal Ctags (ctags) to include them.",
+			m.Unparsed, plural(m.Unparsed, "file", "files")))
+	}
+	if m.Truncated {
+		notes = append(notes, fmt.Sprintf("Only the first %d source files were mapped; pass a subdirectory as path to map the rest.", maxFiles))
+	}
+
+	where := "the repository"
+	if focus != "" {
+		where = focus
+	}
+	if len(files) == 0 {
+		return strings.Join(append([]string{fmt.Sprintf("No source files to outline in %s.", where)}, notes...), "\n")
+	}
+
+	r := m.rank()
+	sort.SliceStable(files, func(i, j int) bool {
+		si, sj := r.files[files[i]], r.files[files[j]]
+		if si != sj {
+			return si > sj
+		}
+		return files[i].Path < files[j].Path
+	})
+
+	budget := maxTokens * charsPerToken
+	var body strings.Builder
+	shown := 0
+	for _, f := range files {
+		block := r.renderFile(f, maxSymbolsPerFile)
+		for n := maxSymbolsPerFile - 1; len(block) > budget && n > 0; n-- {
+			block = r.renderFile(f, n)
+		}
+		if len(block) > budget {
+			break
+		}
+		body.WriteString(block)
+		budget -= len(block)
+		shown++
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "Repository map of %s: %d source %s, %d symbols, most referenced first.\n\n",
+		where, len(files), plural(len(files), "file", "files"), symbols)
+	out.WriteString(body.String())
+	if rest := len(files) - shown; rest > 0 {
+		fmt.Fprintf(&out, "\n... %d more %s not shown (raise max_tokens or pass a subdirectory as path)\n",
+			rest, plural(rest, "file", "files"))
+	}
+	for _, n := range notes {
+		out.WriteString("\n" + n + "\n")
+	}
+	return strings.TrimRight(out.String(), "\n")
+}
+
+// renderFile formats one file with at most limit of its highest-ranked
+// symbols, listed in source order.
+func (r ranking) renderFile(f *File, limit int) string {
+	picked := make([]Symbol, len(f.Symbols))
+	copy(picked, f.Symbols)
+	sort.SliceStable(picked, func(i, j int) bool {
+		return r.symbolScore(f, picked[i]) > r.symbolScore(f, picked[j])
+	})
+	if len(picked) > limit {
+		picked = picked[:limit]
+	}
+	sort.SliceStable(picked, func(i, j int) bool { return picked[i].Line < picked[j].Line })
+
+	var b strings.Builder
+	b.WriteString(f.Path)
+	if f.Package != "" {
+		fmt.Fprintf(&b, " (package %s)", f.Package)
+	}
+	b.WriteString("\n")
+	for _, s := range picked {
+		fmt.Fprintf(&b, "  %d: %s\n", s.Line, s.Outline)
+	}
+	if rest := len(f.Symbols) - len(picked); rest > 0 {
+		fmt.Fprintf(&b, "  … %d more\n", rest)
+	}
+	return b.String()
+}
+
+// plural picks the singular or plural form of a word for n.
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
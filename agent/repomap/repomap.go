@@ -0,0 +1,250 @@
+// Package repomap builds a compact outline of a repository: the packages,
+// types and function signatures declared in each source file, ranked by how
+// often the rest of the code refers to them and trimmed to a token budget.
+// It gives the model the shape of a project up front, instead of the first
+// few turns of every task going to glob and read_file.
+//
+// Go files are parsed with go/parser. Other languages are outlined with
+// Universal Ctags when it is installed and skipped otherwise. Parsed outlines
+// are cached in <repo>/.clyde/repomap.json and reused for every file whose
+// size and modification time are unchanged, so only edited files are parsed
+// again.
+package repomap
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+)
+
+const (
+	// cacheVersion is bumped whenever the cached outline format changes,
+	// discarding caches written by older versions.
+	cacheVersion = 1
+	// maxFiles caps how many source files are outlined.
+	maxFiles = 5000
+	// maxFileSize skips generated or vendored files too large to be useful.
+	maxFileSize = 1 << 20
+)
+
+// Symbol is one declaration in a file's outline.
+type Symbol struct {
+	// Name is the declared identifier.
+	Name string `json:"name"`
+	// Kind is "func", "method", "type", "const" or "var" for Go, or the
+	// ctags kind (e.g. "class", "function") for other languages.
+	Kind string `json:"kind"`
+	// Line is the 1-based line of the declaration.
+	Line int `json:"line"`
+	// Outline is the line shown in the map, e.g.
+	// "func (s *Store) Undo() (*UndoResult, error)".
+	Outline string `json:"outline"`
+	// Exported reports whether the symbol is visible outside its package
+	// (always true for languages without Go's export rule).
+	Exported bool `json:"exported,omitempty"`
+}
+
+// File is the outline of one source file.
+type File struct {
+	// Path is slash-separated and relative to the map's root.
+	Path string `json:"path"`
+	// Package is the Go package name (empty for other languages).
+	Package string `json:"package,omitempty"`
+	// Test marks Go test files. Their references count toward ranking but
+	// their symbols are not shown.
+	Test bool `json:"test,omitempty"`
+	// Symbols are the file's declarations in source order.
+	Symbols []Symbol `json:"symbols,omitempty"`
+	// Refs are the distinct identifiers the file uses, for ranking.
+	Refs []string `json:"refs,omitempty"`
+
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+}
+
+// Map is the outline of a repository.
+type Map struct {
+	// Root is the absolute directory the map describes.
+	Root string
+	// Files holds every outlined file, sorted by path.
+	Files []*File
+	// Unparsed counts non-Go source files skipped because ctags is not
+	// available.
+	Unparsed int
+	// Truncated is true when the repository has more than maxFiles source files.
+	Truncated bool
+}
+
+// cache is the on-disk form of a map.
+type cache struct {
+	Version int              `json:"version"`
+	Files   map[string]*File `json:"files"`
+}
+
+// CachePath returns where the map of the repository at root is cached:
+// <root>/.clyde/repomap.json. It returns "" when root is not a git
+// repository, so no .clyde directory is created in arbitrary directories.
+func CachePath(root string) string {
+	if _, err := os.Stat(filepath.Join(root, ".git")); err != nil {
+		return ""
+	}
+	return filepath.Join(root, ".clyde", "repomap.json")
+}
+
+// Build outlines the source files under root, skipping files ignored by
+// .gitignore/.clydeignore. When cachePath is not empty, outlines of unchanged
+// files are read from it and the updated cache is written back.
+func Build(root, cachePath string) (*Map, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	m := &Map{Root: abs}
+
+	old := loadCache(cachePath)
+	fresh := make(map[string]*File)
+	dirty := false
+	var stale []string // non-Go files that need ctags
+
+	matcher := ignore.New(abs)
+	err = ignore.Walk(abs, matcher, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable entries are left out of the map
+		}
+		if d.IsDir() {
+			if p != abs && skipDir(d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		lang := language(d.Name())
+		if lang == "" {
+			return nil
+		}
+		if len(fresh)+len(stale) >= maxFiles {
+			m.Truncated = true
+			return filepath.SkipAll
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxFileSize {
+			return nil
+		}
+		rel, _ := filepath.Rel(abs, p)
+		rel = filepath.ToSlash(rel)
+
+		if f, ok := old[rel]; ok && f.Size == info.Size() && f.ModTime == info.ModTime().UnixNano() {
+			fresh[rel] = f
+			return nil
+		}
+		if lang != "go" {
+			stale = append(stale, rel)
+			return nil
+		}
+		f, err := parseGo(p)
+		if err != nil {
+			return nil // files that do not parse are left out until fixed
+		}
+		f.Path, f.Size, f.ModTime = rel, info.Size(), info.ModTime().UnixNano()
+		fresh[rel] = f
+		dirty = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stale) > 0 {
+		outlined, ok := runCtags(abs, stale)
+		if !ok {
+			m.Unparsed = len(stale)
+		}
+		for _, f := range outlined {
+			if info, err := os.Stat(filepath.Join(abs, filepath.FromSlash(f.Path))); err == nil {
+				f.Size, f.ModTime = info.Size(), info.ModTime().UnixNano()
+				fresh[f.Path] = f
+				dirty = true
+			}
+		}
+	}
+	if len(fresh) != len(old) {
+		dirty = true
+	}
+
+	for _, f := range fresh {
+		m.Files = append(m.Files, f)
+	}
+	sortFiles(m.Files)
+
+	if cachePath != "" && dirty {
+		saveCache(cachePath, fresh)
+	}
+	return m, nil
+}
+
+// skipDir reports whether a directory never holds code worth outlining:
+// hidden directories (including .clyde itself), Go testdata and the
+// dependency trees every search tool skips.
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "testdata" || ignore.SkipDir(name)
+}
+
+// loadCache reads a cache file, returning nil if it is missing, unreadable
+// or from another version.
+func loadCache(path string) map[string]*File {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var c cache
+	if json.Unmarshal(data, &c) != nil || c.Version != cacheVersion {
+		return nil
+	}
+	return c.Files
+}
+
+// saveCache writes the cache via a temporary file. Failing to cache is not
+// an error; the map is simply rebuilt next time.
+func saveCache(path string, files map[string]*File) {
+	data, err := json.Marshal(cache{Version: cacheVersion, Files: files})
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// A new cache: keep it out of the repository, like the sessions.
+		// path is <root>/.clyde/repomap.json.
+		ignore.AddToGitignore(filepath.Dir(filepath.Dir(path)), ".clyde/repomap.json", "Clyde repository map cache")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// Generate builds (or refreshes) the cached map of the repository containing
+// dir and renders the part of it under dir within maxTokens.
+func Generate(dir string, maxTokens int) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	root := ignore.New(abs).Root()
+	m, err := Build(root, CachePath(root))
+	if err != nil {
+		return "", err
+	}
+	focus, _ := filepath.Rel(root, abs)
+	return m.Render(filepath.ToSlash(focus), maxTokens), nil
+}
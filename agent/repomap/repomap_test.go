@@ -0,0 +1,316 @@
+package repomap
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFiles creates files (slash-separated paths) under dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// fixture is a small Go project: store is used by api and util, api by
+// main, and nothing uses util or main.
+func fixture(t *testing.T) string {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod": "module example.com/app\n",
+		"main.go": `package main
+
+import "example.com/app/api"
+
+func main() { api.Serve(":8080") }
+`,
+		"api/api.go": `package api
+
+import "example.com/app/store"
+
+// Serve starts the server.
+func Serve(addr string) error {
+	s := store.Open("db")
+	_ = s.Get("k")
+	return nil
+}
+`,
+		"store/store.go": `package store
+
+// Store is a key-value store.
+type Store struct{ data map[string]string }
+
+// Reader reads values.
+type Reader interface{ Get(key string) string }
+
+// Handler is called on changes.
+type Handler func(key, value string) error
+
+// List is a generic list.
+type List[T any] []T
+
+type Alias = Store
+
+const Version = "1"
+
+const internal = 2
+
+func Open(path string) *Store { return &Store{} }
+
+func (s *Store) Get(key string) string { return s.data[key] }
+
+func helper() {}
+`,
+		"store/store_test.go": `package store
+
+import "testing"
+
+func TestOpen(t *testing.T) { Open("x") }
+`,
+		"util/util.go": `package util
+
+import "example.com/app/store"
+
+func Keys(s *store.Store) []string { return nil }
+`,
+		"testdata/skip.go":   "package skip\n\nfunc Skipped() {}\n",
+		"broken/broken.go":   "package broken\n\nfunc (\n",
+		"vendor/dep/dep.go":  "package dep\n\nfunc Vendored() {}\n",
+		"docs/readme.txt":    "not source\n",
+		".hidden/hidden.go":  "package hidden\n\nfunc Hidden() {}\n",
+		"ignored/ignored.go": "package ignored\n\nfunc Ignored() {}\n",
+		".gitignore":         "ignored/\n",
+	})
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestBuild_GoOutline(t *testing.T) {
+	dir := fixture(t)
+	m, err := Build(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, f := range m.Files {
+		paths = append(paths, f.Path)
+	}
+	want := "api/api.go main.go store/store.go store/store_test.go util/util.go"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("files = %q, want %q", got, want)
+	}
+
+	var store *File
+	for _, f := range m.Files {
+		if f.Path == "store/store.go" {
+			store = f
+		}
+	}
+	var outlines []string
+	for _, s := range store.Symbols {
+		outlines = append(outlines, s.Outline)
+	}
+	wantOutlines := []string{
+		"type Store struct",
+		"type Reader interface",
+		"type Handler func(key, value string) error",
+		"type List[T any] []T",
+		"type Alias = Store",
+		"const Version",
+		"func Open(path string) *Store",
+		"func (s *Store) Get(key string) string",
+		"func helper()",
+	}
+	if strings.Join(outlines, "\n") != strings.Join(wantOutlines, "\n") {
+		t.Errorf("outlines:\n%s\nwant:\n%s", strings.Join(outlines, "\n"), strings.Join(wantOutlines, "\n"))
+	}
+	if store.Package != "store" || store.Symbols[6].Line != 21 || store.Symbols[7].Kind != "method" {
+		t.Errorf("unexpected symbol details: %+v", store)
+	}
+}
+
+func TestRender_RanksAndBudgets(t *testing.T) {
+	dir := fixture(t)
+	m, err := Build(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := m.Render("", 2000)
+	if !strings.HasPrefix(out, "Repository map of the repository: 4 source files, 12 symbols") {
+		t.Errorf("unexpected header:\n%s", out)
+	}
+	// store is referenced by api, util and its test; api by main; main by nobody.
+	storeAt := strings.Index(out, "store/store.go (package store)")
+	apiAt := strings.Index(out, "api/api.go (package api)")
+	mainAt := strings.Index(out, "main.go (package main)")
+	if storeAt < 0 || apiAt < 0 || mainAt < 0 || !(storeAt < apiAt && apiAt < mainAt) {
+		t.Errorf("files not ranked by references:\n%s", out)
+	}
+	for _, want := range []string{"  21: func Open(path string) *Store", "  6: func Serve(addr string) error"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "TestOpen") {
+		t.Errorf("test file symbols should not be shown:\n%s", out)
+	}
+
+	// A tiny budget keeps the top file (possibly trimmed) and reports the rest.
+	small := m.Render("", 40)
+	if !strings.Contains(small, "store/store.go") || strings.Contains(small, "main.go (package") {
+		t.Errorf("small budget should keep only the top file:\n%s", small)
+	}
+	if !strings.Contains(small, "more files not shown") || !strings.Contains(small, "… ") {
+		t.Errorf("small budget should report omitted files and symbols:\n%s", small)
+	}
+
+	focused := m.Render("store", 2000)
+	if !strings.HasPrefix(focused, "Repository map of store: 1 source file,") || strings.Contains(focused, "api.go") {
+		t.Errorf("focus not applied:\n%s", focused)
+	}
+	if none := m.Render("docs", 2000); none != "No source files to outline in docs." {
+		t.Errorf("empty focus = %q", none)
+	}
+}
+
+func TestBuild_Cache(t *testing.T) {
+	dir := fixture(t)
+	cachePath := CachePath(dir)
+	if cachePath != filepath.Join(dir, ".clyde", "repomap.json") {
+		t.Fatalf("CachePath = %q", cachePath)
+	}
+	if CachePath(t.TempDir()) != "" {
+		t.Error("CachePath outside a git repository should be empty")
+	}
+
+	if _, err := Build(dir, cachePath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tamper with the cached outline of util.go: an unchanged file is read
+	// from the cache, so the tampered outline comes back.
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		t.Fatalf("cache not written: %v", err)
+	}
+	var c cache
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	c.Files["util/util.go"].Symbols[0].Outline = "func Cached()"
+	data, _ = json.Marshal(c)
+	os.WriteFile(cachePath, data, 0644)
+
+	m, err := Build(dir, cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := m.Render("util", 1000); !strings.Contains(out, "func Cached()") {
+		t.Errorf("unchanged file should come from the cache:\n%s", out)
+	}
+
+	// A modified file is parsed again; a deleted one drops out.
+	util := filepath.Join(dir, "util", "util.go")
+	os.WriteFile(util, []byte("package util\n\nfunc Values() []string { return nil }\n"), 0644)
+	os.Chtimes(util, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	os.Remove(filepath.Join(dir, "main.go"))
+
+	m, err = Build(dir, cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := m.Render("", 2000)
+	if !strings.Contains(out, "func Values() []string") || strings.Contains(out, "Cached") || strings.Contains(out, "main.go") {
+		t.Errorf("stale cache entries used:\n%s", out)
+	}
+
+	// The cache is updated on disk too.
+	data, _ = os.ReadFile(cachePath)
+	if strings.Contains(string(data), "Cached") || strings.Contains(string(data), `"main.go"`) {
+		t.Error("cache file not refreshed")
+	}
+}
+
+func TestBuild_Ctags(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"app.py":      "class Greeter:\n    def greet(self, name):\n        return name\n",
+		"main.py":     "from app import Greeter\nGreeter().greet('x')\n",
+		"lib/util.go": "package lib\n\nfunc Util() {}\n",
+	})
+
+	defer func(old string) { CtagsCommand = old }(CtagsCommand)
+
+	// Without ctags, non-Go files are counted but not outlined.
+	CtagsCommand = "clyde-no-such-ctags"
+	m, err := Build(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := m.Render("", 1000)
+	if m.Unparsed != 2 || !strings.Contains(out, "2 non-Go source files not outlined: install Universal Ctags") {
+		t.Errorf("missing ctags not reported (unparsed=%d):\n%s", m.Unparsed, out)
+	}
+
+	// A fake ctags that prints JSON tags for app.py.
+	fake := filepath.Join(t.TempDir(), "ctags")
+	script := "#!/bin/sh\ncat > /dev/null\n" +
+		`echo '{"_type": "ptag", "name": "JSON_OUTPUT_VERSION"}'` + "\n" +
+		`echo '{"_type": "tag", "name": "Greeter", "path": "app.py", "line": 1, "kind": "class"}'` + "\n" +
+		`echo '{"_type": "tag", "name": "greet", "path": "app.py", "line": 2, "kind": "member", "scope": "Greeter"}'` + "\n" +
+		`echo '{"_type": "tag", "name": "greet", "path": "app.py", "line": 2, "kind": "method", "signature": "(self, name)", "scope": "Greeter"}'` + "\n"
+	if err := os.WriteFile(fake, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	CtagsCommand = fake
+
+	m, err = Build(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = m.Render("", 1000)
+	if m.Unparsed != 0 {
+		t.Errorf("unparsed = %d, want 0", m.Unparsed)
+	}
+	for _, want := range []string{"app.py\n  1: class Greeter\n  2: method Greeter.greet(self, name)\n", "lib/util.go (package lib)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q:\n%s", want, out)
+		}
+	}
+	// main.py refers to Greeter, so app.py ranks first.
+	if !strings.Contains(out, "most referenced first.\n\napp.py") {
+		t.Errorf("app.py should rank first:\n%s", out)
+	}
+}
+
+func TestGenerate_Focus(t *testing.T) {
+	dir := fixture(t)
+	out, err := Generate(filepath.Join(dir, "api"), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "Repository map of api: 1 source file") {
+		t.Errorf("unexpected map:\n%s", out)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".clyde", "repomap.json")); err != nil {
+		t.Errorf("cache not written at the repository root: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, ".gitignore")); !strings.Contains(string(data), "\n.clyde/repomap.json\n") {
+		t.Errorf("cache should be git-ignored, .gitignore:\n%s", data)
+	}
+}
@@ -0,0 +1,288 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/todo"
+)
+
+// compactionSummaryPrefix marks the synthetic user message that Compact()
+// injects. It is not a real user turn and cannot be rewound to.
+const compactionSummaryPrefix = "[System: Compaction Summary]"
+
+// RewindPoint is a user turn the conversation can be rewound to.
+type RewindPoint struct {
+	// Index is the position of the user message in GetHistory().
+	Index int
+	// Text is the user's message as it was sent.
+	Text string
+}
+
+// FileRestore reports the outcome of undoing file edits after a rewind.
+type FileRestore struct {
+	// Restored lists the paths returned to their earlier content.
+	Restored []string
+	// Skipped lists edits that could not be undone, as "path: reason".
+	Skipped []string
+}
+
+// RewindPoints returns the user turns in the current history, oldest first.
+// Tool results and the synthetic compaction summary are not user turns and
+// are excluded.
+func (a *Agent) RewindPoints() []RewindPoint {
+	var points []RewindPoint
+	for i, msg := range a.history {
+		if msg.Role != "user" {
+			continue
+		}
+		text, ok := msg.Content.(string)
+		if !ok || strings.HasPrefix(text, compactionSummaryPrefix) {
+			continue
+		}
+		points = append(points, RewindPoint{Index: i, Text: text})
+	}
+	return points
+}
+
+// RewindTo truncates the conversation history just before the user message at
+// messageIndex, so the conversation continues as if that message had never
+// been sent. The index must refer to one of the points returned by
+// RewindPoints. Returns the removed messages (starting with the rewound user
+// message) so the caller can inspect or undo their effects.
+//
+// Token usage from the last API response no longer describes the history, so
+// it is reset; compaction thresholds are re-measured on the next API call. If
+// the removed messages changed the todo list, it goes back to the last list
+// todo_write set in the kept history, or is cleared. The todo callback is not
+// called; callers with a session may restore the list saved there instead.
+func (a *Agent) RewindTo(messageIndex int) ([]Message, error) {
+	if messageIndex < 0 || messageIndex >= len(a.history) {
+		return nil, fmt.Errorf("rewind index %d out of range (history has %d messages)", messageIndex, len(a.history))
+	}
+	valid := false
+	for _, p := range a.RewindPoints() {
+		if p.Index == messageIndex {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("message %d is not a user turn; use RewindPoints() to list valid targets", messageIndex)
+	}
+
+	removed := make([]Message, len(a.history)-messageIndex)
+	copy(removed, a.history[messageIndex:])
+	a.history = a.history[:messageIndex:messageIndex]
+	a.lastUsage = providers.Usage{}
+	if _, changed := lastTodoWrite(removed); changed {
+		a.todos, _ = lastTodoWrite(a.history)
+	}
+
+	return removed, nil
+}
+
+// lastTodoWrite returns the todo list set by the last todo_write call in
+// msgs, and whether there was one.
+func lastTodoWrite(msgs []Message) ([]TodoItem, bool) {
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role != "assistant" {
+			continue
+		}
+		blocks, ok := msgs[i].Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+		for j := len(blocks) - 1; j >= 0; j-- {
+			b := blocks[j]
+			if b.Type != "tool_use" || b.Name != todoWriteTool.Name {
+				continue
+			}
+			if todos, err := todo.Parse(b.Input["todos"]); err == nil {
+				return todos, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// RestoreFiles undoes the file edits recorded in removed (as returned by
+// RewindTo), newest first. When checkpointing is enabled, every turn whose
+// tool calls appear in removed is reverted from its checkpoint. Edits without
+// a checkpoint are reversed from the tool calls themselves: patch_file and
+// multi_patch swap new_text back to old_text, and files created by write_file
+// are deleted; apply_patch edits are only undone from checkpoints. Anything
+// that cannot be reversed safely — a file changed since, an overwrite whose
+// previous content was never recorded, a shell command — is reported in
+// Skipped and left alone.
+func (a *Agent) RestoreFiles(removed []Message) FileRestore {
+	type edit struct {
+		id     string
+		name   string
+		input  map[string]interface{}
+		result string
+	}
+
+	// Pair successful tool calls with their results.
+	results := make(map[string]providers.ContentBlock)
+	for _, msg := range removed {
+		blocks, ok := msg.Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+		for _, b := range blocks {
+			if b.Type == "tool_result" {
+				results[b.ToolUseID] = b
+			}
+		}
+	}
+	var edits []edit
+	ranBash := false
+	for _, msg := range removed {
+		if msg.Role != "assistant" {
+			continue
+		}
+		blocks, ok := msg.Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+		for _, b := range blocks {
+			if b.Type != "tool_use" {
+				continue
+			}
+			res, ok := results[b.ID]
+			if !ok || res.IsError {
+				continue
+			}
+			switch b.Name {
+			case "patch_file", "multi_patch", "apply_patch", "write_file":
+				text, _ := res.Content.(string)
+				edits = append(edits, edit{id: b.ID, name: b.Name, input: b.Input, result: text})
+			case "run_bash":
+				ranBash = true
+			}
+		}
+	}
+
+	var report FileRestore
+	restored := make(map[string]bool)
+	markRestored := func(path string) {
+		if !restored[path] {
+			restored[path] = true
+			report.Restored = append(report.Restored, path)
+		}
+	}
+
+	// Checkpoints first: they restore exact prior contents, including
+	// overwrites the fallback below cannot undo.
+	covered := make(map[string]bool)
+	if a.checkpoints != nil && len(edits) > 0 {
+		ids := make(map[string]bool)
+		for _, e := range edits {
+			ids[e.id] = true
+		}
+		undone, err := a.checkpoints.UndoToolUses(ids)
+		if err != nil {
+			report.Skipped = append(report.Skipped, fmt.Sprintf("checkpoints: %v", err))
+		}
+		for _, res := range undone {
+			for _, id := range res.Turn.ToolUseIDs {
+				covered[id] = true
+			}
+			for _, p := range res.Restored {
+				markRestored(p)
+			}
+			report.Skipped = append(report.Skipped, res.Skipped...)
+		}
+	}
+
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		if covered[e.id] {
+			continue
+		}
+		switch e.name {
+		case "patch_file":
+			path, _ := e.input["path"].(string)
+			oldText, _ := e.input["old_text"].(string)
+			newText, _ := e.input["new_text"].(string)
+			if err := reversePatch(path, oldText, newText); err != nil {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("%s: %v", path, err))
+			} else {
+				markRestored(path)
+			}
+		case "multi_patch":
+			patches, _ := e.input["patches"].([]interface{})
+			for j := len(patches) - 1; j >= 0; j-- {
+				p, _ := patches[j].(map[string]interface{})
+				path, _ := p["path"].(string)
+				oldText, _ := p["old_text"].(string)
+				newText, _ := p["new_text"].(string)
+				if err := reversePatch(path, oldText, newText); err != nil {
+					report.Skipped = append(report.Skipped, fmt.Sprintf("%s: %v", path, err))
+				} else {
+					markRestored(path)
+				}
+			}
+		case "apply_patch":
+			report.Skipped = append(report.Skipped,
+				"apply_patch: no checkpoint recorded; patch cannot be reversed safely")
+		case "write_file":
+			path, _ := e.input["path"].(string)
+			content, _ := e.input["content"].(string)
+			if !strings.HasPrefix(e.result, "Successfully created") {
+				report.Skipped = append(report.Skipped,
+					fmt.Sprintf("%s: overwritten by write_file; previous content was not recorded", path))
+				continue
+			}
+			current, err := os.ReadFile(path)
+			if err != nil {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("%s: %v", path, err))
+				continue
+			}
+			if string(current) != content {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("%s: modified since it was created", path))
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				report.Skipped = append(report.Skipped, fmt.Sprintf("%s: %v", path, err))
+				continue
+			}
+			markRestored(path)
+		}
+	}
+
+	if ranBash {
+		report.Skipped = append(report.Skipped, "run_bash: effects of shell commands cannot be undone")
+	}
+
+	return report
+}
+
+// reversePatch undoes a single find-and-replace edit by swapping newText back
+// to oldText. It refuses when newText is empty (the deleted text has no anchor)
+// or no longer appears exactly once.
+func reversePatch(path, oldText, newText string) error {
+	if newText == "" {
+		return fmt.Errorf("edit deleted text; no anchor to restore it at")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch n := strings.Count(string(content), newText); n {
+	case 1:
+	case 0:
+		return fmt.Errorf("edited text no longer present; file changed since")
+	default:
+		return fmt.Errorf("edited text appears %d times; cannot tell which to revert", n)
+	}
+	reverted := strings.Replace(string(content), newText, oldText, 1)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(reverted), info.Mode().Perm())
+}
@@ -0,0 +1,375 @@
+// Package sandbox runs commands (run_bash, run_tests, custom tools) in a
+// Linux namespace jail: the workspace is writable except for its .clyde
+// directory, the rest of the filesystem is read-only, /tmp is private, the
+// network is off unless allowed, and memory and CPU time can be capped.
+//
+// Sandboxing is configured per project in <repo>/.clyde/sandbox.json:
+//
+//	{
+//	  "enabled": true,
+//	  "network": false,
+//	  "writable": ["~/.cache/go-build", "~/go/pkg/mod"],
+//	  "memory_mb": 4096,
+//	  "cpu_seconds": 600
+//	}
+//
+// The jail is built with bubblewrap (bwrap) when it is installed and with
+// util-linux unshare otherwise; both need unprivileged user namespaces.
+// When sandboxing is enabled but unavailable, commands are refused rather
+// than run unconfined.
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+)
+
+// ConfigFile is the per-project sandbox configuration, relative to the
+// repository root.
+const ConfigFile = ".clyde/sandbox.json"
+
+// Config is the per-project sandbox configuration.
+type Config struct {
+	// Enabled turns the sandbox on for run_bash.
+	Enabled bool `json:"enabled"`
+	// Backend is "auto" (default: bwrap if installed, else unshare),
+	// "bwrap" or "unshare".
+	Backend string `json:"backend,omitempty"`
+	// Network allows network access (default false).
+	Network bool `json:"network,omitempty"`
+	// Writable lists extra writable paths besides the workspace and /tmp
+	// (a private tmpfs, or the shared /tmp when a writable path is in it):
+	// absolute, relative to the repository root, or starting with "~/".
+	// Paths that do not exist are ignored.
+	Writable []string `json:"writable,omitempty"`
+	// MemoryMB caps each command's virtual memory (0 = no limit).
+	MemoryMB int `json:"memory_mb,omitempty"`
+	// CPUSeconds caps each command's CPU time (0 = no limit).
+	CPUSeconds int `json:"cpu_seconds,omitempty"`
+}
+
+// Load reads the sandbox configuration of the repository containing dir.
+// It returns a nil Config (and no error) when the project has none.
+func Load(dir string) (*Config, string, error) {
+	root := ignore.New(dir).Root()
+	path := filepath.Join(root, filepath.FromSlash(ConfigFile))
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, root, nil
+	}
+	if err != nil {
+		return nil, root, fmt.Errorf("cannot read %s: %w", path, err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, root, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	switch cfg.Backend {
+	case "", "auto", "bwrap", "unshare":
+	default:
+		return nil, root, fmt.Errorf("invalid %s: backend must be \"auto\", \"bwrap\" or \"unshare\", got %q", path, cfg.Backend)
+	}
+	if cfg.MemoryMB < 0 || cfg.CPUSeconds < 0 {
+		return nil, root, fmt.Errorf("invalid %s: memory_mb and cpu_seconds must not be negative", path)
+	}
+	return &cfg, root, nil
+}
+
+// Sandbox runs commands confined to a workspace.
+type Sandbox struct {
+	cfg       Config
+	workspace string
+	writable  []string // absolute, existing paths including the workspace
+	readOnly  []string // paths inside the workspace kept read-only (.clyde)
+	backend   string
+}
+
+// probes caches whether each backend works on this machine.
+var (
+	probeMu sync.Mutex
+	probes  = make(map[string]error)
+)
+
+// New prepares a sandbox for the workspace (normally the repository root).
+// It fails if no backend can create namespaces on this machine.
+func New(cfg Config, workspace string) (*Sandbox, error) {
+	if runtime.GOOS != "linux" {
+		return nil, fmt.Errorf("sandboxing requires Linux (running on %s)", runtime.GOOS)
+	}
+	ws, err := filepath.Abs(workspace)
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(ws); err == nil {
+		ws = resolved
+	}
+	s := &Sandbox{cfg: cfg, workspace: ws, writable: []string{ws}}
+	// The configuration (and the hooks and tools beside it) stays out of
+	// reach, so a command cannot loosen the sandbox for later sessions.
+	if info, err := os.Stat(filepath.Join(ws, filepath.Dir(ConfigFile))); err == nil && info.IsDir() {
+		s.readOnly = append(s.readOnly, filepath.Join(ws, filepath.Dir(ConfigFile)))
+	}
+	home, _ := os.UserHomeDir()
+	for _, p := range cfg.Writable {
+		switch {
+		case strings.HasPrefix(p, "~/") && home != "":
+			p = filepath.Join(home, p[2:])
+		case !filepath.IsAbs(p):
+			p = filepath.Join(ws, p)
+		}
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			s.writable = append(s.writable, resolved)
+		}
+	}
+
+	var candidates []string
+	switch cfg.Backend {
+	case "bwrap", "unshare":
+		candidates = []string{cfg.Backend}
+	default:
+		candidates = []string{"bwrap", "unshare"}
+	}
+	var errs []string
+	for _, backend := range candidates {
+		if err := probe(backend); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", backend, err))
+			continue
+		}
+		s.backend = backend
+		return s, nil
+	}
+	return nil, fmt.Errorf("no sandbox backend is usable (%s)", strings.Join(errs, "; "))
+}
+
+// probe checks once per process that a backend can create a jail.
+func probe(backend string) error {
+	probeMu.Lock()
+	defer probeMu.Unlock()
+	if err, ok := probes[backend]; ok {
+		return err
+	}
+	var err error
+	if _, lookErr := exec.LookPath(backend); lookErr != nil {
+		err = fmt.Errorf("not installed")
+	} else {
+		var cmd *exec.Cmd
+		if backend == "bwrap" {
+			cmd = exec.Command("bwrap", "--ro-bind", "/", "/", "--unshare-net", "true")
+		} else {
+			cmd = exec.Command("unshare", "--user", "--map-root-user", "--mount", "--net", "true")
+		}
+		if out, runErr := cmd.CombinedOutput(); runErr != nil {
+			err = fmt.Errorf("cannot create namespaces: %s", strings.TrimSpace(string(out)))
+		}
+	}
+	probes[backend] = err
+	return err
+}
+
+// Backend returns the backend in use ("bwrap" or "unshare").
+func (s *Sandbox) Backend() string {
+	return s.backend
+}
+
+// Describe summarizes the sandbox's restrictions, e.g.
+// "bwrap; network off; 4096 MB memory; 600s CPU".
+func (s *Sandbox) Describe() string {
+	parts := []string{s.backend}
+	if s.cfg.Network {
+		parts = append(parts, "network on")
+	} else {
+		parts = append(parts, "network off")
+	}
+	if s.cfg.MemoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("%d MB memory", s.cfg.MemoryMB))
+	}
+	if s.cfg.CPUSeconds > 0 {
+		parts = append(parts, fmt.Sprintf("%ds CPU", s.cfg.CPUSeconds))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Command returns a command that runs a bash script inside the sandbox,
+// in the current directory if it is writable and the workspace otherwise.
+func (s *Sandbox) Command(script string) *exec.Cmd {
+	return s.command(context.Background(), script)
+}
+
+// CommandContext returns a command that runs a program inside the sandbox,
+// in dir, killed when ctx is done.
+func (s *Sandbox) CommandContext(ctx context.Context, dir, name string, args ...string) *exec.Cmd {
+	words := []string{"exec", shellQuote(name)}
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	return s.command(ctx, fmt.Sprintf("cd %s || exit 1\n%s", shellQuote(dir), strings.Join(words, " ")))
+}
+
+// command builds the sandboxed bash command for Command and CommandContext.
+func (s *Sandbox) command(ctx context.Context, script string) *exec.Cmd {
+	dir, err := os.Getwd()
+	if err == nil {
+		dir, err = filepath.EvalSymlinks(dir)
+	}
+	if err != nil || !s.isWritable(dir) {
+		dir = s.workspace
+	}
+	script = s.limits() + script
+
+	if s.backend == "bwrap" {
+		args := []string{"--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp"}
+		for _, p := range s.writable {
+			args = append(args, "--bind", p, p)
+		}
+		for _, p := range s.readOnly {
+			args = append(args, "--ro-bind", p, p)
+		}
+		if !s.cfg.Network {
+			args = append(args, "--unshare-net")
+		}
+		args = append(args, "--unshare-pid", "--die-with-parent", "--chdir", dir, "--", "bash", "-c", script)
+		return exec.CommandContext(ctx, "bwrap", args...)
+	}
+
+	args := []string{"--user", "--map-root-user", "--mount", "--pid", "--fork", "--mount-proc"}
+	if !s.cfg.Network {
+		args = append(args, "--net")
+	}
+	args = append(args, "--", "bash", "-c", s.unshareSetup(dir), "sandbox", script)
+	return exec.CommandContext(ctx, "unshare", args...)
+}
+
+// isWritable reports whether path is inside a writable root.
+func (s *Sandbox) isWritable(path string) bool {
+	for _, p := range s.writable {
+		if path == p || strings.HasPrefix(path, p+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// limits returns the ulimit prefix applying the memory and CPU caps.
+func (s *Sandbox) limits() string {
+	var b strings.Builder
+	if s.cfg.MemoryMB > 0 {
+		fmt.Fprintf(&b, "ulimit -v %d || exit 1\n", s.cfg.MemoryMB*1024)
+	}
+	if s.cfg.CPUSeconds > 0 {
+		fmt.Fprintf(&b, "ulimit -t %d || exit 1\n", s.cfg.CPUSeconds)
+	}
+	return b.String()
+}
+
+// unshareSetup is the script run inside the new namespaces (as the mapped
+// root user) before the command itself, passed as $1: it gives /tmp a
+// private tmpfs, bind-mounts the writable paths onto themselves and the
+// read-only paths inside them read-only, then remounts every other mount
+// read-only.
+func (s *Sandbox) unshareSetup(dir string) string {
+	privateTmp := true
+	for _, p := range s.writable {
+		if p == "/tmp" || strings.HasPrefix(p, "/tmp/") {
+			// A tmpfs would hide it, so /tmp stays the shared one.
+			privateTmp = false
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("set -e\n")
+	skip := []string{"/proc", "/proc/*", "/dev", "/dev/*", "/sys", "/sys/*", "/tmp"}
+	if privateTmp {
+		b.WriteString("mount -t tmpfs tmpfs /tmp\n")
+	} else {
+		b.WriteString("mount --bind /tmp /tmp\n")
+	}
+	for _, p := range s.writable {
+		fmt.Fprintf(&b, "mount --bind %s %s\n", shellQuote(p), shellQuote(p))
+		skip = append(skip, shellQuote(p), shellQuote(p)+"/*")
+	}
+	for _, p := range s.readOnly {
+		fmt.Fprintf(&b, "mount --bind %s %s\n", shellQuote(p), shellQuote(p))
+		fmt.Fprintf(&b, "mount -o remount,bind,ro %s\n", shellQuote(p))
+	}
+	b.WriteString("awk '{print $2}' /proc/self/mounts | while read -r m; do\n")
+	fmt.Fprintf(&b, "  case \"$m\" in %s) continue ;; esac\n", strings.Join(skip, "|"))
+	b.WriteString("  mount -o remount,bind,ro \"$m\" 2>/dev/null || true\n")
+	b.WriteString("done\n")
+	b.WriteString("set +e\n")
+	fmt.Fprintf(&b, "cd %s\n", shellQuote(dir))
+	// Not exec: unshare cannot pass on a death by SIGXCPU, so this shell
+	// turns it into the usual 128+signal exit status.
+	b.WriteString("bash -c \"$1\"\nexit $?\n")
+	return b.String()
+}
+
+// shellQuote quotes a string for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// Explain turns the signs of a sandbox restriction in a command's output
+// into a note telling the model what was blocked and how to proceed. It
+// returns "" when nothing in the output points at the sandbox.
+func (s *Sandbox) Explain(output string, exitCode int) string {
+	var notes []string
+	// bash and C programs say "Read-only file system", Go "read-only file system"
+	if containsAny(output, []string{"Read-only file system", "read-only file system"}) {
+		writable := append([]string{}, s.writable...)
+		writable = append(writable, "/tmp")
+		notes = append(notes, fmt.Sprintf("Sandbox: the command tried to write outside the writable paths (%s); everything else is read-only. Ask the user to add the path to \"writable\" in %s, or retry with unsandboxed: true (requires the user's approval).",
+			strings.Join(writable, ", "), ConfigFile))
+	}
+	if !s.cfg.Network && containsAny(output, networkErrors) {
+		notes = append(notes, fmt.Sprintf("Sandbox: network access is disabled. Ask the user to set \"network\": true in %s, or retry with unsandboxed: true (requires the user's approval).", ConfigFile))
+	}
+	if s.cfg.MemoryMB > 0 && containsAny(output, memoryErrors) {
+		notes = append(notes, fmt.Sprintf("Sandbox: the command ran out of memory under the %d MB limit (memory_mb in %s).", s.cfg.MemoryMB, ConfigFile))
+	}
+	// A process over its CPU time gets SIGXCPU (exit status 128+24), or
+	// SIGKILL (128+9) at the hard limit when SIGXCPU is ignored, as it is in
+	// processes started from Go.
+	if s.cfg.CPUSeconds > 0 && (exitCode == 152 || exitCode == 137 || strings.Contains(output, "CPU time limit exceeded")) {
+		notes = append(notes, fmt.Sprintf("Sandbox: the command was stopped after the %ds CPU time limit (cpu_seconds in %s).", s.cfg.CPUSeconds, ConfigFile))
+	}
+	return strings.Join(notes, "\n")
+}
+
+// networkErrors are messages common tools print when the network is gone.
+var networkErrors = []string{
+	"Could not resolve host",
+	"Temporary failure in name resolution",
+	"Network is unreachable",
+	"network is unreachable",
+	"Name or service not known",
+	"no such host",
+	"getaddrinfo",
+	"Failed to establish a new connection",
+}
+
+// memoryErrors are messages printed when an allocation fails.
+var memoryErrors = []string{
+	"Cannot allocate memory",
+	"cannot allocate memory",
+	"out of memory",
+	"MemoryError",
+	"std::bad_alloc",
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
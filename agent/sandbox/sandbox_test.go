@@ -0,0 +1,176 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newSandbox creates a sandbox over a fresh workspace, skipping the test
+// when this machine cannot create user namespaces.
+func newSandbox(t *testing.T, cfg Config) (*Sandbox, string) {
+	t.Helper()
+	workspace := t.TempDir()
+	s, err := New(cfg, workspace)
+	if err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	ws, _ := filepath.EvalSymlinks(workspace)
+	return s, ws
+}
+
+func run(t *testing.T, s *Sandbox, script string) (string, int) {
+	t.Helper()
+	out, err := s.Command(script).CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(out), 0
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, ".git"), 0755)
+	sub := filepath.Join(dir, "pkg")
+	os.Mkdir(sub, 0755)
+
+	cfg, root, err := Load(sub)
+	if err != nil || cfg != nil || root != dir {
+		t.Fatalf("no config: got %+v, %q, %v", cfg, root, err)
+	}
+
+	os.Mkdir(filepath.Join(dir, ".clyde"), 0755)
+	path := filepath.Join(dir, ".clyde", "sandbox.json")
+	os.WriteFile(path, []byte(`{"enabled": true, "writable": ["build"], "memory_mb": 512}`), 0644)
+	cfg, _, err = Load(sub)
+	if err != nil || !cfg.Enabled || cfg.Network || cfg.MemoryMB != 512 || len(cfg.Writable) != 1 {
+		t.Fatalf("got %+v, %v", cfg, err)
+	}
+
+	for content, want := range map[string]string{
+		`{"enabled": true, "backend": "docker"}`: "backend must be",
+		`{"enabled": true, "cpu_seconds": -1}`:   "must not be negative",
+		`{"enabled": `:                           "invalid",
+	} {
+		os.WriteFile(path, []byte(content), 0644)
+		if _, _, err := Load(sub); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Load(%s) error = %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestSandbox_Filesystem(t *testing.T) {
+	s, ws := newSandbox(t, Config{Enabled: true})
+
+	out, code := run(t, s, "pwd && echo hi > inside.txt && cat inside.txt && echo tmp > /tmp/scratch && cat /tmp/scratch")
+	if code != 0 || !strings.Contains(out, ws+"\nhi\ntmp") {
+		t.Fatalf("workspace and /tmp should be writable (exit %d):\n%s", code, out)
+	}
+	if data, err := os.ReadFile(filepath.Join(ws, "inside.txt")); err != nil || string(data) != "hi\n" {
+		t.Errorf("workspace write not visible outside: %q, %v", data, err)
+	}
+
+	// Everything outside the workspace is read-only but still readable.
+	target, _ := filepath.Abs("outside.txt")
+	defer os.Remove(target)
+	out, code = run(t, s, "cat /etc/hostname > /dev/null && echo read-ok; echo x > "+target)
+	if code == 0 || !strings.Contains(out, "read-ok") || !strings.Contains(out, "Read-only file system") {
+		t.Fatalf("write outside the workspace should fail (exit %d):\n%s", code, out)
+	}
+	if _, err := os.Stat(target); err == nil {
+		t.Error("file was created outside the workspace")
+	}
+	note := s.Explain(out, code)
+	if !strings.Contains(note, "write outside the writable paths ("+ws) || !strings.Contains(note, "unsandboxed: true") {
+		t.Errorf("unexpected note: %q", note)
+	}
+}
+
+func TestSandbox_ConfigReadOnly(t *testing.T) {
+	for _, backend := range []string{"bwrap", "unshare"} {
+		t.Run(backend, func(t *testing.T) {
+			workspace := t.TempDir()
+			os.Mkdir(filepath.Join(workspace, ".clyde"), 0755)
+			config := filepath.Join(workspace, ConfigFile)
+			os.WriteFile(config, []byte(`{"enabled": true}`), 0644)
+			s, err := New(Config{Enabled: true, Backend: backend}, workspace)
+			if err != nil {
+				t.Skipf("%s unavailable: %v", backend, err)
+			}
+
+			out, code := run(t, s, `echo '{"enabled": false}' > .clyde/sandbox.json; touch .clyde/hooks.json; echo ok > other.txt`)
+			if !strings.Contains(out, "Read-only file system") {
+				t.Errorf("writing .clyde should fail (exit %d):\n%s", code, out)
+			}
+			if data, _ := os.ReadFile(config); string(data) != `{"enabled": true}` {
+				t.Errorf("config was changed to %q", data)
+			}
+			if _, err := os.Stat(filepath.Join(workspace, ".clyde", "hooks.json")); err == nil {
+				t.Error("file was created in .clyde")
+			}
+			if _, err := os.Stat(filepath.Join(workspace, "other.txt")); err != nil {
+				t.Errorf("the rest of the workspace should stay writable: %v", err)
+			}
+		})
+	}
+}
+
+func TestSandbox_CommandContext(t *testing.T) {
+	s, ws := newSandbox(t, Config{Enabled: true})
+	os.Mkdir(filepath.Join(ws, "it's"), 0755)
+	out, err := s.CommandContext(context.Background(), filepath.Join(ws, "it's"), "sh", "-c", `pwd; echo "$1"`, "sh", "a b").CombinedOutput()
+	if err != nil || string(out) != filepath.Join(ws, "it's")+"\na b\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
+
+func TestSandbox_WritableAndLimits(t *testing.T) {
+	extra := t.TempDir()
+	s, _ := newSandbox(t, Config{Enabled: true, Writable: []string{extra, "missing-dir"}, CPUSeconds: 1, MemoryMB: 64})
+
+	out, code := run(t, s, "echo ok > "+filepath.Join(extra, "f")+" && cat "+filepath.Join(extra, "f"))
+	if code != 0 || strings.TrimSpace(out) != "ok" {
+		t.Errorf("extra writable path should be writable (exit %d):\n%s", code, out)
+	}
+
+	out, code = run(t, s, "while :; do :; done")
+	if code != 152 && code != 137 {
+		t.Errorf("CPU limit: exit %d, want 152 or 137:\n%s", code, out)
+	}
+	if note := s.Explain(out, code); !strings.Contains(note, "1s CPU time limit") {
+		t.Errorf("CPU note = %q", note)
+	}
+
+	out, code = run(t, s, "head -c 200000000 /dev/zero | tr '\\0' x | sort > /dev/null")
+	if code == 0 {
+		t.Errorf("memory limit not applied:\n%s", out)
+	}
+	if note := s.Explain("sort: Cannot allocate memory", 2); !strings.Contains(note, "64 MB limit") {
+		t.Errorf("memory note = %q", note)
+	}
+	if got := s.Describe(); got != s.Backend()+"; network off; 64 MB memory; 1s CPU" {
+		t.Errorf("Describe = %q", got)
+	}
+}
+
+func TestSandbox_Network(t *testing.T) {
+	s, _ := newSandbox(t, Config{Enabled: true})
+	out, code := run(t, s, "cat /proc/net/dev")
+	if code != 0 || !strings.Contains(out, "lo:") || strings.Count(out, ":") != 1 {
+		t.Errorf("network should be isolated (loopback only):\n%s", out)
+	}
+	note := s.Explain("curl: (6) Could not resolve host: example.com", 6)
+	if !strings.Contains(note, "network access is disabled") {
+		t.Errorf("network note = %q", note)
+	}
+
+	open, _ := newSandbox(t, Config{Enabled: true, Network: true})
+	if note := open.Explain("curl: (6) Could not resolve host: example.com", 6); note != "" {
+		t.Errorf("no network note expected when the network is on, got %q", note)
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/this-is-alpha-iota/clyde/agent/plan"
 	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/todo"
 )
 
 // SessionInfo holds metadata about a session for listing purposes.
@@ -104,7 +106,7 @@ func MessageTypeFromFilename(filename string) string {
 //   - tool-result files → accumulate tool_result block on user message
 //   - assistant files → flush pending, new assistant message with text, flush
 //   - system files → flush pending, add system message
-//   - diagnostic/compaction files → skipped
+//   - diagnostic/compaction/todo files → skipped
 //
 // If a compaction has occurred (*_system.md exists), reconstruction starts
 // from the latest *_system.md forward. Otherwise all files are loaded.
@@ -187,8 +189,14 @@ func ReconstructHistory(sessionDir string) ([]providers.Message, []string, error
 
 		switch MessageType(msgType) {
 		case TypeUser:
-			flush()
 			userText := extractUserText(text)
+			if pending != nil && pending.role == "user" {
+				// A message queued during a turn went out with the tool
+				// results before it
+				pending.content = append(pending.content, providers.ContentBlock{Type: "text", Text: userText})
+				continue
+			}
+			flush()
 			pending = &pendingMessage{
 				role: "user",
 				content: []providers.ContentBlock{
@@ -289,8 +297,22 @@ func ReconstructHistory(sessionDir string) ([]providers.Message, []string, error
 				Role:    "assistant",
 				Content: "I've reviewed the compaction summary and understand the context. I'll continue from where we left off.",
 			})
+			// Compaction keeps an earlier approved plan pinned after the summary
+			if i == startIdx {
+				if markdown := latestApprovedPlan(sessionDir, files[:startIdx]); markdown != "" {
+					messages = append(messages, pinnedPlan(markdown)...)
+				}
+			}
+
+		case TypePlan:
+			// Approved plans are pinned in the history, as by the agent's
+			// ApprovePlan; proposed ones are not conversation content
+			if markdown, ok := approvedPlan(text); ok {
+				flush()
+				messages = append(messages, pinnedPlan(markdown)...)
+			}
 
-		case TypeDiagnostic, TypeCompaction:
+		case TypeDiagnostic, TypeCompaction, TypeTodo:
 			// Skip — not conversation content
 			continue
 
@@ -342,6 +364,67 @@ func ReconstructHistory(sessionDir string) ([]providers.Message, []string, error
 	return messages, warnings, nil
 }
 
+// approvedPlan returns the plan in the content of a plan message, if it was
+// approved.
+func approvedPlan(content string) (string, bool) {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, planApproved) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(content, planApproved)), true
+}
+
+// latestApprovedPlan returns the last approved plan among files, or "".
+func latestApprovedPlan(sessionDir string, files []string) string {
+	for i := len(files) - 1; i >= 0; i-- {
+		if MessageTypeFromFilename(files[i]) != string(TypePlan) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(sessionDir, files[i]))
+		if err != nil {
+			continue
+		}
+		if markdown, ok := approvedPlan(string(content)); ok {
+			return markdown
+		}
+	}
+	return ""
+}
+
+// pinnedPlan returns the messages that pin an approved plan in the history,
+// matching the agent's ApprovePlan.
+func pinnedPlan(markdown string) []providers.Message {
+	return []providers.Message{
+		{Role: "user", Content: plan.ApprovedPrefix + "\n\n" + markdown},
+		{Role: "assistant", Content: plan.ApprovedAck},
+	}
+}
+
+// LatestTodos returns the todo list saved last in a session directory, or
+// nil if the agent never wrote one.
+func LatestTodos(sessionDir string) ([]todo.Item, error) {
+	files, err := filepath.Glob(filepath.Join(sessionDir, "*_"+string(TypeTodo)+".md"))
+	if err != nil || len(files) == 0 {
+		return nil, err
+	}
+	sort.Strings(files)
+	latest := files[len(files)-1]
+	content, err := os.ReadFile(latest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filepath.Base(latest), err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if rest, ok := strings.CutPrefix(line, "todos: "); ok {
+			var items []todo.Item
+			if err := json.Unmarshal([]byte(rest), &items); err != nil {
+				return nil, fmt.Errorf("malformed todo list in %s: %w", filepath.Base(latest), err)
+			}
+			return items, nil
+		}
+	}
+	return nil, fmt.Errorf("no todos line in %s", filepath.Base(latest))
+}
+
 // pendingMessage accumulates content blocks for a message being built.
 type pendingMessage struct {
 	role    string
@@ -444,7 +527,7 @@ func ListSessions(sessionsRoot string) ([]SessionInfo, error) {
 				continue
 			}
 			msgType := MessageTypeFromFilename(name)
-			if msgType != string(TypeDiagnostic) && msgType != string(TypeCompaction) {
+			if msgType != string(TypeDiagnostic) && msgType != string(TypeCompaction) && msgType != string(TypeTodo) && msgType != string(TypePlan) {
 				messageCount++
 			}
 			// Get first user message for summary
@@ -478,16 +561,40 @@ func ListSessions(sessionsRoot string) ([]SessionInfo, error) {
 // Creates a new directory: <timestamp>_<user>_from_<source-session-id>/
 // Returns the path to the new directory.
 func CopyForResume(sourceDir, sessionsRoot, username string) (string, error) {
+	return copySession(sourceDir, sessionsRoot, username, time.Time{})
+}
+
+// CopyUntil copies a session directory, keeping only the message files
+// timestamped strictly before cutoff. Used to fork a session at an earlier
+// point (rewind) without destroying the original transcript.
+// Creates a new directory: <timestamp>_<user>_from_<source-session-id>/
+// Returns the path to the new directory.
+func CopyUntil(sourceDir, sessionsRoot, username string, cutoff time.Time) (string, error) {
+	return copySession(sourceDir, sessionsRoot, username, cutoff)
+}
+
+// copySession implements CopyForResume and CopyUntil. A zero cutoff copies
+// every file. If the branch directory name is already taken (two branches of
+// the same session within one second), the timestamp is bumped until free.
+func copySession(sourceDir, sessionsRoot, username string, cutoff time.Time) (string, error) {
 	sourceID := filepath.Base(sourceDir)
 	now := time.Now()
 	newDirName := FormatTimestampDir(now) + "_" + username + "_from_" + sourceID
 	newDir := filepath.Join(sessionsRoot, newDirName)
+	for {
+		if _, err := os.Stat(newDir); os.IsNotExist(err) {
+			break
+		}
+		now = now.Add(time.Second)
+		newDirName = FormatTimestampDir(now) + "_" + username + "_from_" + sourceID
+		newDir = filepath.Join(sessionsRoot, newDirName)
+	}
 
 	if err := os.MkdirAll(newDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create branch directory: %w", err)
 	}
 
-	// Copy all files from source to new directory
+	// Copy files from source to new directory
 	entries, err := os.ReadDir(sourceDir)
 	if err != nil {
 		return "", fmt.Errorf("failed to read source session: %w", err)
@@ -497,6 +604,12 @@ func CopyForResume(sourceDir, sessionsRoot, username string) (string, error) {
 		if e.IsDir() {
 			continue
 		}
+		if !cutoff.IsZero() {
+			ts, err := ParseTimestampFromFilename(e.Name())
+			if err != nil || !ts.Before(cutoff) {
+				continue
+			}
+		}
 		srcPath := filepath.Join(sourceDir, e.Name())
 		dstPath := filepath.Join(newDir, e.Name())
 
@@ -512,6 +625,43 @@ func CopyForResume(sourceDir, sessionsRoot, username string) (string, error) {
 	return newDir, nil
 }
 
+// UserMessage is a persisted user turn: the timestamp of its file and its text.
+type UserMessage struct {
+	Timestamp time.Time
+	Text      string
+}
+
+// ListUserMessages returns the user messages in a session directory, oldest
+// first. Used to map an in-memory user turn back to its file on disk.
+func ListUserMessages(sessionDir string) ([]UserMessage, error) {
+	entries, err := os.ReadDir(sessionDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && MessageTypeFromFilename(e.Name()) == string(TypeUser) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var msgs []UserMessage
+	for _, name := range names {
+		ts, err := ParseTimestampFromFilename(name)
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(sessionDir, name))
+		if err != nil {
+			continue
+		}
+		msgs = append(msgs, UserMessage{Timestamp: ts, Text: extractUserText(string(content))})
+	}
+	return msgs, nil
+}
+
 // --- Content extraction helpers ---
 
 // extractUserText extracts user text from a user message file.
@@ -10,12 +10,13 @@
 //
 // File naming: <timestamp>_<type>.md
 //   - Timestamp: ISO-8601 with milliseconds, hyphens for colons
-//   - Type: user, assistant, system, thinking, tool-use, tool-result, diagnostic, compaction
+//   - Type: user, assistant, system, thinking, tool-use, tool-result, diagnostic, compaction, todo, plan
 //
 // Design: see docs/sessions-history.md
 package session
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
@@ -25,6 +26,9 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+	"github.com/this-is-alpha-iota/clyde/agent/todo"
 )
 
 // MessageType identifies the kind of message being persisted.
@@ -39,6 +43,8 @@ const (
 	TypeToolResult MessageType = "tool-result"
 	TypeDiagnostic MessageType = "diagnostic"
 	TypeCompaction MessageType = "compaction"
+	TypeTodo       MessageType = "todo"
+	TypePlan       MessageType = "plan"
 )
 
 // Session represents an active session with its directory and state.
@@ -103,14 +109,94 @@ func New() (*Session, error) {
 func (s *Session) WriteMessage(msgType MessageType, content string) error {
 	s.mu.Lock()
 	now := s.monotonicNow()
+	dir := s.Dir
 	s.mu.Unlock()
 
 	filename := FormatTimestampFile(now) + "_" + string(msgType) + ".md"
-	path := filepath.Join(s.Dir, filename)
+	path := filepath.Join(dir, filename)
 
 	return os.WriteFile(path, []byte(content), 0644)
 }
 
+// Fork branches the session at cutoff: a new session directory is created
+// containing only the files written before cutoff (see CopyUntil), and the
+// session switches to writing there. The original directory is left intact,
+// so the full transcript up to the fork is never lost.
+func (s *Session) Fork(cutoff time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newDir, err := CopyUntil(s.Dir, s.SessionsRoot, getUsername(), cutoff)
+	if err != nil {
+		return err
+	}
+	s.Dir = newDir
+	return nil
+}
+
+// Child creates a session in a subdirectory of s (e.g. "tasks/<id>") for
+// a sub-agent's conversation. Child directories are not part of the parent's
+// history: they are skipped when the parent is resumed or copied.
+func (s *Session) Child(name string) (*Session, error) {
+	s.mu.Lock()
+	dir := filepath.Join(s.Dir, name)
+	s.mu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory %s: %w", dir, err)
+	}
+	return &Session{
+		Dir:          dir,
+		SessionsRoot: s.SessionsRoot,
+	}, nil
+}
+
+// FormatTodos formats the agent's todo list for a todo message: a
+// checklist for reading, and the items as JSON on a "todos:" line for
+// LatestTodos.
+//
+// Format:
+//
+//	📋 Todos: 1/2 done
+//	- [x] 1: Add the parser
+//	- [~] 2: Wire it into the CLI
+//	todos: [{"id":"1",...}]
+func FormatTodos(items []todo.Item) string {
+	data, _ := json.Marshal(items)
+	if items == nil {
+		data = []byte("[]")
+	}
+	content := "📋 Todos: " + todo.Summary(items) + "\n"
+	if len(items) > 0 {
+		content += todo.Checklist(items) + "\n"
+	}
+	return content + "todos: " + string(data) + "\n"
+}
+
+// FormatPlan formats a plan from plan mode for a plan message. Approved
+// plans are restored on resume as the pinned plan of the history; proposed
+// ones are only kept for reading.
+//
+// Format:
+//
+//	📝 Plan (approved)
+//
+//	# Plan: Add a TASK_MODEL key
+//	...
+func FormatPlan(markdown string, approved bool) string {
+	status := planProposed
+	if approved {
+		status = planApproved
+	}
+	return status + "\n\n" + markdown + "\n"
+}
+
+// Headers of plan messages.
+const (
+	planProposed = "📝 Plan (proposed)"
+	planApproved = "📝 Plan (approved)"
+)
+
 // RelativeDir returns the session directory relative to the current working directory,
 // or the absolute path if it can't be made relative.
 func (s *Session) RelativeDir() string {
@@ -235,45 +321,9 @@ func NormalizeUsername(name string) string {
 
 // ensureGitignore adds .clyde/sessions/ to the repo's .gitignore if not already present.
 func ensureGitignore(sessionsRoot string) error {
-	// Find the repo root (parent of .clyde/sessions/)
 	// sessionsRoot is <repo>/.clyde/sessions/
-	clydeDir := filepath.Dir(sessionsRoot) // <repo>/.clyde
-	repoRoot := filepath.Dir(clydeDir)     // <repo>
-	gitignorePath := filepath.Join(repoRoot, ".gitignore")
-
-	entry := ".clyde/sessions/"
-
-	// Read existing .gitignore
-	content, err := os.ReadFile(gitignorePath)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to read .gitignore: %w", err)
-	}
-
-	// Check if already present
-	if strings.Contains(string(content), entry) {
-		return nil // already there
-	}
-
-	// Append the entry
-	f, err := os.OpenFile(gitignorePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open .gitignore: %w", err)
-	}
-	defer f.Close()
-
-	// Ensure we start on a new line
-	if len(content) > 0 && content[len(content)-1] != '\n' {
-		if _, err := f.WriteString("\n"); err != nil {
-			return err
-		}
-	}
-
-	// Add comment and entry
-	if _, err := f.WriteString("\n# Clyde session history\n" + entry + "\n"); err != nil {
-		return err
-	}
-
-	return nil
+	repoRoot := filepath.Dir(filepath.Dir(sessionsRoot))
+	return ignore.AddToGitignore(repoRoot, ".clyde/sessions/", "Clyde session history")
 }
 
 // StripANSI removes ANSI escape codes from a string.
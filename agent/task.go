@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+func init() {
+	registerAgentTool(taskTool, executeTask, displayTask)
+}
+
+var taskTool = providers.Tool{
+	Name: "task",
+	Description: "Delegate a self-contained job to a sub-agent that works in a fresh context and returns only its final report. " +
+		"Use it for broad searches and investigations whose intermediate output would flood this conversation, " +
+		"e.g. \"find every caller of X across the repository and summarize how each uses it\". " +
+		"The sub-agent sees none of this conversation, so the prompt must say everything it needs: the goal, relevant paths and names, and what the report should contain. " +
+		"By default it can only read (list_files, read_file, grep, glob, repo_map, include_file, web_search, browse and the lsp_* lookups). " +
+		"Do not delegate small lookups you can do with one or two tool calls.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"description": map[string]interface{}{
+				"type":        "string",
+				"description": "A short (3-8 word) description of the task, shown to the user",
+			},
+			"prompt": map[string]interface{}{
+				"type":        "string",
+				"description": "Complete instructions for the sub-agent, including what its final report should contain",
+			},
+			"tools": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "Tools the sub-agent may use, replacing the read-only default (e.g. add run_bash or write_file only when the task needs them). task itself is never available.",
+			},
+			"max_turns": map[string]interface{}{
+				"type":        "integer",
+				"description": fmt.Sprintf("Most API calls the sub-agent may make (2-%d, default %d). It is asked for its report on the last one.", maxTaskMaxTurns, DefaultTaskMaxTurns),
+			},
+			"model": map[string]interface{}{
+				"type":        "string",
+				"description": "Model for the sub-agent. Defaults to the configured task model, or this conversation's model.",
+			},
+		},
+		"required": []string{"description", "prompt"},
+	},
+}
+
+const (
+	// DefaultTaskMaxTurns is how many API calls a sub-agent may make when
+	// the task call sets no max_turns.
+	DefaultTaskMaxTurns = 30
+	// maxTaskMaxTurns caps max_turns.
+	maxTaskMaxTurns = 100
+)
+
+// readOnlyTaskTools are the tools a sub-agent gets when the task call names
+// none. Tools that are not registered (e.g. lsp_* without a language server)
+// are left out.
+var readOnlyTaskTools = []string{
+	"list_files", "read_file", "grep", "glob", "repo_map", "include_file", "web_search", "browse",
+	"lsp_definition", "lsp_references", "lsp_hover", "lsp_document_symbols", "lsp_workspace_symbols",
+}
+
+// subAgentPrompt is appended to the system prompt of sub-agents.
+const subAgentPrompt = `
+
+You are running as a sub-agent: another agent delegated the task in the next message to you. It cannot see your tool calls or their output, and there is no user to answer questions, so work autonomously with the tools you have. Your final message is returned to the other agent verbatim as your report. Make it complete and self-contained but concise: state what you found or did, with file paths and line numbers, names and short snippets where they help, and say what you could not verify. Do not narrate your process.`
+
+// SubAgentCallback is called when the task tool starts a sub-agent, with
+// the tool_use_id of the task call and its description. The options it
+// returns are applied to the sub-agent, e.g. callbacks that persist the
+// sub-agent's conversation in its own session directory.
+type SubAgentCallback func(toolUseID string, description string) []AgentOption
+
+// WithSubAgentCallback sets the callback that configures sub-agents started
+// by the task tool. Without it, sub-agents report progress (nested under the
+// task) and errors through this agent's callbacks, and nothing else.
+func WithSubAgentCallback(cb SubAgentCallback) AgentOption {
+	return func(a *Agent) {
+		a.subAgentCallback = cb
+	}
+}
+
+func executeTask(a *Agent, toolUseID string, input map[string]interface{}) (string, error) {
+	description, _ := input["description"].(string)
+	prompt, _ := input["prompt"].(string)
+	if strings.TrimSpace(prompt) == "" {
+		return "", fmt.Errorf("task requires a prompt: the complete instructions for the sub-agent, which sees nothing of this conversation")
+	}
+
+	names, err := taskTools(input["tools"])
+	if err != nil {
+		return "", err
+	}
+
+	maxTurns := DefaultTaskMaxTurns
+	if v, ok := input["max_turns"].(float64); ok {
+		maxTurns = int(v)
+		if maxTurns < 2 || maxTurns > maxTaskMaxTurns {
+			return "", fmt.Errorf("max_turns must be between 2 and %d, got %d", maxTaskMaxTurns, maxTurns)
+		}
+	}
+
+	model, _ := input["model"].(string)
+	child := a.newSubAgent(toolUseID, description, names, maxTurns, model)
+	report, err := child.HandleMessage(prompt)
+	if err != nil {
+		return "", fmt.Errorf("the sub-agent for %q failed: %w\n\nSuggestions:\n"+
+			"  - Retry with a narrower prompt, or a higher max_turns if it ran out of turns\n"+
+			"  - Do the work directly if it only needs a few tool calls", description, err)
+	}
+	if strings.TrimSpace(report) == "" {
+		return "(the sub-agent finished without a report)", nil
+	}
+	return report, nil
+}
+
+// taskTools validates the tools input of a task call, defaulting to the
+// read-only set.
+func taskTools(value interface{}) ([]string, error) {
+	if value == nil {
+		var names []string
+		for _, name := range readOnlyTaskTools {
+			if _, err := tools.GetTool(name); err == nil {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("tools must be an array of tool names")
+	}
+	var names []string
+	for _, v := range list {
+		name, _ := v.(string)
+		if name == "task" {
+			return nil, fmt.Errorf("a sub-agent cannot start tasks of its own; remove task from tools")
+		}
+		if _, err := tools.GetTool(name); err != nil {
+			return nil, fmt.Errorf("tools: %w. Available: %s", err, strings.Join(toolNames(tools.GetAllTools()), ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// newSubAgent builds the agent that runs a task: a fresh history, only the
+// given tools and turns, and the parent's prompt, settings and safeguards
+// (workspace, hooks, redaction, permissions, checkpoints).
+func (a *Agent) newSubAgent(toolUseID, description string, names []string, maxTurns int, model string) *Agent {
+	client := a.apiClient
+	if model == "" {
+		model = a.taskModel
+	}
+	if model != "" {
+		client = client.WithModel(model)
+	}
+
+	child := &Agent{
+		apiClient:                   client,
+		systemPrompt:                a.systemPrompt + subAgentPrompt,
+		history:                     []providers.Message{},
+		permissionCallback:          a.permissionCallback,
+		contextWindowSize:           a.contextWindowSize,
+		reserveTokens:               a.reserveTokens,
+		compactIncludeRecentContext: a.compactIncludeRecentContext,
+		toolResultThreshold:         a.toolResultThreshold,
+		microCompactPercent:         a.microCompactPercent,
+		microCompactKeepTurns:       a.microCompactKeepTurns,
+		lspServer:                   a.lspServer,
+		redactor:                    a.redactor,
+		workspace:                   a.workspace,
+		hooks:                       a.hooks,
+		turn:                        a.turn,
+		askUserDefault:              a.askUserDefault,
+		maxTurns:                    maxTurns,
+		parent:                      a,
+	}
+	WithTools(names...)(child)
+
+	// Pass the sub-agent's events on, marked with the task
+	child.eventHandlers = []EventHandler{a.forwardEvents(toolUseID)}
+	if a.subAgentCallback != nil {
+		for _, opt := range a.subAgentCallback(toolUseID, description) {
+			opt(child)
+		}
+	}
+	return child
+}
+
+func displayTask(input map[string]interface{}) string {
+	description, _ := input["description"].(string)
+	if description == "" {
+		return "→ Delegating task"
+	}
+	return fmt.Sprintf("→ Delegating task: %s", description)
+}
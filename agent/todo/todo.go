@@ -0,0 +1,95 @@
+// Package todo holds the task list the agent keeps with the todo_write and
+// todo_read tools, so its plan survives long turns and compaction.
+package todo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Statuses of an item.
+const (
+	Pending    = "pending"
+	InProgress = "in_progress"
+	Done       = "done"
+)
+
+// Item is one entry of the list.
+type Item struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	Status  string `json:"status"`
+}
+
+// Parse validates the todos input of a todo_write call: an array of items
+// with unique IDs, non-empty content, a known status, and at most one item
+// in progress.
+func Parse(value interface{}) ([]Item, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("todos must be an array of {id, content, status} items (pass the whole list, [] to clear it)")
+	}
+	items := make([]Item, 0, len(list))
+	seen := make(map[string]bool)
+	inProgress := ""
+	for i, v := range list {
+		m, _ := v.(map[string]interface{})
+		item := Item{}
+		item.ID, _ = m["id"].(string)
+		item.Content, _ = m["content"].(string)
+		item.Status, _ = m["status"].(string)
+		item.ID = strings.TrimSpace(item.ID)
+		item.Content = strings.Join(strings.Fields(item.Content), " ")
+
+		switch {
+		case item.ID == "":
+			return nil, fmt.Errorf("todo %d has no id", i+1)
+		case seen[item.ID]:
+			return nil, fmt.Errorf("todo id %q is used twice; ids must be unique", item.ID)
+		case item.Content == "":
+			return nil, fmt.Errorf("todo %q has no content", item.ID)
+		}
+		switch item.Status {
+		case Pending, Done:
+		case InProgress:
+			if inProgress != "" {
+				return nil, fmt.Errorf("todos %q and %q are both in_progress; work on one item at a time", inProgress, item.ID)
+			}
+			inProgress = item.ID
+		default:
+			return nil, fmt.Errorf("todo %q has status %q; use %q, %q or %q", item.ID, item.Status, Pending, InProgress, Done)
+		}
+		seen[item.ID] = true
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Checklist renders items as a Markdown checklist, one "- [x] 1: Add the
+// parser" line per item, with "[~]" marking the item in progress and "[ ]"
+// the pending ones.
+func Checklist(items []Item) string {
+	var sb strings.Builder
+	for _, item := range items {
+		mark := " "
+		switch item.Status {
+		case InProgress:
+			mark = "~"
+		case Done:
+			mark = "x"
+		}
+		fmt.Fprintf(&sb, "- [%s] %s: %s\n", mark, item.ID, item.Content)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// Summary counts the items done, e.g. "2/5 done".
+func Summary(items []Item) string {
+	done := 0
+	for _, item := range items {
+		if item.Status == Done {
+			done++
+		}
+	}
+	return fmt.Sprintf("%d/%d done", done, len(items))
+}
@@ -0,0 +1,48 @@
+package todo
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	items, err := Parse([]interface{}{
+		map[string]interface{}{"id": " 1 ", "content": "Write\n  the parser ", "status": "done"},
+		map[string]interface{}{"id": "2", "content": "Test it", "status": "in_progress"},
+		map[string]interface{}{"id": "3", "content": "Ship it", "status": "pending"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items[0] != (Item{ID: "1", Content: "Write the parser", Status: Done}) {
+		t.Errorf("item = %+v", items[0])
+	}
+	if got := Checklist(items); got != "- [x] 1: Write the parser\n- [~] 2: Test it\n- [ ] 3: Ship it" {
+		t.Errorf("checklist = %q", got)
+	}
+	if got := Summary(items); got != "1/3 done" {
+		t.Errorf("summary = %q", got)
+	}
+	if items, err := Parse([]interface{}{}); err != nil || len(items) != 0 {
+		t.Errorf("empty list = %v, %v", items, err)
+	}
+
+	item := func(id, content, status string) interface{} {
+		return map[string]interface{}{"id": id, "content": content, "status": status}
+	}
+	for _, tc := range []struct {
+		value interface{}
+		want  string
+	}{
+		{"1. parse", "todos must be an array"},
+		{[]interface{}{item("", "x", Pending)}, "todo 1 has no id"},
+		{[]interface{}{item("a", "x", Pending), item("a", "y", Pending)}, `"a" is used twice`},
+		{[]interface{}{item("a", " ", Pending)}, `todo "a" has no content`},
+		{[]interface{}{item("a", "x", "blocked")}, `has status "blocked"`},
+		{[]interface{}{item("a", "x", InProgress), item("b", "y", InProgress)}, "both in_progress"},
+	} {
+		if _, err := Parse(tc.value); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Parse(%v) error = %v, want %q", tc.value, err, tc.want)
+		}
+	}
+}
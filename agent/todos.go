@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/todo"
+)
+
+func init() {
+	registerAgentTool(todoWriteTool, executeTodoWrite, displayTodoWrite)
+	registerAgentTool(todoReadTool, executeTodoRead, displayTodoRead)
+}
+
+// TodoItem is one entry of the agent's todo list.
+type TodoItem = todo.Item
+
+// TodoCallback receives the whole todo list each time todo_write changes it.
+// Used by the CLI to render it as a checklist and persist it to the session.
+type TodoCallback func(todos []TodoItem)
+
+// WithTodoCallback sets the callback for todo list changes.
+func WithTodoCallback(cb TodoCallback) AgentOption {
+	return func(a *Agent) {
+		a.todoCallback = cb
+	}
+}
+
+// Todos returns a copy of the current todo list.
+func (a *Agent) Todos() []TodoItem {
+	return append([]TodoItem(nil), a.todos...)
+}
+
+// SetTodos replaces the todo list without calling the todo callback.
+// Used by session resume to restore the list saved last.
+func (a *Agent) SetTodos(todos []TodoItem) {
+	a.todos = append([]TodoItem(nil), todos...)
+}
+
+var todoWriteTool = providers.Tool{
+	Name: "todo_write",
+	Description: "Create or update your todo list for the current task. Pass the complete list every time; it replaces the previous one. " +
+		"Use it for work with three or more steps, or when the user gives several tasks at once: add the steps up front, " +
+		"mark one item in_progress before starting it, and mark it done as soon as it is finished. " +
+		"The list is shown to the user and survives compaction, so keep it accurate. Skip it for trivial one-step requests.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"todos": map[string]interface{}{
+				"type":        "array",
+				"description": "The whole todo list, in order",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id": map[string]interface{}{
+							"type":        "string",
+							"description": "Short unique ID, stable across updates (e.g. \"1\", \"2\")",
+						},
+						"content": map[string]interface{}{
+							"type":        "string",
+							"description": "What to do, as one imperative sentence",
+						},
+						"status": map[string]interface{}{
+							"type":        "string",
+							"enum":        []string{todo.Pending, todo.InProgress, todo.Done},
+							"description": "At most one item may be in_progress",
+						},
+					},
+					"required": []string{"id", "content", "status"},
+				},
+			},
+		},
+		"required": []string{"todos"},
+	},
+}
+
+var todoReadTool = providers.Tool{
+	Name:        "todo_read",
+	Description: "Show your current todo list with each item's status. Use it after compaction or a long stretch of work to check what is left.",
+	InputSchema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{},
+		"required":   []string{},
+	},
+}
+
+func executeTodoWrite(a *Agent, toolUseID string, input map[string]interface{}) (string, error) {
+	todos, err := todo.Parse(input["todos"])
+	if err != nil {
+		return "", err
+	}
+	a.todos = todos
+	if a.todoCallback != nil {
+		a.todoCallback(a.Todos())
+	}
+	if len(todos) == 0 {
+		return "Todo list cleared.", nil
+	}
+	// The user sees the list through the callback and the model just wrote
+	// it, so the result only confirms it.
+	result := fmt.Sprintf("Todo list updated: %s.", todo.Summary(todos))
+	for _, item := range todos {
+		if item.Status == todo.InProgress {
+			result += fmt.Sprintf(" In progress: %s: %s", item.ID, item.Content)
+		}
+	}
+	return result, nil
+}
+
+func executeTodoRead(a *Agent, toolUseID string, input map[string]interface{}) (string, error) {
+	if len(a.todos) == 0 {
+		return "The todo list is empty. Use todo_write to plan work with several steps.", nil
+	}
+	return fmt.Sprintf("Todo list (%s):\n%s", todo.Summary(a.todos), todo.Checklist(a.todos)), nil
+}
+
+func displayTodoWrite(input map[string]interface{}) string {
+	todos, err := todo.Parse(input["todos"])
+	if err != nil {
+		return "→ Updating todos"
+	}
+	return fmt.Sprintf("→ Updating todos: %s", todo.Summary(todos))
+}
+
+func displayTodoRead(input map[string]interface{}) string {
+	return "→ Reading todos"
+}
@@ -0,0 +1,916 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+func init() {
+	Register(applyPatchTool, executeApplyPatch, displayApplyPatch)
+	RegisterWritePaths("apply_patch", applyPatchPaths)
+	SetApplyPatchFuzz(defaultPatchFuzz)
+}
+
+var applyPatchTool = providers.Tool{
+	Name:        "apply_patch",
+	Description: "Apply a patch that adds, updates, deletes or moves one or more files. Accepts a unified diff (as produced by `diff -u` or `git diff`) or the \"*** Begin Patch\" format. Context lines are matched fuzzily (whitespace differences are tolerated by default), and the whole patch is applied all-or-nothing: if any hunk fails to match, no file is modified and the closest region in the file is shown. Prefer this over patch_file for large or multi-file refactors.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"patch": map[string]interface{}{
+				"type": "string",
+				"description": "The patch text. Either a unified diff, or:\n" +
+					"*** Begin Patch\n" +
+					"*** Add File: path/new.go\n+line\n" +
+					"*** Update File: path/old.go\n*** Move to: path/renamed.go (optional)\n@@ func Example (optional line to locate the hunk)\n context\n-removed\n+added\n" +
+					"*** Delete File: path/gone.go\n" +
+					"*** End Patch",
+			},
+			"fuzz": map[string]interface{}{
+				"type":        "integer",
+				"description": "How loosely context lines may match: 0 = exact, 1 = ignore trailing whitespace, 2 = also ignore indentation (default), 3 = also ignore inner whitespace and Unicode punctuation differences.",
+			},
+		},
+		"required": []string{"patch"},
+	},
+}
+
+// defaultPatchFuzz is the fuzz level used when neither the call nor the
+// ApplyPatchFuzz setting specifies one.
+const defaultPatchFuzz = fuzzIndent
+
+// patchFuzz is the fuzz level used when a call does not specify one.
+var patchFuzz atomic.Int32
+
+// SetApplyPatchFuzz sets the fuzz level apply_patch uses when a call does
+// not specify one. A level outside 0–3 restores the default.
+func SetApplyPatchFuzz(level int) {
+	if level < fuzzExact || level > fuzzPunct {
+		level = defaultPatchFuzz
+	}
+	patchFuzz.Store(int32(level))
+}
+
+type patchOpKind int
+
+const (
+	opAdd patchOpKind = iota
+	opUpdate
+	opDelete
+)
+
+// patchOp is one file operation in a patch.
+type patchOp struct {
+	kind   patchOpKind
+	path   string
+	moveTo string
+	// content holds the lines of an added file.
+	content []string
+	hunks   []patchHunk
+	// eolSet is true when the patch says whether the result ends with a
+	// newline ("\ No newline at end of file"); noEOL is that answer.
+	eolSet bool
+	noEOL  bool
+}
+
+// patchHunk is one contiguous change within an updated file.
+type patchHunk struct {
+	// anchors are lines ("@@ func Foo") to find, in order, before the hunk.
+	anchors []string
+	// hint is the 1-based line where the hunk starts in the original file
+	// (unified diffs only; 0 if unknown).
+	hint int
+	// lines are the hunk body: op is ' ' (context), '-' or '+'.
+	lines []hunkLine
+	// eof anchors the hunk at the end of the file.
+	eof bool
+}
+
+type hunkLine struct {
+	op   byte
+	text string
+}
+
+// old returns the lines the hunk expects to find (context and removals).
+func (h patchHunk) old() []string {
+	var out []string
+	for _, l := range h.lines {
+		if l.op != '+' {
+			out = append(out, l.text)
+		}
+	}
+	return out
+}
+
+// counts returns the number of added and removed lines.
+func (h patchHunk) counts() (added, removed int) {
+	for _, l := range h.lines {
+		switch l.op {
+		case '+':
+			added++
+		case '-':
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// counts returns the number of lines the operation adds and removes.
+func (op patchOp) counts() (added, removed int) {
+	if op.kind == opAdd {
+		return len(op.content), 0
+	}
+	for _, h := range op.hunks {
+		a, r := h.counts()
+		added += a
+		removed += r
+	}
+	return added, removed
+}
+
+func (op patchOp) label() string {
+	switch op.kind {
+	case opAdd:
+		return "Add " + op.path
+	case opDelete:
+		return "Delete " + op.path
+	}
+	if op.moveTo != "" {
+		return fmt.Sprintf("Update %s → %s", op.path, op.moveTo)
+	}
+	return "Update " + op.path
+}
+
+// parsePatch detects the patch format and parses it into file operations.
+func parsePatch(text string) ([]patchOp, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if strings.Contains(text, "*** Begin Patch") {
+		return parseV4APatch(text)
+	}
+	if strings.Contains(text, "\n@@") || strings.HasPrefix(text, "@@") ||
+		strings.Contains(text, "--- ") || strings.HasPrefix(text, "diff --git ") {
+		return parseUnifiedDiff(text)
+	}
+	return nil, fmt.Errorf("%s", strings.Join([]string{
+		"patch is not a unified diff or a \"*** Begin Patch\" block.",
+		"",
+		"Expected either:",
+		"  --- a/main.go",
+		"  +++ b/main.go",
+		"  @@ -10,3 +10,3 @@",
+		"   context",
+		"  -old line",
+		"  +new line",
+		"or:",
+		"  *** Begin Patch",
+		"  *** Update File: main.go",
+		"  @@",
+		"   context",
+		"  -old line",
+		"  +new line",
+		"  *** End Patch",
+	}, "\n"))
+}
+
+// parseV4APatch parses the "*** Begin Patch" format.
+func parseV4APatch(text string) ([]patchOp, error) {
+	lines := strings.Split(text, "\n")
+	start := -1
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "*** Begin Patch" {
+			start = i + 1
+			break
+		}
+	}
+
+	var ops []patchOp
+	var op *patchOp
+	var hunk *patchHunk
+
+	flushHunk := func() {
+		if hunk != nil {
+			hunk.lines = trimBlankContext(hunk.lines)
+		}
+		if op != nil && hunk != nil && (len(hunk.lines) > 0 || len(hunk.anchors) > 0) {
+			op.hunks = append(op.hunks, *hunk)
+		}
+		hunk = nil
+	}
+	flushOp := func() {
+		flushHunk()
+		if op != nil {
+			ops = append(ops, *op)
+		}
+		op = nil
+	}
+
+	for n := start; n < len(lines); n++ {
+		line := lines[n]
+		lineNo := n + 1
+		switch {
+		case strings.TrimSpace(line) == "*** End Patch":
+			flushOp()
+			return validateOps(ops)
+		case strings.HasPrefix(line, "*** Add File: "):
+			flushOp()
+			op = &patchOp{kind: opAdd, path: strings.TrimSpace(strings.TrimPrefix(line, "*** Add File: "))}
+		case strings.HasPrefix(line, "*** Delete File: "):
+			flushOp()
+			op = &patchOp{kind: opDelete, path: strings.TrimSpace(strings.TrimPrefix(line, "*** Delete File: "))}
+		case strings.HasPrefix(line, "*** Update File: "):
+			flushOp()
+			op = &patchOp{kind: opUpdate, path: strings.TrimSpace(strings.TrimPrefix(line, "*** Update File: "))}
+		case strings.HasPrefix(line, "*** Move to: "):
+			if op == nil || op.kind != opUpdate || len(op.hunks) > 0 || hunk != nil {
+				return nil, fmt.Errorf("patch line %d: '*** Move to:' must directly follow '*** Update File:'", lineNo)
+			}
+			op.moveTo = strings.TrimSpace(strings.TrimPrefix(line, "*** Move to: "))
+		case op == nil:
+			if strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("patch line %d: expected '*** Add File:', '*** Update File:' or '*** Delete File:', got %q", lineNo, line)
+			}
+		case op.kind == opAdd:
+			if !strings.HasPrefix(line, "+") {
+				if strings.TrimSpace(line) == "" {
+					continue
+				}
+				return nil, fmt.Errorf("patch line %d: lines of an added file must start with '+', got %q", lineNo, line)
+			}
+			op.content = append(op.content, line[1:])
+		case op.kind == opDelete:
+			if strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("patch line %d: unexpected content after '*** Delete File: %s'", lineNo, op.path)
+			}
+		case strings.TrimSpace(line) == "*** End of File":
+			if hunk == nil {
+				hunk = &patchHunk{}
+			}
+			hunk.eof = true
+			flushHunk()
+		case strings.HasPrefix(line, "@@"):
+			if hunk != nil && len(hunk.lines) > 0 {
+				flushHunk()
+			}
+			if hunk == nil {
+				hunk = &patchHunk{}
+			}
+			if anchor := strings.TrimSpace(strings.TrimPrefix(line, "@@")); anchor != "" {
+				hunk.anchors = append(hunk.anchors, anchor)
+			}
+		default:
+			if hunk == nil {
+				hunk = &patchHunk{}
+			}
+			if line == "" {
+				hunk.lines = append(hunk.lines, hunkLine{op: ' '})
+				continue
+			}
+			switch line[0] {
+			case ' ', '-', '+':
+				hunk.lines = append(hunk.lines, hunkLine{op: line[0], text: line[1:]})
+			default:
+				return nil, fmt.Errorf("patch line %d: hunk lines must start with ' ', '-' or '+', got %q", lineNo, line)
+			}
+		}
+	}
+
+	// Tolerate a missing "*** End Patch".
+	flushOp()
+	return validateOps(ops)
+}
+
+// parseUnifiedDiff parses `diff -u` / `git diff` output.
+func parseUnifiedDiff(text string) ([]patchOp, error) {
+	lines := strings.Split(text, "\n")
+
+	var ops []patchOp
+	var oldPath, newPath string
+	var renameFrom, renameTo string
+	var hunks []patchHunk
+	var eolSet, noEOL bool
+	inFile := false
+
+	flush := func() error {
+		if !inFile {
+			return nil
+		}
+		inFile = false
+		if oldPath == "" && newPath == "" {
+			oldPath, newPath = renameFrom, renameTo
+		}
+		oldP, newP := stripDiffPrefixes(oldPath, newPath)
+		op := patchOp{eolSet: eolSet, noEOL: noEOL}
+		switch {
+		case oldP == "/dev/null" && newP == "/dev/null":
+			return fmt.Errorf("diff has /dev/null on both sides")
+		case oldP == "/dev/null":
+			op.kind, op.path = opAdd, newP
+			for _, h := range hunks {
+				for _, l := range h.lines {
+					if l.op != '+' {
+						return fmt.Errorf("diff adds %s but its hunk contains context or removed lines", newP)
+					}
+					op.content = append(op.content, l.text)
+				}
+			}
+		case newP == "/dev/null":
+			op.kind, op.path = opDelete, oldP
+		default:
+			op.kind, op.path, op.hunks = opUpdate, oldP, hunks
+			if newP != oldP {
+				op.moveTo = newP
+			}
+		}
+		ops = append(ops, op)
+		oldPath, newPath, renameFrom, renameTo = "", "", "", ""
+		hunks, eolSet, noEOL = nil, false, false
+		return nil
+	}
+
+	for n := 0; n < len(lines); n++ {
+		line := lines[n]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			inFile = true
+			if fields := strings.Fields(strings.TrimPrefix(line, "diff --git ")); len(fields) == 2 {
+				renameFrom, renameTo = fields[0], fields[1]
+			}
+		case strings.HasPrefix(line, "rename from "):
+			renameFrom = "a/" + strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			renameTo = "b/" + strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "Binary files "):
+			return nil, fmt.Errorf("binary diffs are not supported: %s", line)
+		case strings.HasPrefix(line, "--- ") && n+1 < len(lines) && strings.HasPrefix(lines[n+1], "+++ "):
+			if len(hunks) > 0 || (inFile && oldPath != "") {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			inFile = true
+			oldPath = diffPath(strings.TrimPrefix(line, "--- "))
+			newPath = diffPath(strings.TrimPrefix(lines[n+1], "+++ "))
+			n++
+		case strings.HasPrefix(line, "@@"):
+			if !inFile {
+				return nil, fmt.Errorf("patch line %d: hunk header before any '---'/'+++' file header", n+1)
+			}
+			hunk := patchHunk{hint: hunkStart(line)}
+			last := byte(0)
+			n++
+			for ; n < len(lines); n++ {
+				l := lines[n]
+				if strings.HasPrefix(l, "@@") || strings.HasPrefix(l, "diff --git ") ||
+					(strings.HasPrefix(l, "--- ") && n+1 < len(lines) && strings.HasPrefix(lines[n+1], "+++ ")) {
+					break
+				}
+				if l == "" {
+					// A blank context line whose leading space was stripped.
+					hunk.lines = append(hunk.lines, hunkLine{op: ' '})
+					last = ' '
+					continue
+				}
+				switch l[0] {
+				case ' ', '-', '+':
+					hunk.lines = append(hunk.lines, hunkLine{op: l[0], text: l[1:]})
+					last = l[0]
+					continue
+				case '\\':
+					// "\ No newline at end of file" applies to the line above.
+					if last == '-' {
+						if !eolSet {
+							eolSet, noEOL = true, false
+						}
+					} else {
+						eolSet, noEOL = true, true
+					}
+					continue
+				}
+				break
+			}
+			n--
+			hunk.lines = trimBlankContext(hunk.lines)
+			hunks = append(hunks, hunk)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return validateOps(ops)
+}
+
+// trimBlankContext drops blank context lines from the end of a hunk. They
+// are usually separators between sections of the patch, not context.
+func trimBlankContext(lines []hunkLine) []hunkLine {
+	for len(lines) > 0 {
+		tail := lines[len(lines)-1]
+		if tail.op != ' ' || tail.text != "" {
+			break
+		}
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffPath extracts the path from a ---/+++ header, dropping any timestamp.
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if unq, err := strconv.Unquote(s); err == nil {
+			s = unq
+		}
+	}
+	return s
+}
+
+// stripDiffPrefixes removes git's a/ and b/ prefixes when both sides use them.
+func stripDiffPrefixes(oldPath, newPath string) (string, string) {
+	oldOK := oldPath == "/dev/null" || strings.HasPrefix(oldPath, "a/")
+	newOK := newPath == "/dev/null" || strings.HasPrefix(newPath, "b/")
+	if !oldOK || !newOK {
+		return oldPath, newPath
+	}
+	if oldPath != "/dev/null" {
+		oldPath = oldPath[2:]
+	}
+	if newPath != "/dev/null" {
+		newPath = newPath[2:]
+	}
+	return oldPath, newPath
+}
+
+// hunkStart parses the original start line from "@@ -12,5 +12,6 @@".
+func hunkStart(header string) int {
+	fields := strings.Fields(header)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "-") {
+		return 0
+	}
+	num := strings.TrimPrefix(fields[1], "-")
+	if i := strings.IndexByte(num, ','); i >= 0 {
+		num = num[:i]
+	}
+	start, err := strconv.Atoi(num)
+	if err != nil {
+		return 0
+	}
+	return start
+}
+
+func validateOps(ops []patchOp) ([]patchOp, error) {
+	if len(ops) == 0 {
+		return nil, fmt.Errorf("patch contains no file operations")
+	}
+	for _, op := range ops {
+		if op.path == "" {
+			return nil, fmt.Errorf("patch has a file operation without a path")
+		}
+		if op.kind == opUpdate && len(op.hunks) == 0 && op.moveTo == "" {
+			return nil, fmt.Errorf("patch updates %s but contains no changes for it", op.path)
+		}
+	}
+	return ops, nil
+}
+
+// patchFile is the in-memory state of one file during apply_patch.
+type patchFile struct {
+	path     string // As first named in the patch
+	existed  bool
+	original []byte
+	mode     os.FileMode
+
+	exists  bool
+	content string
+	failed  bool
+}
+
+func executeApplyPatch(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
+	text, ok := input["patch"].(string)
+	if !ok || strings.TrimSpace(text) == "" {
+		return "", fmt.Errorf("patch is required. Provide a unified diff or a \"*** Begin Patch\" block")
+	}
+
+	fuzz := int(patchFuzz.Load())
+	if f, ok := input["fuzz"].(float64); ok {
+		fuzz = int(f)
+	}
+	if fuzz < fuzzExact || fuzz > fuzzPunct {
+		return "", fmt.Errorf("fuzz must be between %d and %d, got %d", fuzzExact, fuzzPunct, fuzz)
+	}
+
+	ops, err := parsePatch(text)
+	if err != nil {
+		return "", err
+	}
+
+	// Load every file the patch touches, keeping the originals in memory.
+	// Files are keyed by the resolved path, so two spellings of one file
+	// share its contents.
+	files := make(map[string]*patchFile)
+	var order []string
+	load := func(path string) (*patchFile, error) {
+		key := fileKey(path)
+		if f, ok := files[key]; ok {
+			return f, nil
+		}
+		f := &patchFile{path: path, mode: 0644}
+		info, err := os.Stat(path)
+		switch {
+		case err == nil && info.IsDir():
+			return nil, fmt.Errorf("'%s' is a directory, not a file", path)
+		case err == nil:
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+			}
+			f.existed, f.exists = true, true
+			f.original, f.content = data, string(data)
+			f.mode = info.Mode().Perm()
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to access '%s': %w", path, err)
+		}
+		files[key] = f
+		order = append(order, key)
+		return f, nil
+	}
+
+	// Apply every operation in memory. Nothing touches disk until all of
+	// them succeed.
+	var statuses, notes, rejects []string
+	failed := 0
+	for _, op := range ops {
+		label := op.label()
+		fail := func(format string, args ...interface{}) {
+			failed++
+			statuses = append(statuses, fmt.Sprintf("❌ %s FAILED: %s", label, fmt.Sprintf(format, args...)))
+		}
+
+		f, err := load(op.path)
+		if err != nil {
+			fail("%v", err)
+			continue
+		}
+		if f.failed {
+			statuses = append(statuses, fmt.Sprintf("- %s: skipped (an earlier change to this file failed)", label))
+			continue
+		}
+
+		switch op.kind {
+		case opAdd:
+			if f.exists {
+				f.failed = true
+				fail("file already exists (use an update instead)")
+				continue
+			}
+			f.exists = true
+			f.content = strings.Join(op.content, "\n")
+			if len(op.content) > 0 && !(op.eolSet && op.noEOL) {
+				f.content += "\n"
+			}
+			statuses = append(statuses, fmt.Sprintf("✓ %s (%d lines)", label, len(op.content)))
+
+		case opDelete:
+			if !f.exists {
+				f.failed = true
+				fail("file does not exist")
+				continue
+			}
+			f.exists, f.content = false, ""
+			statuses = append(statuses, fmt.Sprintf("✓ %s", label))
+
+		case opUpdate:
+			if !f.exists {
+				f.failed = true
+				fail("file does not exist. Use list_files or glob to find the right path")
+				continue
+			}
+			updated, hunkNotes, err := applyHunks(f.content, op, fuzz)
+			if err != nil {
+				f.failed = true
+				failed++
+				statuses = append(statuses, fmt.Sprintf("❌ %s FAILED: %s", label, firstLine(err.Error())))
+				if _, detail, ok := strings.Cut(err.Error(), "\n"); ok {
+					rejects = append(rejects, fmt.Sprintf("%s:\n%s", op.path, detail))
+				}
+				continue
+			}
+			for _, note := range hunkNotes {
+				notes = append(notes, fmt.Sprintf("%s: %s", op.path, note))
+			}
+			if op.moveTo != "" {
+				dest, err := load(op.moveTo)
+				if err != nil {
+					f.failed = true
+					fail("%v", err)
+					continue
+				}
+				if dest.exists {
+					f.failed = true
+					fail("destination '%s' already exists", op.moveTo)
+					continue
+				}
+				dest.exists, dest.content, dest.mode = true, updated, f.mode
+				f.exists, f.content = false, ""
+			} else {
+				f.content = updated
+			}
+			added, removed := op.counts()
+			statuses = append(statuses, fmt.Sprintf("✓ %s: %d hunks (+%d -%d)", label, len(op.hunks), added, removed))
+		}
+	}
+
+	if failed > 0 {
+		report := []string{
+			fmt.Sprintf("❌ apply_patch FAILED: %d of %d file operations could not be applied (fuzz level %d).", failed, len(ops), fuzz),
+			"No files were modified (the whole patch is validated in memory before anything is written).",
+			"",
+		}
+		report = append(report, statuses...)
+		for _, r := range rejects {
+			report = append(report, "", r)
+		}
+		report = append(report,
+			"",
+			"Suggestions:",
+			"  - Use read_file to see the current content around the nearest region",
+			"  - Regenerate the failing hunk against the current file, or use patch_file for a small edit",
+		)
+		return "", fmt.Errorf("%s", strings.Join(report, "\n"))
+	}
+
+	// Write through the resolved path (key), so a file named through a
+	// symlink is changed, moved or deleted at its target and the link kept.
+	var changes []FileChange
+	for _, key := range order {
+		f := files[key]
+		path := key
+		switch {
+		case f.exists && (!f.existed || f.content != string(f.original)):
+			changes = append(changes, FileChange{Path: path, Content: []byte(f.content), Mode: f.mode,
+				Existed: f.existed, Original: f.original})
+		case !f.exists && f.existed:
+			changes = append(changes, FileChange{Path: path, Delete: true, Mode: f.mode,
+				Existed: true, Original: f.original})
+		}
+	}
+	if err := CommitFileChanges(changes); err != nil {
+		report := []string{fmt.Sprintf("❌ apply_patch FAILED while writing: %v", err), ""}
+		report = append(report, statuses...)
+		return "", fmt.Errorf("%s", strings.Join(report, "\n"))
+	}
+
+	summary := []string{fmt.Sprintf("✅ Successfully applied patch: %d file operations", len(ops)), ""}
+	summary = append(summary, statuses...)
+	if len(notes) > 0 {
+		summary = append(summary, "", "Notes:")
+		for _, note := range notes {
+			summary = append(summary, "  - "+note)
+		}
+	}
+	return strings.Join(summary, "\n"), nil
+}
+
+// applyHunks applies op's hunks to content. Line endings are normalized for
+// matching and restored afterwards. Returns notes for hunks that needed a
+// fuzz level above exact, or an error describing the first hunk that did
+// not match, with the nearest region of the file.
+func applyHunks(content string, op patchOp, fuzz int) (string, []string, error) {
+	crlf := strings.Contains(content, "\r\n")
+	text := strings.ReplaceAll(content, "\r\n", "\n")
+	hasEOL := strings.HasSuffix(text, "\n")
+	text = strings.TrimSuffix(text, "\n")
+	var lines []string
+	if text != "" || hasEOL {
+		lines = strings.Split(text, "\n")
+	}
+
+	var notes []string
+	cursor, offset := 0, 0
+	for k, h := range op.hunks {
+		which := fmt.Sprintf("hunk %d of %d", k+1, len(op.hunks))
+
+		for _, anchor := range h.anchors {
+			idx := seekAnchor(lines, anchor, cursor, fuzz)
+			if idx < 0 {
+				msg := fmt.Sprintf("%s: could not find the line '@@ %s' after line %d", which, anchor, cursor)
+				if near := nearestRegions(lines[cursor:], []string{anchor}, 1); len(near) > 0 {
+					near[0].Start += cursor
+					msg += "\nNearest " + formatRegion(lines, near[0])
+				}
+				return "", nil, fmt.Errorf("%s", msg)
+			}
+			cursor = idx + 1
+		}
+
+		old := h.old()
+		var pos int
+		if len(old) == 0 {
+			// Pure insertion: at the hinted line, otherwise at the anchor
+			// (or end of file when there is none).
+			switch {
+			case h.eof:
+				pos = len(lines)
+			case h.hint > 0:
+				pos = h.hint + offset
+			case len(h.anchors) > 0:
+				pos = cursor
+			default:
+				pos = len(lines)
+			}
+			if pos < cursor {
+				pos = cursor
+			}
+			if pos > len(lines) {
+				pos = len(lines)
+			}
+		} else {
+			pos = -1
+			for level := fuzzExact; level <= fuzz; level++ {
+				matches := seekLines(lines, old, cursor, level)
+				if h.eof {
+					var atEOF []int
+					for _, m := range matches {
+						if m+len(old) == len(lines) {
+							atEOF = append(atEOF, m)
+						}
+					}
+					matches = atEOF
+				}
+				if len(matches) == 0 {
+					continue
+				}
+				pos = closestMatch(matches, h.hint-1+offset, h.hint > 0)
+				if level > fuzzExact {
+					notes = append(notes, fmt.Sprintf("%s matched at line %d with fuzz level %d (%s)", which, pos+1, level, fuzzDescription(level)))
+				}
+				break
+			}
+			if pos < 0 {
+				return "", nil, hunkRejection(which, lines, old, fuzz)
+			}
+		}
+
+		// Splice in the new lines, keeping the file's own text for context
+		// lines (which may differ from the patch in whitespace).
+		var replacement []string
+		i := pos
+		for _, l := range h.lines {
+			switch l.op {
+			case ' ':
+				replacement = append(replacement, lines[i])
+				i++
+			case '-':
+				i++
+			case '+':
+				replacement = append(replacement, l.text)
+			}
+		}
+		result := make([]string, 0, len(lines)-len(old)+len(replacement))
+		result = append(result, lines[:pos]...)
+		result = append(result, replacement...)
+		result = append(result, lines[pos+len(old):]...)
+		lines = result
+
+		cursor = pos + len(replacement)
+		offset += len(replacement) - len(old)
+	}
+
+	eol := hasEOL
+	if op.eolSet {
+		eol = !op.noEOL
+	}
+	out := strings.Join(lines, "\n")
+	if eol && len(lines) > 0 {
+		out += "\n"
+	}
+	if crlf {
+		out = strings.ReplaceAll(out, "\n", "\r\n")
+	}
+	return out, notes, nil
+}
+
+// seekAnchor finds the first line at or after from that equals anchor at
+// the given fuzz level (at least ignoring surrounding whitespace), falling
+// back to the first line that contains it.
+func seekAnchor(lines []string, anchor string, from, fuzz int) int {
+	if fuzz < fuzzIndent {
+		fuzz = fuzzIndent
+	}
+	want := normalizeLine(anchor, fuzz)
+	for i := from; i < len(lines); i++ {
+		if normalizeLine(lines[i], fuzz) == want {
+			return i
+		}
+	}
+	for i := from; i < len(lines); i++ {
+		if strings.Contains(normalizeLine(lines[i], fuzz), want) {
+			return i
+		}
+	}
+	return -1
+}
+
+// closestMatch picks the match nearest the expected line, or the first.
+func closestMatch(matches []int, expected int, useHint bool) int {
+	best := matches[0]
+	if !useHint {
+		return best
+	}
+	for _, m := range matches[1:] {
+		if abs(m-expected) < abs(best-expected) {
+			best = m
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func fuzzDescription(level int) string {
+	switch level {
+	case fuzzTrailing:
+		return "ignoring trailing whitespace"
+	case fuzzIndent:
+		return "ignoring indentation"
+	case fuzzPunct:
+		return "ignoring whitespace and punctuation differences"
+	}
+	return "exact"
+}
+
+// hunkRejection describes a hunk that did not match, with the region of the
+// file that resembles it most.
+func hunkRejection(which string, lines, old []string, fuzz int) error {
+	msg := []string{fmt.Sprintf("%s did not match the file (fuzz level %d)", which, fuzz), "Expected:"}
+	for _, l := range old {
+		msg = append(msg, "       | "+l)
+	}
+	if near := nearestRegions(lines, old, 1); len(near) > 0 {
+		msg = append(msg, "Nearest "+formatRegion(lines, near[0]))
+	} else {
+		msg = append(msg, "No similar region found in the file.")
+	}
+	return fmt.Errorf("%s", strings.Join(msg, "\n"))
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// applyPatchPaths returns every file an apply_patch call may create, modify
+// or delete, including move destinations.
+func applyPatchPaths(input map[string]interface{}) []string {
+	text, _ := input["patch"].(string)
+	ops, err := parsePatch(text)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, op := range ops {
+		for _, p := range []string{op.path, op.moveTo} {
+			if p != "" && !seen[p] {
+				seen[p] = true
+				paths = append(paths, filepath.Clean(p))
+			}
+		}
+	}
+	return paths
+}
+
+func displayApplyPatch(input map[string]interface{}) string {
+	text, _ := input["patch"].(string)
+	ops, err := parsePatch(text)
+	if err != nil {
+		return "→ Applying patch"
+	}
+	added, removed := 0, 0
+	for _, op := range ops {
+		a, r := op.counts()
+		added += a
+		removed += r
+	}
+	if len(ops) == 1 {
+		return fmt.Sprintf("→ Applying patch: %s (+%d -%d)", ops[0].path, added, removed)
+	}
+	return fmt.Sprintf("→ Applying patch: %d files (+%d -%d)", len(ops), added, removed)
+}
@@ -0,0 +1,161 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent/workspace"
+)
+
+// writeTemp writes data to a new temp file in the same directory as path,
+// so it can later be renamed over path atomically. Returns the temp path.
+func writeTemp(path string, data []byte, perm os.FileMode) (string, error) {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".clyde-tmp-*")
+	if err != nil {
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("permission denied writing to '%s'. Check directory permissions", dir)
+		}
+		return "", fmt.Errorf("failed to create temp file for '%s': %w", path, err)
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write temp file for '%s': %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to write temp file for '%s': %w", path, err)
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("failed to set permissions for '%s': %w", path, err)
+	}
+	return tmp, nil
+}
+
+// writeFileAtomic replaces path with data via a temp file and rename, so
+// readers never observe a partially written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := writeTemp(path, data, perm)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace '%s': %w", path, err)
+	}
+	return nil
+}
+
+// fileKey identifies the file at path for a multi-file transaction: its
+// absolute path with symlinks resolved, so different spellings of one file
+// ("f.txt", "./f.txt", "dir/../f.txt") are one target.
+func fileKey(path string) string {
+	if resolved, err := workspace.Resolve(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// FileChange is one file's new state in a multi-file transaction, along
+// with its original state for rollback.
+type FileChange struct {
+	Path    string
+	Content []byte
+	Mode    os.FileMode
+	// Delete removes the file instead of writing Content.
+	Delete bool
+
+	// Existed and Original describe the file before the transaction.
+	Existed  bool
+	Original []byte
+}
+
+// CommitFileChanges applies changes as a unit. Every new file is first
+// written to a temp file next to its target; only when all temp files are
+// ready are they renamed into place (and deletions performed). If any step
+// fails part-way, files already changed are put back from their originals.
+//
+// Paths are resolved before anything is written, so a change to a symlink
+// updates the file it points to and leaves the link in place.
+func CommitFileChanges(changes []FileChange) error {
+	resolved := make([]FileChange, len(changes))
+	for i, c := range changes {
+		c.Path = fileKey(c.Path)
+		resolved[i] = c
+	}
+	changes = resolved
+
+	temps := make(map[int]string)
+	cleanup := func() {
+		for _, tmp := range temps {
+			os.Remove(tmp)
+		}
+	}
+
+	for i, c := range changes {
+		if c.Delete {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+			cleanup()
+			return fmt.Errorf("failed to create directory for '%s': %v. No files were modified", c.Path, err)
+		}
+		tmp, err := writeTemp(c.Path, c.Content, c.Mode)
+		if err != nil {
+			cleanup()
+			return fmt.Errorf("%v. No files were modified", err)
+		}
+		temps[i] = tmp
+	}
+
+	var done []FileChange
+	for i, c := range changes {
+		var err error
+		if c.Delete {
+			err = os.Remove(c.Path)
+		} else {
+			err = os.Rename(temps[i], c.Path)
+		}
+		if err != nil {
+			cleanup()
+			msg := []string{fmt.Sprintf("failed to update '%s': %v", c.Path, err)}
+			if len(done) == 0 {
+				msg = append(msg, "No files were modified.")
+				return fmt.Errorf("%s", strings.Join(msg, "\n"))
+			}
+			msg = append(msg, fmt.Sprintf("Rolling back %d files already written...", len(done)))
+			var rollbackErrors []string
+			for j := len(done) - 1; j >= 0; j-- {
+				if err := rollbackFileChange(done[j]); err != nil {
+					rollbackErrors = append(rollbackErrors, fmt.Sprintf("  - Failed to restore %s: %v", done[j].Path, err))
+				}
+			}
+			if len(rollbackErrors) > 0 {
+				msg = append(msg, "⚠️  Some rollback operations failed:")
+				msg = append(msg, rollbackErrors...)
+			} else {
+				msg = append(msg, "✓ Successfully rolled back all changes")
+			}
+			return fmt.Errorf("%s", strings.Join(msg, "\n"))
+		}
+		delete(temps, i)
+		done = append(done, c)
+	}
+	return nil
+}
+
+// rollbackFileChange returns a file to its state before the transaction.
+func rollbackFileChange(c FileChange) error {
+	if !c.Existed {
+		if err := os.Remove(c.Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(c.Path, c.Original, c.Mode)
+}
@@ -0,0 +1,192 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Fuzz levels control how loosely context lines must match file lines.
+// Each level includes the ones below it.
+const (
+	// fuzzExact requires lines to match byte for byte.
+	fuzzExact = 0
+	// fuzzTrailing ignores trailing whitespace (including a stray \r).
+	fuzzTrailing = 1
+	// fuzzIndent also ignores leading whitespace.
+	fuzzIndent = 2
+	// fuzzPunct also collapses inner whitespace runs and folds Unicode
+	// punctuation (curly quotes, dashes, non-breaking spaces) to ASCII.
+	fuzzPunct = 3
+)
+
+// normalizeLine reduces a line to the form compared at the given fuzz level.
+func normalizeLine(line string, fuzz int) string {
+	if fuzz >= fuzzTrailing {
+		line = strings.TrimRight(line, " \t\r")
+	}
+	if fuzz >= fuzzIndent {
+		line = strings.TrimLeft(line, " \t")
+	}
+	if fuzz >= fuzzPunct {
+		line = strings.Map(func(r rune) rune {
+			switch r {
+			case '‘', '’', '‚', '‛':
+				return '\''
+			case '“', '”', '„', '‟':
+				return '"'
+			case '‐', '‑', '‒', '–', '—', '―', '−':
+				return '-'
+			case '\u00a0', '\u2007', '\u202f': // non-breaking spaces
+				return ' '
+			}
+			return r
+		}, line)
+		line = strings.Join(strings.Fields(line), " ")
+	}
+	return line
+}
+
+// seekLines returns every index i >= from at which pattern matches lines
+// at the given fuzz level.
+func seekLines(lines, pattern []string, from, fuzz int) []int {
+	if len(pattern) == 0 {
+		return nil
+	}
+	norm := make([]string, len(pattern))
+	for i, p := range pattern {
+		norm[i] = normalizeLine(p, fuzz)
+	}
+	var matches []int
+	for i := from; i+len(pattern) <= len(lines); i++ {
+		ok := true
+		for j := range pattern {
+			if normalizeLine(lines[i+j], fuzz) != norm[j] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// region is a span of file lines that resembles a pattern.
+type region struct {
+	// Start is the 0-based index of the first line.
+	Start int
+	// Lines is the number of lines in the region.
+	Lines int
+	// Similarity is in [0, 1]; 1 means every line matches after trimming.
+	Similarity float64
+}
+
+// nearestRegions ranks every window of len(pattern) lines by similarity to
+// pattern and returns the best n, most similar first. Windows that overlap
+// a better one are skipped so the candidates are distinct places.
+func nearestRegions(lines, pattern []string, n int) []region {
+	size := len(pattern)
+	if size == 0 || len(lines) == 0 || n <= 0 {
+		return nil
+	}
+	if size > len(lines) {
+		size = len(lines)
+	}
+
+	want := make([]map[string]int, len(pattern))
+	for i, p := range pattern {
+		want[i] = bigrams(p)
+	}
+	have := make([]map[string]int, len(lines))
+	for i, l := range lines {
+		have[i] = bigrams(l)
+	}
+
+	var all []region
+	for start := 0; start+size <= len(lines); start++ {
+		total := 0.0
+		for j := 0; j < size; j++ {
+			total += lineSimilarity(pattern[j], lines[start+j], want[j], have[start+j])
+		}
+		all = append(all, region{Start: start, Lines: size, Similarity: total / float64(len(pattern))})
+	}
+
+	var best []region
+	for len(best) < n {
+		pick := -1
+		for i, r := range all {
+			if r.Similarity <= 0 || overlapsAny(r, best) {
+				continue
+			}
+			if pick < 0 || r.Similarity > all[pick].Similarity {
+				pick = i
+			}
+		}
+		if pick < 0 {
+			break
+		}
+		best = append(best, all[pick])
+	}
+	return best
+}
+
+func overlapsAny(r region, list []region) bool {
+	for _, o := range list {
+		if r.Start < o.Start+o.Lines && o.Start < r.Start+r.Lines {
+			return true
+		}
+	}
+	return false
+}
+
+// lineSimilarity compares two lines ignoring surrounding whitespace, using
+// the Dice coefficient over character bigrams.
+func lineSimilarity(a, b string, ga, gb map[string]int) float64 {
+	ta, tb := strings.TrimSpace(a), strings.TrimSpace(b)
+	if ta == tb {
+		return 1
+	}
+	if len(ga) == 0 || len(gb) == 0 {
+		return 0
+	}
+	common, total := 0, 0
+	for g, ca := range ga {
+		total += ca
+		if cb := gb[g]; cb > 0 {
+			if cb < ca {
+				common += cb
+			} else {
+				common += ca
+			}
+		}
+	}
+	for _, cb := range gb {
+		total += cb
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+// bigrams counts the adjacent rune pairs of a trimmed line.
+func bigrams(s string) map[string]int {
+	runes := []rune(strings.TrimSpace(s))
+	grams := make(map[string]int, len(runes))
+	for i := 0; i+1 < len(runes); i++ {
+		if unicode.IsSpace(runes[i]) && unicode.IsSpace(runes[i+1]) {
+			continue
+		}
+		grams[string(runes[i:i+2])]++
+	}
+	return grams
+}
+
+// formatRegion renders a region with a line-number gutter for error reports.
+func formatRegion(lines []string, r region) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "lines %d-%d (%.0f%% similar):", r.Start+1, r.Start+r.Lines, r.Similarity*100)
+	for i := r.Start; i < r.Start+r.Lines && i < len(lines); i++ {
+		fmt.Fprintf(&b, "\n  %4d | %s", i+1, strings.TrimRight(lines[i], "\r"))
+	}
+	return b.String()
+}
@@ -1,36 +1,82 @@
 package tools
 
 import (
-	"github.com/this-is-alpha-iota/clyde/agent/providers"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
 )
 
 func init() {
 	Register(globTool, executeGlob, displayGlob)
+	RegisterReadPaths("glob", globReadPaths)
 }
 
 var globTool = providers.Tool{
 	Name:        "glob",
-	Description: "Find files matching patterns. More flexible than list_files for navigating projects. Returns file paths that match the pattern. Useful for finding specific files in large codebases.",
+	Description: "Find files matching patterns. More flexible than list_files for navigating projects. Returns file paths that match the pattern, most recently modified first. Skips files ignored by .gitignore/.clydeignore as well as .git, node_modules and vendor directories. Useful for finding specific files in large codebases.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
 			"pattern": map[string]interface{}{
 				"type":        "string",
-				"description": "File pattern to match. Examples: '**/*.go' (all Go files), '*_test.go' (test files), '*.md' (markdown files), '**/main.go' (find main.go anywhere)",
+				"description": "File pattern to match. A pattern without '/' matches file names at any depth; one with '/' matches the path relative to the search directory, where '**' spans directories. Braces list alternatives. A trailing '/' matches directories instead of files. Examples: '*.go', '**/*.go', 'src/**/test/*.go', '*.{go,mod}', '**/main.go', 'cmd/*/'",
 			},
 			"path": map[string]interface{}{
 				"type":        "string",
 				"description": "Directory to search. Defaults to current directory if not specified.",
 			},
+			"max_results": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of paths to return. Default 200.",
+			},
+			"no_ignore": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Also match ignored files and directories.",
+			},
 		},
 		"required": []string{"pattern"},
 	},
 }
 
+// defaultGlobResults caps glob output when max_results is not given.
+const defaultGlobResults = 200
+
+// globHit is a matching path and its modification time.
+type globHit struct {
+	path    string
+	modTime time.Time
+}
+
+// globReadPaths returns the directories a glob walks: the search path, or
+// below it each pattern's literal prefix, which may lead elsewhere
+// ("../other/*.go").
+func globReadPaths(input map[string]interface{}) []string {
+	path := dirInput(input)[0]
+	pattern, _ := input["pattern"].(string)
+	patterns, err := expandBraces(pattern)
+	if err != nil || pattern == "" {
+		return []string{path}
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		base, _ := splitGlobBase(strings.TrimSuffix(strings.TrimPrefix(p, "./"), "/"))
+		root := filepath.Join(path, filepath.FromSlash(base))
+		if !seen[root] {
+			seen[root] = true
+			paths = append(paths, root)
+		}
+	}
+	return paths
+}
+
 func executeGlob(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
 	pattern, patternOk := input["pattern"].(string)
 	if !patternOk || pattern == "" {
@@ -47,40 +93,101 @@ func executeGlob(input map[string]interface{}, apiClient *providers.Client, conv
 	}
 
 	// Check if search path exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
 		return "", fmt.Errorf("directory '%s' does not exist. Use '.' for current directory or provide a valid path", path)
 	}
-
-	// Use find command with -name or -path depending on pattern
-	// ** patterns need -path, simple patterns need -name
-	var args []string
-	if strings.Contains(pattern, "**") {
-		// Recursive pattern - use -path
-		// Convert ** glob pattern to find -path pattern
-		// Example: **/*.go -> */*.go (find already recurses by default)
-		findPattern := strings.ReplaceAll(pattern, "**/", "")
-		if !strings.HasPrefix(findPattern, "*") {
-			findPattern = "*/" + findPattern
-		}
-		args = []string{path, "-path", findPattern, "-type", "f"}
-	} else {
-		// Simple pattern - use -name
-		args = []string{path, "-name", pattern, "-type", "f"}
+	if err == nil && !info.IsDir() {
+		return "", fmt.Errorf("'%s' is a file, not a directory. Use the directory containing it as path", path)
 	}
 
-	cmd := exec.Command("find", args...)
-	output, err := cmd.CombinedOutput()
+	maxResults := defaultGlobResults
+	if m, ok := input["max_results"].(float64); ok && m > 0 {
+		maxResults = int(m)
+	}
+	noIgnore, _ := input["no_ignore"].(bool)
 
+	patterns, err := expandBraces(pattern)
 	if err != nil {
-		// Check for permission errors
-		if strings.Contains(string(output), "Permission denied") {
-			return "", fmt.Errorf("permission denied searching in '%s'. Some directories may not be accessible", path)
+		return "", err
+	}
+	var matcher *ignore.Matcher
+	if !noIgnore {
+		matcher = ignore.New(path)
+	}
+
+	seen := make(map[string]bool)
+	var hits []globHit
+	denied := 0
+	for _, p := range patterns {
+		dirsOnly := strings.HasSuffix(p, "/")
+		p = strings.TrimSuffix(strings.TrimPrefix(p, "./"), "/")
+
+		// Walk only below the pattern's literal prefix: "cmd/**/*.go" never
+		// needs to look outside cmd. This also lets an explicit pattern such
+		// as ".clyde/sessions/*/" reach directories Walk would skip.
+		base, rest := splitGlobBase(p)
+		root := path
+		if base != "" {
+			root = filepath.Join(path, filepath.FromSlash(base))
+			if _, err := os.Stat(root); err != nil {
+				continue
+			}
+		}
+
+		err := ignore.Walk(root, matcher, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsPermission(err) {
+					denied++
+					if d != nil && d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() != dirsOnly || file == root {
+				return nil
+			}
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			var ok bool
+			if rest == "" {
+				// A pattern without a slash matches names at any depth.
+				ok = ignore.Match(p, d.Name())
+			} else {
+				ok = ignore.Match(rest, rel)
+			}
+			if !ok {
+				return nil
+			}
+			// Report paths the way find does: prefixed with the search path.
+			out := filepath.ToSlash(filepath.Join(filepath.FromSlash(base), filepath.FromSlash(rel)))
+			out = strings.TrimSuffix(path, "/") + "/" + out
+			if dirsOnly {
+				out += "/"
+			}
+			if seen[out] {
+				return nil
+			}
+			seen[out] = true
+			hit := globHit{path: out}
+			if fi, err := d.Info(); err == nil {
+				hit.modTime = fi.ModTime()
+			}
+			hits = append(hits, hit)
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("glob failed searching '%s': %v", path, err)
 		}
-		return "", fmt.Errorf("find command failed: %s\nOutput: %s", err, string(output))
 	}
 
 	// Process results
-	if len(output) == 0 || strings.TrimSpace(string(output)) == "" {
+	if len(hits) == 0 {
 		suggestions := []string{
 			fmt.Sprintf("No files found matching pattern '%s' in %s", pattern, path),
 			"",
@@ -89,24 +196,115 @@ func executeGlob(input map[string]interface{}, apiClient *providers.Client, conv
 			"  - Try a broader pattern (e.g., '*.go' instead of 'main.go')",
 			"  - Use '**/*.go' to search recursively",
 			"  - Verify you're searching in the right directory",
+		}
+		if !noIgnore {
+			suggestions = append(suggestions, "  - Ignored files were skipped; use no_ignore: true to include them")
+		}
+		suggestions = append(suggestions,
 			"",
 			"Pattern examples:",
-			"  - '*.go' - all Go files in directory",
-			"  - '**/*.go' - all Go files recursively",
-			"  - '*_test.go' - all test files in directory",
+			"  - '*.go' - all Go files, at any depth",
+			"  - 'cmd/**/*.go' - all Go files under cmd",
+			"  - '*_test.go' - all test files",
+			"  - '*.{go,mod}' - Go source and module files",
 			"  - '**/main.go' - find main.go anywhere",
-		}
+		)
 		return strings.Join(suggestions, "\n"), nil
 	}
 
-	// Count files and format output
-	files := strings.Split(strings.TrimSpace(string(output)), "\n")
-	fileCount := len(files)
+	// Most recently modified first: usually what the model is working on.
+	sort.Slice(hits, func(i, j int) bool {
+		if !hits[i].modTime.Equal(hits[j].modTime) {
+			return hits[i].modTime.After(hits[j].modTime)
+		}
+		return hits[i].path < hits[j].path
+	})
+
+	var out []string
+	header := fmt.Sprintf("Found %d files matching '%s':", len(hits), pattern)
+	if len(hits) > maxResults {
+		header = fmt.Sprintf("Found %d files matching '%s' (showing the %d most recently modified):", len(hits), pattern, maxResults)
+	}
+	out = append(out, header, "")
+	for i, h := range hits {
+		if i == maxResults {
+			out = append(out, "", fmt.Sprintf("... %d more files not shown (raise max_results or narrow the pattern)", len(hits)-maxResults))
+			break
+		}
+		out = append(out, h.path)
+	}
+	if denied > 0 {
+		out = append(out, "", fmt.Sprintf("Note: %d files or directories could not be read (permission denied).", denied))
+	}
+	return strings.Join(out, "\n") + "\n", nil
+}
+
+// splitGlobBase splits a slash-separated pattern into its leading literal
+// directories and the remainder. Patterns without a slash have no base and
+// an empty remainder; they match names at any depth.
+func splitGlobBase(pattern string) (base, rest string) {
+	if !strings.Contains(pattern, "/") {
+		return "", ""
+	}
+	segments := strings.Split(pattern, "/")
+	i := 0
+	for i < len(segments)-1 && !strings.ContainsAny(segments[i], "*?[\\") {
+		i++
+	}
+	return strings.Join(segments[:i], "/"), strings.Join(segments[i:], "/")
+}
+
+// expandBraces expands "{a,b}" alternatives, including nested ones:
+// "*.{go,mod}" becomes ["*.go", "*.mod"].
+func expandBraces(pattern string) ([]string, error) {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		if strings.IndexByte(pattern, '}') >= 0 {
+			return nil, fmt.Errorf("unbalanced '}' in pattern '%s'", pattern)
+		}
+		return []string{pattern}, nil
+	}
+
+	// Find the matching close brace and the top-level commas between.
+	depth := 0
+	commas := []int{}
+	close := -1
+	for i := open; i < len(pattern) && close < 0; i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				close = i
+			}
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		}
+	}
+	if close < 0 {
+		return nil, fmt.Errorf("unbalanced '{' in pattern '%s'. Example: '*.{go,mod}'", pattern)
+	}
 
-	// Build result with summary
-	result := fmt.Sprintf("Found %d files matching '%s':\n\n%s", fileCount, pattern, string(output))
+	prefix, suffix := pattern[:open], pattern[close+1:]
+	var alternatives []string
+	start := open + 1
+	for _, c := range append(commas, close) {
+		alternatives = append(alternatives, pattern[start:c])
+		start = c + 1
+	}
 
-	return result, nil
+	var expanded []string
+	for _, alt := range alternatives {
+		more, err := expandBraces(prefix + alt + suffix)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, more...)
+	}
+	return expanded, nil
 }
 
 func displayGlob(input map[string]interface{}) string {
@@ -115,11 +313,11 @@ func displayGlob(input map[string]interface{}) string {
 	if pathVal, ok := input["path"]; ok && pathVal != nil {
 		path, _ = pathVal.(string)
 	}
-	
+
 	searchPath := path
 	if searchPath == "" || searchPath == "." {
 		searchPath = "current directory"
 	}
-	
+
 	return fmt.Sprintf("→ Finding files: '%s' in %s", pattern, searchPath)
 }
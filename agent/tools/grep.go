@@ -1,40 +1,102 @@
 package tools
 
 import (
-	"github.com/this-is-alpha-iota/clyde/agent/providers"
 	"fmt"
+	"io/fs"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"unicode/utf8"
+
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
 )
 
 func init() {
 	Register(grepTool, executeGrep, displayGrep)
+	RegisterReadPaths("grep", dirInput)
 }
 
 var grepTool = providers.Tool{
 	Name:        "grep",
-	Description: "Search for patterns across multiple files. Returns file paths and matching lines with context. Useful for finding function definitions, variable references, TODO comments, error messages, and configuration values.",
+	Description: "Search for a regular expression across files. Skips files ignored by .gitignore/.clydeignore as well as .git, node_modules and vendor directories. Returns matching lines as path:line:text, optionally with context lines, or just the matching files or per-file counts. Useful for finding function definitions, variable references, TODO comments, error messages, and configuration values.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
 			"pattern": map[string]interface{}{
 				"type":        "string",
-				"description": "The search pattern (text or regex). Example: 'func main', 'TODO', 'error:'",
+				"description": "The search pattern (Go regular expression syntax). Example: 'func main', 'TODO', 'error:', 'func \\w+Handler'. A pattern that is not a valid regex is searched for literally.",
 			},
 			"path": map[string]interface{}{
 				"type":        "string",
-				"description": "Directory to search. Defaults to current directory if not specified.",
+				"description": "File or directory to search. Defaults to current directory if not specified.",
 			},
 			"file_pattern": map[string]interface{}{
 				"type":        "string",
-				"description": "Optional: filter by file pattern using glob syntax. Example: '*.go', '*.md', 'test_*.py'",
+				"description": "Optional: filter by file pattern using glob syntax. Example: '*.go', '*.md', 'test_*.py', 'src/**/*.ts'",
+			},
+			"case_insensitive": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Match regardless of case.",
+			},
+			"multiline": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Let the pattern span lines ('.' also matches newlines). Each match is reported with all the lines it covers.",
+			},
+			"context": map[string]interface{}{
+				"type":        "integer",
+				"description": "Lines of context to show before and after each match (like grep -C).",
+			},
+			"before": map[string]interface{}{
+				"type":        "integer",
+				"description": "Lines of context to show before each match (like grep -B).",
+			},
+			"after": map[string]interface{}{
+				"type":        "integer",
+				"description": "Lines of context to show after each match (like grep -A).",
+			},
+			"output_mode": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"content", "files", "count"},
+				"description": "'content' (default) shows matching lines; 'files' lists only files with matches; 'count' shows the number of matches per file.",
+			},
+			"max_results": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum matches (or files, in files/count mode) to return. Default 200.",
+			},
+			"no_ignore": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Also search ignored files and directories.",
 			},
 		},
 		"required": []string{"pattern"},
 	},
 }
 
+const (
+	// defaultGrepResults caps grep output when max_results is not given.
+	defaultGrepResults = 200
+	// maxGrepLineChars truncates very long matching lines in the output.
+	maxGrepLineChars = 500
+	// maxGrepFileBytes skips files too large to read whole, such as big
+	// logs and data dumps.
+	maxGrepFileBytes = 10 << 20
+)
+
+// grepMatch is one match: the 0-based lines it covers in a file.
+type grepMatch struct {
+	first, last int
+}
+
+// grepFile holds a file's matches and, for content mode, its lines.
+type grepFile struct {
+	path    string
+	lines   []string
+	matches []grepMatch
+}
+
 func executeGrep(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
 	pattern, patternOk := input["pattern"].(string)
 	if !patternOk || pattern == "" {
@@ -55,87 +117,300 @@ func executeGrep(input map[string]interface{}, apiClient *providers.Client, conv
 		return "", fmt.Errorf("directory '%s' does not exist. Use '.' for current directory or provide a valid path", path)
 	}
 
-	// Build the grep command
-	// Use -r for recursive, -n for line numbers, -H for file names
-	// Use -I to skip binary files
-	args := []string{"-rnI", pattern, path}
-
-	// Add file pattern if specified
 	filePattern := ""
 	if fpVal, ok := input["file_pattern"]; ok && fpVal != nil {
 		filePattern, _ = fpVal.(string)
 	}
-	if filePattern != "" {
-		args = append(args, "--include="+filePattern)
+	caseInsensitive, _ := input["case_insensitive"].(bool)
+	multiline, _ := input["multiline"].(bool)
+	noIgnore, _ := input["no_ignore"].(bool)
+
+	before, after := 0, 0
+	if c, ok := input["context"].(float64); ok {
+		before, after = int(c), int(c)
+	}
+	if b, ok := input["before"].(float64); ok {
+		before = int(b)
+	}
+	if a, ok := input["after"].(float64); ok {
+		after = int(a)
+	}
+	if before < 0 || after < 0 {
+		return "", fmt.Errorf("context, before and after must not be negative")
 	}
 
-	cmd := exec.Command("grep", args...)
-	output, err := cmd.CombinedOutput()
+	mode := "content"
+	if m, ok := input["output_mode"].(string); ok && m != "" {
+		mode = m
+	}
+	if mode != "content" && mode != "files" && mode != "count" {
+		return "", fmt.Errorf("output_mode must be 'content', 'files' or 'count', got '%s'", mode)
+	}
+	maxResults := defaultGrepResults
+	if m, ok := input["max_results"].(float64); ok && m > 0 {
+		maxResults = int(m)
+	}
 
-	// grep returns exit code 1 if no matches found (not an error for us)
+	flags := ""
+	if caseInsensitive {
+		flags += "i"
+	}
+	if multiline {
+		flags += "s"
+	}
+	if flags != "" {
+		flags = "(?" + flags + ")"
+	}
+	var notes []string
+	re, err := regexp.Compile(flags + pattern)
 	if err != nil {
-		exitErr, ok := err.(*exec.ExitError)
-		if ok && exitErr.ExitCode() == 1 {
-			// No matches found
-			suggestions := []string{
-				fmt.Sprintf("No matches found for pattern '%s' in %s", pattern, path),
-			}
-			if filePattern != "" {
-				suggestions = append(suggestions, fmt.Sprintf("(searching files matching '%s')", filePattern))
+		// Plain text such as "foo(" is a common search; treat it literally.
+		re = regexp.MustCompile(flags + regexp.QuoteMeta(pattern))
+		notes = append(notes, fmt.Sprintf("Note: '%s' is not a valid regular expression (%v); searched for it literally.", pattern, err))
+	}
+
+	var matcher *ignore.Matcher
+	if !noIgnore {
+		matcher = ignore.New(path)
+	}
+
+	var files []grepFile
+	var skipped, tooLarge []string
+	walkErr := ignore.Walk(path, matcher, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsPermission(err) {
+				skipped = append(skipped, p)
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
 			}
-			suggestions = append(suggestions,
-				"",
-				"Suggestions:",
-				"  - Check if the pattern is spelled correctly",
-				"  - Try a simpler or broader search pattern",
-				"  - Verify you're searching in the right directory",
-			)
-			if filePattern != "" {
-				suggestions = append(suggestions, "  - Check if the file pattern matches existing files")
+			return err
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		if filePattern != "" && !matchFilePattern(filePattern, path, p) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.Size() > maxGrepFileBytes {
+			tooLarge = append(tooLarge, p)
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			skipped = append(skipped, p)
+			return nil
+		}
+		head := data
+		if len(head) > binarySniffBytes {
+			head = head[:binarySniffBytes]
+		}
+		if isBinary(head) {
+			return nil
+		}
+		if f := grepContent(p, string(data), re, multiline); len(f.matches) > 0 {
+			files = append(files, f)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		return "", fmt.Errorf("grep failed searching '%s': %v", path, walkErr)
+	}
+	if len(skipped) > 0 {
+		notes = append(notes, fmt.Sprintf("Note: %d files or directories could not be read (permission denied).", len(skipped)))
+	}
+	if len(tooLarge) > 0 {
+		notes = append(notes, fmt.Sprintf("Note: %d files over %d MB were not searched: %s. Search them with run_bash (grep -n) if needed.",
+			len(tooLarge), maxGrepFileBytes>>20, strings.Join(tooLarge, ", ")))
+	}
+
+	if len(files) == 0 {
+		suggestions := []string{
+			fmt.Sprintf("No matches found for pattern '%s' in %s", pattern, path),
+		}
+		if filePattern != "" {
+			suggestions = append(suggestions, fmt.Sprintf("(searching files matching '%s')", filePattern))
+		}
+		suggestions = append(suggestions, notes...)
+		suggestions = append(suggestions,
+			"",
+			"Suggestions:",
+			"  - Check if the pattern is spelled correctly",
+			"  - Try a simpler or broader search pattern",
+			"  - Verify you're searching in the right directory",
+		)
+		if !caseInsensitive {
+			suggestions = append(suggestions, "  - Try case_insensitive: true")
+		}
+		if !noIgnore {
+			suggestions = append(suggestions, "  - Ignored files were skipped; use no_ignore: true to include them")
+		}
+		if filePattern != "" {
+			suggestions = append(suggestions, "  - Check if the file pattern matches existing files")
+		}
+		return strings.Join(suggestions, "\n"), nil
+	}
+
+	total := 0
+	for _, f := range files {
+		total += len(f.matches)
+	}
+
+	var out []string
+	switch mode {
+	case "files":
+		out = append(out, fmt.Sprintf("Found %d matches in %d files:", total, len(files)), "")
+		for i, f := range files {
+			if i == maxResults {
+				out = append(out, "", fmt.Sprintf("... %d more files not shown (raise max_results or narrow the search)", len(files)-maxResults))
+				break
 			}
-			return strings.Join(suggestions, "\n"), nil
+			out = append(out, f.path)
 		}
 
-		// Check for other grep errors
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			if exitErr.ExitCode() == 2 {
-				// grep syntax error or file not found
-				return "", fmt.Errorf("grep error: %s\n\nOutput: %s\n\nCheck your pattern syntax or file paths",
-					err, string(output))
+	case "count":
+		out = append(out, fmt.Sprintf("Found %d matches in %d files:", total, len(files)), "")
+		sort.SliceStable(files, func(i, j int) bool { return len(files[i].matches) > len(files[j].matches) })
+		for i, f := range files {
+			if i == maxResults {
+				out = append(out, "", fmt.Sprintf("... %d more files not shown (raise max_results or narrow the search)", len(files)-maxResults))
+				break
 			}
+			out = append(out, fmt.Sprintf("%s:%d", f.path, len(f.matches)))
 		}
 
-		// Permission or other errors
-		if strings.Contains(string(output), "Permission denied") {
-			return "", fmt.Errorf("permission denied searching in '%s'. Some directories or files may not be accessible", path)
+	default:
+		out = append(out, fmt.Sprintf("Found %d matches in %d files:", total, len(files)), "")
+		shown := 0
+		for fi, f := range files {
+			if shown == maxResults {
+				break
+			}
+			matches := f.matches
+			if shown+len(matches) > maxResults {
+				matches = matches[:maxResults-shown]
+			}
+			shown += len(matches)
+			if fi > 0 && (before > 0 || after > 0) {
+				out = append(out, "--")
+			}
+			out = append(out, formatGrepFile(f, matches, before, after)...)
+		}
+		if shown < total {
+			out = append(out, "", fmt.Sprintf("... %d more matches not shown (raise max_results, use output_mode 'files' or 'count', or narrow the search)", total-shown))
 		}
+	}
 
-		return "", fmt.Errorf("grep failed: %s\nOutput: %s", err, string(output))
+	if len(notes) > 0 {
+		out = append(out, "")
+		out = append(out, notes...)
 	}
+	return strings.Join(out, "\n") + "\n", nil
+}
+
+// grepContent finds every match of re in content. In multiline mode the
+// pattern runs over the whole file and a match may span several lines;
+// otherwise each line is matched on its own.
+func grepContent(path, content string, re *regexp.Regexp, multiline bool) grepFile {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	f := grepFile{path: path, lines: lines}
 
-	// Success - format and return results
-	if len(output) == 0 {
-		return fmt.Sprintf("No matches found for pattern '%s' in %s", pattern, path), nil
+	if !multiline {
+		for i, line := range lines {
+			if re.MatchString(line) {
+				f.matches = append(f.matches, grepMatch{first: i, last: i})
+			}
+		}
+		return f
 	}
 
-	// Count matches and files
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	matchCount := len(lines)
+	// Map byte offsets to line numbers.
+	starts := make([]int, len(lines))
+	offset := 0
+	for i, line := range lines {
+		starts[i] = offset
+		offset += len(line) + 1
+	}
+	lineAt := func(pos int) int {
+		return sort.Search(len(starts), func(i int) bool { return starts[i] > pos }) - 1
+	}
+	for _, loc := range re.FindAllStringIndex(content, -1) {
+		end := loc[1]
+		if end > loc[0] {
+			end-- // the last byte of the match, not the one after
+		}
+		m := grepMatch{first: lineAt(loc[0]), last: lineAt(end)}
+		if m.last >= len(lines) {
+			m.last = len(lines) - 1
+		}
+		// Several matches on one line count once.
+		if n := len(f.matches); n > 0 && f.matches[n-1].first == m.first {
+			continue
+		}
+		f.matches = append(f.matches, m)
+	}
+	return f
+}
 
-	// Count unique files
-	fileSet := make(map[string]bool)
-	for _, line := range lines {
-		if colonIdx := strings.Index(line, ":"); colonIdx > 0 {
-			filename := line[:colonIdx]
-			fileSet[filename] = true
+// formatGrepFile renders matches grep-style: "path:N:text" for matching
+// lines, "path-N-text" for context lines and "--" between separate groups.
+func formatGrepFile(f grepFile, matches []grepMatch, before, after int) []string {
+	matched := make(map[int]bool)
+	for _, m := range matches {
+		for i := m.first; i <= m.last; i++ {
+			matched[i] = true
 		}
 	}
-	fileCount := len(fileSet)
 
-	// Build result with summary
-	result := fmt.Sprintf("Found %d matches in %d files:\n\n%s", matchCount, fileCount, string(output))
+	var out []string
+	last := -1
+	for _, m := range matches {
+		from := m.first - before
+		if from < 0 {
+			from = 0
+		}
+		if from <= last {
+			from = last + 1
+		}
+		to := m.last + after
+		if to >= len(f.lines) {
+			to = len(f.lines) - 1
+		}
+		if last >= 0 && from > last+1 && (before > 0 || after > 0) {
+			out = append(out, "--")
+		}
+		for i := from; i <= to; i++ {
+			line := f.lines[i]
+			if utf8.RuneCountInString(line) > maxGrepLineChars {
+				line = string([]rune(line)[:maxGrepLineChars]) + "…"
+			}
+			sep := "-"
+			if matched[i] {
+				sep = ":"
+			}
+			out = append(out, fmt.Sprintf("%s%s%d%s%s", f.path, sep, i+1, sep, line))
+		}
+		if to > last {
+			last = to
+		}
+	}
+	return out
+}
 
-	return result, nil
+// matchFilePattern reports whether file (found under root) matches a glob.
+// Patterns without a slash match the base name, like grep --include;
+// patterns with one match the path relative to root.
+func matchFilePattern(pattern, root, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(file))
+		return ok
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		return false
+	}
+	return ignore.Match(pattern, filepath.ToSlash(rel))
 }
 
 func displayGrep(input map[string]interface{}) string {
@@ -144,17 +419,17 @@ func displayGrep(input map[string]interface{}) string {
 	if pathVal, ok := input["path"]; ok && pathVal != nil {
 		path, _ = pathVal.(string)
 	}
-	
+
 	searchPath := path
 	if searchPath == "" || searchPath == "." {
 		searchPath = "current directory"
 	}
-	
+
 	filePattern := ""
 	if fpVal, ok := input["file_pattern"]; ok && fpVal != nil {
 		filePattern, _ = fpVal.(string)
 	}
-	
+
 	if filePattern != "" {
 		return fmt.Sprintf("→ Searching: '%s' in %s (%s)", pattern, searchPath, filePattern)
 	}
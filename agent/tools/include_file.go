@@ -14,6 +14,7 @@ import (
 
 func init() {
 	Register(includeFileTool, executeIncludeFile, displayIncludeFile)
+	RegisterReadPaths("include_file", includeFilePaths)
 }
 
 var includeFileTool = providers.Tool{
@@ -31,6 +32,16 @@ var includeFileTool = providers.Tool{
 	},
 }
 
+// includeFilePaths is the local file an include_file call reads (none for
+// URLs).
+func includeFilePaths(input map[string]interface{}) []string {
+	path, _ := input["path"].(string)
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return nil
+	}
+	return pathInput(input)
+}
+
 func executeIncludeFile(input map[string]interface{}, apiClient *providers.Client, history []providers.Message) (string, error) {
 	path, ok := input["path"].(string)
 	if !ok || path == "" {
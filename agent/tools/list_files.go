@@ -1,20 +1,27 @@
 package tools
 
 import (
-	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"bytes"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent/ignore"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
 )
 
 func init() {
 	Register(listFilesTool, executeListFiles, displayListFiles)
+	RegisterReadPaths("list_files", dirInput)
 }
 
 var listFilesTool = providers.Tool{
 	Name:        "list_files",
-	Description: "List files and directories in a specified path. Returns the output of 'ls -la' command.",
+	Description: "List files and directories in a specified path. By default returns the output of 'ls -la'. With tree or depth, returns a compact indented tree of the directory and its subdirectories, skipping ignored files (.gitignore/.clydeignore) and directories like .git, node_modules and vendor — one call instead of many when exploring a repository.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -22,11 +29,40 @@ var listFilesTool = providers.Tool{
 				"type":        "string",
 				"description": "The directory path to list. Use '.' for current directory. Defaults to current directory if not specified.",
 			},
+			"tree": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Show a recursive indented tree instead of 'ls -la' (default depth 3).",
+			},
+			"depth": map[string]interface{}{
+				"type":        "integer",
+				"description": "How many directory levels the tree descends (1 = only the directory itself). Implies tree.",
+			},
+			"ignore": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Tree only: skip ignored files and .git/node_modules/vendor directories (default true). Set false to show everything.",
+			},
+			"sizes": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Tree only: show each file's size and line count.",
+			},
 		},
 		"required": []string{},
 	},
 }
 
+const (
+	// defaultTreeDepth is how deep a tree goes when only tree is set.
+	defaultTreeDepth = 3
+	// treeDirFiles is how many files a tree shows per directory before
+	// collapsing the rest into "(+N files)".
+	treeDirFiles = 30
+	// treeMaxEntries bounds the whole tree so a deep listing of a large
+	// repository cannot flood the context.
+	treeMaxEntries = 1000
+	// maxLineCountBytes skips line counting for files larger than this.
+	maxLineCountBytes = 10 * 1024 * 1024
+)
+
 func executeListFiles(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
 	path := ""
 	if pathVal, ok := input["path"]; ok && pathVal != nil {
@@ -35,7 +71,28 @@ func executeListFiles(input map[string]interface{}, apiClient *providers.Client,
 	if path == "" {
 		path = "."
 	}
-	
+
+	tree, _ := input["tree"].(bool)
+	depth := 0
+	if d, ok := input["depth"].(float64); ok {
+		depth = int(d)
+		if depth < 1 {
+			return "", fmt.Errorf("depth must be 1 or greater, got %d", depth)
+		}
+		tree = true
+	}
+	if tree {
+		if depth == 0 {
+			depth = defaultTreeDepth
+		}
+		useIgnore := true
+		if v, ok := input["ignore"].(bool); ok {
+			useIgnore = v
+		}
+		sizes, _ := input["sizes"].(bool)
+		return listTree(path, depth, useIgnore, sizes)
+	}
+
 	cmd := exec.Command("ls", "-la", path)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -52,13 +109,201 @@ func executeListFiles(input map[string]interface{}, apiClient *providers.Client,
 	return string(output), nil
 }
 
+// treeNode is one entry of a directory tree.
+type treeNode struct {
+	name     string
+	dir      bool
+	size     int64
+	lines    int
+	binary   bool
+	children []*treeNode
+	// truncated marks a directory at the depth limit whose contents were
+	// not listed; entries counts them.
+	truncated bool
+	entries   int
+}
+
+// listTree renders path as an indented tree, depth levels deep.
+func listTree(path string, depth int, useIgnore, sizes bool) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("directory '%s' does not exist. Use '.' for current directory or provide a valid path", path)
+		}
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("permission denied accessing '%s'. Check file permissions or try a different directory", path)
+		}
+		return "", fmt.Errorf("failed to list files in '%s': %v", path, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("'%s' is a file, not a directory. Use read_file to read it", path)
+	}
+
+	var matcher *ignore.Matcher
+	if useIgnore {
+		matcher = ignore.New(path)
+	}
+
+	// Nodes are keyed by cleaned path: the walk joins (and so cleans) the
+	// paths below the root, which is looked up as filepath.Dir of its entries
+	root := &treeNode{name: path, dir: true}
+	nodes := map[string]*treeNode{filepath.Clean(path): root}
+	dirs, files, denied := 0, 0, 0
+	err = ignore.Walk(path, matcher, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsPermission(err) && p != path {
+				denied++
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			return err
+		}
+		if p == path {
+			return nil
+		}
+		parent := nodes[filepath.Dir(p)]
+		if parent == nil {
+			return nil
+		}
+		node := &treeNode{name: d.Name(), dir: d.IsDir()}
+		parent.children = append(parent.children, node)
+
+		if d.IsDir() {
+			dirs++
+			nodes[p] = node
+			rel, _ := filepath.Rel(path, p)
+			if strings.Count(rel, string(filepath.Separator))+1 >= depth {
+				node.truncated = true
+				entries, _ := os.ReadDir(p)
+				for _, e := range entries {
+					if matcher == nil || !matcher.Ignored(filepath.Join(p, e.Name()), e.IsDir()) {
+						node.entries++
+					}
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		files++
+		if sizes {
+			if fi, err := d.Info(); err == nil {
+				node.size = fi.Size()
+				if fi.Mode().IsRegular() && fi.Size() <= maxLineCountBytes {
+					if data, err := os.ReadFile(p); err == nil {
+						head := data
+						if len(head) > binarySniffBytes {
+							head = head[:binarySniffBytes]
+						}
+						if isBinary(head) {
+							node.binary = true
+						} else {
+							node.lines = bytes.Count(data, []byte("\n"))
+							if len(data) > 0 && data[len(data)-1] != '\n' {
+								node.lines++
+							}
+						}
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list files in '%s': %v", path, err)
+	}
+
+	var out []string
+	out = append(out, strings.TrimSuffix(path, "/")+"/")
+	truncated := renderTree(&out, root, 1, sizes)
+
+	out = append(out, "", fmt.Sprintf("%d directories, %d files (depth %d", dirs, files, depth))
+	if useIgnore {
+		out[len(out)-1] += ", ignored files hidden"
+	}
+	out[len(out)-1] += ")"
+	if truncated {
+		out = append(out, fmt.Sprintf("Output limited to %d entries; list a subdirectory or use a smaller depth to see more.", treeMaxEntries))
+	}
+	if denied > 0 {
+		out = append(out, fmt.Sprintf("Note: %d files or directories could not be read (permission denied).", denied))
+	}
+	return strings.Join(out, "\n") + "\n", nil
+}
+
+// renderTree appends node's children to out, indented two spaces per level:
+// directories first, then files, with long file lists collapsed. It reports
+// whether treeMaxEntries was reached.
+func renderTree(out *[]string, node *treeNode, level int, sizes bool) bool {
+	var dirs, files []*treeNode
+	for _, c := range node.children {
+		if c.dir {
+			dirs = append(dirs, c)
+		} else {
+			files = append(files, c)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].name < dirs[j].name })
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	indent := strings.Repeat("  ", level)
+
+	for _, d := range dirs {
+		if len(*out) >= treeMaxEntries {
+			return true
+		}
+		line := indent + d.name + "/"
+		if d.truncated && d.entries > 0 {
+			if d.entries == 1 {
+				line += " (1 entry)"
+			} else {
+				line += fmt.Sprintf(" (%d entries)", d.entries)
+			}
+		}
+		*out = append(*out, line)
+		if !d.truncated && renderTree(out, d, level+1, sizes) {
+			return true
+		}
+	}
+
+	for i, f := range files {
+		if i == treeDirFiles && len(files) > treeDirFiles {
+			*out = append(*out, fmt.Sprintf("%s(+%d files)", indent, len(files)-treeDirFiles))
+			break
+		}
+		if len(*out) >= treeMaxEntries {
+			return true
+		}
+		line := indent + f.name
+		if sizes {
+			switch {
+			case f.binary:
+				line += fmt.Sprintf(" (%s, binary)", formatSize(f.size))
+			case f.lines > 0:
+				line += fmt.Sprintf(" (%s, %s)", formatSize(f.size), plural(f.lines, "line"))
+			default:
+				line += fmt.Sprintf(" (%s)", formatSize(f.size))
+			}
+		}
+		*out = append(*out, line)
+	}
+	return false
+}
+
 func displayListFiles(input map[string]interface{}) string {
 	path := ""
 	if pathVal, ok := input["path"]; ok && pathVal != nil {
 		path, _ = pathVal.(string)
 	}
 	if path == "" || path == "." {
-		return "→ Listing files: . (current directory)"
+		path = ". (current directory)"
+	}
+	if d, ok := input["depth"].(float64); ok {
+		return fmt.Sprintf("→ Listing files: %s (tree, depth %d)", path, int(d))
+	}
+	if tree, _ := input["tree"].(bool); tree {
+		return fmt.Sprintf("→ Listing files: %s (tree)", path)
 	}
 	return fmt.Sprintf("→ Listing files: %s", path)
 }
@@ -3,23 +3,24 @@ package tools
 import (
 	"github.com/this-is-alpha-iota/clyde/agent/providers"
 	"fmt"
-	"os/exec"
+	"os"
 	"strings"
 )
 
 func init() {
 	Register(multiPatchTool, executeMultiPatch, displayMultiPatch)
+	RegisterWritePaths("multi_patch", multiPatchPaths)
 }
 
 var multiPatchTool = providers.Tool{
 	Name:        "multi_patch",
-	Description: "Apply coordinated changes to multiple files atomically. If any patch fails, all previous changes are rolled back using git. Best for refactoring function names, updating imports, or applying consistent changes across files.",
+	Description: "Apply coordinated changes to one or more files atomically. Patches are applied in order, so several patches may target the same file (each must match the text as left by the ones before it). All patches are validated in memory first; if any fails, no file is modified. Best for refactoring function names, updating imports, or applying consistent changes across files.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
 			"patches": map[string]interface{}{
 				"type":        "array",
-				"description": "Array of patches to apply to different files",
+				"description": "Array of patches, applied in order. The same path may appear more than once.",
 				"items": map[string]interface{}{
 					"type": "object",
 					"properties": map[string]interface{}{
@@ -44,6 +45,21 @@ var multiPatchTool = providers.Tool{
 	},
 }
 
+// multiPatchPaths returns the distinct files named in a multi_patch call.
+func multiPatchPaths(input map[string]interface{}) []string {
+	patches, _ := input["patches"].([]interface{})
+	var paths []string
+	seen := make(map[string]bool)
+	for _, p := range patches {
+		patchMap, _ := p.(map[string]interface{})
+		if path, ok := patchMap["path"].(string); ok && path != "" && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
 type patchInfo struct {
 	Path    string
 	OldText string
@@ -85,137 +101,144 @@ func executeMultiPatch(input map[string]interface{}, apiClient *providers.Client
 		})
 	}
 
-	// Check if git is available and we're in a git repo
-	gitAvailable := false
-	if cmd := exec.Command("git", "rev-parse", "--git-dir"); cmd.Run() == nil {
-		gitAvailable = true
-	}
-
-	// Check for uncommitted changes and suggest commit if git available
-	if gitAvailable {
-		cmd := exec.Command("git", "status", "--porcelain")
-		output, err := cmd.Output()
-		if err == nil && len(output) > 0 {
-			// There are uncommitted changes - suggest committing first
-			suggestions := []string{
-				"⚠️  You have uncommitted changes.",
-				"",
-				"It's recommended to commit your changes before applying multiple patches.",
-				"This allows you to easily undo if something goes wrong.",
-				"",
-				"To commit first:",
-				"  1. Review changes: run_bash(\"git status\")",
-				"  2. Commit changes: run_bash(\"git add -A && git commit -m 'Before multi-patch'\")",
-				"  3. Then run multi_patch again",
-				"",
-				"Or, if you're sure, I can proceed anyway.",
-				"",
-				fmt.Sprintf("Ready to apply %d patches to:", len(parsedPatches)),
-			}
-			for i, patch := range parsedPatches {
-				suggestions = append(suggestions, fmt.Sprintf("  %d. %s", i+1, patch.Path))
-			}
-
-			// For now, we'll proceed but with a warning in the output
-			// In a future version, we could add confirmation logic
-			return strings.Join(suggestions, "\n"), nil
+	// Phase 1: read every target file once, keeping the originals in memory.
+	// Targets are keyed by the resolved path, so "f.txt" and "./f.txt" edit
+	// one buffer instead of overwriting each other.
+	files := make(map[string]*patchTarget)
+	keys := make([]string, len(parsedPatches))
+	var order []string
+	for i, patch := range parsedPatches {
+		keys[i] = fileKey(patch.Path)
+		if _, ok := files[keys[i]]; ok {
+			continue
 		}
+		target, err := readPatchTarget(patch.Path)
+		if err != nil {
+			return "", err
+		}
+		files[keys[i]] = target
+		order = append(order, keys[i])
 	}
 
-	// Apply patches
-	var results []string
-	var appliedPatches []patchInfo
-
+	// Phase 2: apply every edit in memory, in order. Edits to the same file
+	// see the result of the edits before them. Nothing touches disk yet, so
+	// a failure here leaves every file exactly as it was.
+	statuses := make([]string, len(parsedPatches))
+	failed := 0
 	for i, patch := range parsedPatches {
-		// Create input for executePatchFile
-		patchInput := map[string]interface{}{
-			"path":     patch.Path,
-			"old_text": patch.OldText,
-			"new_text": patch.NewText,
+		label := fmt.Sprintf("Patch %d/%d: %s", i+1, len(parsedPatches), patch.Path)
+		target := files[keys[i]]
+		if target.failed {
+			statuses[i] = fmt.Sprintf("- %s: skipped (an earlier edit to this file failed)", label)
+			continue
 		}
-		
-		result, err := executePatchFile(patchInput, apiClient, conversationHistory)
-		if err != nil {
-			// Patch failed - attempt rollback if git available
-			failureMsg := []string{
-				fmt.Sprintf("❌ Patch %d/%d FAILED: %s", i+1, len(parsedPatches), patch.Path),
-				fmt.Sprintf("Error: %v", err),
-				"",
-			}
-
-			if gitAvailable && len(appliedPatches) > 0 {
-				failureMsg = append(failureMsg,
-					fmt.Sprintf("Rolling back %d successful patches...", len(appliedPatches)),
-				)
-
-				// Attempt to restore each file that was changed
-				var rollbackErrors []string
-				for _, applied := range appliedPatches {
-					if restoreErr := exec.Command("git", "checkout", "--", applied.Path).Run(); restoreErr != nil {
-						rollbackErrors = append(rollbackErrors, fmt.Sprintf("  - Failed to restore %s: %v", applied.Path, restoreErr))
-					}
-				}
-
-				if len(rollbackErrors) > 0 {
-					failureMsg = append(failureMsg,
-						"⚠️  Some rollback operations failed:",
-					)
-					failureMsg = append(failureMsg, rollbackErrors...)
-					failureMsg = append(failureMsg,
-						"",
-						"You may need to manually restore these files with:",
-						"  git checkout -- <file>",
-					)
-				} else {
-					failureMsg = append(failureMsg,
-						"✓ Successfully rolled back all changes",
-					)
-				}
-			} else if len(appliedPatches) > 0 {
-				failureMsg = append(failureMsg,
-					fmt.Sprintf("⚠️  %d patches were applied before this failure:", len(appliedPatches)),
-				)
-				for _, applied := range appliedPatches {
-					failureMsg = append(failureMsg, fmt.Sprintf("  - %s", applied.Path))
-				}
-				if gitAvailable {
-					failureMsg = append(failureMsg,
-						"",
-						"To undo these changes, run:",
-						"  git checkout -- <files>",
-					)
-				} else {
-					failureMsg = append(failureMsg,
-						"",
-						"You may need to manually undo these changes",
-					)
-				}
-			}
-
-			return "", fmt.Errorf("%s", strings.Join(failureMsg, "\n"))
+		if err := target.apply(patch.OldText, patch.NewText); err != nil {
+			target.failed = true
+			failed++
+			statuses[i] = fmt.Sprintf("❌ %s FAILED: %v", label, err)
+			continue
 		}
+		statuses[i] = fmt.Sprintf("✓ %s: replaced %d bytes with %d bytes (change: %+d bytes)",
+			label, len(patch.OldText), len(patch.NewText), len(patch.NewText)-len(patch.OldText))
+	}
 
-		appliedPatches = append(appliedPatches, patch)
-		results = append(results, fmt.Sprintf("✓ Patch %d/%d: %s", i+1, len(parsedPatches), result))
+	if failed > 0 {
+		report := []string{
+			fmt.Sprintf("❌ multi_patch FAILED: %d of %d patches could not be applied.", failed, len(parsedPatches)),
+			"No files were modified (all patches are validated in memory before anything is written).",
+			"",
+		}
+		report = append(report, statuses...)
+		report = append(report,
+			"",
+			"Suggestions:",
+			"  - Use read_file to see the current content of the failing file",
+			"  - Later patches to the same file must match the text produced by earlier ones",
+		)
+		return "", fmt.Errorf("%s", strings.Join(report, "\n"))
+	}
+
+	// Phase 3: write every file atomically (temp file + rename). If a write
+	// fails part-way, files already replaced are restored from memory.
+	var changes []FileChange
+	for _, key := range order {
+		t := files[key]
+		changes = append(changes, FileChange{
+			Path:     t.path,
+			Content:  []byte(t.content),
+			Mode:     t.mode,
+			Existed:  true,
+			Original: t.original,
+		})
+	}
+	if err := CommitFileChanges(changes); err != nil {
+		report := []string{
+			fmt.Sprintf("❌ multi_patch FAILED while writing: %v", err),
+			"",
+		}
+		report = append(report, statuses...)
+		return "", fmt.Errorf("%s", strings.Join(report, "\n"))
 	}
 
-	// All patches succeeded
 	summary := []string{
-		fmt.Sprintf("✅ Successfully applied all %d patches:", len(parsedPatches)),
+		fmt.Sprintf("✅ Successfully applied all %d patches to %d files:", len(parsedPatches), len(order)),
 		"",
 	}
-	summary = append(summary, results...)
+	summary = append(summary, statuses...)
+	return strings.Join(summary, "\n"), nil
+}
 
-	if gitAvailable {
-		summary = append(summary,
-			"",
-			"Next steps:",
-			"  - Review changes: run_bash(\"git diff\")",
-			"  - Commit changes: run_bash(\"git add -A && git commit -m 'Applied multi-patch'\")",
-		)
+// patchTarget is one file in a multi_patch transaction: its original
+// contents (for rollback) and the contents with edits applied so far.
+type patchTarget struct {
+	path     string
+	mode     os.FileMode
+	original []byte
+	content  string
+	failed   bool
+}
+
+// readPatchTarget loads a file into memory for patching.
+func readPatchTarget(path string) (*patchTarget, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("file '%s' does not exist. Use write_file to create a new file, or use list_files to see available files", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to access '%s': %w", path, err)
 	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("'%s' is a directory, not a file", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsPermission(err) {
+			return nil, fmt.Errorf("permission denied reading '%s'. Check file permissions", path)
+		}
+		return nil, fmt.Errorf("failed to read file '%s': %w", path, err)
+	}
+	return &patchTarget{
+		path:     path,
+		mode:     info.Mode().Perm(),
+		original: content,
+		content:  string(content),
+	}, nil
+}
 
-	return strings.Join(summary, "\n"), nil
+// apply replaces the single occurrence of oldText in the in-memory content.
+func (t *patchTarget) apply(oldText, newText string) error {
+	if oldText == "" {
+		return fmt.Errorf("old_text cannot be empty")
+	}
+	switch n := strings.Count(t.content, oldText); n {
+	case 1:
+		t.content = strings.Replace(t.content, oldText, newText, 1)
+		return nil
+	case 0:
+		return fmt.Errorf("old_text not found (check whitespace, or whether an earlier patch already changed it)")
+	default:
+		return fmt.Errorf("old_text appears %d times; include more context to make it unique", n)
+	}
 }
 
 func displayMultiPatch(input map[string]interface{}) string {
@@ -223,5 +246,9 @@ func displayMultiPatch(input map[string]interface{}) string {
 	if !ok {
 		return "→ Applying multi-patch"
 	}
-	return fmt.Sprintf("→ Applying multi-patch: %d files", len(patches))
+	files := len(multiPatchPaths(input))
+	if files == len(patches) {
+		return fmt.Sprintf("→ Applying multi-patch: %d files", files)
+	}
+	return fmt.Sprintf("→ Applying multi-patch: %d edits to %d files", len(patches), files)
 }
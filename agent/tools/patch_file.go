@@ -9,11 +9,12 @@ import (
 
 func init() {
 	Register(patchFileTool, executePatchFile, displayPatchFile)
+	RegisterWritePaths("patch_file", pathInput)
 }
 
 var patchFileTool = providers.Tool{
 	Name:        "patch_file",
-	Description: "Edit a file by finding and replacing text. This is a patch-based approach that only requires the specific text to change, not the entire file. To use: (1) use read_file to see current content, (2) identify a unique string to replace, (3) provide the old text and new text. The old_text must match exactly and be unique in the file.",
+	Description: "Edit a file by finding and replacing text. This is a patch-based approach that only requires the specific text to change, not the entire file. To use: (1) use read_file to see current content, (2) identify a unique string to replace, (3) provide the old text and new text. The old_text should match exactly and must be unique in the file. If it does not match exactly, lines are matched ignoring trailing whitespace and line endings, then ignoring a uniform indentation difference; the result says when that happened.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -65,53 +66,286 @@ func executePatchFile(input map[string]interface{}, apiClient *providers.Client,
 
 	fileContent := string(content)
 
-	// Check if old_text exists in the file
-	if !strings.Contains(fileContent, oldText) {
-		// Provide helpful suggestions
-		suggestions := []string{
-			"The old_text was not found in the file. Common issues:",
-			"  1. Whitespace or newlines don't match exactly",
-			"  2. The text has already been changed",
-			"  3. There's a typo in old_text",
-			"",
-			"Suggestions:",
-			"  - Use read_file first to see the current content",
-			"  - Copy the exact text including all whitespace",
-			"  - Check for tabs vs spaces, line endings, etc.",
+	match, err := locatePatch(fileContent, oldText, newText)
+	if err != nil {
+		return "", err
+	}
+
+	// Replace the text
+	newContent := fileContent[:match.start] + match.replacement + fileContent[match.end:]
+
+	// Write the modified content back
+	if err := os.WriteFile(path, []byte(newContent), 0644); err != nil {
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("permission denied writing to '%s'. Check file permissions", path)
 		}
-		return "", fmt.Errorf("%s", strings.Join(suggestions, "\n"))
+		return "", fmt.Errorf("failed to write file '%s': %w", path, err)
 	}
 
-	// Count occurrences to ensure it's unique
-	occurrences := strings.Count(fileContent, oldText)
-	if occurrences > 1 {
+	replaced := match.end - match.start
+	changeSize := len(match.replacement) - replaced
+	result := fmt.Sprintf("Successfully patched %s: replaced %d bytes with %d bytes (change: %+d bytes)",
+		path, replaced, len(match.replacement), changeSize)
+	if match.note != "" {
+		result += "\n" + match.note
+	}
+	return result, nil
+}
+
+// patchMatch is where patch_file will apply an edit.
+type patchMatch struct {
+	// start and end are byte offsets of the text to replace.
+	start, end int
+	// replacement is new_text, adjusted to the file's line endings and
+	// indentation when a non-exact strategy matched.
+	replacement string
+	// note explains a non-exact match; empty for exact matches.
+	note string
+}
+
+// locatePatch finds the single place old_text refers to, trying strategies
+// from strictest to loosest and stopping at the first that finds anything:
+//
+//  1. exact bytes
+//  2. whole lines, ignoring trailing whitespace and CRLF vs LF
+//  3. whole lines, ignoring a uniform difference in indentation
+//
+// Multiple matches under a strategy are ambiguous and rejected rather than
+// falling through to a looser one. When nothing matches, the error lists the
+// closest regions of the file.
+func locatePatch(content, oldText, newText string) (*patchMatch, error) {
+	switch n := strings.Count(content, oldText); {
+	case n == 1:
+		start := strings.Index(content, oldText)
+		return &patchMatch{start: start, end: start + len(oldText), replacement: newText}, nil
+	case n > 1:
+		lines, _ := splitLineOffsets(content)
+		patternLines := len(textLines(oldText))
+		var candidates []region
+		offset := 0
+		for i := 0; i < n; i++ {
+			idx := strings.Index(content[offset:], oldText) + offset
+			candidates = append(candidates, region{
+				Start: strings.Count(content[:idx], "\n"), Lines: patternLines, Similarity: 1,
+			})
+			offset = idx + 1
+		}
 		suggestions := []string{
-			fmt.Sprintf("The old_text appears %d times in the file. It must be unique to ensure the right text is replaced.", occurrences),
+			fmt.Sprintf("The old_text appears %d times in the file. It must be unique to ensure the right text is replaced.", n),
+			"",
+		}
+		suggestions = append(suggestions, formatCandidates(lines, candidates)...)
+		suggestions = append(suggestions,
 			"",
 			"To fix this:",
 			"  1. Include more surrounding context in old_text",
 			"  2. Add nearby lines or unique identifiers",
 			"  3. Example: Instead of just 'func foo()', use 'func foo() {\\n\\t// comment\\n\\treturn nil'",
-			"",
-			"Use read_file to see the full context around each occurrence.",
+		)
+		return nil, fmt.Errorf("%s", strings.Join(suggestions, "\n"))
+	}
+
+	lines, starts := splitLineOffsets(content)
+	pattern := textLines(oldText)
+	endsWithNewline := strings.HasSuffix(strings.ReplaceAll(oldText, "\r\n", "\n"), "\n")
+	crlf := strings.Contains(content, "\r\n")
+
+	strategies := []struct {
+		name     string
+		seek     func() []int
+		reindent bool
+	}{
+		{"ignoring trailing whitespace and line endings", func() []int {
+			return seekLines(lines, pattern, 0, fuzzTrailing)
+		}, false},
+		{"ignoring a difference in indentation", func() []int {
+			return seekDedented(lines, pattern)
+		}, true},
+	}
+	for _, strategy := range strategies {
+		matches := strategy.seek()
+		if len(matches) == 0 {
+			continue
+		}
+		if len(matches) > 1 {
+			var candidates []region
+			for _, m := range matches {
+				candidates = append(candidates, region{Start: m, Lines: len(pattern), Similarity: 1})
+			}
+			suggestions := []string{
+				fmt.Sprintf("The old_text did not match exactly, and %s it matches %d places. It must be unique.", strategy.name, len(matches)),
+				"",
+			}
+			suggestions = append(suggestions, formatCandidates(lines, candidates)...)
+			suggestions = append(suggestions, "", "Include more surrounding context in old_text, copied exactly from read_file.")
+			return nil, fmt.Errorf("%s", strings.Join(suggestions, "\n"))
+		}
+
+		first := matches[0]
+		last := first + len(pattern) - 1
+		m := &patchMatch{start: starts[first], end: starts[last] + len(strings.TrimSuffix(lines[last], "\r"))}
+		if endsWithNewline && last+1 < len(starts) {
+			m.end = starts[last+1]
+		} else if endsWithNewline {
+			m.end = len(content)
+		}
+
+		replacement := strings.ReplaceAll(newText, "\r\n", "\n")
+		note := fmt.Sprintf("Note: old_text did not match exactly; matched lines %d-%d %s.", first+1, last+1, strategy.name)
+		if strategy.reindent {
+			from := commonIndent(pattern)
+			to := commonIndent(lines[first : last+1])
+			replacement = reindent(replacement, from, to)
+			note += fmt.Sprintf(" new_text was re-indented from %s to %s to fit.", describeIndent(from), describeIndent(to))
 		}
-		return "", fmt.Errorf("%s", strings.Join(suggestions, "\n"))
+		if crlf {
+			replacement = strings.ReplaceAll(replacement, "\n", "\r\n")
+		}
+		m.replacement = replacement
+		m.note = note
+		return m, nil
 	}
 
-	// Replace the text
-	newContent := strings.Replace(fileContent, oldText, newText, 1)
+	suggestions := []string{
+		"The old_text was not found in the file, even ignoring trailing whitespace, line endings and indentation.",
+	}
+	if near := nearestRegions(lines, pattern, 3); len(near) > 0 {
+		suggestions = append(suggestions, "", "Closest candidates:")
+		for _, r := range near {
+			suggestions = append(suggestions, formatRegion(lines, r))
+		}
+	}
+	suggestions = append(suggestions,
+		"",
+		"Suggestions:",
+		"  - Check whether the text has already been changed, or has a typo",
+		"  - If a candidate above is the right place, copy its exact text into old_text",
+		"  - Use read_file with the line numbers above to see more context",
+	)
+	return nil, fmt.Errorf("%s", strings.Join(suggestions, "\n"))
+}
 
-	// Write the modified content back
-	if err := os.WriteFile(path, []byte(newContent), 0644); err != nil {
-		if os.IsPermission(err) {
-			return "", fmt.Errorf("permission denied writing to '%s'. Check file permissions", path)
+// formatCandidates renders up to five regions, noting how many were left out.
+func formatCandidates(lines []string, candidates []region) []string {
+	const max = 5
+	out := []string{"Matches at:"}
+	for i, r := range candidates {
+		if i == max {
+			out = append(out, fmt.Sprintf("... and %d more", len(candidates)-max))
+			break
 		}
-		return "", fmt.Errorf("failed to write file '%s': %w", path, err)
+		out = append(out, formatRegion(lines, r))
 	}
+	return out
+}
 
-	changeSize := len(newText) - len(oldText)
-	return fmt.Sprintf("Successfully patched %s: replaced %d bytes with %d bytes (change: %+d bytes)",
-		path, len(oldText), len(newText), changeSize), nil
+// splitLineOffsets splits content into lines (without the "\n") and the
+// byte offset at which each starts. A final newline does not start a line.
+func splitLineOffsets(content string) ([]string, []int) {
+	var lines []string
+	var starts []int
+	offset := 0
+	for offset < len(content) {
+		end := strings.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			lines = append(lines, content[offset:])
+			starts = append(starts, offset)
+			break
+		}
+		lines = append(lines, content[offset:offset+end])
+		starts = append(starts, offset)
+		offset += end + 1
+	}
+	return lines, starts
+}
+
+// textLines splits old_text into lines, ignoring a final newline.
+func textLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// seekDedented finds windows of lines equal to pattern once each side's
+// common indentation is removed (and trailing whitespace ignored).
+func seekDedented(lines, pattern []string) []int {
+	want := dedent(pattern)
+	var matches []int
+	for i := 0; i+len(pattern) <= len(lines); i++ {
+		got := dedent(lines[i : i+len(pattern)])
+		equal := true
+		for j := range want {
+			if got[j] != want[j] {
+				equal = false
+				break
+			}
+		}
+		if equal {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// dedent strips trailing whitespace and the common leading indentation.
+func dedent(lines []string) []string {
+	indent := commonIndent(lines)
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		l = strings.TrimRight(l, " \t\r")
+		out[i] = strings.TrimPrefix(l, indent)
+	}
+	return out
+}
+
+// commonIndent returns the leading whitespace shared by all non-blank lines.
+func commonIndent(lines []string) string {
+	indent, first := "", true
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		lead := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+		if first {
+			indent, first = lead, false
+			continue
+		}
+		for !strings.HasPrefix(lead, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	return indent
+}
+
+// reindent replaces the from prefix of each non-blank line with to.
+func reindent(text, from, to string) string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		lines[i] = to + strings.TrimPrefix(l, from)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeIndent renders indentation for humans: "4 spaces", "1 tab", ...
+func describeIndent(indent string) string {
+	switch {
+	case indent == "":
+		return "no indentation"
+	case strings.Trim(indent, " ") == "":
+		return plural(len(indent), "space")
+	case strings.Trim(indent, "\t") == "":
+		return plural(len(indent), "tab")
+	}
+	return fmt.Sprintf("%q", indent)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
 }
 
 func displayPatchFile(input map[string]interface{}) string {
@@ -1,18 +1,41 @@
 package tools
 
 import (
-	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"bufio"
+	"bytes"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
 )
 
 func init() {
 	Register(readFileTool, executeReadFile, displayReadFile)
+	RegisterReadPaths("read_file", pathInput)
+	SetReadFileMaxLines(defaultReadLines)
+}
+
+// readLines is how many lines read_file returns when no limit is given.
+var readLines atomic.Int64
+
+// SetReadFileMaxLines sets how many lines read_file returns when a call
+// gives no limit. A value below 1 restores the default.
+func SetReadFileMaxLines(n int) {
+	if n < 1 {
+		n = defaultReadLines
+	}
+	readLines.Store(int64(n))
 }
 
 var readFileTool = providers.Tool{
 	Name:        "read_file",
-	Description: "Read the contents of a file at the specified path.",
+	Description: "Read the contents of a file at the specified path. Long files are returned a page at a time (2000 lines by default) with a note saying how many lines the file has; use offset and limit to read other parts. Binary files are detected and described rather than returned.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -20,17 +43,57 @@ var readFileTool = providers.Tool{
 				"type":        "string",
 				"description": "The file path to read. Can be absolute or relative to the current directory.",
 			},
+			"offset": map[string]interface{}{
+				"type":        "integer",
+				"description": "1-based line number to start reading from (default 1).",
+			},
+			"limit": map[string]interface{}{
+				"type":        "integer",
+				"description": "Maximum number of lines to return (default 2000).",
+			},
+			"line_numbers": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Prefix each line with its line number (useful before patching or when citing lines).",
+			},
 		},
 		"required": []string{"path"},
 	},
 }
 
+const (
+	// defaultReadLines is how many lines read_file returns when no limit is
+	// given. Override with SetReadFileMaxLines.
+	defaultReadLines = 2000
+	// maxReadBytes caps a single read_file result regardless of line count.
+	maxReadBytes = 256 * 1024
+	// maxLineChars truncates pathological lines (minified JS, base64 blobs).
+	maxLineChars = 2000
+	// binarySniffBytes is how much of a file is inspected for binary content.
+	binarySniffBytes = 8000
+)
+
 func executeReadFile(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
 	path, ok := input["path"].(string)
 	if !ok || path == "" {
 		return "", fmt.Errorf("file path is required. Example: read_file(\"main.go\")")
 	}
 
+	offset := 1
+	if v, ok := input["offset"].(float64); ok {
+		offset = int(v)
+		if offset < 1 {
+			return "", fmt.Errorf("offset must be 1 or greater (line numbers start at 1), got %d", offset)
+		}
+	}
+	limit := int(readLines.Load())
+	if v, ok := input["limit"].(float64); ok {
+		limit = int(v)
+		if limit < 1 {
+			return "", fmt.Errorf("limit must be 1 or greater, got %d", limit)
+		}
+	}
+	lineNumbers, _ := input["line_numbers"].(bool)
+
 	// Check if file exists first
 	info, err := os.Stat(path)
 	if err != nil {
@@ -48,20 +111,149 @@ func executeReadFile(input map[string]interface{}, apiClient *providers.Client,
 		return "", fmt.Errorf("'%s' is a directory. Use list_files to list its contents instead", path)
 	}
 
-	// Check file size to warn about large files
-	if info.Size() > 1024*1024 { // 1MB
-		return "", fmt.Errorf("file '%s' is very large (%d MB). Consider reading a smaller section or using a different approach",
-			path, info.Size()/(1024*1024))
-	}
-
-	content, err := os.ReadFile(path)
+	f, err := os.Open(path)
 	if err != nil {
+		if os.IsPermission(err) {
+			return "", fmt.Errorf("permission denied reading '%s'. Check file permissions", path)
+		}
 		return "", fmt.Errorf("failed to read file '%s': %w", path, err)
 	}
-	return string(content), nil
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	head, _ := reader.Peek(binarySniffBytes)
+	if isBinary(head) {
+		suggestions := []string{
+			fmt.Sprintf("'%s' appears to be a binary file (%s, %s), so its contents are not shown.",
+				path, http.DetectContentType(head), formatSize(info.Size())),
+			"",
+			"Suggestions:",
+			"  - For images, use include_file to view them",
+			fmt.Sprintf("  - To inspect the bytes, use run_bash(\"xxd %s | head\") or run_bash(\"file %s\")", path, path),
+		}
+		return "", fmt.Errorf("%s", strings.Join(suggestions, "\n"))
+	}
+
+	var out strings.Builder
+	total, first, last := 0, 0, 0
+	truncatedLines := 0
+	cappedAt := 0
+	width := len(strconv.Itoa(offset + limit - 1))
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			total++
+			if total >= offset && total < offset+limit && cappedAt == 0 {
+				if out.Len()+len(line) > maxReadBytes && first != 0 {
+					cappedAt = total
+				} else {
+					if first == 0 {
+						first = total
+					}
+					last = total
+					if text := strings.TrimRight(line, "\r\n"); utf8.RuneCountInString(text) > maxLineChars {
+						// Cut on a rune boundary so the output stays valid UTF-8
+						truncatedLines++
+						line = fmt.Sprintf("%s… [line truncated, %d chars]\n", string([]rune(text)[:maxLineChars]), utf8.RuneCountInString(text))
+					}
+					if lineNumbers {
+						fmt.Fprintf(&out, "%*d | ", width, total)
+						if !strings.HasSuffix(line, "\n") {
+							line += "\n"
+						}
+					}
+					out.WriteString(line)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read file '%s': %w", path, err)
+		}
+	}
+
+	if total == 0 {
+		return "", nil
+	}
+	if first == 0 {
+		return "", fmt.Errorf("offset %d is past the end of '%s', which has %d lines", offset, path, total)
+	}
+
+	result := out.String()
+	complete := first == 1 && last == total
+	if complete && truncatedLines == 0 {
+		// The whole file: returned verbatim (plus the gutter, if asked for).
+		return result, nil
+	}
+
+	var notes []string
+	if !complete {
+		note := fmt.Sprintf("Showing lines %d-%d. File has %d lines", first, last, total)
+		if last < total {
+			note += fmt.Sprintf("; use offset=%d to continue", last+1)
+		}
+		if cappedAt != 0 {
+			note += fmt.Sprintf(" (output capped at %s)", formatSize(maxReadBytes))
+		}
+		notes = append(notes, note+".")
+	}
+	if truncatedLines > 0 {
+		notes = append(notes, fmt.Sprintf("%d lines longer than %d characters were truncated.", truncatedLines, maxLineChars))
+	}
+	if !strings.HasSuffix(result, "\n") {
+		result += "\n"
+	}
+	return result + "\n[" + strings.Join(notes, " ") + "]", nil
+}
+
+// isBinary reports whether data looks like binary rather than text: it
+// contains a NUL byte, or too much of it is not valid UTF-8.
+func isBinary(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return true
+	}
+	invalid := 0
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			// A multi-byte rune cut off by the sniff window is not binary.
+			if len(data)-i < utf8.UTFMax {
+				break
+			}
+			invalid++
+		}
+		i += size
+	}
+	return invalid*10 > len(data)
+}
+
+// formatSize renders a byte count for messages.
+func formatSize(n int64) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d bytes", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
 }
 
 func displayReadFile(input map[string]interface{}) string {
 	path, _ := input["path"].(string)
+	offset, hasOffset := input["offset"].(float64)
+	limit, hasLimit := input["limit"].(float64)
+	switch {
+	case hasOffset && hasLimit:
+		return fmt.Sprintf("→ Reading file: %s (lines %d-%d)", path, int(offset), int(offset)+int(limit)-1)
+	case hasOffset:
+		return fmt.Sprintf("→ Reading file: %s (from line %d)", path, int(offset))
+	case hasLimit:
+		return fmt.Sprintf("→ Reading file: %s (first %d lines)", path, int(limit))
+	}
 	return fmt.Sprintf("→ Reading file: %s", path)
 }
@@ -11,11 +11,27 @@ type ExecutorFunc func(input map[string]interface{}, apiClient *providers.Client
 // DisplayFunc is a function that formats a display message for a tool
 type DisplayFunc func(input map[string]interface{}) string
 
+// PathsFunc returns the files a tool call is about to modify, as given in
+// its input (relative or absolute). Used to checkpoint files before writes.
+type PathsFunc func(input map[string]interface{}) []string
+
+// PermissionFunc decides whether a tool call needs the user's approval.
+// It returns a description of what is being requested, or "" when the call
+// may run without asking.
+type PermissionFunc func(input map[string]interface{}) string
+
 // Registration holds a tool registration
 type Registration struct {
 	Tool     providers.Tool
 	Execute  ExecutorFunc
 	Display  DisplayFunc
+	// WritePaths is set for tools that modify files (nil for read-only tools).
+	WritePaths PathsFunc
+	// ReadPaths is set for tools that read files or directories named in
+	// their input, so the agent can check them against the workspace.
+	ReadPaths PathsFunc
+	// Permission is set for tools whose calls may need approval.
+	Permission PermissionFunc
 }
 
 // Registry holds all registered tools
@@ -30,6 +46,36 @@ func Register(tool providers.Tool, execute ExecutorFunc, display DisplayFunc) {
 	}
 }
 
+// Unregister removes a tool, such as a custom tool that is no longer
+// declared.
+func Unregister(name string) {
+	delete(Registry, name)
+}
+
+// RegisterWritePaths declares which files a registered tool modifies.
+// Must be called after Register for the same tool name.
+func RegisterWritePaths(name string, paths PathsFunc) {
+	if reg, ok := Registry[name]; ok {
+		reg.WritePaths = paths
+	}
+}
+
+// RegisterReadPaths declares which files or directories a registered tool
+// reads. Must be called after Register for the same tool name.
+func RegisterReadPaths(name string, paths PathsFunc) {
+	if reg, ok := Registry[name]; ok {
+		reg.ReadPaths = paths
+	}
+}
+
+// RegisterPermission declares when calls to a registered tool need the
+// user's approval. Must be called after Register for the same tool name.
+func RegisterPermission(name string, permission PermissionFunc) {
+	if reg, ok := Registry[name]; ok {
+		reg.Permission = permission
+	}
+}
+
 // GetTool returns the tool registration for a given name
 func GetTool(name string) (*Registration, error) {
 	reg, ok := Registry[name]
@@ -47,3 +93,21 @@ func GetAllTools() []providers.Tool {
 	}
 	return tools
 }
+
+// pathInput is a PathsFunc for tools that write the single file named by
+// their "path" input.
+func pathInput(input map[string]interface{}) []string {
+	if path, ok := input["path"].(string); ok && path != "" {
+		return []string{path}
+	}
+	return nil
+}
+
+// dirInput is a PathsFunc for tools that read the directory (or file) named
+// by their optional "path" input, defaulting to the current directory.
+func dirInput(input map[string]interface{}) []string {
+	if path, ok := input["path"].(string); ok && path != "" {
+		return []string{path}
+	}
+	return []string{"."}
+}
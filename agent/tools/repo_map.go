@@ -0,0 +1,75 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/repomap"
+)
+
+func init() {
+	Register(repoMapTool, executeRepoMap, displayRepoMap)
+	RegisterReadPaths("repo_map", dirInput)
+}
+
+var repoMapTool = providers.Tool{
+	Name:        "repo_map",
+	Description: "Show an outline of the repository: the package, types and function signatures (with line numbers) declared in each source file, most referenced files first, trimmed to a token budget. Go files are parsed natively; other languages are included when Universal Ctags is installed. Use it first when starting work in an unfamiliar codebase, instead of many glob and read_file calls.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory (or file) to outline. Defaults to the current directory. The whole repository is indexed either way; path only narrows what is shown.",
+			},
+			"max_tokens": map[string]interface{}{
+				"type":        "integer",
+				"description": "Approximate size of the map in tokens. Default 2000, max 16000.",
+			},
+		},
+		"required": []string{},
+	},
+}
+
+const (
+	// defaultRepoMapTokens sizes the map when max_tokens is not given.
+	defaultRepoMapTokens = 2000
+	// maxRepoMapTokens keeps a single map from flooding the context.
+	maxRepoMapTokens = 16000
+)
+
+func executeRepoMap(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
+	path, _ := input["path"].(string)
+	if path == "" {
+		path = "."
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("path '%s' does not exist. Use '.' for the current directory or list_files to find the right path", path)
+	}
+
+	maxTokens := defaultRepoMapTokens
+	if v, ok := input["max_tokens"].(float64); ok {
+		maxTokens = int(v)
+		if maxTokens < 100 {
+			return "", fmt.Errorf("max_tokens must be at least 100, got %d", maxTokens)
+		}
+		if maxTokens > maxRepoMapTokens {
+			maxTokens = maxRepoMapTokens
+		}
+	}
+
+	out, err := repomap.Generate(path, maxTokens)
+	if err != nil {
+		return "", fmt.Errorf("failed to map '%s': %w", path, err)
+	}
+	return out, nil
+}
+
+func displayRepoMap(input map[string]interface{}) string {
+	path, _ := input["path"].(string)
+	if path == "" || path == "." {
+		path = ". (current directory)"
+	}
+	return fmt.Sprintf("→ Mapping repository: %s", path)
+}
@@ -2,18 +2,21 @@ package tools
 
 import (
 	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/sandbox"
 	"fmt"
 	"os/exec"
 	"strings"
+	"sync"
 )
 
 func init() {
 	Register(runBashTool, executeRunBash, displayRunBash)
+	RegisterPermission(runBashTool.Name, runBashPermission)
 }
 
 var runBashTool = providers.Tool{
 	Name:        "run_bash",
-	Description: "Execute arbitrary bash commands and return the output. Use this for running shell commands, scripts, or any command-line operations.",
+	Description: "Execute arbitrary bash commands and return the output. Use this for running shell commands, scripts, or any command-line operations. If the project enables the sandbox (.clyde/sandbox.json), commands can only write inside the workspace, have no network unless allowed, and may have memory and CPU limits.",
 	InputSchema: map[string]interface{}{
 		"type": "object",
 		"properties": map[string]interface{}{
@@ -21,6 +24,10 @@ var runBashTool = providers.Tool{
 				"type":        "string",
 				"description": "The bash command to execute. Can be any valid bash command or script.",
 			},
+			"unsandboxed": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Run outside the project's sandbox. Requires the user's approval; only use it when a command genuinely needs to write outside the workspace or reach the network, after the sandboxed attempt failed.",
+			},
 		},
 		"required": []string{"command"},
 	},
@@ -32,7 +39,14 @@ func executeRunBash(input map[string]interface{}, apiClient *providers.Client, c
 		return "", fmt.Errorf("command is required. Example: run_bash(\"ls -la\")")
 	}
 
+	sb, err := loadSandbox(input)
+	if err != nil {
+		return "", err
+	}
 	cmd := exec.Command("bash", "-c", command)
+	if sb != nil {
+		cmd = sb.Command(command)
+	}
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
@@ -45,6 +59,11 @@ func executeRunBash(input map[string]interface{}, apiClient *providers.Client, c
 				"Output:",
 				string(output),
 			}
+			if sb != nil {
+				if note := sb.Explain(string(output), exitCode); note != "" {
+					suggestions = append(suggestions, "", note)
+				}
+			}
 
 			// Add context-specific suggestions
 			if exitCode == 127 {
@@ -85,10 +104,108 @@ func executeRunBash(input map[string]interface{}, apiClient *providers.Client, c
 		return "", fmt.Errorf("failed to execute command '%s': %w", command, err)
 	}
 
+	if sb != nil {
+		if note := sb.Explain(string(output), 0); note != "" {
+			return string(output) + "\n" + note, nil
+		}
+	}
 	return string(output), nil
 }
 
+// The project's sandbox configuration, read once by LoadSandbox so that a
+// command or tool editing it cannot loosen the sandbox mid-session.
+var (
+	sandboxMu     sync.Mutex
+	sandboxLoaded bool
+	sandboxConfig *sandbox.Config
+	sandboxRoot   string
+	sandboxErr    error
+)
+
+// LoadSandbox reads the sandbox configuration of the project containing
+// dir. The agent calls it when it starts; run_bash, run_tests and custom
+// tools use that configuration until the next call.
+func LoadSandbox(dir string) {
+	cfg, root, err := sandbox.Load(dir)
+	sandboxMu.Lock()
+	defer sandboxMu.Unlock()
+	sandboxLoaded = true
+	sandboxConfig, sandboxRoot, sandboxErr = cfg, root, err
+}
+
+// sandboxEnabled returns the loaded configuration when sandboxing is on,
+// loading it from the current directory if LoadSandbox was never called.
+func sandboxEnabled() (*sandbox.Config, string, error) {
+	sandboxMu.Lock()
+	loaded := sandboxLoaded
+	sandboxMu.Unlock()
+	if !loaded {
+		LoadSandbox(".")
+	}
+	sandboxMu.Lock()
+	defer sandboxMu.Unlock()
+	if sandboxErr != nil {
+		return nil, "", fmt.Errorf("cannot load the sandbox configuration: %w", sandboxErr)
+	}
+	if sandboxConfig == nil || !sandboxConfig.Enabled {
+		return nil, "", nil
+	}
+	return sandboxConfig, sandboxRoot, nil
+}
+
+// Sandbox returns the sandbox for a tool to run commands in, or nil when
+// the project has none enabled. A sandbox that is enabled but cannot start
+// is an error naming the tool: commands never silently run unconfined.
+func Sandbox(tool string) (*sandbox.Sandbox, error) {
+	cfg, root, err := sandboxEnabled()
+	if err != nil || cfg == nil {
+		return nil, err
+	}
+	sb, err := sandbox.New(*cfg, root)
+	if err != nil {
+		suggestions := []string{
+			fmt.Sprintf("%s is sandboxed in this project (%s) but the sandbox cannot start: %v", tool, sandbox.ConfigFile, err),
+			"",
+			"Suggestions:",
+			"  - Install bubblewrap (bwrap) or util-linux unshare, with unprivileged user namespaces enabled",
+			"  - Or run the command with run_bash and unsandboxed: true (requires the user's approval)",
+		}
+		return nil, fmt.Errorf("%s", strings.Join(suggestions, "\n"))
+	}
+	return sb, nil
+}
+
+// loadSandbox returns the sandbox to run a command in, or nil when the
+// project has none enabled or the call asked (with approval) to run
+// without it.
+func loadSandbox(input map[string]interface{}) (*sandbox.Sandbox, error) {
+	if unsandboxed, _ := input["unsandboxed"].(bool); unsandboxed {
+		if _, _, err := sandboxEnabled(); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return Sandbox(runBashTool.Name)
+}
+
+// runBashPermission asks for approval before a command leaves an enabled
+// sandbox.
+func runBashPermission(input map[string]interface{}) string {
+	unsandboxed, _ := input["unsandboxed"].(bool)
+	if !unsandboxed {
+		return ""
+	}
+	if cfg, _, err := sandboxEnabled(); err != nil || cfg == nil {
+		return ""
+	}
+	command, _ := input["command"].(string)
+	return fmt.Sprintf("Run this command outside the sandbox (full filesystem and network access)?\n  %s", command)
+}
+
 func displayRunBash(input map[string]interface{}) string {
 	command, _ := input["command"].(string)
+	if unsandboxed, _ := input["unsandboxed"].(bool); unsandboxed {
+		return fmt.Sprintf("→ Running bash (unsandboxed): %s", command)
+	}
 	return fmt.Sprintf("→ Running bash: %s", command)
 }
@@ -0,0 +1,459 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+func init() {
+	Register(runTestsTool, executeRunTests, displayRunTests)
+}
+
+var runTestsTool = providers.Tool{
+	Name:        "run_tests",
+	Description: "Run Go tests with 'go test -json' and return a compact structured summary: pass/fail/skip counts, each failing test with its output and file:line, build errors, and elapsed time. Prefer this over run_bash for Go tests — the summary stays small even for large suites. Runs in the project's sandbox when .clyde/sandbox.json enables it.",
+	InputSchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"packages": map[string]interface{}{
+				"type":        "string",
+				"description": "Space-separated package patterns to test. Default './...'. Examples: './...', './agent/...', './internal/parser ./cmd/app'",
+			},
+			"run": map[string]interface{}{
+				"type":        "string",
+				"description": "Only run tests matching this regular expression (go test -run). Example: 'TestParse' or 'TestParse/empty_input'",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Directory to run in (the module or a directory inside it). Defaults to the current directory.",
+			},
+			"timeout": map[string]interface{}{
+				"type":        "integer",
+				"description": "Timeout in seconds for the whole run (go test -timeout). Default 300.",
+			},
+			"race": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Enable the race detector (-race).",
+			},
+			"no_cache": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Re-run tests even if cached results exist (-count=1).",
+			},
+		},
+		"required": []string{},
+	},
+}
+
+const (
+	// defaultTestTimeout is the go test -timeout when none is given.
+	defaultTestTimeout = 300
+	// maxFailuresShown caps how many failing tests are listed in detail.
+	maxFailuresShown = 20
+	// maxFailureLines caps the output kept per failing test or package.
+	maxFailureLines = 30
+	// maxBuildErrorLines caps compiler output per package.
+	maxBuildErrorLines = 40
+)
+
+// testEvent is one line of 'go test -json' output (see 'go doc test2json').
+type testEvent struct {
+	Action      string  `json:"Action"`
+	Package     string  `json:"Package"`
+	Test        string  `json:"Test"`
+	Elapsed     float64 `json:"Elapsed"`
+	Output      string  `json:"Output"`
+	ImportPath  string  `json:"ImportPath"`
+	FailedBuild string  `json:"FailedBuild"`
+}
+
+// testRun accumulates the events of one go test run.
+type testRun struct {
+	passed, failed, skipped int
+	// output holds output lines per "package\x00test" ("package\x00" for
+	// package-level output).
+	output map[string][]string
+	// failures lists failing tests in the order they finished.
+	failures []testResult
+	packages map[string]*packageResult
+	// buildOutput holds compiler output per import path.
+	buildOutput map[string][]string
+}
+
+type testResult struct {
+	pkg, name string
+	elapsed   float64
+}
+
+type packageResult struct {
+	name        string
+	action      string // pass, fail, skip
+	elapsed     float64
+	failedBuild string
+	noTests     bool
+}
+
+// fileLinePattern finds t.Error/t.Fatal locations ("    parser_test.go:42: ...")
+// and panic frames ("\t/path/to/parser.go:17 +0x1d").
+var fileLinePattern = regexp.MustCompile(`([\w./-]+\.go:\d+)`)
+
+func executeRunTests(input map[string]interface{}, apiClient *providers.Client, conversationHistory []providers.Message) (string, error) {
+	packages := strings.Fields(stringInput(input, "packages"))
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+	for _, p := range packages {
+		// Only package paths and patterns: anything else would be taken
+		// as a go test flag (-exec, -toolexec, ...)
+		if strings.HasPrefix(p, "-") {
+			return "", fmt.Errorf("packages must be import paths or patterns such as ./... or ./agent/..., got flag %q. Use run, race, no_cache and timeout for test options", p)
+		}
+	}
+	dir := stringInput(input, "path")
+	if dir != "" {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("directory '%s' does not exist. Use '.' for the current directory or list_files to find the module", dir)
+		}
+	}
+
+	timeout := defaultTestTimeout
+	if t, ok := input["timeout"].(float64); ok {
+		timeout = int(t)
+		if timeout < 1 {
+			return "", fmt.Errorf("timeout must be at least 1 second, got %d", timeout)
+		}
+	}
+
+	if _, err := exec.LookPath("go"); err != nil {
+		return "", fmt.Errorf("%s", strings.Join([]string{
+			"The go command was not found on PATH.",
+			"Suggestions:",
+			"  - Install Go from https://go.dev/dl/",
+			"  - For non-Go projects, run the test command with run_bash instead",
+		}, "\n"))
+	}
+
+	args := []string{"test", "-json", fmt.Sprintf("-timeout=%ds", timeout)}
+	if run := stringInput(input, "run"); run != "" {
+		if _, err := regexp.Compile(run); err != nil {
+			return "", fmt.Errorf("run is not a valid regular expression: %v", err)
+		}
+		args = append(args, "-run", run)
+	}
+	if race, _ := input["race"].(bool); race {
+		args = append(args, "-race")
+	}
+	if noCache, _ := input["no_cache"].(bool); noCache {
+		args = append(args, "-count=1")
+	}
+	args = append(args, packages...)
+
+	sb, err := Sandbox(runTestsTool.Name)
+	if err != nil {
+		return "", err
+	}
+
+	// go test enforces -timeout per test binary; the context is a backstop
+	// for builds or binaries that hang anyway.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second+time.Minute)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = dir
+	if sb != nil {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", fmt.Errorf("invalid path '%s': %w", dir, err)
+		}
+		cmd = sb.CommandContext(ctx, abs, "go", args...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	elapsed := time.Since(start)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("go test was killed after %s without finishing. Try a narrower packages or run filter, or a larger timeout", elapsed.Round(time.Second))
+	}
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return "", fmt.Errorf("failed to run go test: %w", err)
+		}
+	}
+
+	run := parseTestEvents(stdout.Bytes())
+	summary := run.summary(elapsed, strings.TrimSpace(stderr.String()))
+	if sb != nil {
+		exitCode := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		if note := sb.Explain(stdout.String()+stderr.String(), exitCode); note != "" {
+			summary += "\n" + note
+		}
+	}
+	return summary, nil
+}
+
+// stringInput returns a string input, or "" if it is missing.
+func stringInput(input map[string]interface{}, key string) string {
+	s, _ := input[key].(string)
+	return strings.TrimSpace(s)
+}
+
+// parseTestEvents reads a go test -json stream. Lines that are not JSON
+// (rare, e.g. output from a crashed test binary) are kept as package output.
+func parseTestEvents(data []byte) *testRun {
+	run := &testRun{
+		output:      make(map[string][]string),
+		packages:    make(map[string]*packageResult),
+		buildOutput: make(map[string][]string),
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var ev testEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			run.output["\x00"] = append(run.output["\x00"], scanner.Text())
+			continue
+		}
+		run.add(ev)
+	}
+	return run
+}
+
+// add records one event.
+func (r *testRun) add(ev testEvent) {
+	key := ev.Package + "\x00" + ev.Test
+	switch ev.Action {
+	case "build-output":
+		r.buildOutput[ev.ImportPath] = append(r.buildOutput[ev.ImportPath], strings.TrimRight(ev.Output, "\n"))
+	case "output":
+		if line := strings.TrimRight(ev.Output, "\n"); !isTestFrameLine(line) {
+			r.output[key] = append(r.output[key], line)
+		}
+		if ev.Test == "" && strings.Contains(ev.Output, "[no test files]") {
+			r.pkg(ev.Package).noTests = true
+		}
+	case "pass", "fail", "skip":
+		if ev.Test == "" {
+			p := r.pkg(ev.Package)
+			p.action, p.elapsed = ev.Action, ev.Elapsed
+			if ev.FailedBuild != "" {
+				p.failedBuild = ev.FailedBuild
+			}
+			return
+		}
+		switch ev.Action {
+		case "pass":
+			r.passed++
+		case "skip":
+			r.skipped++
+		case "fail":
+			r.failed++
+			r.failures = append(r.failures, testResult{pkg: ev.Package, name: ev.Test, elapsed: ev.Elapsed})
+		}
+	}
+}
+
+func (r *testRun) pkg(name string) *packageResult {
+	p := r.packages[name]
+	if p == nil {
+		p = &packageResult{name: name}
+		r.packages[name] = p
+	}
+	return p
+}
+
+// isTestFrameLine reports whether an output line is go test's own framing
+// (=== RUN, --- PASS, PASS, ok ...) rather than output from the test.
+func isTestFrameLine(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	for _, prefix := range []string{"=== RUN", "=== PAUSE", "=== CONT", "=== NAME", "--- PASS", "--- FAIL", "--- SKIP"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return trimmed == "PASS" || trimmed == "FAIL" || strings.HasPrefix(trimmed, "ok  \t") ||
+		strings.HasPrefix(trimmed, "FAIL\t") || strings.HasPrefix(line, "?   \t")
+}
+
+// summary formats the run for the model.
+func (r *testRun) summary(elapsed time.Duration, stderr string) string {
+	var names []string
+	for name := range r.packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var okPkgs, failedPkgs, noTestPkgs int
+	var brokenPkgs []*packageResult // failed without a failing test: build errors, panics, TestMain
+	failingTests := make(map[string]bool)
+	for _, f := range r.failures {
+		failingTests[f.pkg] = true
+	}
+	for _, name := range names {
+		p := r.packages[name]
+		switch {
+		case p.action == "fail":
+			failedPkgs++
+			if !failingTests[name] {
+				brokenPkgs = append(brokenPkgs, p)
+			}
+		case p.noTests:
+			noTestPkgs++
+		case p.action == "pass" || p.action == "skip":
+			okPkgs++
+		}
+	}
+
+	status := "PASS"
+	if failedPkgs > 0 || r.failed > 0 || (len(r.packages) == 0 && stderr != "") {
+		status = "FAIL"
+	} else if r.passed == 0 && r.failed == 0 {
+		status = "NO TESTS RUN"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d passed, %d failed, %d skipped (%s)\n", status, r.passed, r.failed, r.skipped, elapsed.Round(10*time.Millisecond))
+	pkgParts := []string{fmt.Sprintf("%d ok", okPkgs)}
+	if failedPkgs > 0 {
+		pkgParts = append(pkgParts, fmt.Sprintf("%d failed", failedPkgs))
+	}
+	if noTestPkgs > 0 {
+		pkgParts = append(pkgParts, fmt.Sprintf("%d without tests", noTestPkgs))
+	}
+	fmt.Fprintf(&b, "Packages: %s\n", strings.Join(pkgParts, ", "))
+
+	// Build failures and package-level failures (panics, TestMain, timeouts).
+	for _, p := range brokenPkgs {
+		lines := r.buildOutput[p.failedBuild]
+		label := "build failed"
+		if len(lines) == 0 {
+			lines = r.output[p.name+"\x00"]
+			label = "failed"
+		}
+		fmt.Fprintf(&b, "\n--- %s: %s\n", strings.ToUpper(label[:1])+label[1:], p.name)
+		limit := maxFailureLines
+		if p.failedBuild != "" {
+			limit = maxBuildErrorLines
+		}
+		writeTestLines(&b, lines, limit)
+	}
+
+	// Failing tests. A parent fails whenever a subtest does; only the
+	// innermost failures are shown.
+	var leaves []testResult
+	for _, f := range r.failures {
+		if !hasFailingSubtest(f, r.failures) {
+			leaves = append(leaves, f)
+		}
+	}
+	for i, f := range leaves {
+		if i == maxFailuresShown {
+			var rest []string
+			for _, g := range leaves[i:] {
+				rest = append(rest, g.name)
+			}
+			fmt.Fprintf(&b, "\n... %d more failing tests: %s\n", len(rest), strings.Join(rest, ", "))
+			break
+		}
+		lines := dropRuntimeFrames(r.output[f.pkg+"\x00"+f.name])
+		fmt.Fprintf(&b, "\n--- FAIL: %s (%s, %.2fs)\n", f.name, f.pkg, f.elapsed)
+		if loc := fileLinePattern.FindString(strings.Join(lines, "\n")); loc != "" {
+			fmt.Fprintf(&b, "    at %s\n", loc)
+		}
+		writeTestLines(&b, lines, maxFailureLines)
+	}
+
+	// Anything go test printed outside the JSON stream (e.g. a bad package
+	// pattern or go.mod errors).
+	if stray := r.output["\x00"]; len(stray) > 0 {
+		b.WriteString("\n")
+		writeTestLines(&b, stray, maxBuildErrorLines)
+	}
+	if stderr != "" && len(brokenPkgs) == 0 {
+		b.WriteString("\n")
+		writeTestLines(&b, strings.Split(stderr, "\n"), maxBuildErrorLines)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// dropRuntimeFrames removes goroutine stack frames inside the runtime and
+// testing packages from a panic trace, leaving the frames in the code under
+// test. Each frame is a function line followed by a tab-indented file line.
+func dropRuntimeFrames(lines []string) []string {
+	var kept []string
+	for i := 0; i < len(lines); i++ {
+		if i+1 < len(lines) && strings.HasPrefix(lines[i+1], "\t") && isRuntimeFrame(lines[i+1]) {
+			i++
+			continue
+		}
+		kept = append(kept, lines[i])
+	}
+	return kept
+}
+
+// isRuntimeFrame reports whether a stack frame's file line is in the Go
+// runtime or testing package.
+func isRuntimeFrame(line string) bool {
+	return strings.Contains(line, "/src/runtime/") || strings.Contains(line, "/src/testing/")
+}
+
+// hasFailingSubtest reports whether any failure is a subtest of f.
+func hasFailingSubtest(f testResult, failures []testResult) bool {
+	for _, g := range failures {
+		if g.pkg == f.pkg && strings.HasPrefix(g.name, f.name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTestLines writes indented output lines, keeping the first and last
+// lines when there are more than limit.
+func writeTestLines(b *strings.Builder, lines []string, limit int) {
+	var kept []string
+	for _, l := range lines {
+		if strings.TrimSpace(l) != "" {
+			kept = append(kept, l)
+		}
+	}
+	if len(kept) > limit {
+		head := limit / 3
+		tail := limit - head
+		omitted := len(kept) - limit
+		kept = append(append(kept[:head:head], fmt.Sprintf("... (%d lines omitted)", omitted)), kept[len(kept)-tail:]...)
+	}
+	for _, l := range kept {
+		b.WriteString("    " + strings.TrimPrefix(l, "    ") + "\n")
+	}
+}
+
+func displayRunTests(input map[string]interface{}) string {
+	packages := stringInput(input, "packages")
+	if packages == "" {
+		packages = "./..."
+	}
+	msg := "→ Running tests: " + packages
+	if run := stringInput(input, "run"); run != "" {
+		msg += fmt.Sprintf(" (run: %s)", run)
+	}
+	if path := stringInput(input, "path"); path != "" && path != "." {
+		msg += " in " + path
+	}
+	return msg
+}
@@ -10,6 +10,7 @@ import (
 
 func init() {
 	Register(writeFileTool, executeWriteFile, displayWriteFile)
+	RegisterWritePaths("write_file", pathInput)
 }
 
 var writeFileTool = providers.Tool{
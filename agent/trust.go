@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent/trust"
+)
+
+// untrustedConfig is project configuration that runs commands (hooks,
+// custom tools) and is held back until the user approves its content.
+type untrustedConfig struct {
+	name     string // what asks for approval, e.g. "hooks"
+	key      string // trust store key (an absolute path)
+	data     []byte // content the approval is for
+	request  string // the approval request shown to the user
+	enable   func() // puts the configuration to use once approved
+	disabled string // diagnostic when it is not approved
+}
+
+// requireTrust enables c right away if the user approved its content
+// before, and otherwise holds it back until the next message (see
+// approveProjectConfig).
+func (a *Agent) requireTrust(c untrustedConfig) {
+	if trust.Trusted(c.key, c.data) {
+		c.enable()
+		return
+	}
+	a.untrusted = append(a.untrusted, c)
+}
+
+// approveProjectConfig asks the user to approve each held-back
+// configuration. It runs before a message is handled, when the REPL can
+// prompt; without a permission callback (CLI mode) everything stays
+// disabled.
+func (a *Agent) approveProjectConfig() {
+	pending := a.untrusted
+	a.untrusted = nil
+	for _, c := range pending {
+		if !a.askPermission(c.name, c.request) {
+			a.emit(DiagnosticEvent{Message: c.disabled})
+			continue
+		}
+		if err := trust.Approve(c.key, c.data); err != nil {
+			a.emit(ErrorEvent{Err: fmt.Errorf("cannot remember the approval of %s: %w", c.key, err)})
+		}
+		c.enable()
+	}
+}
+
+// trustRequest formats an approval request listing the commands that
+// would run.
+func trustRequest(question string, commands []string) string {
+	lines := []string{question}
+	for _, c := range commands {
+		lines = append(lines, "  "+c)
+	}
+	return strings.Join(lines, "\n")
+}
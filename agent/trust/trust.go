@@ -0,0 +1,97 @@
+// Package trust remembers which project files the user approved running
+// commands from. Hooks (.clyde/hooks.json) and project custom tools
+// (.clyde/tools/) run shell commands with the user's permissions, so a
+// repository someone else wrote could otherwise run anything as soon as
+// the agent starts in it.
+//
+// An approval is stored in ~/.clyde/trusted.json as the SHA-256 of the
+// approved content, keyed by path:
+//
+//	{
+//	  "/home/me/src/app/.clyde/hooks.json": "9f86d081884c7d65..."
+//	}
+//
+// Any change to the content needs a new approval.
+package trust
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// File is the trust store, relative to the home directory.
+const File = ".clyde/trusted.json"
+
+// mu serializes reads and writes of the store within the process.
+var mu sync.Mutex
+
+// Trusted reports whether the user approved data as the content of key.
+func Trusted(key string, data []byte) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	approved, err := load()
+	return err == nil && approved[key] == digest(data)
+}
+
+// Approve records the user's approval of data as the content of key.
+func Approve(key string, data []byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+	approved, err := load()
+	if err != nil {
+		return err
+	}
+	approved[key] = digest(data)
+	path, err := storePath()
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(approved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(out, '\n'), 0600)
+}
+
+// load reads the store; a missing store is empty.
+func load() (map[string]string, error) {
+	path, err := storePath()
+	if err != nil {
+		return nil, err
+	}
+	approved := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return approved, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &approved); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", path, err)
+	}
+	return approved, nil
+}
+
+// storePath returns the store's absolute path.
+func storePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the home directory for %s: %w", File, err)
+	}
+	return filepath.Join(home, filepath.FromSlash(File)), nil
+}
+
+// digest returns the hex SHA-256 of data.
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+package trust
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrust(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	const key = "/src/app/.clyde/hooks.json"
+
+	if Trusted(key, []byte("v1")) {
+		t.Fatal("nothing is trusted before approval")
+	}
+	if err := Approve(key, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if !Trusted(key, []byte("v1")) {
+		t.Error("approved content should be trusted")
+	}
+	if Trusted(key, []byte("v2")) || Trusted("/src/other/.clyde/hooks.json", []byte("v1")) {
+		t.Error("changed content or another path should not be trusted")
+	}
+
+	info, err := os.Stat(filepath.Join(home, File))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("store = %v, %v", info, err)
+	}
+
+	os.WriteFile(filepath.Join(home, File), []byte("{"), 0600)
+	if Trusted(key, []byte("v1")) {
+		t.Error("a corrupt store trusts nothing")
+	}
+	if err := Approve(key, []byte("v1")); err == nil {
+		t.Error("approving should not overwrite a corrupt store")
+	}
+}
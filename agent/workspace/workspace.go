@@ -0,0 +1,177 @@
+// Package workspace decides which paths the file tools may touch. The
+// workspace (normally the repository root) and any extra roots are open to
+// reads and writes; outside them, writes are denied and reads are either
+// allowed or need the user's approval. Paths are resolved through symlinks
+// before they are checked, so a link inside the workspace cannot be used to
+// reach files outside it.
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Values for OutsideReads.
+const (
+	// ReadsAsk requires the user's approval to read outside the roots.
+	ReadsAsk = "ask"
+	// ReadsAllow lets the file tools read anywhere.
+	ReadsAllow = "allow"
+)
+
+// Policy is the set of roots file tools may write to and read from.
+type Policy struct {
+	roots        []string // absolute, symlinks resolved; roots[0] is the workspace
+	outsideReads string
+	protected    []string // resolved files that may not be written even inside the roots
+}
+
+// New returns a policy for the workspace directory plus extra roots
+// (absolute, relative to the working directory, or starting with "~/").
+// outsideReads is ReadsAsk (the default when empty) or ReadsAllow.
+func New(workspace string, extraRoots []string, outsideReads string) (*Policy, error) {
+	switch outsideReads {
+	case "":
+		outsideReads = ReadsAsk
+	case ReadsAsk, ReadsAllow:
+	default:
+		return nil, fmt.Errorf("outside reads must be %q or %q, got %q", ReadsAsk, ReadsAllow, outsideReads)
+	}
+	p := &Policy{outsideReads: outsideReads}
+	home, _ := os.UserHomeDir()
+	for _, root := range append([]string{workspace}, extraRoots...) {
+		root = strings.TrimSpace(root)
+		if root == "" {
+			continue
+		}
+		if strings.HasPrefix(root, "~/") && home != "" {
+			root = filepath.Join(home, root[2:])
+		}
+		resolved, err := Resolve(root)
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace root %q: %w", root, err)
+		}
+		p.roots = append(p.roots, resolved)
+	}
+	if len(p.roots) == 0 {
+		return nil, fmt.Errorf("no workspace root given")
+	}
+	return p, nil
+}
+
+// Roots returns the resolved roots, the workspace first.
+func (p *Policy) Roots() []string {
+	return p.roots
+}
+
+// Protect denies writes to files inside the roots that only the user may
+// change, such as the sandbox configuration.
+func (p *Policy) Protect(paths ...string) {
+	for _, path := range paths {
+		if resolved, err := Resolve(path); err == nil {
+			p.protected = append(p.protected, resolved)
+		}
+	}
+}
+
+// Resolve returns the absolute path with symlinks resolved. For a path that
+// does not exist yet, the longest existing prefix is resolved and the rest
+// appended, so new files are checked where they will actually be created.
+func Resolve(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for dir := abs; ; {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			for i := len(missing) - 1; i >= 0; i-- {
+				resolved = filepath.Join(resolved, missing[i])
+			}
+			return resolved, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return abs, nil
+		}
+		missing = append(missing, filepath.Base(dir))
+		dir = parent
+	}
+}
+
+// Contains reports whether path resolves inside one of the roots, and
+// returns the resolved path.
+func (p *Policy) Contains(path string) (string, bool) {
+	resolved, err := Resolve(path)
+	if err != nil {
+		return path, false
+	}
+	for _, root := range p.roots {
+		if resolved == root || strings.HasPrefix(resolved, root+string(filepath.Separator)) || root == string(filepath.Separator) {
+			return resolved, true
+		}
+	}
+	return resolved, false
+}
+
+// CheckWrite returns an error explaining the policy if path is outside the
+// roots or protected.
+func (p *Policy) CheckWrite(path string) error {
+	resolved, inside := p.Contains(path)
+	for _, protected := range p.protected {
+		if resolved == protected {
+			return fmt.Errorf("Write denied: %s is protected; only the user may change it", describe(path, resolved))
+		}
+	}
+	if inside {
+		return nil
+	}
+	lines := []string{
+		fmt.Sprintf("Write denied: %s is outside the workspace.", describe(path, resolved)),
+		"",
+		"File tools can only write inside the workspace roots: " + strings.Join(p.roots, ", "),
+		"Suggestions:",
+		"  - Keep the change inside the workspace if possible",
+		"  - Otherwise ask the user to make it, or to add the directory to WORKSPACE_ROOTS in ~/.clyde/config",
+	}
+	return fmt.Errorf("%s", strings.Join(lines, "\n"))
+}
+
+// ReadRequest returns the approval request for reading path, or "" when
+// the read needs no approval (inside the roots, or outside reads allowed).
+func (p *Policy) ReadRequest(path string) string {
+	if p.outsideReads == ReadsAllow {
+		return ""
+	}
+	resolved, inside := p.Contains(path)
+	if inside {
+		return ""
+	}
+	return fmt.Sprintf("Read %s, outside the workspace (%s)?", describe(path, resolved), p.roots[0])
+}
+
+// ReadDenied returns the error for a read outside the roots that the user
+// did not approve.
+func (p *Policy) ReadDenied(path string) error {
+	resolved, _ := p.Contains(path)
+	lines := []string{
+		fmt.Sprintf("Read denied: %s is outside the workspace and the user did not approve reading it.", describe(path, resolved)),
+		"",
+		"Readable without approval: " + strings.Join(p.roots, ", "),
+		"Suggestions:",
+		"  - Continue without this file, or ask the user why it is needed",
+		"  - The user can add the directory to WORKSPACE_ROOTS, or set OUTSIDE_READS=allow, in ~/.clyde/config",
+	}
+	return fmt.Errorf("%s", strings.Join(lines, "\n"))
+}
+
+// describe names a path, noting when a symlink points it elsewhere.
+func describe(path, resolved string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil || abs == resolved {
+		return resolved
+	}
+	return fmt.Sprintf("%s (which resolves to %s through a symlink)", path, resolved)
+}
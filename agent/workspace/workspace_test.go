@@ -0,0 +1,142 @@
+package workspace
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// layout creates a workspace, an outside directory, and links from the
+// workspace to the outside.
+func layout(t *testing.T) (ws, outside string) {
+	t.Helper()
+	base, _ := filepath.EvalSymlinks(t.TempDir())
+	ws = filepath.Join(base, "ws")
+	outside = filepath.Join(base, "outside")
+	os.MkdirAll(filepath.Join(ws, "src"), 0755)
+	os.MkdirAll(outside, 0755)
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("x"), 0644)
+	os.Symlink(outside, filepath.Join(ws, "escape"))
+	os.Symlink(filepath.Join(ws, "src"), filepath.Join(outside, "into-ws"))
+	return ws, outside
+}
+
+func TestPolicy_Contains(t *testing.T) {
+	ws, outside := layout(t)
+	p, err := New(ws, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(ws)
+	defer os.Chdir(wd)
+
+	for path, want := range map[string]bool{
+		ws:                                    true,
+		"src/main.go":                         true,
+		"new/dir/file.go":                     true,
+		filepath.Join(ws, "src", "..", "x"):   true,
+		"../outside/secret.txt":               false,
+		filepath.Join(ws, "..", "ws-sibling"): false,
+		"escape/secret.txt":                   false,
+		"escape/new.txt":                      false,
+		filepath.Join(outside, "into-ws", "a.go"): true,
+		"/etc/passwd": false,
+	} {
+		if _, got := p.Contains(path); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestPolicy_WritesAndReads(t *testing.T) {
+	ws, outside := layout(t)
+	p, _ := New(ws, nil, ReadsAsk)
+
+	if err := p.CheckWrite(filepath.Join(ws, "src", "a.go")); err != nil {
+		t.Errorf("write inside denied: %v", err)
+	}
+	err := p.CheckWrite(filepath.Join(ws, "escape", "secret.txt"))
+	if err == nil {
+		t.Fatal("write through a symlink out of the workspace should be denied")
+	}
+	for _, want := range []string{
+		"Write denied: " + filepath.Join(ws, "escape", "secret.txt") + " (which resolves to " + filepath.Join(outside, "secret.txt") + " through a symlink) is outside the workspace.",
+		"workspace roots: " + ws,
+		"WORKSPACE_ROOTS",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("missing %q in:\n%v", want, err)
+		}
+	}
+
+	if r := p.ReadRequest(filepath.Join(ws, "src")); r != "" {
+		t.Errorf("read inside needs no approval, got %q", r)
+	}
+	if r := p.ReadRequest(filepath.Join(outside, "secret.txt")); r != "Read "+filepath.Join(outside, "secret.txt")+", outside the workspace ("+ws+")?" {
+		t.Errorf("ReadRequest = %q", r)
+	}
+	if err := p.ReadDenied(filepath.Join(outside, "secret.txt")); !strings.Contains(err.Error(), "OUTSIDE_READS=allow") {
+		t.Errorf("ReadDenied = %v", err)
+	}
+
+	allow, _ := New(ws, nil, ReadsAllow)
+	if r := allow.ReadRequest(filepath.Join(outside, "secret.txt")); r != "" {
+		t.Errorf("reads should be allowed, got %q", r)
+	}
+	if allow.CheckWrite(filepath.Join(outside, "secret.txt")) == nil {
+		t.Error("writes outside are denied even when reads are allowed")
+	}
+}
+
+func TestPolicy_ExtraRoots(t *testing.T) {
+	ws, outside := layout(t)
+	home, _ := os.UserHomeDir()
+
+	p, err := New(ws, []string{outside, " ", "~/"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(p.Roots()); got != 3 || p.Roots()[0] != ws {
+		t.Errorf("roots = %q", p.Roots())
+	}
+	if err := p.CheckWrite(filepath.Join(outside, "secret.txt")); err != nil {
+		t.Errorf("extra root should be writable: %v", err)
+	}
+	if home != "" {
+		if _, inside := p.Contains(filepath.Join(home, "notes.txt")); !inside {
+			t.Error("~/ root not expanded")
+		}
+	}
+
+	open, _ := New(ws, []string{"/"}, "")
+	if open.CheckWrite("/etc/hosts") != nil {
+		t.Error("\"/\" as a root should allow everything")
+	}
+
+	if _, err := New(ws, nil, "sometimes"); err == nil {
+		t.Error("expected an error for an invalid outside reads mode")
+	}
+}
+
+func TestPolicy_Protect(t *testing.T) {
+	ws, outside := layout(t)
+	p, _ := New(ws, nil, ReadsAsk)
+	os.Mkdir(filepath.Join(ws, ".clyde"), 0755)
+	p.Protect(filepath.Join(ws, ".clyde", "sandbox.json"))
+	os.Symlink(filepath.Join(ws, ".clyde"), filepath.Join(outside, "config"))
+
+	for _, path := range []string{
+		filepath.Join(ws, ".clyde", "sandbox.json"),
+		filepath.Join(ws, "src", "..", ".clyde", "sandbox.json"),
+		filepath.Join(ws, "escape", "config", "sandbox.json"),
+	} {
+		if err := p.CheckWrite(path); err == nil || !strings.Contains(err.Error(), "only the user may change it") {
+			t.Errorf("CheckWrite(%q) = %v, want protected", path, err)
+		}
+	}
+	if err := p.CheckWrite(filepath.Join(ws, ".clyde", "other.json")); err != nil {
+		t.Errorf("write beside the protected file denied: %v", err)
+	}
+}
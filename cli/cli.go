@@ -12,18 +12,19 @@ package cli
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 
 	"github.com/this-is-alpha-iota/clyde/agent"
 	"github.com/this-is-alpha-iota/clyde/agent/session"
+	"github.com/this-is-alpha-iota/clyde/agent/todo"
 	"github.com/this-is-alpha-iota/clyde/cli/input"
 	"github.com/this-is-alpha-iota/clyde/cli/loglevel"
 	"github.com/this-is-alpha-iota/clyde/cli/prompt"
@@ -45,9 +46,30 @@ func Run() {
 		return
 	}
 
+	// Validate --output-format and --input-format
+	outputFormat, inputFormat := flags.OutputFormat, flags.InputFormat
+	if outputFormat == "" {
+		outputFormat = outputText
+	}
+	if inputFormat == "" {
+		inputFormat = inputText
+	}
+	if outputFormat != outputText && outputFormat != outputJSON && outputFormat != outputStreamJSON {
+		fmt.Fprintf(os.Stderr, "Error: unknown output format %q (want text, json or stream-json)\n", outputFormat)
+		os.Exit(1)
+	}
+	if inputFormat != inputText && inputFormat != inputStreamJSON {
+		fmt.Fprintf(os.Stderr, "Error: unknown input format %q (want text or stream-json)\n", inputFormat)
+		os.Exit(1)
+	}
+
 	// Handle --resume mode
 	if flags.Resume {
-		runResumeMode(flags.ResumeTarget, flags.Level, flags.NoThink)
+		if outputFormat != outputText || inputFormat != inputText {
+			fmt.Fprintln(os.Stderr, "Error: --output-format and --input-format are only supported in CLI mode")
+			os.Exit(1)
+		}
+		runResumeMode(flags.ResumeTarget, flags.Level, flags.NoThink, flags.Plan)
 		return
 	}
 
@@ -56,12 +78,16 @@ func Run() {
 	hasStdinInput := (stat.Mode() & os.ModeCharDevice) == 0
 
 	// Determine mode: CLI or REPL
-	// CLI mode if: args provided OR stdin is piped
+	// CLI mode if: args provided OR stdin is piped OR --input-format stream-json
 	// REPL mode if: no args AND stdin is interactive (terminal)
-	if len(flags.Args) > 0 || hasStdinInput {
-		runCLIMode(flags.Args, hasStdinInput, flags.Level, flags.NoThink)
+	if len(flags.Args) > 0 || hasStdinInput || inputFormat == inputStreamJSON {
+		runCLIMode(flags.Args, hasStdinInput, flags.Level, flags.NoThink, flags.Plan, outputFormat, inputFormat)
 	} else {
-		runREPLMode(flags.Level, flags.NoThink)
+		if outputFormat != outputText {
+			fmt.Fprintln(os.Stderr, "Error: --output-format is only supported in CLI mode")
+			os.Exit(1)
+		}
+		runREPLMode(flags.Level, flags.NoThink, flags.Plan)
 	}
 }
 
@@ -134,6 +160,114 @@ func loadAgentConfig(configPath string, noThink bool) (agent.Config, error) {
 		toolResultThreshold = trt
 	}
 
+	// Parse optional micro-compaction settings
+	microCompactPercent := 0
+	if mcpStr := os.Getenv("MICRO_COMPACT_PERCENT"); mcpStr != "" {
+		pct, err := strconv.Atoi(mcpStr)
+		if err != nil {
+			return agent.Config{}, fmt.Errorf("MICRO_COMPACT_PERCENT must be a number, got %q: %w", mcpStr, err)
+		}
+		if pct < 10 || pct > 95 {
+			return agent.Config{}, fmt.Errorf("MICRO_COMPACT_PERCENT must be between 10 and 95, got %d", pct)
+		}
+		microCompactPercent = pct
+	}
+	microCompactKeepTurns := 0
+	if mktStr := os.Getenv("MICRO_COMPACT_KEEP_TURNS"); mktStr != "" {
+		mkt, err := strconv.Atoi(mktStr)
+		if err != nil {
+			return agent.Config{}, fmt.Errorf("MICRO_COMPACT_KEEP_TURNS must be a number, got %q: %w", mktStr, err)
+		}
+		if mkt < 1 {
+			return agent.Config{}, fmt.Errorf("MICRO_COMPACT_KEEP_TURNS must be >= 1, got %d", mkt)
+		}
+		microCompactKeepTurns = mkt
+	}
+
+	// Parse optional default fuzz level for apply_patch
+	var applyPatchFuzz *int
+	if apfStr := os.Getenv("APPLY_PATCH_FUZZ"); apfStr != "" {
+		apf, err := strconv.Atoi(apfStr)
+		if err != nil {
+			return agent.Config{}, fmt.Errorf("APPLY_PATCH_FUZZ must be a number, got %q: %w", apfStr, err)
+		}
+		if apf < 0 || apf > 3 {
+			return agent.Config{}, fmt.Errorf("APPLY_PATCH_FUZZ must be between 0 and 3, got %d", apf)
+		}
+		applyPatchFuzz = &apf
+	}
+
+	// Parse optional default line limit for read_file
+	readFileMaxLines := 0
+	if rfmStr := os.Getenv("READ_FILE_MAX_LINES"); rfmStr != "" {
+		rfm, err := strconv.Atoi(rfmStr)
+		if err != nil {
+			return agent.Config{}, fmt.Errorf("READ_FILE_MAX_LINES must be a number, got %q: %w", rfmStr, err)
+		}
+		if rfm < 1 {
+			return agent.Config{}, fmt.Errorf("READ_FILE_MAX_LINES must be >= 1, got %d", rfm)
+		}
+		readFileMaxLines = rfm
+	}
+
+	// Parse optional repository map budget for the system prompt
+	repoMapTokens := 0
+	if rmtStr := os.Getenv("REPO_MAP_TOKENS"); rmtStr != "" {
+		rmt, err := strconv.Atoi(rmtStr)
+		if err != nil {
+			return agent.Config{}, fmt.Errorf("REPO_MAP_TOKENS must be a number, got %q: %w", rmtStr, err)
+		}
+		if rmt != 0 && (rmt < 500 || rmt > 16000) {
+			return agent.Config{}, fmt.Errorf("REPO_MAP_TOKENS must be 0 (off) or between 500 and 16000, got %d", rmt)
+		}
+		repoMapTokens = rmt
+	}
+
+	// Language server for the lsp_* tools; gopls unless configured otherwise
+	lspCommand := os.Getenv("LSP_COMMAND")
+	switch strings.ToLower(lspCommand) {
+	case "":
+		lspCommand = "gopls"
+	case "off", "none", "false":
+		lspCommand = ""
+	}
+
+	// Secret redaction: on unless REDACT_SECRETS=false; credentials stored
+	// in the config file are redacted by value
+	var redactSecrets *bool
+	if val := os.Getenv("REDACT_SECRETS"); val != "" {
+		b := val != "false" && val != "0"
+		redactSecrets = &b
+	}
+	var redactAllowlist []string
+	if val := os.Getenv("REDACT_ALLOWLIST"); val != "" {
+		redactAllowlist = strings.Split(val, ",")
+	}
+	redactValues := make(map[string]string)
+	if entries, err := godotenv.Read(configPath); err == nil {
+		for key, value := range entries {
+			if isSecretConfigKey(key) {
+				redactValues[key] = value
+			}
+		}
+	}
+
+	// Workspace policy for the file tools: extra roots and reads outside them
+	var workspaceRoots []string
+	if val := os.Getenv("WORKSPACE_ROOTS"); val != "" {
+		workspaceRoots = strings.Split(val, ",")
+	}
+	outsideReads := strings.ToLower(os.Getenv("OUTSIDE_READS"))
+	if outsideReads != "" && outsideReads != "ask" && outsideReads != "allow" {
+		return agent.Config{}, fmt.Errorf("OUTSIDE_READS must be \"ask\" or \"allow\", got %q", outsideReads)
+	}
+
+	// Model for task sub-agents (empty = the main model)
+	taskModel := os.Getenv("TASK_MODEL")
+
+	// Answer to ask_user questions when no user is available (CLI mode)
+	askUserDefault := os.Getenv("ASK_USER_DEFAULT")
+
 	return agent.Config{
 		APIKey:            apiKey,
 		APIURL:            "https://api.anthropic.com/v1/messages",
@@ -148,16 +282,49 @@ func loadAgentConfig(configPath string, noThink bool) (agent.Config, error) {
 		ReserveTokens:     reserveTokens,
 		CompactIncludeRecentContext: compactIncludeRecentContext,
 		ToolResultThreshold:        toolResultThreshold,
+		MicroCompactPercent:        microCompactPercent,
+		MicroCompactKeepTurns:      microCompactKeepTurns,
+		ApplyPatchFuzz:             applyPatchFuzz,
+		ReadFileMaxLines:           readFileMaxLines,
+		LSPCommand:                 lspCommand,
+		RepoMapTokens:              repoMapTokens,
+		RedactSecrets:              redactSecrets,
+		RedactAllowlist:            redactAllowlist,
+		RedactValues:               redactValues,
+		WorkspaceRoots:             workspaceRoots,
+		OutsideReads:               outsideReads,
+		TaskModel:                  taskModel,
+		AskUserDefault:             askUserDefault,
 	}, nil
 }
 
-// runCLIMode executes the agent on a single prompt and exits
-func runCLIMode(args []string, hasStdinInput bool, level loglevel.Level, noThink bool) {
+// isSecretConfigKey reports whether a config file entry holds a credential
+// whose value should be redacted wherever it appears.
+func isSecretConfigKey(key string) bool {
+	key = strings.ToUpper(key)
+	for _, word := range []string{"KEY", "TOKEN", "SECRET", "PASSWORD"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// runCLIMode executes the agent on a single prompt and exits. With the
+// stream-json input format it handles one message per stdin line instead,
+// until stdin is closed. The output format picks what goes to stdout: the
+// response (text), a result object (json) or every event (stream-json).
+func runCLIMode(args []string, hasStdinInput bool, level loglevel.Level, noThink, plan bool, outputFormat, inputFormat string) {
 	// Determine prompt source
 	var userPrompt string
+	var stream *streamInput
 	var err error
 
-	if len(args) > 0 && args[0] == "-f" {
+	if inputFormat == inputStreamJSON {
+		// Messages come from stdin; args, if any, are the first
+		stream = newStreamInput(os.Stdin)
+		userPrompt = strings.Join(args, " ")
+	} else if len(args) > 0 && args[0] == "-f" {
 		// Read from file
 		if len(args) < 2 {
 			fmt.Fprintln(os.Stderr, "Error: -f requires a file path")
@@ -181,7 +348,7 @@ func runCLIMode(args []string, hasStdinInput bool, level loglevel.Level, noThink
 		userPrompt = strings.Join(args, " ")
 	}
 
-	if strings.TrimSpace(userPrompt) == "" {
+	if stream == nil && strings.TrimSpace(userPrompt) == "" {
 		fmt.Fprintln(os.Stderr, "Error: Empty prompt provided")
 		os.Exit(1)
 	}
@@ -193,6 +360,7 @@ func runCLIMode(args []string, hasStdinInput bool, level loglevel.Level, noThink
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	cfg.PlanMode = plan
 
 	// Create session for persistence
 	sess, err := session.New()
@@ -200,130 +368,107 @@ func runCLIMode(args []string, hasStdinInput bool, level loglevel.Level, noThink
 		fmt.Fprintf(os.Stderr, "Warning: session creation failed: %v\n", err)
 		// Continue without session — non-fatal
 	}
+	cfg.CheckpointDir = checkpointDir(sess)
+	var sessionDir string
+	if sess != nil {
+		sessionDir = sess.Dir
+	}
 
 	// Create agent — the CLI layer owns all display filtering.
 	// The agent emits everything unconditionally; we filter here.
+	out := newCLIOutput(outputFormat, os.Stdout)
 	agentInstance := agent.New(cfg,
-		agent.WithProgressCallback(func(msg string, toolUseID string) {
-			// Append tool use ID for display
-			msgWithID := session.FormatToolUseID(msg, toolUseID)
+		agent.WithEventHandler(recordEvents(sess)),
+		agent.WithEventHandler(logEvents(level)),
+		agent.WithEventHandler(out.handle),
+		agent.WithTodoCallback(func(todos []agent.TodoItem) {
 			if level.ShouldShow(loglevel.Quiet) {
-				fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Quiet, msgWithID))
+				fmt.Fprintln(os.Stderr, formatTodos(todos))
 			}
-		}),
-		agent.WithToolUseCallback(func(displayMsg, toolName, toolUseID string, toolInput map[string]interface{}) {
-			// Persist enriched tool-use metadata for session reconstruction
 			if sess != nil {
-				msgWithID := session.FormatToolUseID(displayMsg, toolUseID)
-				inputJSON, _ := json.Marshal(toolInput)
-				content := fmt.Sprintf("%s\nname: %s\ninput: %s\n",
-					session.StripANSI(msgWithID), toolName, string(inputJSON))
-				sess.WriteMessage(session.TypeToolUse, content)
+				sess.WriteMessage(session.TypeTodo, session.FormatTodos(todos))
 			}
-			// At debug level, emit metadata to match session file contents
-			inputJSON, _ := json.Marshal(toolInput)
-			emitDebugMetadata(os.Stderr, level,
-				"name: "+toolName,
-				"input: "+string(inputJSON))
 		}),
-		agent.WithOutputCallback(func(output string, toolUseID string) {
-			// At debug level, emit tool_use_id to match session file contents
-			emitDebugMetadata(os.Stderr, level, "["+toolUseID+"]")
-			if level.ShouldShow(loglevel.Normal) {
-				displayed := truncateForLevel(output, truncate.ToolOutputLineLimit, level)
-				fmt.Fprintln(os.Stderr)
-				fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Normal, displayed))
-				fmt.Fprintln(os.Stderr)
-			}
-			// Persist full (untruncated) tool output with tool_use_id
+		agent.WithPlanCallback(func(p agent.Plan, approved bool) {
 			if sess != nil {
-				content := fmt.Sprintf("[%s]\n```\n%s\n```\n", toolUseID, output)
-				sess.WriteMessage(session.TypeToolResult, content)
+				sess.WriteMessage(session.TypePlan, session.FormatPlan(p.Markdown(), approved))
 			}
 		}),
-		agent.WithThinkingCallback(func(text string, signature string) {
-			if level.ShouldShow(loglevel.Normal) {
-				displayed := truncateForLevel(text, truncate.ThinkingLineLimit, level)
-				fmt.Fprintln(os.Stderr, style.FormatThinking(displayed))
-			}
-			// At debug level, emit signature to match session file contents
-			emitDebugMetadata(os.Stderr, level, "signature: "+signature)
-			// Persist full thinking + signature to session
-			if sess != nil {
-				sess.WriteMessage(session.TypeThinking, formatThinkingForSession(text, signature))
-			}
-		}),
-		agent.WithDiagnosticCallback(func(msg string) {
-			if strings.HasPrefix(msg, "💾 Cache:") && !strings.Contains(msg, "|") {
-				// Verbose cache format
-				if level.ShouldShow(loglevel.Verbose) {
-					fmt.Fprintln(os.Stderr, msg)
-				}
-			} else if strings.HasPrefix(msg, "💾 Cache:") && strings.Contains(msg, "|") {
-				// Debug cache format
-				if level.ShouldShow(loglevel.Debug) {
-					fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Debug, msg))
-				}
-			} else if strings.HasPrefix(msg, "🔍") || strings.HasPrefix(msg, "🔒") {
-				// Token diagnostics and redacted thinking
-				if level.ShouldShow(loglevel.Debug) {
-					fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Debug, msg))
+		agent.WithSubAgentCallback(taskSession(sess)),
+	)
+	defer agentInstance.Close()
+
+	// Execute the prompt, or each message of the input stream
+	var response, planMarkdown string
+	var turnErr error
+	failed := false
+	for turns := 0; ; turns++ {
+		if stream != nil && strings.TrimSpace(userPrompt) == "" {
+			userPrompt, err = stream.next()
+			if err == io.EOF {
+				if turns == 0 {
+					fmt.Fprintln(os.Stderr, "Error: Empty prompt provided")
+					os.Exit(1)
 				}
+				break
 			}
-			// Persist all diagnostics to session (always at debug level)
-			if sess != nil {
-				sess.WriteMessage(session.TypeDiagnostic, msg+"\n")
-			}
-		}),
-		agent.WithUserMessageCallback(func(text string) {
-			if sess != nil {
-				sess.WriteMessage(session.TypeUser, "**You:**\n\n"+text+"\n")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading from stdin: %v\n", err)
+				os.Exit(1)
 			}
-		}),
-		agent.WithAssistantMessageCallback(func(text string) {
-			if sess != nil {
-				sess.WriteMessage(session.TypeAssistant, "**Claude:**\n\n"+text+"\n")
-			}
-		}),
-		agent.WithCompactionCallback(func(marker string, summary string) {
-			if marker != "" {
-				if level.ShouldShow(loglevel.Quiet) {
-					fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Quiet, marker))
-				}
-				if sess != nil {
-					sess.WriteMessage(session.TypeCompaction, marker+"\n")
+		}
+
+		response, turnErr = agentInstance.HandleMessage(userPrompt)
+		userPrompt = ""
+		planMarkdown = ""
+		if p := agentInstance.PendingPlan(); p != nil {
+			planMarkdown = p.Markdown()
+		}
+		if turnErr != nil {
+			failed = true
+		}
+
+		switch outputFormat {
+		case outputText:
+			if turnErr != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", turnErr)
+				if stream == nil {
+					os.Exit(1)
 				}
+				break
 			}
-			if summary != "" && sess != nil {
-				sess.WriteMessage(session.TypeSystem, "**System:**\n\n"+summary+"\n")
+			// Print response to stdout (for piping/redirection), after the
+			// plan when one was submitted in plan mode
+			if planMarkdown != "" {
+				fmt.Println(planMarkdown)
+				fmt.Println()
 			}
-		}),
-		agent.WithErrorCallback(func(err error) {
-			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
-		}),
-	)
-	defer agentInstance.Close()
+			fmt.Println(response)
+		case outputStreamJSON:
+			out.writeResult(out.result(response, turnErr, planMarkdown, sessionDir))
+		}
 
-	// Execute prompt
-	response, err := agentInstance.HandleMessage(userPrompt)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		if stream == nil {
+			break
+		}
+	}
+	if outputFormat == outputJSON {
+		out.writeResult(out.result(response, turnErr, planMarkdown, sessionDir))
 	}
-
-	// Print response to stdout (for piping/redirection)
-	fmt.Println(response)
 
 	// Print session path on exit
 	if sess != nil {
 		fmt.Fprintf(os.Stderr, "Session saved: %s\n", sess.RelativeDir())
 	}
 
+	if failed {
+		os.Exit(1)
+	}
 	os.Exit(0)
 }
 
 // runREPLMode runs the interactive REPL
-func runREPLMode(level loglevel.Level, noThink bool) {
+func runREPLMode(level loglevel.Level, noThink, plan bool) {
 	// Load config and build agent.Config
 	configPath := getConfigPath()
 	cfg, err := loadAgentConfig(configPath, noThink)
@@ -331,6 +476,7 @@ func runREPLMode(level loglevel.Level, noThink bool) {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	cfg.PlanMode = plan
 
 	// Create session for persistence
 	sess, err := session.New()
@@ -338,176 +484,53 @@ func runREPLMode(level loglevel.Level, noThink bool) {
 		fmt.Fprintf(os.Stderr, "Warning: session creation failed: %v\n", err)
 		// Continue without session — non-fatal
 	}
+	cfg.CheckpointDir = checkpointDir(sess)
 
 	// Create spinner for animated progress display (REPL mode only).
 	sp := spinner.New()
-
-	// lastProgressMsg tracks the most recent tool → progress message so we
-	// can print it as a permanent log line when the spinner stops.
-	var lastProgressMsg string
+	perm := &permissionPrompt{sp: sp}
+	steer := &steering{sp: sp}
 
 	// Create agent — the CLI layer owns all display filtering, truncation,
 	// and spinner management. The agent emits everything unconditionally.
+	display := &replDisplay{level: level, sp: sp}
 	agentInstance := agent.New(cfg,
-		agent.WithSpinnerCallback(func(start bool, message string) {
-			if level == loglevel.Silent {
-				return
-			}
-			if start {
-				sp.Start(message)
-			} else {
-				if sp.IsActive() {
-					sp.Stop()
-				}
-			}
-		}),
-		agent.WithThinkingCallback(func(text string, signature string) {
-			// Persist full thinking + signature to session (always, regardless of display level)
+		agent.WithEventHandler(recordEvents(sess)),
+		agent.WithEventHandler(display.show),
+		agent.WithPermissionCallback(perm.confirm),
+		agent.WithAskUserCallback(perm.question),
+		agent.WithTodoCallback(func(todos []agent.TodoItem) {
+			// Persist every change to session (always, regardless of display level)
 			if sess != nil {
-				sess.WriteMessage(session.TypeThinking, formatThinkingForSession(text, signature))
-			}
-			if !level.ShouldShow(loglevel.Normal) {
-				return
-			}
-			// Stop spinner before printing thinking
-			if sp.IsActive() {
-				sp.Stop()
+				sess.WriteMessage(session.TypeTodo, session.FormatTodos(todos))
 			}
-			// Flush any pending progress message
-			if lastProgressMsg != "" {
-				fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-				lastProgressMsg = ""
-			}
-			displayed := truncateForLevel(text, truncate.ThinkingLineLimit, level)
-			fmt.Println(style.FormatThinking(displayed))
-			// At debug level, emit signature to match session file contents
-			emitDebugMetadata(os.Stdout, level, "signature: "+signature)
-		}),
-		agent.WithProgressCallback(func(msg string, toolUseID string) {
-			// Append tool use ID for display
-			msgWithID := session.FormatToolUseID(msg, toolUseID)
 			if !level.ShouldShow(loglevel.Quiet) {
 				return
 			}
-			// Tool progress line (→ Reading file: main.go [toolu_abc123]).
-			// If there's a pending progress message from a previous tool,
-			// flush it now before updating.
-			if lastProgressMsg != "" {
-				if sp.IsActive() {
-					sp.Stop()
-				}
-				fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-			}
-			lastProgressMsg = msgWithID
-			if level != loglevel.Silent {
-				sp.Start(spinner.FormatSpinnerMessage(msgWithID))
-			}
+			display.flush()
+			fmt.Println(formatTodos(todos))
 		}),
-		agent.WithToolUseCallback(func(displayMsg, toolName, toolUseID string, toolInput map[string]interface{}) {
-			// Persist enriched tool-use metadata for session reconstruction
+		agent.WithPlanCallback(func(p agent.Plan, approved bool) {
+			// Persist every plan to session; show it when it is submitted
 			if sess != nil {
-				msgWithID := session.FormatToolUseID(displayMsg, toolUseID)
-				inputJSON, _ := json.Marshal(toolInput)
-				content := fmt.Sprintf("%s\nname: %s\ninput: %s\n",
-					session.StripANSI(msgWithID), toolName, string(inputJSON))
-				sess.WriteMessage(session.TypeToolUse, content)
+				sess.WriteMessage(session.TypePlan, session.FormatPlan(p.Markdown(), approved))
 			}
-			// At debug level, emit metadata to match session file contents
-			inputJSON, _ := json.Marshal(toolInput)
-			emitDebugMetadata(os.Stdout, level,
-				"name: "+toolName,
-				"input: "+string(inputJSON))
-		}),
-		agent.WithOutputCallback(func(output string, toolUseID string) {
-			// Persist full (untruncated) tool output with tool_use_id
-			if sess != nil {
-				content := fmt.Sprintf("[%s]\n```\n%s\n```\n", toolUseID, output)
-				sess.WriteMessage(session.TypeToolResult, content)
-			}
-			if !level.ShouldShow(loglevel.Normal) {
+			if approved {
 				return
 			}
-			// Tool output body — tool execution is complete.
-			// Stop spinner, print permanent progress line, then output
-			// body with blank line separation above and below.
-			if sp.IsActive() {
-				sp.Stop()
-			}
-			if lastProgressMsg != "" {
-				fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-				lastProgressMsg = ""
-			}
-			// At debug level, emit tool_use_id to match session file contents
-			emitDebugMetadata(os.Stdout, level, "["+toolUseID+"]")
-			displayed := truncateForLevel(output, truncate.ToolOutputLineLimit, level)
-			fmt.Println()
-			fmt.Println(StyleMessage(loglevel.Normal, displayed))
-			fmt.Println()
+			display.flush()
+			fmt.Println(formatPlan(p))
 		}),
-		agent.WithDiagnosticCallback(func(msg string) {
-			// Persist all diagnostics to session (always at debug level)
-			if sess != nil {
-				sess.WriteMessage(session.TypeDiagnostic, msg+"\n")
-			}
-			if strings.HasPrefix(msg, "💾 Cache:") && !strings.Contains(msg, "|") {
-				// Verbose cache format
-				if !level.ShouldShow(loglevel.Verbose) {
-					return
-				}
-			} else if strings.HasPrefix(msg, "💾 Cache:") && strings.Contains(msg, "|") {
-				// Debug cache format
-				if !level.ShouldShow(loglevel.Debug) {
-					return
-				}
-			} else {
-				// Token diagnostics, redacted thinking
-				if !level.ShouldShow(loglevel.Debug) {
-					return
-				}
-			}
-			// Stop spinner if active, print directly
-			if sp.IsActive() {
-				sp.Stop()
-				if lastProgressMsg != "" {
-					fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-					lastProgressMsg = ""
-				}
-			}
-			fmt.Println(StyleMessage(loglevel.Debug, msg))
-		}),
-		agent.WithUserMessageCallback(func(text string) {
-			if sess != nil {
-				sess.WriteMessage(session.TypeUser, "**You:**\n\n"+text+"\n")
-			}
-		}),
-		agent.WithAssistantMessageCallback(func(text string) {
-			if sess != nil {
-				sess.WriteMessage(session.TypeAssistant, "**Claude:**\n\n"+text+"\n")
-			}
-		}),
-		agent.WithCompactionCallback(func(marker string, summary string) {
-			if marker != "" {
-				if sp.IsActive() {
-					sp.Stop()
-				}
-				if lastProgressMsg != "" {
-					fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-					lastProgressMsg = ""
-				}
-				if level.ShouldShow(loglevel.Quiet) {
-					fmt.Println(StyleMessage(loglevel.Quiet, marker))
-				}
-				if sess != nil {
-					sess.WriteMessage(session.TypeCompaction, marker+"\n")
-				}
-			}
-			if summary != "" && sess != nil {
-				sess.WriteMessage(session.TypeSystem, "**System:**\n\n"+summary+"\n")
+		agent.WithQueueCallback(func(delivered, queued []string) {
+			// Show the queue on the spinner, and messages once sent
+			steer.queueChanged(queued)
+			if len(delivered) == 0 {
+				return
 			}
+			display.flush()
+			fmt.Println(formatDelivered(delivered))
 		}),
-		agent.WithErrorCallback(func(err error) {
-			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
-		}),
+		agent.WithSubAgentCallback(taskSession(sess)),
 	)
 	defer agentInstance.Close()
 
@@ -516,6 +539,9 @@ func runREPLMode(level loglevel.Level, noThink bool) {
 	fmt.Println("  Multiline: Ctrl+J or Alt+Enter to insert a newline,")
 	fmt.Println("             or end a line with \\ to continue")
 	fmt.Println("==========================================================")
+	if agentInstance.PlanMode() {
+		fmt.Println(planModeStatus(true))
+	}
 
 	// Create rich text input reader (readline-based).
 	homeDir, _ := os.UserHomeDir()
@@ -534,7 +560,7 @@ func runREPLMode(level loglevel.Level, noThink bool) {
 	if err != nil {
 		// Fall back to basic bufio reader if readline fails
 		fmt.Fprintf(os.Stderr, "Warning: Rich input unavailable (%v), using basic input\n", err)
-		runREPLBasicMode(level, agentInstance, sp, cfg.ContextWindowSize, sess)
+		runREPLBasicMode(agentInstance, display, cfg.ContextWindowSize, sess, perm)
 		return
 	}
 	defer reader.Close()
@@ -542,47 +568,62 @@ func runREPLMode(level loglevel.Level, noThink bool) {
 	// contextPercent starts at -1 (no data yet) until the first API response
 	contextPercent := -1
 
+	rc := &replContext{
+		agent: agentInstance,
+		sess:  sess,
+		ask: func(question string) (string, error) {
+			steer.pause()
+			defer steer.resume()
+			reader.SetPrompt(question)
+			return reader.ReadLine()
+		},
+	}
+	perm.ask = rc.ask
+	steer.reader = reader
+	steer.agent = agentInstance
+
+	// next is sent without reading input: the answer to a plan review
+	var next string
 	for {
-		gitInfo := prompt.GetGitInfo()
-		fmt.Println()
-		reader.SetPrompt(prompt.FormatPrompt(gitInfo, contextPercent))
+		userInput := next
+		next = ""
+		if userInput == "" {
+			gitInfo := prompt.GetGitInfo()
+			fmt.Println()
+			reader.SetPrompt(prompt.FormatPrompt(gitInfo, contextPercent))
 
-		userInput, err := reader.ReadLine()
-		if err != nil {
-			if err == io.EOF {
+			line, err := reader.ReadLine()
+			if err != nil {
+				if err == io.EOF {
+					printGoodbye(sess)
+					break
+				}
+				// ErrInterrupt (Ctrl+C) — just show a new prompt
+				continue
+			}
+
+			userInput = strings.TrimSpace(line)
+			if userInput == "" {
+				continue
+			}
+
+			if userInput == "exit" || userInput == "quit" {
 				printGoodbye(sess)
 				break
 			}
-			// ErrInterrupt (Ctrl+C) — just show a new prompt
-			continue
-		}
 
-		userInput = strings.TrimSpace(userInput)
-		if userInput == "" {
-			continue
-		}
-
-		if userInput == "exit" || userInput == "quit" {
-			printGoodbye(sess)
-			break
+			if handleSlashCommand(userInput, rc) {
+				continue
+			}
 		}
 
-		response, handleErr := agentInstance.HandleMessage(userInput)
+		// Messages typed during the turn are queued for the agent
+		steer.start()
+		response, _ := agentInstance.HandleMessage(userInput)
+		steer.finish()
 
 		// Ensure spinner is stopped before printing the response
-		if sp.IsActive() {
-			sp.Stop()
-		}
-		if lastProgressMsg != "" {
-			fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-			lastProgressMsg = ""
-		}
-
-		// Persist errors to session log so the full history is on disk
-		if handleErr != nil && sess != nil {
-			sess.WriteMessage(session.TypeDiagnostic,
-				fmt.Sprintf("❌ Error: %v\n", handleErr))
-		}
+		display.flush()
 
 		fmt.Printf("\n%s%s\n", style.FormatAgentPrefix(), response)
 
@@ -590,63 +631,81 @@ func runREPLMode(level loglevel.Level, noThink bool) {
 		usage := agentInstance.LastUsage()
 		totalInput := usage.InputTokens + usage.CacheReadInputTokens
 		contextPercent = prompt.CalculateContextPercent(totalInput, cfg.ContextWindowSize)
+
+		// Messages queued after the last tool results are sent next;
+		// otherwise a plan submitted in plan mode is approved or revised
+		if held := agentInstance.TakeQueued(); len(held) > 0 {
+			next = strings.Join(held, "\n\n")
+			fmt.Printf("\n%s%s\n", style.FormatDim("↪ Sending your queued message: "), next)
+		} else {
+			next = reviewPlan(rc)
+		}
 	}
 }
 
 // runREPLBasicMode is the fallback REPL when readline is unavailable.
-func runREPLBasicMode(level loglevel.Level, agentInstance *agent.Agent, sp *spinner.Spinner, contextWindowSize int, sess *session.Session) {
-	var lastProgressMsg string
-
+func runREPLBasicMode(agentInstance *agent.Agent, display *replDisplay, contextWindowSize int, sess *session.Session, perm *permissionPrompt) {
 	// The agent is already created by the caller. We just need to set up
-	// the basic input loop. The callbacks were already configured when the
-	// agent was created in runREPLMode.
+	// the basic input loop. The event handlers and callbacks were already
+	// configured when the agent was created in runREPLMode.
 
 	reader := bufio.NewReader(os.Stdin)
 	contextPercent := -1
 
+	rc := &replContext{
+		agent: agentInstance,
+		sess:  sess,
+		ask: func(question string) (string, error) {
+			fmt.Print(question)
+			return reader.ReadString('\n')
+		},
+	}
+	perm.ask = rc.ask
+
+	// next is sent without reading input: the answer to a plan review
+	var next string
 	for {
-		gitInfo := prompt.GetGitInfo()
-		fmt.Print("\n" + prompt.FormatPrompt(gitInfo, contextPercent))
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
+		line := next
+		next = ""
+		if line == "" {
+			gitInfo := prompt.GetGitInfo()
+			fmt.Print("\n" + prompt.FormatPrompt(gitInfo, contextPercent))
+			input, err := reader.ReadString('\n')
+			if err != nil {
+				if err == io.EOF {
+					printGoodbye(sess)
+					break
+				}
+				fmt.Printf("Error reading input: %v\n", err)
+				continue
+			}
+
+			line = strings.TrimSpace(input)
+			if line == "" {
+				continue
+			}
+			if line == "exit" || line == "quit" {
 				printGoodbye(sess)
 				break
 			}
-			fmt.Printf("Error reading input: %v\n", err)
-			continue
-		}
 
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if line == "exit" || line == "quit" {
-			printGoodbye(sess)
-			break
+			if handleSlashCommand(line, rc) {
+				continue
+			}
 		}
 
-		response, handleErr := agentInstance.HandleMessage(line)
-
-		if sp.IsActive() {
-			sp.Stop()
-		}
-		if lastProgressMsg != "" {
-			fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-			lastProgressMsg = ""
-		}
+		response, _ := agentInstance.HandleMessage(line)
 
-		// Persist errors to session log
-		if handleErr != nil && sess != nil {
-			sess.WriteMessage(session.TypeDiagnostic,
-				fmt.Sprintf("❌ Error: %v\n", handleErr))
-		}
+		display.flush()
 
 		fmt.Printf("\n%s%s\n", style.FormatAgentPrefix(), response)
 
 		usage := agentInstance.LastUsage()
 		totalInput := usage.InputTokens + usage.CacheReadInputTokens
 		contextPercent = prompt.CalculateContextPercent(totalInput, contextWindowSize)
+
+		// A plan submitted in plan mode is approved or revised right away
+		next = reviewPlan(rc)
 	}
 }
 
@@ -686,7 +745,7 @@ func runSessionsMode() {
 }
 
 // runResumeMode loads a previous session and starts the REPL.
-func runResumeMode(target string, level loglevel.Level, noThink bool) {
+func runResumeMode(target string, level loglevel.Level, noThink, plan bool) {
 	sessionsRoot, _ := session.FindSessionsRoot()
 	currentUser := session.GetUsername()
 
@@ -749,6 +808,9 @@ func runResumeMode(target string, level loglevel.Level, noThink bool) {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	cfg.PlanMode = plan
+
+	cfg.CheckpointDir = checkpointDir(sess)
 
 	// Start REPL with restored history
 	runREPLModeWithSession(level, noThink, cfg, sess, history)
@@ -759,151 +821,48 @@ func runResumeMode(target string, level loglevel.Level, noThink bool) {
 func runREPLModeWithSession(level loglevel.Level, noThink bool, cfg agent.Config, sess *session.Session, history []agent.Message) {
 	// Create spinner for animated progress display (REPL mode only).
 	sp := spinner.New()
-
-	// lastProgressMsg tracks the most recent tool → progress message
-	var lastProgressMsg string
+	perm := &permissionPrompt{sp: sp}
+	steer := &steering{sp: sp}
 
 	// Create agent
+	display := &replDisplay{level: level, sp: sp}
 	agentInstance := agent.New(cfg,
-		agent.WithSpinnerCallback(func(start bool, message string) {
-			if level == loglevel.Silent {
-				return
-			}
-			if start {
-				sp.Start(message)
-			} else {
-				if sp.IsActive() {
-					sp.Stop()
-				}
-			}
-		}),
-		agent.WithThinkingCallback(func(text string, signature string) {
+		agent.WithEventHandler(recordEvents(sess)),
+		agent.WithEventHandler(display.show),
+		agent.WithPermissionCallback(perm.confirm),
+		agent.WithAskUserCallback(perm.question),
+		agent.WithTodoCallback(func(todos []agent.TodoItem) {
+			// Persist every change to session (always, regardless of display level)
 			if sess != nil {
-				sess.WriteMessage(session.TypeThinking, formatThinkingForSession(text, signature))
+				sess.WriteMessage(session.TypeTodo, session.FormatTodos(todos))
 			}
-			if !level.ShouldShow(loglevel.Normal) {
-				return
-			}
-			if sp.IsActive() {
-				sp.Stop()
-			}
-			if lastProgressMsg != "" {
-				fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-				lastProgressMsg = ""
-			}
-			displayed := truncateForLevel(text, truncate.ThinkingLineLimit, level)
-			fmt.Println(style.FormatThinking(displayed))
-			emitDebugMetadata(os.Stdout, level, "signature: "+signature)
-		}),
-		agent.WithProgressCallback(func(msg string, toolUseID string) {
-			msgWithID := session.FormatToolUseID(msg, toolUseID)
 			if !level.ShouldShow(loglevel.Quiet) {
 				return
 			}
-			if lastProgressMsg != "" {
-				if sp.IsActive() {
-					sp.Stop()
-				}
-				fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-			}
-			lastProgressMsg = msgWithID
-			if level != loglevel.Silent {
-				sp.Start(spinner.FormatSpinnerMessage(msgWithID))
-			}
+			display.flush()
+			fmt.Println(formatTodos(todos))
 		}),
-		agent.WithToolUseCallback(func(displayMsg, toolName, toolUseID string, toolInput map[string]interface{}) {
+		agent.WithPlanCallback(func(p agent.Plan, approved bool) {
+			// Persist every plan to session; show it when it is submitted
 			if sess != nil {
-				msgWithID := session.FormatToolUseID(displayMsg, toolUseID)
-				inputJSON, _ := json.Marshal(toolInput)
-				content := fmt.Sprintf("%s\nname: %s\ninput: %s\n",
-					session.StripANSI(msgWithID), toolName, string(inputJSON))
-				sess.WriteMessage(session.TypeToolUse, content)
+				sess.WriteMessage(session.TypePlan, session.FormatPlan(p.Markdown(), approved))
 			}
-			inputJSON, _ := json.Marshal(toolInput)
-			emitDebugMetadata(os.Stdout, level,
-				"name: "+toolName,
-				"input: "+string(inputJSON))
-		}),
-		agent.WithOutputCallback(func(output string, toolUseID string) {
-			if sess != nil {
-				content := fmt.Sprintf("[%s]\n```\n%s\n```\n", toolUseID, output)
-				sess.WriteMessage(session.TypeToolResult, content)
-			}
-			if !level.ShouldShow(loglevel.Normal) {
+			if approved {
 				return
 			}
-			if sp.IsActive() {
-				sp.Stop()
-			}
-			if lastProgressMsg != "" {
-				fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-				lastProgressMsg = ""
-			}
-			emitDebugMetadata(os.Stdout, level, "["+toolUseID+"]")
-			displayed := truncateForLevel(output, truncate.ToolOutputLineLimit, level)
-			fmt.Println()
-			fmt.Println(StyleMessage(loglevel.Normal, displayed))
-			fmt.Println()
-		}),
-		agent.WithDiagnosticCallback(func(msg string) {
-			if sess != nil {
-				sess.WriteMessage(session.TypeDiagnostic, msg+"\n")
-			}
-			if strings.HasPrefix(msg, "💾 Cache:") && !strings.Contains(msg, "|") {
-				if !level.ShouldShow(loglevel.Verbose) {
-					return
-				}
-			} else if strings.HasPrefix(msg, "💾 Cache:") && strings.Contains(msg, "|") {
-				if !level.ShouldShow(loglevel.Debug) {
-					return
-				}
-			} else {
-				if !level.ShouldShow(loglevel.Debug) {
-					return
-				}
-			}
-			if sp.IsActive() {
-				sp.Stop()
-				if lastProgressMsg != "" {
-					fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-					lastProgressMsg = ""
-				}
-			}
-			fmt.Println(StyleMessage(loglevel.Debug, msg))
-		}),
-		agent.WithUserMessageCallback(func(text string) {
-			if sess != nil {
-				sess.WriteMessage(session.TypeUser, "**You:**\n\n"+text+"\n")
-			}
-		}),
-		agent.WithAssistantMessageCallback(func(text string) {
-			if sess != nil {
-				sess.WriteMessage(session.TypeAssistant, "**Claude:**\n\n"+text+"\n")
-			}
+			display.flush()
+			fmt.Println(formatPlan(p))
 		}),
-		agent.WithCompactionCallback(func(marker string, summary string) {
-			if marker != "" {
-				if sp.IsActive() {
-					sp.Stop()
-				}
-				if lastProgressMsg != "" {
-					fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-					lastProgressMsg = ""
-				}
-				if level.ShouldShow(loglevel.Quiet) {
-					fmt.Println(StyleMessage(loglevel.Quiet, marker))
-				}
-				if sess != nil {
-					sess.WriteMessage(session.TypeCompaction, marker+"\n")
-				}
-			}
-			if summary != "" && sess != nil {
-				sess.WriteMessage(session.TypeSystem, "**System:**\n\n"+summary+"\n")
+		agent.WithQueueCallback(func(delivered, queued []string) {
+			// Show the queue on the spinner, and messages once sent
+			steer.queueChanged(queued)
+			if len(delivered) == 0 {
+				return
 			}
+			display.flush()
+			fmt.Println(formatDelivered(delivered))
 		}),
-		agent.WithErrorCallback(func(err error) {
-			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
-		}),
+		agent.WithSubAgentCallback(taskSession(sess)),
 	)
 	defer agentInstance.Close()
 
@@ -912,6 +871,15 @@ func runREPLModeWithSession(level loglevel.Level, noThink bool, cfg agent.Config
 		agentInstance.SetHistory(history)
 	}
 
+	// Restore the todo list saved last
+	if sess != nil {
+		if todos, err := session.LatestTodos(sess.Dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		} else if len(todos) > 0 {
+			agentInstance.SetTodos(todos)
+		}
+	}
+
 	// Start REPL
 	sessionName := ""
 	if sess != nil {
@@ -925,6 +893,9 @@ func runREPLModeWithSession(level loglevel.Level, noThink bool, cfg agent.Config
 	fmt.Println("  Multiline: Ctrl+J or Alt+Enter to insert a newline,")
 	fmt.Println("             or end a line with \\ to continue")
 	fmt.Println("==========================================================")
+	if agentInstance.PlanMode() {
+		fmt.Println(planModeStatus(true))
+	}
 
 	// Create rich text input reader
 	homeDir, _ := os.UserHomeDir()
@@ -942,59 +913,194 @@ func runREPLModeWithSession(level loglevel.Level, noThink bool, cfg agent.Config
 	})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: Rich input unavailable (%v), using basic input\n", err)
-		runREPLBasicMode(level, agentInstance, sp, cfg.ContextWindowSize, sess)
+		runREPLBasicMode(agentInstance, display, cfg.ContextWindowSize, sess, perm)
 		return
 	}
 	defer reader.Close()
 
 	contextPercent := -1
 
+	rc := &replContext{
+		agent: agentInstance,
+		sess:  sess,
+		ask: func(question string) (string, error) {
+			steer.pause()
+			defer steer.resume()
+			reader.SetPrompt(question)
+			return reader.ReadLine()
+		},
+	}
+	perm.ask = rc.ask
+	steer.reader = reader
+	steer.agent = agentInstance
+
+	// next is sent without reading input: the answer to a plan review
+	var next string
 	for {
-		gitInfo := prompt.GetGitInfo()
-		fmt.Println()
-		reader.SetPrompt(prompt.FormatPrompt(gitInfo, contextPercent))
+		userInput := next
+		next = ""
+		if userInput == "" {
+			gitInfo := prompt.GetGitInfo()
+			fmt.Println()
+			reader.SetPrompt(prompt.FormatPrompt(gitInfo, contextPercent))
 
-		userInput, err := reader.ReadLine()
-		if err != nil {
-			if err == io.EOF {
+			line, err := reader.ReadLine()
+			if err != nil {
+				if err == io.EOF {
+					printGoodbye(sess)
+					break
+				}
+				continue
+			}
+
+			userInput = strings.TrimSpace(line)
+			if userInput == "" {
+				continue
+			}
+
+			if userInput == "exit" || userInput == "quit" {
 				printGoodbye(sess)
 				break
 			}
-			continue
-		}
 
-		userInput = strings.TrimSpace(userInput)
-		if userInput == "" {
-			continue
-		}
-
-		if userInput == "exit" || userInput == "quit" {
-			printGoodbye(sess)
-			break
+			if handleSlashCommand(userInput, rc) {
+				continue
+			}
 		}
 
-		response, handleErr := agentInstance.HandleMessage(userInput)
-
-		if sp.IsActive() {
-			sp.Stop()
-		}
-		if lastProgressMsg != "" {
-			fmt.Println(StyleMessage(loglevel.Quiet, lastProgressMsg))
-			lastProgressMsg = ""
-		}
+		// Messages typed during the turn are queued for the agent
+		steer.start()
+		response, _ := agentInstance.HandleMessage(userInput)
+		steer.finish()
 
-		// Persist errors to session log
-		if handleErr != nil && sess != nil {
-			sess.WriteMessage(session.TypeDiagnostic,
-				fmt.Sprintf("❌ Error: %v\n", handleErr))
-		}
+		display.flush()
 
 		fmt.Printf("\n%s%s\n", style.FormatAgentPrefix(), response)
 
 		usage := agentInstance.LastUsage()
 		totalInput := usage.InputTokens + usage.CacheReadInputTokens
 		contextPercent = prompt.CalculateContextPercent(totalInput, cfg.ContextWindowSize)
+
+		// Messages queued after the last tool results are sent next;
+		// otherwise a plan submitted in plan mode is approved or revised
+		if held := agentInstance.TakeQueued(); len(held) > 0 {
+			next = strings.Join(held, "\n\n")
+			fmt.Printf("\n%s%s\n", style.FormatDim("↪ Sending your queued message: "), next)
+		} else {
+			next = reviewPlan(rc)
+		}
+	}
+}
+
+// permissionPrompt asks the REPL user to approve tool calls that need it
+// (see agent.PermissionCallback) and to answer ask_user questions. The agent
+// is created before the input reader, so ask is filled in once the reader
+// exists; until then, and if reading fails, calls are denied and questions
+// dismissed.
+type permissionPrompt struct {
+	sp  *spinner.Spinner
+	ask func(question string) (string, error)
+}
+
+// confirm shows the request and reads a y/N answer.
+func (p *permissionPrompt) confirm(toolName, request string) bool {
+	if p.ask == nil {
+		return false
 	}
+	if p.sp.IsActive() {
+		p.sp.Stop()
+	}
+	fmt.Printf("\n🔐 %s wants permission:\n%s\n", toolName, request)
+	answer, err := p.ask("Allow? [y/N]: ")
+	if err != nil {
+		return false
+	}
+	a := strings.ToLower(strings.TrimSpace(answer))
+	return a == "y" || a == "yes"
+}
+
+// question shows an ask_user question with its numbered options and reads
+// the answer.
+func (p *permissionPrompt) question(question string, options []string) (string, error) {
+	if p.ask == nil {
+		return "", fmt.Errorf("no input available")
+	}
+	if p.sp.IsActive() {
+		p.sp.Stop()
+	}
+	fmt.Printf("\n❓ %s\n", question)
+	for i, option := range options {
+		fmt.Printf("  %d. %s\n", i+1, option)
+	}
+	if len(options) > 0 {
+		return p.ask(fmt.Sprintf("Answer [1-%d, or type your own]: ", len(options)))
+	}
+	return p.ask("Answer: ")
+}
+
+// checkpointDir returns where file checkpoints are kept for a session:
+// .clyde/checkpoints/<session-id>/, next to .clyde/sessions/. Checkpoints
+// therefore survive --resume of the same session. Without a session, a
+// timestamped directory is used instead.
+func checkpointDir(sess *session.Session) string {
+	if sess != nil {
+		return filepath.Join(filepath.Dir(sess.SessionsRoot), "checkpoints", filepath.Base(sess.Dir))
+	}
+	sessionsRoot, _ := session.FindSessionsRoot()
+	return filepath.Join(filepath.Dir(sessionsRoot), "checkpoints", session.FormatTimestampDir(time.Now()))
+}
+
+// taskSession persists the conversation of each sub-agent started by the
+// task tool in <session>/tasks/<tool-use-id>/, in the same format as the
+// main session, which itself only records the task call and its report.
+func taskSession(sess *session.Session) agent.SubAgentCallback {
+	return func(toolUseID, description string) []agent.AgentOption {
+		if sess == nil {
+			return nil
+		}
+		child, err := sess.Child(filepath.Join("tasks", toolUseID))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: task %q will not be saved: %v\n", description, err)
+			return nil
+		}
+		return []agent.AgentOption{
+			agent.WithEventHandler(recordEvents(child)),
+			agent.WithTodoCallback(func(todos []agent.TodoItem) {
+				child.WriteMessage(session.TypeTodo, session.FormatTodos(todos))
+			}),
+		}
+	}
+}
+
+// formatTodos renders the agent's todo list as a terminal checklist:
+//
+//	📋 Todos (1/3 done)
+//	  ✔ Add the parser
+//	  ▸ Wire it into the CLI
+//	  ☐ Document the flag
+func formatTodos(todos []agent.TodoItem) string {
+	if len(todos) == 0 {
+		return style.FormatDim("📋 Todo list cleared")
+	}
+	lines := []string{fmt.Sprintf("📋 Todos (%s)", todo.Summary(todos))}
+	for _, item := range todos {
+		switch item.Status {
+		case todo.Done:
+			lines = append(lines, style.FormatDim("  ✔ "+item.Content))
+		case todo.InProgress:
+			lines = append(lines, "  ▸ "+style.ToolLabel(item.Content))
+		default:
+			lines = append(lines, "  ☐ "+item.Content)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatPlan renders a plan submitted in plan mode for the REPL: its
+// Markdown, with the title highlighted.
+func formatPlan(p agent.Plan) string {
+	title, rest, _ := strings.Cut(p.Markdown(), "\n")
+	return "\n📝 " + style.ToolLabel(strings.TrimPrefix(title, "# ")) + "\n" + rest
 }
 
 // formatThinkingForSession formats a thinking block for session persistence.
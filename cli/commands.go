@@ -0,0 +1,327 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/session"
+)
+
+// rewindListLimit is how many recent user turns /rewind offers.
+const rewindListLimit = 10
+
+// replContext is what slash commands need from the running REPL.
+type replContext struct {
+	agent *agent.Agent
+	sess  *session.Session
+	// ask prints a question and reads one line of follow-up input.
+	ask func(question string) (string, error)
+}
+
+// handleSlashCommand runs a REPL slash command. It returns false when the
+// input is not a known command, in which case it should be sent to the agent
+// as a normal message (so inputs like "/usr/bin is missing" still work).
+func handleSlashCommand(input string, rc *replContext) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+	args := fields[1:]
+
+	switch fields[0] {
+	case "/rewind":
+		runRewind(args, rc)
+	case "/undo":
+		runUndo(rc)
+	case "/checkpoints":
+		runCheckpoints(rc)
+	case "/plan":
+		runPlan(args, rc)
+	default:
+		return false
+	}
+	return true
+}
+
+// runRewind implements /rewind [n]: list recent user turns, truncate the
+// conversation before the chosen one, optionally undo file edits made since,
+// and fork the session directory so the original transcript is kept.
+// n counts back from the most recent user turn (1 = last message).
+func runRewind(args []string, rc *replContext) {
+	points := rc.agent.RewindPoints()
+	if len(points) == 0 {
+		fmt.Println("Nothing to rewind: no user messages yet.")
+		return
+	}
+
+	var choice string
+	if len(args) > 0 {
+		choice = args[0]
+	} else {
+		shown := points
+		if len(shown) > rewindListLimit {
+			shown = shown[len(shown)-rewindListLimit:]
+		}
+		fmt.Println("Recent messages (1 = most recent):")
+		for i := range shown {
+			n := len(shown) - i
+			fmt.Printf("  %2d) %s\n", n, rewindSummary(shown[i].Text))
+		}
+		answer, err := rc.ask(fmt.Sprintf("Rewind to before which message? [1-%d, Enter to cancel]: ", len(shown)))
+		if err != nil {
+			return
+		}
+		choice = strings.TrimSpace(answer)
+		if choice == "" {
+			fmt.Println("Rewind cancelled.")
+			return
+		}
+	}
+
+	n, err := strconv.Atoi(choice)
+	if err != nil || n < 1 || n > len(points) {
+		fmt.Printf("Invalid choice %q: expected a number between 1 and %d.\n", choice, len(points))
+		return
+	}
+	target := len(points) - n
+
+	restore := false
+	answer, err := rc.ask("Also restore files changed since then? [y/N]: ")
+	if err != nil {
+		return
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a == "y" || a == "yes" {
+		restore = true
+	}
+
+	// Fork the session first: if that fails, leave the conversation untouched
+	// so the transcript on disk still matches the history in memory.
+	if rc.sess != nil {
+		cutoff, ok := rewindCutoff(rc.sess.Dir, points, target)
+		if !ok {
+			fmt.Println("Rewind failed: could not locate that message in the session files.")
+			return
+		}
+		original := rc.sess.RelativeDir()
+		if err := rc.sess.Fork(cutoff); err != nil {
+			fmt.Printf("Rewind failed: %v\n", err)
+			return
+		}
+		fmt.Printf("Forked session: %s (original kept at %s)\n", rc.sess.RelativeDir(), original)
+	}
+
+	removed, err := rc.agent.RewindTo(points[target].Index)
+	if err != nil {
+		fmt.Printf("Rewind failed: %v\n", err)
+		return
+	}
+	fmt.Printf("Rewound to before: %s\n", rewindSummary(points[target].Text))
+	if rc.sess != nil {
+		// The fork ends at the cutoff, so its latest todo list is the one
+		// from before the rewound message, even across compaction.
+		if todos, err := session.LatestTodos(rc.sess.Dir); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else {
+			rc.agent.SetTodos(todos)
+		}
+		rc.sess.WriteMessage(session.TypeDiagnostic,
+			fmt.Sprintf("⏪ Rewound %d messages to before: %s\n", len(removed), rewindSummary(points[target].Text)))
+	}
+
+	if !restore {
+		return
+	}
+	report := rc.agent.RestoreFiles(removed)
+	if len(report.Restored) == 0 && len(report.Skipped) == 0 {
+		fmt.Println("No file edits to restore.")
+	}
+	for _, p := range report.Restored {
+		fmt.Printf("  restored %s\n", displayPath(p))
+	}
+	for _, s := range report.Skipped {
+		fmt.Printf("  skipped  %s\n", displayPath(s))
+	}
+}
+
+// runUndo implements /undo: revert every file edit from the most recent
+// checkpointed turn. Files changed since the agent's edit are left alone.
+func runUndo(rc *replContext) {
+	store := rc.agent.Checkpoints()
+	if store == nil {
+		fmt.Println("Checkpoints are disabled; nothing to undo.")
+		return
+	}
+	res, err := store.UndoLast()
+	if err != nil {
+		fmt.Println(capitalize(err.Error()) + ".")
+		return
+	}
+	fmt.Printf("Undid checkpoint %d: %s\n", res.Turn.ID, rewindSummary(res.Turn.Label))
+	for _, p := range res.Restored {
+		fmt.Printf("  restored %s\n", displayPath(p))
+	}
+	for _, s := range res.Skipped {
+		fmt.Printf("  skipped  %s\n", displayPath(s))
+	}
+	if res.Kept != "" {
+		fmt.Printf("Snapshots of the skipped files are kept in %s\n", displayPath(res.Kept))
+	}
+	if rc.sess != nil {
+		rc.sess.WriteMessage(session.TypeDiagnostic,
+			fmt.Sprintf("↩️ Undid checkpoint %d (%d restored, %d skipped)\n",
+				res.Turn.ID, len(res.Restored), len(res.Skipped)))
+	}
+}
+
+// runCheckpoints implements /checkpoints: list recorded turns, newest first,
+// with the files each one changed.
+func runCheckpoints(rc *replContext) {
+	store := rc.agent.Checkpoints()
+	if store == nil {
+		fmt.Println("Checkpoints are disabled.")
+		return
+	}
+	turns, err := store.List()
+	if err != nil {
+		fmt.Printf("Error listing checkpoints: %v\n", err)
+		return
+	}
+	if len(turns) == 0 {
+		fmt.Println("No checkpoints yet. They are recorded whenever the agent edits files.")
+		return
+	}
+	fmt.Printf("Checkpoints in %s (newest first; /undo reverts the top one not undone):\n", displayPath(store.Dir()))
+	for i := len(turns) - 1; i >= 0; i-- {
+		t := turns[i]
+		label := rewindSummary(t.Label)
+		if t.Undone {
+			label += " (undone; snapshots of skipped files kept)"
+		}
+		fmt.Printf("  %3d  %s  %s\n", t.ID, t.Time.Format("15:04:05"), label)
+		for _, f := range t.Files {
+			action := "modified"
+			switch {
+			case !f.Existed:
+				action = "created"
+			case f.Deleted:
+				action = "deleted"
+			}
+			fmt.Printf("         %-8s %s\n", action, displayPath(f.Path))
+		}
+	}
+}
+
+// displayPath shortens absolute paths under the working directory to relative
+// ones. Works on "path: reason" strings too.
+func displayPath(s string) string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return s
+	}
+	return strings.Replace(s, cwd+string(filepath.Separator), "", 1)
+}
+
+// capitalize upper-cases the first letter of an error message for display.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// rewindCutoff finds the timestamp of the session file for the user turn at
+// points[target]. In-memory turns are matched to user files by text, walking
+// back from the end, because compaction drops turns from history (except the
+// pinned first message) while the files remain on disk.
+func rewindCutoff(sessionDir string, points []agent.RewindPoint, target int) (time.Time, bool) {
+	msgs, err := session.ListUserMessages(sessionDir)
+	if err != nil {
+		return time.Time{}, false
+	}
+	j := len(msgs) - 1
+	for i := len(points) - 1; i >= target; i-- {
+		text := strings.TrimSpace(points[i].Text)
+		for j >= 0 && msgs[j].Text != text {
+			j--
+		}
+		if j < 0 {
+			return time.Time{}, false
+		}
+		if i == target {
+			return msgs[j].Timestamp, true
+		}
+		j--
+	}
+	return time.Time{}, false
+}
+
+// rewindSummary shortens a user message to one line for the /rewind list.
+func rewindSummary(text string) string {
+	text = strings.TrimSpace(text)
+	if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+		text = text[:idx] + " …"
+	}
+	if r := []rune(text); len(r) > 70 {
+		text = string(r[:67]) + "..."
+	}
+	return text
+}
+
+// runPlan implements /plan [on|off]: switch plan mode, or toggle it without
+// an argument.
+func runPlan(args []string, rc *replContext) {
+	on := !rc.agent.PlanMode()
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			fmt.Printf("Unknown argument %q: use /plan, /plan on or /plan off.\n", args[0])
+			return
+		}
+	}
+	rc.agent.SetPlanMode(on)
+	fmt.Println(planModeStatus(on))
+}
+
+// planModeStatus describes plan mode after switching it.
+func planModeStatus(on bool) string {
+	if on {
+		return "📝 Plan mode on: only read-only tools; answers end with a plan for you to approve or revise."
+	}
+	return "📝 Plan mode off: all tools are available."
+}
+
+// reviewPlan asks the user to approve the plan submitted during the last
+// message, if any. It returns the message to send next: the request to
+// implement an approved plan, the changes the user asked for (sent in plan
+// mode, for a revised plan), or "" to return to the prompt.
+func reviewPlan(rc *replContext) string {
+	if rc.agent.PendingPlan() == nil {
+		return ""
+	}
+	answer, err := rc.ask("Approve this plan? [y to implement it, or type what to change, Enter to keep planning]: ")
+	if err != nil {
+		return ""
+	}
+	answer = strings.TrimSpace(answer)
+	switch strings.ToLower(answer) {
+	case "":
+		return ""
+	case "y", "yes":
+		if _, err := rc.agent.ApprovePlan(); err != nil {
+			fmt.Printf("Approval failed: %v\n", err)
+			return ""
+		}
+		fmt.Println("✅ Plan approved. " + planModeStatus(false))
+		return "Implement the approved plan."
+	}
+	return answer
+}
@@ -0,0 +1,255 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/session"
+	"github.com/this-is-alpha-iota/clyde/cli/loglevel"
+	"github.com/this-is-alpha-iota/clyde/cli/spinner"
+	"github.com/this-is-alpha-iota/clyde/cli/style"
+	"github.com/this-is-alpha-iota/clyde/cli/truncate"
+)
+
+// recordEvents persists the agent's events to sess, in full regardless of
+// the log level: messages, thinking, tool calls and results, diagnostics,
+// compaction, and the error a turn ended with. Sub-agents' events are
+// skipped; their conversations are saved by taskSession.
+func recordEvents(sess *session.Session) agent.EventHandler {
+	return func(e agent.Event) {
+		if sess == nil || e.Meta().TaskID != "" {
+			return
+		}
+		switch e := e.(type) {
+		case agent.UserMessageEvent:
+			sess.WriteMessage(session.TypeUser, "**You:**\n\n"+e.Text+"\n")
+		case agent.AssistantMessageEvent:
+			sess.WriteMessage(session.TypeAssistant, "**Claude:**\n\n"+e.Text+"\n")
+		case agent.ThinkingDeltaEvent:
+			sess.WriteMessage(session.TypeThinking, formatThinkingForSession(e.Text, e.Signature))
+		case agent.ToolCallEvent:
+			// Enriched tool-use metadata for session reconstruction
+			msgWithID := session.FormatToolUseID(e.Display, e.ToolUseID)
+			inputJSON, _ := json.Marshal(e.Input)
+			sess.WriteMessage(session.TypeToolUse, fmt.Sprintf("%s\nname: %s\ninput: %s\n",
+				session.StripANSI(msgWithID), e.Name, string(inputJSON)))
+		case agent.ToolResultEvent:
+			// Full (untruncated) tool output with tool_use_id
+			if e.Output != "" && !e.Image {
+				sess.WriteMessage(session.TypeToolResult, fmt.Sprintf("[%s]\n```\n%s\n```\n", e.ToolUseID, e.Output))
+			}
+		case agent.DiagnosticEvent:
+			sess.WriteMessage(session.TypeDiagnostic, e.Message+"\n")
+		case agent.CompactionEvent:
+			if e.Message != "" {
+				sess.WriteMessage(session.TypeCompaction, e.Message+"\n")
+			}
+			if e.Summary != "" {
+				sess.WriteMessage(session.TypeSystem, "**System:**\n\n"+e.Summary+"\n")
+			}
+		case agent.TurnEndEvent:
+			if e.Err != nil {
+				sess.WriteMessage(session.TypeDiagnostic, fmt.Sprintf("❌ Error: %v\n", e.Err))
+			}
+		}
+	}
+}
+
+// logEvents shows the agent's events on stderr in CLI mode, filtered by
+// level, keeping stdout for the response.
+func logEvents(level loglevel.Level) agent.EventHandler {
+	return func(e agent.Event) {
+		switch e := e.(type) {
+		case agent.ToolCallEvent:
+			// Progress lines, sub-agents' included
+			if e.Display != "" && level.ShouldShow(loglevel.Quiet) {
+				fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Quiet, session.FormatToolUseID(e.Display, e.ToolUseID)))
+			}
+			if e.TaskID == "" {
+				// At debug level, emit metadata to match session file contents
+				inputJSON, _ := json.Marshal(e.Input)
+				emitDebugMetadata(os.Stderr, level,
+					"name: "+e.Name,
+					"input: "+string(inputJSON))
+			}
+		case agent.ToolResultEvent:
+			if e.TaskID != "" || e.Output == "" || e.Image {
+				return
+			}
+			// At debug level, emit tool_use_id to match session file contents
+			emitDebugMetadata(os.Stderr, level, "["+e.ToolUseID+"]")
+			if level.ShouldShow(loglevel.Normal) {
+				displayed := truncateForLevel(e.Output, truncate.ToolOutputLineLimit, level)
+				fmt.Fprintln(os.Stderr)
+				fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Normal, displayed))
+				fmt.Fprintln(os.Stderr)
+			}
+		case agent.ThinkingDeltaEvent:
+			if e.TaskID != "" {
+				return
+			}
+			if level.ShouldShow(loglevel.Normal) {
+				displayed := truncateForLevel(e.Text, truncate.ThinkingLineLimit, level)
+				fmt.Fprintln(os.Stderr, style.FormatThinking(displayed))
+			}
+			// At debug level, emit signature to match session file contents
+			emitDebugMetadata(os.Stderr, level, "signature: "+e.Signature)
+		case agent.DiagnosticEvent:
+			if e.TaskID != "" {
+				return
+			}
+			msg := e.Message
+			if strings.HasPrefix(msg, "💾 Cache:") && !strings.Contains(msg, "|") {
+				// Verbose cache format
+				if level.ShouldShow(loglevel.Verbose) {
+					fmt.Fprintln(os.Stderr, msg)
+				}
+			} else if strings.HasPrefix(msg, "💾 Cache:") && strings.Contains(msg, "|") {
+				// Debug cache format
+				if level.ShouldShow(loglevel.Debug) {
+					fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Debug, msg))
+				}
+			} else if strings.HasPrefix(msg, "🪝") {
+				// Hook runs
+				if level.ShouldShow(loglevel.Verbose) {
+					fmt.Fprintln(os.Stderr, msg)
+				}
+			} else if strings.HasPrefix(msg, "🔍") || strings.HasPrefix(msg, "🔒") {
+				// Token diagnostics and redacted thinking
+				if level.ShouldShow(loglevel.Debug) {
+					fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Debug, msg))
+				}
+			}
+		case agent.CompactionEvent:
+			if e.TaskID == "" && e.Message != "" && level.ShouldShow(loglevel.Quiet) {
+				fmt.Fprintln(os.Stderr, StyleMessage(loglevel.Quiet, e.Message))
+			}
+		case agent.ErrorEvent:
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", e.Err)
+		}
+	}
+}
+
+// replDisplay shows the agent's events in the REPL, filtered by level: a
+// spinner while waiting for the API, tool progress lines, tool output,
+// thinking and diagnostics.
+type replDisplay struct {
+	level loglevel.Level
+	sp    *spinner.Spinner
+	// lastProgress is the most recent tool → progress line. It is shown on
+	// the spinner while the tool runs, then printed as a permanent line.
+	lastProgress string
+}
+
+// flush stops the spinner and prints the pending progress line, before
+// anything else is printed.
+func (d *replDisplay) flush() {
+	if d.sp.IsActive() {
+		d.sp.Stop()
+	}
+	if d.lastProgress != "" {
+		fmt.Println(StyleMessage(loglevel.Quiet, d.lastProgress))
+		d.lastProgress = ""
+	}
+}
+
+// show is the agent event handler.
+func (d *replDisplay) show(e agent.Event) {
+	level := d.level
+	switch e := e.(type) {
+	case agent.APIRequestEvent:
+		if level != loglevel.Silent {
+			d.sp.Start("Thinking...")
+		}
+	case agent.UsageEvent, agent.TurnEndEvent:
+		if d.sp.IsActive() {
+			d.sp.Stop()
+		}
+	case agent.ThinkingDeltaEvent:
+		if e.TaskID != "" || !level.ShouldShow(loglevel.Normal) {
+			return
+		}
+		d.flush()
+		displayed := truncateForLevel(e.Text, truncate.ThinkingLineLimit, level)
+		fmt.Println(style.FormatThinking(displayed))
+		// At debug level, emit signature to match session file contents
+		emitDebugMetadata(os.Stdout, level, "signature: "+e.Signature)
+	case agent.ToolCallEvent:
+		// Tool progress line (→ Reading file: main.go [toolu_abc123]),
+		// sub-agents' included. If there's a pending progress line from a
+		// previous tool, flush it now before updating.
+		if e.Display != "" && level.ShouldShow(loglevel.Quiet) {
+			if d.lastProgress != "" {
+				d.flush()
+			}
+			d.lastProgress = session.FormatToolUseID(e.Display, e.ToolUseID)
+			if level != loglevel.Silent {
+				d.sp.Start(spinner.FormatSpinnerMessage(d.lastProgress))
+			}
+		}
+		if e.TaskID == "" {
+			// At debug level, emit metadata to match session file contents
+			inputJSON, _ := json.Marshal(e.Input)
+			emitDebugMetadata(os.Stdout, level,
+				"name: "+e.Name,
+				"input: "+string(inputJSON))
+		}
+	case agent.ToolResultEvent:
+		if e.TaskID != "" || e.Output == "" || e.Image || !level.ShouldShow(loglevel.Normal) {
+			return
+		}
+		// Tool execution is complete: print the permanent progress line,
+		// then the output body with blank line separation above and below.
+		d.flush()
+		// At debug level, emit tool_use_id to match session file contents
+		emitDebugMetadata(os.Stdout, level, "["+e.ToolUseID+"]")
+		displayed := truncateForLevel(e.Output, truncate.ToolOutputLineLimit, level)
+		fmt.Println()
+		fmt.Println(StyleMessage(loglevel.Normal, displayed))
+		fmt.Println()
+	case agent.DiagnosticEvent:
+		if e.TaskID != "" {
+			return
+		}
+		msg := e.Message
+		if strings.HasPrefix(msg, "💾 Cache:") && !strings.Contains(msg, "|") {
+			// Verbose cache format
+			if !level.ShouldShow(loglevel.Verbose) {
+				return
+			}
+		} else if strings.HasPrefix(msg, "💾 Cache:") && strings.Contains(msg, "|") {
+			// Debug cache format
+			if !level.ShouldShow(loglevel.Debug) {
+				return
+			}
+		} else if strings.HasPrefix(msg, "🪝") {
+			// Hook runs
+			if !level.ShouldShow(loglevel.Verbose) {
+				return
+			}
+		} else {
+			// Token diagnostics, redacted thinking
+			if !level.ShouldShow(loglevel.Debug) {
+				return
+			}
+		}
+		// Stop spinner if active, print directly
+		if d.sp.IsActive() {
+			d.flush()
+		}
+		fmt.Println(StyleMessage(loglevel.Debug, msg))
+	case agent.CompactionEvent:
+		if e.TaskID != "" || e.Message == "" {
+			return
+		}
+		d.flush()
+		if level.ShouldShow(loglevel.Quiet) {
+			fmt.Println(StyleMessage(loglevel.Quiet, e.Message))
+		}
+	case agent.ErrorEvent:
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", e.Err)
+	}
+}
@@ -10,6 +10,7 @@
 //   - Up/down navigation between lines in multiline mode
 //   - No artificial length limit
 //   - Dynamic prompt updates (git branch, context %, You: label)
+//   - Typeahead: lines typed while the agent works, read without echo
 //
 // The package is used in REPL mode only. CLI mode reads from args/stdin
 // and does not use this package.
@@ -43,7 +44,8 @@ type Reader struct {
 	activeIdx  int          // which line the cursor is on (may be len(lines) = virtual new line)
 	multiline  bool         // true once Ctrl+J / backslash continuation enters multiline mode
 
-	browsingHistory bool // true while up/down is cycling through history
+	browsingHistory bool   // true while up/down is cycling through history
+	prefill         string // text the next ReadLine starts with (see Prefill)
 	history         *history
 
 	// Terminal state (only set when stdin is a real terminal)
@@ -138,6 +140,10 @@ func (r *Reader) ReadLine() (string, error) {
 	r.multiline = false
 	r.browsingHistory = false
 	r.lines = []lineBuffer{{}}
+	if r.prefill != "" {
+		r.lines[0].set(r.prefill)
+		r.prefill = ""
+	}
 	r.activeIdx = 0
 	r.cursorRow = 0
 	r.history.Reset()
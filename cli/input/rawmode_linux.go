@@ -37,3 +37,25 @@ func setupRawMode(fd int) (restore func(), width int, err error) {
 
 	return func() { unix.IoctlSetTermios(fd, unix.TCSETS, orig) }, w, nil
 }
+
+// setupTypeaheadMode turns off echo and line buffering so keys typed while
+// the agent works can be read as they come, but keeps signals (Ctrl+C still
+// interrupts) and CR-NL translation of output. Reads return after 100ms
+// without input, so the reader can be stopped.
+func setupTypeaheadMode(fd int) (restore func(), err error) {
+	orig, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return nil, err
+	}
+
+	ta := *orig
+	ta.Iflag &^= unix.ICRNL | unix.INLCR | unix.IGNCR
+	ta.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.IEXTEN
+	ta.Cc[unix.VMIN] = 0
+	ta.Cc[unix.VTIME] = 1
+
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, &ta); err != nil {
+		return nil, err
+	}
+	return func() { unix.IoctlSetTermios(fd, unix.TCSETS, orig) }, nil
+}
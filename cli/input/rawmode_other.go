@@ -11,3 +11,8 @@ func isTerminal(fd int) bool { return false }
 func setupRawMode(fd int) (func(), int, error) {
 	return nil, 80, fmt.Errorf("raw terminal mode not supported on this platform")
 }
+
+// setupTypeaheadMode is a stub for unsupported platforms.
+func setupTypeaheadMode(fd int) (func(), error) {
+	return nil, fmt.Errorf("raw terminal mode not supported on this platform")
+}
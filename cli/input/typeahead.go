@@ -0,0 +1,115 @@
+package input
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Typeahead reads what the user types while the agent is working, so it
+// can be queued for the agent. Keys are read without echo; the line being
+// typed is reported to onChange (e.g. for the spinner line) and each line
+// submitted with Enter to onLine. Only typing, Backspace and Ctrl+U are
+// supported. Ctrl+C still interrupts.
+//
+// A Typeahead must be stopped before the next ReadLine.
+type Typeahead struct {
+	line     lineBuffer
+	onChange func(partial string)
+	onLine   func(line string)
+	stop     chan struct{}
+	done     chan struct{}
+	restore  func()
+}
+
+// StartTypeahead starts reading keys in the background, with initial as
+// the text already typed (e.g. what a previous Typeahead returned when it
+// was stopped for a prompt).
+func (r *Reader) StartTypeahead(initial string, onChange func(partial string), onLine func(line string)) (*Typeahead, error) {
+	t := &Typeahead{
+		onChange: onChange,
+		onLine:   onLine,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	t.line.set(initial)
+	if r.isTTY {
+		restore, err := setupTypeaheadMode(r.fd)
+		if err != nil {
+			return nil, fmt.Errorf("input: %w", err)
+		}
+		t.restore = restore
+	}
+	go t.run(r.stdin, r.isTTY)
+	return t, nil
+}
+
+// Stop stops reading, restores the terminal and returns the text typed but
+// not submitted.
+func (t *Typeahead) Stop() string {
+	close(t.stop)
+	<-t.done
+	if t.restore != nil {
+		t.restore()
+	}
+	return t.line.String()
+}
+
+// run reads input until Stop. On a terminal, reads time out regularly
+// (reported as io.EOF) to check for Stop; elsewhere EOF ends the input.
+func (t *Typeahead) run(stdin io.Reader, tty bool) {
+	defer close(t.done)
+	buf := make([]byte, 256)
+	for {
+		select {
+		case <-t.stop:
+			return
+		default:
+		}
+		n, err := stdin.Read(buf)
+		if n > 0 {
+			t.handle(buf[:n])
+		}
+		if err != nil && !(tty && err == io.EOF) {
+			return
+		}
+	}
+}
+
+// handle applies the keys in data to the line being typed.
+func (t *Typeahead) handle(data []byte) {
+	keys := bytes.NewReader(data)
+	for keys.Len() > 0 {
+		k, err := readKey(keys)
+		if err != nil {
+			return
+		}
+		switch k.special {
+		case keyEnter, keyCtrlJ:
+			text := strings.TrimSpace(t.line.String())
+			t.line.clear()
+			if text != "" && t.onLine != nil {
+				t.onLine(text)
+			}
+		case keyBackspace:
+			t.line.backspace()
+		case keyCtrlU:
+			t.line.clear()
+		default:
+			if k.r == 0 {
+				continue // cursor movement and other keys are not supported
+			}
+			t.line.insert(k.r)
+		}
+		if t.onChange != nil {
+			t.onChange(t.line.String())
+		}
+	}
+}
+
+// Prefill sets the text the next ReadLine starts with, e.g. what the user
+// typed but did not submit during a Typeahead.
+func (r *Reader) Prefill(text string) {
+	r.prefill = text
+}
@@ -9,7 +9,10 @@
 //   - Debug:   Additional harness diagnostics (token counts, latency, etc.).
 package loglevel
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Level represents a verbosity level for Clyde's output.
 type Level int
@@ -57,9 +60,12 @@ func (l Level) ShouldShow(threshold Level) bool {
 type FlagResult struct {
 	Level        Level
 	NoThink      bool     // true if --no-think was passed
+	Plan         bool     // true if --plan was passed
 	Resume       bool     // true if --resume or -r was passed
 	ResumeTarget string   // session ID if --resume <id> was passed
 	Sessions     bool     // true if --sessions was passed
+	OutputFormat string   // value of --output-format ("" if not passed)
+	InputFormat  string   // value of --input-format ("" if not passed)
 	Args         []string // remaining args after flag stripping
 }
 
@@ -74,6 +80,9 @@ type FlagResult struct {
 //   -v, --verbose   → Verbose
 //   --debug         → Debug
 //   --no-think      → Disable thinking (orthogonal to log level)
+//   --plan          → Start in plan mode (orthogonal to log level)
+//   --output-format → CLI mode output: text, json or stream-json (next arg, or --output-format=json)
+//   --input-format  → CLI mode input: text or stream-json (same forms)
 //
 // If multiple verbosity flags are provided, the last one wins.
 func ParseFlags(args []string) (Level, []string) {
@@ -100,8 +109,22 @@ func ParseFlagsExt(args []string) FlagResult {
 			result.Level = Debug
 		case "--no-think":
 			result.NoThink = true
+		case "--plan":
+			result.Plan = true
 		case "--sessions":
 			result.Sessions = true
+		case "--output-format", "--input-format":
+			// The format is the next arg
+			value := ""
+			if i+1 < len(args) {
+				value = args[i+1]
+				i++
+			}
+			if arg == "--output-format" {
+				result.OutputFormat = value
+			} else {
+				result.InputFormat = value
+			}
 		case "--resume", "-r":
 			result.Resume = true
 			// Peek at next arg for optional session ID
@@ -110,7 +133,13 @@ func ParseFlagsExt(args []string) FlagResult {
 				i++ // consume the next arg
 			}
 		default:
-			result.Args = append(result.Args, arg)
+			if value, ok := strings.CutPrefix(arg, "--output-format="); ok {
+				result.OutputFormat = value
+			} else if value, ok := strings.CutPrefix(arg, "--input-format="); ok {
+				result.InputFormat = value
+			} else {
+				result.Args = append(result.Args, arg)
+			}
 		}
 	}
 
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+)
+
+// Output formats for CLI mode (--output-format).
+const (
+	outputText       = "text"        // The response on stdout (default)
+	outputJSON       = "json"        // One cliResult object when done
+	outputStreamJSON = "stream-json" // A streamEvent line per event, and a cliResult line per turn
+)
+
+// Input formats for CLI mode (--input-format).
+const (
+	inputText       = "text"        // The prompt from args, -f or stdin (default)
+	inputStreamJSON = "stream-json" // One {"type":"user","text":"..."} message per stdin line
+)
+
+// modelPrice is what a model costs, in USD per million tokens. Cache writes
+// cost 1.25× the input price and cache reads 0.1×.
+type modelPrice struct {
+	prefix        string
+	input, output float64
+}
+
+// modelPrices are matched by model ID prefix, in order, so more specific
+// prefixes come first.
+var modelPrices = []modelPrice{
+	{"claude-opus-4-6", 5, 25},
+	{"claude-opus-4-5", 5, 25},
+	{"claude-opus-4", 15, 75},
+	{"claude-sonnet-4", 3, 15},
+	{"claude-3-7-sonnet", 3, 15},
+	{"claude-haiku-4-5", 1, 5},
+	{"claude-3-5-haiku", 0.8, 4},
+}
+
+// usageCost returns the cost of usage on model in USD, and false if the
+// model's price is unknown.
+func usageCost(model string, usage agent.Usage) (float64, bool) {
+	for _, p := range modelPrices {
+		if strings.HasPrefix(model, p.prefix) {
+			tokens := float64(usage.InputTokens)*p.input +
+				float64(usage.CacheCreationInputTokens)*p.input*1.25 +
+				float64(usage.CacheReadInputTokens)*p.input*0.1 +
+				float64(usage.OutputTokens)*p.output
+			return tokens / 1e6, true
+		}
+	}
+	return 0, false
+}
+
+// cliResult is the outcome of CLI mode in the json output format, and of
+// each turn in stream-json. Usage and cost add up every API call so far,
+// sub-agents' included.
+type cliResult struct {
+	Type       string      `json:"type"` // "result"
+	Result     string      `json:"result"`
+	StopReason string      `json:"stop_reason"`
+	IsError    bool        `json:"is_error"`
+	Error      string      `json:"error,omitempty"`
+	Plan       string      `json:"plan,omitempty"` // Plan submitted in plan mode, as Markdown
+	NumTurns   int         `json:"num_turns"`      // Messages handled
+	Usage      agent.Usage `json:"usage"`
+	CostUSD    *float64    `json:"cost_usd"` // null if a model's price is unknown
+	SessionDir string      `json:"session_dir,omitempty"`
+}
+
+// streamEvent is an agent event as a stream-json line. Type is the event
+// kind in snake case ("tool_call", "turn_end", ...); the other fields are
+// those of the event, omitted when empty.
+type streamEvent struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Time       time.Time              `json:"time"`
+	Turn       int                    `json:"turn"`
+	TaskID     string                 `json:"task_id,omitempty"`
+	Text       string                 `json:"text,omitempty"`
+	Signature  string                 `json:"signature,omitempty"`
+	Model      string                 `json:"model,omitempty"`
+	Messages   int                    `json:"messages,omitempty"`
+	Usage      *agent.Usage           `json:"usage,omitempty"`
+	ToolUseID  string                 `json:"tool_use_id,omitempty"`
+	Name       string                 `json:"name,omitempty"`
+	Input      map[string]interface{} `json:"input,omitempty"`
+	Display    string                 `json:"display,omitempty"`
+	Output     string                 `json:"output,omitempty"`
+	IsError    bool                   `json:"is_error,omitempty"`
+	Image      bool                   `json:"image,omitempty"`
+	Summary    string                 `json:"summary,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	StopReason string                 `json:"stop_reason,omitempty"`
+}
+
+// newStreamEvent converts an agent event.
+func newStreamEvent(e agent.Event) streamEvent {
+	m := e.Meta()
+	s := streamEvent{ID: m.ID, Time: m.Time, Turn: m.Turn, TaskID: m.TaskID}
+	switch e := e.(type) {
+	case agent.TurnStartEvent:
+		s.Type, s.Text = "turn_start", e.Message
+	case agent.APIRequestEvent:
+		s.Type, s.Model, s.Messages = "api_request", e.Model, e.Messages
+	case agent.UsageEvent:
+		usage := e.Usage
+		s.Type, s.Model, s.Usage = "usage", e.Model, &usage
+	case agent.ThinkingDeltaEvent:
+		s.Type, s.Text, s.Signature = "thinking", e.Text, e.Signature
+	case agent.TextDeltaEvent:
+		s.Type, s.Text = "text", e.Text
+	case agent.ToolCallEvent:
+		s.Type, s.ToolUseID, s.Name, s.Input, s.Display = "tool_call", e.ToolUseID, e.Name, e.Input, e.Display
+	case agent.ToolResultEvent:
+		s.Type, s.ToolUseID, s.Output, s.IsError, s.Image = "tool_result", e.ToolUseID, e.Output, e.IsError, e.Image
+	case agent.CompactionEvent:
+		s.Type, s.Text, s.Summary = "compaction", e.Message, e.Summary
+	case agent.ErrorEvent:
+		s.Type, s.Error = "error", e.Err.Error()
+	case agent.TurnEndEvent:
+		s.Type, s.Text, s.StopReason = "turn_end", e.Response, e.StopReason
+		if e.Err != nil {
+			s.Error = e.Err.Error()
+		}
+	case agent.UserMessageEvent:
+		s.Type, s.Text = "user", e.Text
+	case agent.AssistantMessageEvent:
+		s.Type, s.Text = "assistant", e.Text
+	case agent.DiagnosticEvent:
+		s.Type, s.Text = "diagnostic", e.Message
+	}
+	return s
+}
+
+// cliOutput writes CLI mode's results in an output format. Its handle
+// method is an agent event handler that adds up usage and cost, and in
+// stream-json writes each event.
+type cliOutput struct {
+	format     string
+	enc        *json.Encoder
+	usage      agent.Usage
+	cost       float64
+	costKnown  bool
+	stopReason string
+	turns      int
+}
+
+// newCLIOutput returns the output for format, written to w.
+func newCLIOutput(format string, w io.Writer) *cliOutput {
+	return &cliOutput{format: format, enc: json.NewEncoder(w), costKnown: true}
+}
+
+// handle is the agent event handler.
+func (o *cliOutput) handle(e agent.Event) {
+	switch e := e.(type) {
+	case agent.UsageEvent:
+		o.usage.InputTokens += e.Usage.InputTokens
+		o.usage.OutputTokens += e.Usage.OutputTokens
+		o.usage.CacheCreationInputTokens += e.Usage.CacheCreationInputTokens
+		o.usage.CacheReadInputTokens += e.Usage.CacheReadInputTokens
+		cost, ok := usageCost(e.Model, e.Usage)
+		o.cost += cost
+		o.costKnown = o.costKnown && ok
+	case agent.TurnEndEvent:
+		if e.TaskID == "" {
+			o.stopReason = e.StopReason
+			o.turns++
+		}
+	}
+	if o.format == outputStreamJSON {
+		o.enc.Encode(newStreamEvent(e))
+	}
+}
+
+// result builds the result of the turns so far, the last of which returned
+// response and err.
+func (o *cliOutput) result(response string, err error, plan, sessionDir string) cliResult {
+	r := cliResult{
+		Type:       "result",
+		Result:     response,
+		StopReason: o.stopReason,
+		Plan:       plan,
+		NumTurns:   o.turns,
+		Usage:      o.usage,
+		SessionDir: sessionDir,
+	}
+	if err != nil {
+		r.IsError = true
+		r.Error = err.Error()
+		r.Result = ""
+	}
+	if o.costKnown {
+		cost := o.cost
+		r.CostUSD = &cost
+	}
+	return r
+}
+
+// writeResult writes a result line (json and stream-json).
+func (o *cliOutput) writeResult(r cliResult) {
+	o.enc.Encode(r)
+}
+
+// streamInput reads stream-json input: one user message per line, as
+// {"type":"user","text":"..."}, the shape of "user" events in the
+// stream-json output. Blank lines are skipped.
+type streamInput struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// newStreamInput reads messages from r.
+func newStreamInput(r io.Reader) *streamInput {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &streamInput{scanner: scanner}
+}
+
+// next returns the next message, or io.EOF at the end of the input.
+func (in *streamInput) next() (string, error) {
+	for in.scanner.Scan() {
+		in.line++
+		line := strings.TrimSpace(in.scanner.Text())
+		if line == "" {
+			continue
+		}
+		var msg struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			return "", fmt.Errorf("input line %d: %w", in.line, err)
+		}
+		if msg.Type != "user" || strings.TrimSpace(msg.Text) == "" {
+			return "", fmt.Errorf(`input line %d: want {"type":"user","text":"..."}`, in.line)
+		}
+		return msg.Text, nil
+	}
+	if err := in.scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", io.EOF
+}
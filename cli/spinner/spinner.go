@@ -34,6 +34,7 @@ const FramesPerSymbol = 2
 type Spinner struct {
 	mu      sync.Mutex
 	message string // Current operation text (e.g., "Patching file: agent.go...")
+	status  string // Shown after the message, across Start/Stop (e.g. the message queue)
 	active  bool   // Whether the spinner is currently running
 	stopCh  chan struct{}
 	doneCh  chan struct{}
@@ -111,6 +112,22 @@ func (s *Spinner) Message() string {
 	return s.message
 }
 
+// SetStatus sets text shown after the message on every frame, such as the
+// messages the user queued while the agent works. It is kept when the
+// spinner stops and restarts; "" removes it.
+func (s *Spinner) SetStatus(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Status returns the text shown after the message.
+func (s *Spinner) Status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
 // Frame returns the current symbol index (for testing).
 func (s *Spinner) Frame() int {
 	s.mu.Lock()
@@ -135,6 +152,9 @@ func (s *Spinner) run() {
 			s.mu.Lock()
 			symbolIdx := (frameCount / FramesPerSymbol) % len(Frames)
 			msg := s.message
+			if s.status != "" {
+				msg += "  " + s.status
+			}
 			s.frame = symbolIdx
 			s.mu.Unlock()
 
@@ -223,5 +243,9 @@ var spinnerVerbs = map[string]string{
 	"Listing files":        "Listing...",
 	"Finding files":        "Finding...",
 	"Applying multi-patch": "Patching...",
+	"Applying patch":       "Patching...",
 	"Including file":       "Loading...",
+	"LSP":                  "Analyzing...",
+	"Mapping repository":   "Mapping...",
+	"Running tests":        "Testing...",
 }
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/cli/input"
+	"github.com/this-is-alpha-iota/clyde/cli/spinner"
+	"github.com/this-is-alpha-iota/clyde/cli/style"
+)
+
+// steeringPreviewLen is how much of the line being typed the spinner shows.
+const steeringPreviewLen = 30
+
+// steering reads the messages the user types while a turn runs and queues
+// them for the agent (see agent.Queue), showing the queue and the line being
+// typed after the spinner message. Like permissionPrompt, it is created
+// before the agent and the input reader, which are filled in later; until
+// then start does nothing.
+type steering struct {
+	sp     *spinner.Spinner
+	reader *input.Reader
+	agent  *agent.Agent
+
+	mu      sync.Mutex
+	ta      *input.Typeahead
+	running bool   // a turn is in progress
+	partial string // typed but not submitted
+	queued  int    // messages waiting for delivery
+}
+
+// start begins reading input for a turn.
+func (s *steering) start() {
+	if s.reader == nil || s.agent == nil {
+		return
+	}
+	s.mu.Lock()
+	s.running = true
+	s.mu.Unlock()
+	s.resume()
+}
+
+// finish stops reading at the end of a turn. Text typed but not submitted
+// becomes the start of the next prompt.
+func (s *steering) finish() {
+	s.pause()
+	s.mu.Lock()
+	s.running = false
+	partial := s.partial
+	s.partial = ""
+	s.queued = 0
+	s.mu.Unlock()
+	if s.reader != nil {
+		s.reader.Prefill(partial)
+	}
+	s.sp.SetStatus("")
+}
+
+// pause stops reading while a prompt (permission, ask_user) uses the input
+// reader.
+func (s *steering) pause() {
+	s.mu.Lock()
+	ta := s.ta
+	s.ta = nil
+	s.mu.Unlock()
+	if ta == nil {
+		return
+	}
+	partial := ta.Stop()
+	s.mu.Lock()
+	s.partial = partial
+	s.mu.Unlock()
+}
+
+// resume reads input again after pause, during a turn.
+func (s *steering) resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running || s.ta != nil {
+		return
+	}
+	ta, err := s.reader.StartTypeahead(s.partial, s.typing, s.agent.Queue)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: messages typed during this turn cannot be queued: %v\n", err)
+		return
+	}
+	s.ta = ta
+}
+
+// typing shows the line being typed.
+func (s *steering) typing(partial string) {
+	s.mu.Lock()
+	s.partial = partial
+	s.mu.Unlock()
+	s.updateStatus()
+}
+
+// queueChanged records how many messages wait for delivery. Used from the
+// agent's queue callback.
+func (s *steering) queueChanged(queued []string) {
+	s.mu.Lock()
+	s.queued = len(queued)
+	s.mu.Unlock()
+	s.updateStatus()
+}
+
+// updateStatus shows the queue and the line being typed on the spinner.
+func (s *steering) updateStatus() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var parts []string
+	if s.queued > 0 {
+		parts = append(parts, fmt.Sprintf("[%d queued]", s.queued))
+	}
+	if s.partial != "" {
+		preview := []rune(s.partial)
+		if len(preview) > steeringPreviewLen {
+			preview = append([]rune("…"), preview[len(preview)-steeringPreviewLen:]...)
+		}
+		parts = append(parts, "✎ "+string(preview))
+	}
+	if len(parts) == 0 {
+		s.sp.SetStatus("")
+		return
+	}
+	s.sp.SetStatus(style.FormatDim(strings.Join(parts, " ")))
+}
+
+// formatDelivered renders the queued messages sent to the agent with tool
+// results, for the scrollback.
+func formatDelivered(delivered []string) string {
+	lines := make([]string, len(delivered))
+	for i, text := range delivered {
+		lines[i] = style.FormatDim("↪ Sent while working: ") + text
+	}
+	return strings.Join(lines, "\n")
+}
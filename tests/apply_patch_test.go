@@ -0,0 +1,342 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent/config"
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+func TestApplyPatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldDir, _ := os.Getwd()
+	defer os.Chdir(oldDir)
+	os.Chdir(tmpDir)
+
+	t.Run("Begin Patch add, update, delete and move", func(t *testing.T) {
+		os.WriteFile("main.go", []byte("package main\n\nfunc main() {\n\tprintln(\"old\")\n}\n"), 0644)
+		os.WriteFile("gone.txt", []byte("bye\n"), 0644)
+		os.WriteFile("util.go", []byte("package main\n\nfunc helper() {}\n"), 0644)
+
+		patch := strings.Join([]string{
+			"*** Begin Patch",
+			"*** Add File: docs/new.md",
+			"+# New",
+			"+text",
+			"*** Update File: main.go",
+			"@@ func main() {",
+			"-\tprintln(\"old\")",
+			"+\tprintln(\"new\")",
+			"*** Delete File: gone.txt",
+			"*** Update File: util.go",
+			"*** Move to: helpers.go",
+			"@@",
+			"-func helper() {}",
+			"+func helper() { return }",
+			"*** End Patch",
+		}, "\n")
+
+		result, err := executeApplyPatch(patch, 2)
+		if err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if !strings.Contains(result, "Successfully applied patch: 4 file operations") {
+			t.Errorf("Expected success message, got: %s", result)
+		}
+
+		if got, _ := os.ReadFile("docs/new.md"); string(got) != "# New\ntext\n" {
+			t.Errorf("docs/new.md = %q", got)
+		}
+		if got, _ := os.ReadFile("main.go"); !strings.Contains(string(got), "println(\"new\")") {
+			t.Errorf("main.go not updated: %q", got)
+		}
+		if _, err := os.Stat("gone.txt"); !os.IsNotExist(err) {
+			t.Error("gone.txt should be deleted")
+		}
+		if _, err := os.Stat("util.go"); !os.IsNotExist(err) {
+			t.Error("util.go should be moved away")
+		}
+		if got, _ := os.ReadFile("helpers.go"); string(got) != "package main\n\nfunc helper() { return }\n" {
+			t.Errorf("helpers.go = %q", got)
+		}
+	})
+
+	t.Run("Unified diff with multiple hunks", func(t *testing.T) {
+		var lines []string
+		for i := 1; i <= 30; i++ {
+			lines = append(lines, "line "+strings.Repeat("x", i%3)+string(rune('a'+i%26)))
+		}
+		lines[4] = "five"
+		lines[24] = "twenty-five"
+		os.WriteFile("long.txt", []byte(strings.Join(lines, "\n")+"\n"), 0644)
+
+		patch := strings.Join([]string{
+			"diff --git a/long.txt b/long.txt",
+			"index 1111111..2222222 100644",
+			"--- a/long.txt",
+			"+++ b/long.txt",
+			"@@ -4,3 +4,3 @@",
+			" " + lines[3],
+			"-five",
+			"+FIVE",
+			" " + lines[5],
+			"@@ -24,3 +24,4 @@",
+			" " + lines[23],
+			"-twenty-five",
+			"+TWENTY-FIVE",
+			"+inserted",
+			" " + lines[25],
+		}, "\n")
+
+		if _, err := executeApplyPatch(patch, 0); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		got, _ := os.ReadFile("long.txt")
+		if !strings.Contains(string(got), "\nFIVE\n") || !strings.Contains(string(got), "\nTWENTY-FIVE\ninserted\n") {
+			t.Errorf("long.txt not patched: %s", got)
+		}
+	})
+
+	t.Run("Fuzzy context tolerates indentation but reports it", func(t *testing.T) {
+		os.WriteFile("indent.go", []byte("func f() {\n\tif x {\n\t\treturn 1\n\t}\n}\n"), 0644)
+
+		// Context written with spaces instead of tabs.
+		patch := strings.Join([]string{
+			"--- indent.go",
+			"+++ indent.go",
+			"@@ -2,3 +2,3 @@",
+			"     if x {",
+			"-        return 1",
+			"+        return 2",
+			"     }",
+		}, "\n")
+
+		_, err := executeApplyPatch(patch, 0)
+		if err == nil {
+			t.Fatal("Expected exact matching to fail")
+		}
+		if !strings.Contains(err.Error(), "Nearest lines 2-4") {
+			t.Errorf("Expected nearest region in rejection, got: %v", err)
+		}
+
+		result, err := executeApplyPatch(patch, 2)
+		if err != nil {
+			t.Fatalf("Expected fuzzy match to succeed, got: %v", err)
+		}
+		if !strings.Contains(result, "fuzz level 2") {
+			t.Errorf("Expected a note about the fuzz level used, got: %s", result)
+		}
+		// Context lines keep the file's own indentation.
+		got, _ := os.ReadFile("indent.go")
+		if string(got) != "func f() {\n\tif x {\n        return 2\n\t}\n}\n" {
+			t.Errorf("indent.go = %q", got)
+		}
+	})
+
+	t.Run("Configured fuzz level applies when the call gives none", func(t *testing.T) {
+		os.WriteFile("indent2.go", []byte("func f() {\n\tif x {\n\t\treturn 1\n\t}\n}\n"), 0644)
+		patch := "--- indent2.go\n+++ indent2.go\n@@ -2,3 +2,3 @@\n     if x {\n-        return 1\n+        return 2\n     }"
+
+		tools.SetApplyPatchFuzz(0)
+		defer tools.SetApplyPatchFuzz(-1)
+		if _, err := executeToolWith("apply_patch", map[string]interface{}{"patch": patch}); err == nil {
+			t.Fatal("Expected exact matching to fail at the configured level 0")
+		}
+
+		tools.SetApplyPatchFuzz(-1)
+		if _, err := executeToolWith("apply_patch", map[string]interface{}{"patch": patch}); err != nil {
+			t.Fatalf("Expected the default level to match, got: %v", err)
+		}
+	})
+
+	t.Run("All or nothing with nearest region", func(t *testing.T) {
+		os.WriteFile("a.txt", []byte("alpha\nbeta\ngamma\n"), 0644)
+		os.WriteFile("b.txt", []byte("one\ntwo\nthree\nfour\n"), 0644)
+
+		patch := strings.Join([]string{
+			"*** Begin Patch",
+			"*** Update File: a.txt",
+			" alpha",
+			"-beta",
+			"+BETA",
+			"*** Update File: b.txt",
+			" two",
+			"-tree",
+			"+THREE",
+			"*** End Patch",
+		}, "\n")
+
+		_, err := executeApplyPatch(patch, 2)
+		if err == nil {
+			t.Fatal("Expected failure")
+		}
+		msg := err.Error()
+		for _, want := range []string{"FAILED", "No files were modified", "✓ Update a.txt", "❌ Update b.txt FAILED", "Nearest lines 2-3", "   3 | three"} {
+			if !strings.Contains(msg, want) {
+				t.Errorf("Expected %q in error, got: %s", want, msg)
+			}
+		}
+		if got, _ := os.ReadFile("a.txt"); string(got) != "alpha\nbeta\ngamma\n" {
+			t.Errorf("a.txt was modified: %q", got)
+		}
+	})
+
+	t.Run("Preserves CRLF line endings", func(t *testing.T) {
+		os.WriteFile("win.txt", []byte("one\r\ntwo\r\nthree\r\n"), 0644)
+		patch := "*** Begin Patch\n*** Update File: win.txt\n one\n-two\n+TWO\n*** End Patch"
+		if _, err := executeApplyPatch(patch, 2); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if got, _ := os.ReadFile("win.txt"); string(got) != "one\r\nTWO\r\nthree\r\n" {
+			t.Errorf("win.txt = %q", got)
+		}
+	})
+
+	t.Run("Refuses to add an existing file", func(t *testing.T) {
+		os.WriteFile("exists.txt", []byte("keep\n"), 0644)
+		patch := "--- /dev/null\n+++ b/exists.txt\n@@ -0,0 +1 @@\n+new\n"
+		_, err := executeApplyPatch(patch, 2)
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("Expected 'already exists' error, got: %v", err)
+		}
+		if got, _ := os.ReadFile(filepath.Join(tmpDir, "exists.txt")); string(got) != "keep\n" {
+			t.Errorf("exists.txt = %q", got)
+		}
+	})
+
+	t.Run("Updates to one file under different spellings apply in order", func(t *testing.T) {
+		os.WriteFile("twice.txt", []byte("one\ntwo\nthree\n"), 0644)
+		patch := strings.Join([]string{
+			"*** Begin Patch",
+			"*** Update File: twice.txt",
+			"-one",
+			"+ONE",
+			"*** Update File: ./twice.txt",
+			" ONE",
+			"-two",
+			"+TWO",
+			"*** End Patch",
+		}, "\n")
+		if _, err := executeApplyPatch(patch, 0); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if got, _ := os.ReadFile("twice.txt"); string(got) != "ONE\nTWO\nthree\n" {
+			t.Errorf("twice.txt = %q", got)
+		}
+	})
+
+	t.Run("Symlinked files are changed at their target", func(t *testing.T) {
+		os.WriteFile("real.txt", []byte("hello world\n"), 0644)
+		os.WriteFile("real-gone.txt", []byte("bye\n"), 0644)
+		os.Symlink("real.txt", "link.txt")
+		os.Symlink("real-gone.txt", "link-gone.txt")
+		isLink := func(path string) bool {
+			info, err := os.Lstat(path)
+			return err == nil && info.Mode()&os.ModeSymlink != 0
+		}
+
+		diff := strings.Join([]string{
+			"--- a/link.txt",
+			"+++ b/link.txt",
+			"@@ -1 +1 @@",
+			"-hello world",
+			"+hello there",
+		}, "\n")
+		if _, err := executeApplyPatch(diff, 0); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if got, _ := os.ReadFile("real.txt"); string(got) != "hello there\n" {
+			t.Errorf("real.txt = %q", got)
+		}
+		if !isLink("link.txt") {
+			t.Error("link.txt should still be a symlink")
+		}
+
+		patch := strings.Join([]string{
+			"*** Begin Patch",
+			"*** Delete File: link-gone.txt",
+			"*** Update File: link.txt",
+			"*** Move to: moved.txt",
+			"@@",
+			"-hello there",
+			"+moved",
+			"*** End Patch",
+		}, "\n")
+		if _, err := executeApplyPatch(patch, 0); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if _, err := os.Stat("real-gone.txt"); !os.IsNotExist(err) || !isLink("link-gone.txt") {
+			t.Error("deleting through a link should remove its target and keep the link")
+		}
+		if _, err := os.Stat("real.txt"); !os.IsNotExist(err) || !isLink("link.txt") {
+			t.Error("moving through a link should move its target and keep the link")
+		}
+		if got, _ := os.ReadFile("moved.txt"); string(got) != "moved\n" {
+			t.Errorf("moved.txt = %q", got)
+		}
+	})
+
+	t.Run("Rejects text that is not a patch", func(t *testing.T) {
+		_, err := executeApplyPatch("just some prose", 2)
+		if err == nil || !strings.Contains(err.Error(), "not a unified diff") {
+			t.Errorf("Expected format error, got: %v", err)
+		}
+	})
+}
+
+// TestApplyPatch_Config verifies APPLY_PATCH_FUZZ is parsed and validated.
+func TestApplyPatch_Config(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	subtests := []struct {
+		name     string
+		content  string
+		wantFuzz *int
+		wantErr  bool
+	}{
+		{
+			name:     "exact",
+			content:  "TS_AGENT_API_KEY=sk-test\nAPPLY_PATCH_FUZZ=0\n",
+			wantFuzz: new(int),
+		},
+		{
+			name:    "not_set_uses_default",
+			content: "TS_AGENT_API_KEY=sk-test\n",
+		},
+		{
+			name:    "out_of_range",
+			content: "TS_AGENT_API_KEY=sk-test\nAPPLY_PATCH_FUZZ=4\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range subtests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Unsetenv("APPLY_PATCH_FUZZ")
+			os.Unsetenv("TS_AGENT_API_KEY")
+			defer os.Unsetenv("APPLY_PATCH_FUZZ")
+			defer os.Unsetenv("TS_AGENT_API_KEY")
+
+			testConfigPath := filepath.Join(tmpDir, tc.name+"_config")
+			os.WriteFile(testConfigPath, []byte(tc.content), 0644)
+
+			cfg, err := config.LoadFromFile(testConfigPath)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (cfg.ApplyPatchFuzz == nil) != (tc.wantFuzz == nil) ||
+				(cfg.ApplyPatchFuzz != nil && *cfg.ApplyPatchFuzz != *tc.wantFuzz) {
+				t.Errorf("ApplyPatchFuzz = %v, want %v", cfg.ApplyPatchFuzz, tc.wantFuzz)
+			}
+		})
+	}
+}
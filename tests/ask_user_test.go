@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+// TestAskUser answers ask_user questions through the callback, and without
+// one as a non-interactive run would.
+func TestAskUser(t *testing.T) {
+	question := map[string]interface{}{
+		"question": "Which database should the cache use?",
+		"options":  []interface{}{"Redis", "  SQLite\n(local file)", "None"},
+	}
+
+	t.Run("The user picks an option or types an answer", func(t *testing.T) {
+		server := startScriptedServer(t,
+			toolCall("toolu_1", "ask_user", question),
+			toolCall("toolu_2", "ask_user", map[string]interface{}{"question": "Any naming preference?"}),
+			toolCall("toolu_3", "ask_user", map[string]interface{}{"question": "Delete the old table?"}),
+			toolCall("toolu_4", "ask_user", map[string]interface{}{"question": "?", "options": []interface{}{"a", ""}}),
+		)
+		answers := []string{" 2\n", "cache_v2", ""}
+		var asked []string
+		var progress []string
+		a := agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test",
+			agent.WithProgressCallback(func(msg, _ string) { progress = append(progress, msg) }),
+			agent.WithAskUserCallback(func(q string, options []string) (string, error) {
+				asked = append(asked, fmt.Sprintf("%s %q", q, options))
+				if len(answers) == 0 {
+					return "", fmt.Errorf("interrupted")
+				}
+				answer := answers[0]
+				answers = answers[1:]
+				return answer, nil
+			}),
+		)
+		if _, err := a.HandleMessage("add a cache"); err != nil {
+			t.Fatal(err)
+		}
+
+		var results []providers.ContentBlock
+		for _, msg := range a.GetHistory() {
+			if blocks, ok := msg.Content.([]providers.ContentBlock); ok && msg.Role == "user" {
+				results = append(results, blocks[0])
+			}
+		}
+		if len(results) != 4 {
+			t.Fatalf("got %d tool results, want 4", len(results))
+		}
+		if results[0].IsError || results[0].Content != "The user answered: SQLite (local file)" {
+			t.Errorf("option answer = %+v", results[0])
+		}
+		if results[1].Content != "The user answered: cache_v2" {
+			t.Errorf("free-form answer = %+v", results[1])
+		}
+		if !strings.HasPrefix(results[2].Content.(string), "The user gave no answer.") {
+			t.Errorf("empty answer = %+v", results[2])
+		}
+		if !results[3].IsError || results[3].Content != "option 2 is empty" {
+			t.Errorf("invalid options = %+v", results[3])
+		}
+		want := []string{
+			`Which database should the cache use? ["Redis" "SQLite (local file)" "None"]`,
+			`Any naming preference? []`,
+			`Delete the old table? []`,
+		}
+		if strings.Join(asked, "\n") != strings.Join(want, "\n") {
+			t.Errorf("asked = %q", asked)
+		}
+		if progress[0] != "→ Asking the user: Which database should the cache use?" {
+			t.Errorf("progress = %q", progress)
+		}
+	})
+
+	t.Run("Dismissed question", func(t *testing.T) {
+		server := startScriptedServer(t, toolCall("toolu_1", "ask_user", question))
+		a := agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test",
+			agent.WithAskUserCallback(func(string, []string) (string, error) {
+				return "", fmt.Errorf("interrupted")
+			}),
+		)
+		if _, err := a.HandleMessage("add a cache"); err != nil {
+			t.Fatal(err)
+		}
+		result := lastToolResult(t, a)
+		if !result.IsError || !strings.Contains(result.Content.(string), "the user dismissed the question (interrupted)") {
+			t.Errorf("result = %+v", result)
+		}
+	})
+
+	t.Run("No user available", func(t *testing.T) {
+		for _, tc := range []struct {
+			defaultAnswer string
+			want          string
+		}{
+			{"", "No user is available to answer (non-interactive run). Proceed with your best judgment"},
+			{"Use the simplest option", "No user is available to answer; the configured default answer is: Use the simplest option"},
+		} {
+			server := startScriptedServer(t, toolCall("toolu_1", "ask_user", question))
+			a := agent.New(agent.Config{
+				APIKey:         "fake",
+				APIURL:         server.URL,
+				ModelID:        "m",
+				MaxTokens:      1000,
+				NoThink:        true,
+				AskUserDefault: tc.defaultAnswer,
+			})
+			if _, err := a.HandleMessage("add a cache"); err != nil {
+				t.Fatal(err)
+			}
+			if result := lastToolResult(t, a); result.IsError || !strings.HasPrefix(result.Content.(string), tc.want) {
+				t.Errorf("default %q: result = %+v", tc.defaultAnswer, result)
+			}
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+// startScriptedServer returns a mock API that replies with the given content
+// blocks in order, one response per request. Once the script runs out it
+// answers with a plain "done" text block.
+func startScriptedServer(t *testing.T, script ...[]providers.ContentBlock) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	next := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		content := []providers.ContentBlock{{Type: "text", Text: "done"}}
+		if next < len(script) {
+			content = script[next]
+		}
+		next++
+		mu.Unlock()
+
+		data, _ := json.Marshal(content)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"content": %s, "usage": {"input_tokens": 100, "output_tokens": 10}}`, data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func toolCall(id, name string, input map[string]interface{}) []providers.ContentBlock {
+	return []providers.ContentBlock{{Type: "tool_use", ID: id, Name: name, Input: input}}
+}
+
+// TestCheckpoint_UndoAgentEdits drives two turns of real tool calls through
+// HandleMessage and verifies each turn is undone separately, without touching
+// an unrelated dirty file.
+func TestCheckpoint_UndoAgentEdits(t *testing.T) {
+	work := t.TempDir()
+	edited := filepath.Join(work, "main.go")
+	created := filepath.Join(work, "notes.txt")
+	dirty := filepath.Join(work, "dirty.go")
+	os.WriteFile(edited, []byte("func main() { old() }\n"), 0644)
+	os.WriteFile(dirty, []byte("user's uncommitted work\n"), 0644)
+
+	server := startScriptedServer(t,
+		// Turn 1: patch then overwrite the same file, and create another.
+		toolCall("toolu_p", "patch_file", map[string]interface{}{
+			"path": edited, "old_text": "old()", "new_text": "mid()",
+		}),
+		toolCall("toolu_w", "write_file", map[string]interface{}{
+			"path": edited, "content": "func main() { rewritten() }\n",
+		}),
+		toolCall("toolu_c", "write_file", map[string]interface{}{
+			"path": created, "content": "notes\n",
+		}),
+		[]providers.ContentBlock{{Type: "text", Text: "turn one done"}},
+		// Turn 2: one more patch.
+		toolCall("toolu_p2", "patch_file", map[string]interface{}{
+			"path": edited, "old_text": "rewritten()", "new_text": "final()",
+		}),
+	)
+
+	a := agent.New(agent.Config{
+		APIKey:         "fake",
+		APIURL:         server.URL,
+		ModelID:        "m",
+		MaxTokens:      1000,
+		NoThink:        true,
+		CheckpointDir:  filepath.Join(t.TempDir(), "checkpoints"),
+		WorkspaceRoots: []string{work},
+	})
+
+	if _, err := a.HandleMessage("rewrite main"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.HandleMessage("rename again"); err != nil {
+		t.Fatal(err)
+	}
+
+	turns, err := a.Checkpoints().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(turns) != 2 {
+		t.Fatalf("expected 2 checkpoints, got %d", len(turns))
+	}
+	if turns[0].Label != "rewrite main" || len(turns[0].Files) != 2 {
+		t.Errorf("turn 1 = %+v", turns[0])
+	}
+
+	// Undo turn 2.
+	if _, err := a.Checkpoints().UndoLast(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(edited); string(got) != "func main() { rewritten() }\n" {
+		t.Errorf("after first undo main.go = %q", got)
+	}
+
+	// Undo turn 1: the overwrite is restored exactly and the new file removed.
+	if _, err := a.Checkpoints().UndoLast(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(edited); string(got) != "func main() { old() }\n" {
+		t.Errorf("after second undo main.go = %q", got)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Error("notes.txt should be removed")
+	}
+	if got, _ := os.ReadFile(dirty); string(got) != "user's uncommitted work\n" {
+		t.Error("unrelated dirty file was touched")
+	}
+}
+
+// TestCheckpoint_RewindRestoresOverwrite verifies RestoreFiles uses
+// checkpoints, so even a write_file overwrite is undone on rewind.
+func TestCheckpoint_RewindRestoresOverwrite(t *testing.T) {
+	work := t.TempDir()
+	path := filepath.Join(work, "README.md")
+	os.WriteFile(path, []byte("original readme\n"), 0644)
+
+	server := startScriptedServer(t,
+		toolCall("toolu_w", "write_file", map[string]interface{}{
+			"path": path, "content": "replaced\n",
+		}),
+	)
+	a := agent.New(agent.Config{
+		APIKey:         "fake",
+		APIURL:         server.URL,
+		ModelID:        "m",
+		MaxTokens:      1000,
+		NoThink:        true,
+		CheckpointDir:  filepath.Join(t.TempDir(), "checkpoints"),
+		WorkspaceRoots: []string{work},
+	})
+
+	if _, err := a.HandleMessage("replace the readme"); err != nil {
+		t.Fatal(err)
+	}
+
+	points := a.RewindPoints()
+	removed, err := a.RewindTo(points[0].Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := a.RestoreFiles(removed)
+
+	if got, _ := os.ReadFile(path); string(got) != "original readme\n" {
+		t.Errorf("README.md = %q, want original", got)
+	}
+	if len(report.Restored) != 1 || len(report.Skipped) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if turns, _ := a.Checkpoints().List(); len(turns) != 0 {
+		t.Error("rewound turn's checkpoint should be consumed")
+	}
+}
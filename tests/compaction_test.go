@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -2019,3 +2020,163 @@ func startMockCompactionServer(t *testing.T, handler func(body string) string) *
 	}))
 }
 
+
+// TestCompact_ReportsUsage verifies every compaction API call, including
+// tool result summarization, is reported as a UsageEvent so usage and cost
+// add up.
+func TestCompact_ReportsUsage(t *testing.T) {
+	calls := 0
+	ts := startMockCompactionServer(t, func(body string) string {
+		calls++
+		return "Phase output"
+	})
+	defer ts.Close()
+
+	var usage []agent.UsageEvent
+	a := agent.NewAgent(providers.NewClient("fake-key", ts.URL, "m", 4096), "test",
+		agent.WithContextWindowSize(200000),
+		agent.WithEventHandler(func(e agent.Event) {
+			if u, ok := e.(agent.UsageEvent); ok {
+				usage = append(usage, u)
+			}
+		}),
+	)
+	history := []providers.Message{
+		{Role: "user", Content: "Find the bug"},
+		{Role: "assistant", Content: []providers.ContentBlock{
+			{Type: "tool_use", ID: "toolu_1", Name: "run_bash", Input: map[string]interface{}{"command": "cat log"}},
+		}},
+		{Role: "user", Content: []providers.ContentBlock{
+			{Type: "tool_result", ToolUseID: "toolu_1", Content: strings.Repeat("log line\n", agent.DefaultToolResultThreshold/9+1)},
+		}},
+	}
+	for i := 0; i < 8; i++ {
+		history = append(history, providers.Message{Role: []string{"assistant", "user"}[i%2], Content: fmt.Sprintf("message %d", i)})
+	}
+	a.SetHistory(history)
+	if err := a.Compact(); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	if calls < 6 || len(usage) != calls {
+		t.Fatalf("%d usage events for %d API calls, want one each (phases and summarization)", len(usage), calls)
+	}
+	for _, u := range usage {
+		if u.Model != "m" || u.Usage.InputTokens != 100 || u.Usage.OutputTokens != 50 {
+			t.Errorf("usage event = %+v", u)
+		}
+	}
+}
+
+// TestCompact_RunTestsVerbatim verifies that run_tests summaries are neither
+// summarized nor truncated, and that phase 4 attaches the latest one verbatim.
+func TestCompact_RunTestsVerbatim(t *testing.T) {
+	var capturedInputs []string
+	ts := startMockCompactionServer(t, func(body string) string {
+		capturedInputs = append(capturedInputs, body)
+		return "Phase output"
+	})
+	defer ts.Close()
+
+	client := providers.NewClient("fake-key", ts.URL, "m", 4096)
+	a := agent.NewAgent(client, "test", agent.WithContextWindowSize(200000))
+
+	oldRun := "FAIL: 3 passed, 1 failed, 0 skipped (1.2s)"
+	latestRun := "FAIL: 40 passed, 2 failed, 0 skipped (3.4s)\nPackages: 5 ok, 1 failed\n" +
+		strings.Repeat("\n--- FAIL: TestParse (example/parser, 0.01s)\n    parser_test.go:42: got 1, want 2", 60)
+	toolTurn := func(id, output string) []providers.Message {
+		return []providers.Message{
+			{Role: "assistant", Content: []providers.ContentBlock{
+				{Type: "tool_use", ID: id, Name: "run_tests", Input: map[string]interface{}{"packages": "./..."}},
+			}},
+			{Role: "user", Content: []providers.ContentBlock{
+				{Type: "tool_result", ToolUseID: id, Content: output},
+			}},
+		}
+	}
+	history := []providers.Message{{Role: "user", Content: "Fix the parser tests."}}
+	history = append(history, toolTurn("toolu_1", oldRun)...)
+	history = append(history, toolTurn("toolu_2", latestRun)...)
+	history = append(history,
+		providers.Message{Role: "assistant", Content: "Two failures left."},
+		providers.Message{Role: "user", Content: "keep going"},
+		providers.Message{Role: "assistant", Content: "Working on it."},
+		providers.Message{Role: "user", Content: "continue"},
+		providers.Message{Role: "assistant", Content: "Still working."},
+	)
+	a.SetHistory(history)
+
+	if err := a.Compact(); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	wantBlock := "**Latest Test Results** (run_tests, verbatim):\n```\n" + latestRun + "\n```"
+	for _, input := range capturedInputs {
+		if strings.Contains(input, "summarizing a large tool output") {
+			t.Error("run_tests output should not be sent for summarization")
+		}
+	}
+	var handoffInput string
+	for _, input := range capturedInputs {
+		if strings.Contains(input, "developer handoff document") {
+			handoffInput = input
+		}
+	}
+	// Request bodies are JSON, so compare against the JSON-encoded block.
+	encoded, _ := json.Marshal(wantBlock)
+	if !strings.Contains(handoffInput, strings.Trim(string(encoded), `"`)) {
+		t.Errorf("phase 5 input should carry the latest run_tests summary verbatim")
+	}
+	if strings.Contains(handoffInput, "3 passed, 1 failed") {
+		t.Errorf("only the latest run_tests summary should be attached")
+	}
+}
+
+// TestCompact_TodoListVerbatim verifies that the agent's todo list reaches
+// the handoff phase exactly as written, with an instruction to carry the
+// unfinished items into Next Steps.
+func TestCompact_TodoListVerbatim(t *testing.T) {
+	var handoffInput string
+	ts := startMockCompactionServer(t, func(body string) string {
+		if strings.Contains(body, "developer handoff document") {
+			handoffInput = body
+		}
+		return "Phase output"
+	})
+	defer ts.Close()
+
+	client := providers.NewClient("fake-key", ts.URL, "m", 4096)
+	server := startScriptedServer(t, toolCall("toolu_1", "todo_write", map[string]interface{}{
+		"todos": []interface{}{
+			map[string]interface{}{"id": "1", "content": "Add the parser", "status": "done"},
+			map[string]interface{}{"id": "2", "content": "Wire it into the CLI", "status": "in_progress"},
+			map[string]interface{}{"id": "3", "content": "Document the flag", "status": "pending"},
+		},
+	}))
+	a := agent.NewAgent(providers.NewClient("fake-key", server.URL, "m", 4096), "test", agent.WithContextWindowSize(200000))
+	if _, err := a.HandleMessage("Add a --format flag."); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compact through the mock compaction server, keeping the todo list
+	b := agent.NewAgent(client, "test", agent.WithContextWindowSize(200000))
+	b.SetTodos(a.Todos())
+	var history []providers.Message
+	for i := 0; i < 10; i++ {
+		history = append(history, providers.Message{Role: []string{"user", "assistant"}[i%2], Content: fmt.Sprintf("message %d", i)})
+	}
+	b.SetHistory(history)
+	if err := b.Compact(); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"### Todo List (1/3 done, [~] = in progress)\n- [x] 1: Add the parser\n- [~] 2: Wire it into the CLI\n- [ ] 3: Document the flag",
+		"The Next Steps section MUST list every item that is not done",
+	} {
+		encoded, _ := json.Marshal(want)
+		if !strings.Contains(handoffInput, strings.Trim(string(encoded), `"`)) {
+			t.Errorf("phase 5 input is missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+// eventKind names an event by its type, e.g. "ToolCall".
+func eventKind(e agent.Event) string {
+	return strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%T", e), "agent."), "Event")
+}
+
+// TestEvents runs a turn that delegates to a sub-agent and checks the event
+// stream: order, metadata, the sub-agent's events and the callback adapters.
+func TestEvents(t *testing.T) {
+	work := t.TempDir()
+	server, _ := startTaskServer(t,
+		append([]providers.ContentBlock{{Type: "text", Text: "Let me delegate."}},
+			toolCall("toolu_task", "task", map[string]interface{}{"description": "List files", "prompt": "List the files."})...),
+		// Sub-agent
+		toolCall("toolu_c1", "list_files", map[string]interface{}{"path": work}),
+		[]providers.ContentBlock{{Type: "text", Text: "No files."}},
+		// Parent
+		[]providers.ContentBlock{{Type: "text", Text: "The directory is empty."}},
+	)
+
+	var events []agent.Event
+	var spinner, progress, toolUses []string
+	a := agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test",
+		agent.WithEventHandler(func(e agent.Event) { events = append(events, e) }),
+		agent.WithSpinnerCallback(func(start bool, message string) { spinner = append(spinner, fmt.Sprint(start)) }),
+		agent.WithProgressCallback(func(msg, _ string) { progress = append(progress, msg) }),
+		agent.WithToolUseCallback(func(_, toolName, _ string, _ map[string]interface{}) { toolUses = append(toolUses, toolName) }),
+	)
+	if _, err := a.HandleMessage("what is in the directory?"); err != nil {
+		t.Fatal(err)
+	}
+
+	var own, task []string
+	for i, e := range events {
+		m := e.Meta()
+		if m.ID != fmt.Sprintf("evt-%d", i+1) || m.Turn != 1 || m.Time.IsZero() {
+			t.Errorf("event %d (%s) meta = %+v", i, eventKind(e), m)
+		}
+		if i > 0 && m.Time.Before(events[i-1].Meta().Time) {
+			t.Errorf("event %d is older than the one before", i)
+		}
+		if _, ok := e.(agent.DiagnosticEvent); ok {
+			continue
+		}
+		switch m.TaskID {
+		case "":
+			own = append(own, eventKind(e))
+		case "toolu_task":
+			task = append(task, eventKind(e))
+		default:
+			t.Errorf("event %d has task %q", i, m.TaskID)
+		}
+	}
+	wantOwn := "TurnStart UserMessage APIRequest Usage TextDelta ToolCall ToolResult APIRequest Usage TextDelta AssistantMessage TurnEnd"
+	if strings.Join(own, " ") != wantOwn {
+		t.Errorf("own events = %v, want %s", own, wantOwn)
+	}
+	wantTask := "TurnStart UserMessage APIRequest Usage ToolCall ToolResult APIRequest Usage TextDelta AssistantMessage TurnEnd"
+	if strings.Join(task, " ") != wantTask {
+		t.Errorf("task events = %v, want %s", task, wantTask)
+	}
+
+	// Event data
+	for _, e := range events {
+		switch e := e.(type) {
+		case agent.TurnStartEvent:
+			if e.TaskID == "" && e.Message != "what is in the directory?" {
+				t.Errorf("turn start = %+v", e)
+			}
+		case agent.APIRequestEvent:
+			if e.Model != "m" || e.Messages == 0 {
+				t.Errorf("API request = %+v", e)
+			}
+		case agent.ToolResultEvent:
+			if e.IsError || e.Output == "" {
+				t.Errorf("tool result = %+v", e)
+			}
+		case agent.UsageEvent:
+			if e.Model != "m" || e.Usage.InputTokens != 100 {
+				t.Errorf("usage = %+v", e)
+			}
+		case agent.TurnEndEvent:
+			if e.StopReason != "end_turn" || e.TaskID == "" && (e.Response != "The directory is empty." || e.Err != nil) {
+				t.Errorf("turn end = %+v", e)
+			}
+		}
+	}
+
+	// Adapters: the spinner and progress lines include the sub-agent, with
+	// its progress nested; tool-use metadata is the agent's own only
+	if strings.Join(spinner, " ") != "true false true false true false true false" {
+		t.Errorf("spinner = %v", spinner)
+	}
+	if len(progress) != 2 || progress[0] != "→ Delegating task: List files" || !strings.HasPrefix(progress[1], "→ ↳ ") {
+		t.Errorf("progress = %q", progress)
+	}
+	if strings.Join(toolUses, " ") != "task" {
+		t.Errorf("tool uses = %v", toolUses)
+	}
+
+	// The next message is turn 2
+	events = nil
+	if _, err := a.HandleMessage("thanks"); err != nil {
+		t.Fatal(err)
+	}
+	if start, ok := events[0].(agent.TurnStartEvent); !ok || start.Turn != 2 || start.Message != "thanks" {
+		t.Errorf("second turn starts with %+v", events[0])
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// globFixture creates a small repository whose files have distinct,
+// increasing modification times in the order listed.
+func globFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := []string{
+		".git/HEAD",
+		".gitignore",
+		"go.mod",
+		"main.go",
+		"debug.log",
+		"build/out.go",
+		"src/test/a.go",
+		"src/pkg/test/b.go",
+		"src/pkg/test/sub/c.go",
+		"src/pkg/util.go",
+		"node_modules/dep/index.go",
+		"vendor/lib/lib.go",
+		"cmd/tool/main.go",
+	}
+	start := time.Now().Add(-time.Hour)
+	for i, name := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		content := ""
+		if name == ".gitignore" {
+			content = "*.log\nbuild/\n"
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := start.Add(time.Duration(i) * time.Minute)
+		os.Chtimes(path, mtime, mtime)
+	}
+	return dir
+}
+
+// globPaths returns the paths listed in glob output, relative to dir.
+func globPaths(output, dir string) []string {
+	var paths []string
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, dir+"/") {
+			paths = append(paths, strings.TrimPrefix(line, dir+"/"))
+		}
+	}
+	return paths
+}
+
+func TestGlobNative(t *testing.T) {
+	dir := globFixture(t)
+
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+	}{
+		{"Name pattern matches at any depth, newest first", "*.go", []string{
+			"cmd/tool/main.go", "src/pkg/util.go", "src/pkg/test/sub/c.go", "src/pkg/test/b.go", "src/test/a.go", "main.go",
+		}},
+		{"Doublestar in the middle", "src/**/test/*.go", []string{"src/pkg/test/b.go", "src/test/a.go"}},
+		{"Single star stays in one directory", "src/*/test/*.go", []string{"src/pkg/test/b.go"}},
+		{"Brace expansion", "*.{go,mod}", []string{
+			"cmd/tool/main.go", "src/pkg/util.go", "src/pkg/test/sub/c.go", "src/pkg/test/b.go", "src/test/a.go", "main.go", "go.mod",
+		}},
+		{"Brace expansion in a directory", "src/{test,pkg}/*.go", []string{"src/pkg/util.go", "src/test/a.go"}},
+		{"Trailing slash matches directories", "cmd/*/", []string{"cmd/tool/"}},
+		{"Ignored files are skipped", "**/*.{log,go}", []string{
+			"cmd/tool/main.go", "src/pkg/util.go", "src/pkg/test/sub/c.go", "src/pkg/test/b.go", "src/test/a.go", "main.go",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := executeGlob(tt.pattern, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := globPaths(output, dir)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("glob(%q) = %v\nwant %v\noutput:\n%s", tt.pattern, got, tt.want, output)
+			}
+		})
+	}
+
+	t.Run("no_ignore includes ignored and vendored files", func(t *testing.T) {
+		output, err := executeToolWith("glob", map[string]interface{}{"pattern": "*.{go,log}", "path": dir, "no_ignore": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"debug.log", "build/out.go", "node_modules/dep/index.go", "vendor/lib/lib.go"} {
+			if !strings.Contains(output, dir+"/"+want+"\n") {
+				t.Errorf("expected %s with no_ignore, got:\n%s", want, output)
+			}
+		}
+	})
+
+	t.Run("max_results caps the newest files", func(t *testing.T) {
+		output, err := executeToolWith("glob", map[string]interface{}{"pattern": "*.go", "path": dir, "max_results": float64(2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := globPaths(output, dir); len(got) != 2 || got[0] != "cmd/tool/main.go" {
+			t.Errorf("expected the 2 newest files, got %v", got)
+		}
+		if !strings.Contains(output, "Found 6 files matching '*.go' (showing the 2 most recently modified)") ||
+			!strings.Contains(output, "... 4 more files not shown") {
+			t.Errorf("expected cap notes, got:\n%s", output)
+		}
+	})
+
+	t.Run("Unbalanced braces are an error", func(t *testing.T) {
+		if _, err := executeGlob("*.{go,mod", dir); err == nil {
+			t.Error("expected error for unbalanced brace")
+		}
+	})
+}
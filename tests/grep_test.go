@@ -0,0 +1,201 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// grepFixture creates a small repository with ignore files and vendored
+// dependencies for grep to skip.
+func grepFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		".git/HEAD":                  "ref: refs/heads/main\n",
+		".gitignore":                 "*.log\nbuild/\n",
+		".clydeignore":               "fixtures/\n",
+		"main.go":                    "package main\n\n// TODO: wire up flags\nfunc main() {\n\trun()\n}\n\nfunc run() {\n\t// todo: lower case\n}\n",
+		"util.go":                    "package main\n\nfunc helper() int {\n\treturn 42\n}\n",
+		"notes.md":                   "TODO: write docs\n",
+		"debug.log":                  "TODO: in a log\n",
+		"build/gen.go":               "// TODO: generated\n",
+		"fixtures/data.txt":          "TODO: fixture\n",
+		"node_modules/dep/index.js":  "// TODO: dependency\n",
+		"vendor/lib/lib.go":          "// TODO: vendored\n",
+		".clyde/sessions/s1/0001.md": "TODO: session\n",
+		"image.bin":                  "TODO\x00\x01\x02",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGrepNative(t *testing.T) {
+	dir := grepFixture(t)
+
+	t.Run("Skips ignored, vendored and binary files", func(t *testing.T) {
+		got, err := executeGrep("TODO", dir, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "Found 2 matches in 2 files:") {
+			t.Errorf("expected 2 matches, got:\n%s", got)
+		}
+		for _, skipped := range []string{"debug.log", "build", "fixtures", "node_modules", "vendor", "sessions", "image.bin"} {
+			if strings.Contains(got, skipped) {
+				t.Errorf("expected %s to be skipped, got:\n%s", skipped, got)
+			}
+		}
+		if !strings.Contains(got, filepath.Join(dir, "main.go")+":3:// TODO: wire up flags") {
+			t.Errorf("expected path:line:text output, got:\n%s", got)
+		}
+	})
+
+	t.Run("no_ignore searches everything that is text", func(t *testing.T) {
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": "TODO", "path": dir, "no_ignore": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"debug.log", "gen.go", "data.txt", "index.js", "lib.go", "0001.md"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("expected %s with no_ignore, got:\n%s", want, got)
+			}
+		}
+		if strings.Contains(got, "image.bin") {
+			t.Errorf("binary files should still be skipped, got:\n%s", got)
+		}
+	})
+
+	t.Run("Case insensitive", func(t *testing.T) {
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": "todo", "path": dir, "case_insensitive": true, "file_pattern": "*.go"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "Found 2 matches in 1 files:") {
+			t.Errorf("got:\n%s", got)
+		}
+	})
+
+	t.Run("Context lines", func(t *testing.T) {
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": "return 42", "path": dir, "context": float64(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		util := filepath.Join(dir, "util.go")
+		want := util + "-3-func helper() int {\n" + util + ":4:\treturn 42\n" + util + "-5-}\n"
+		if !strings.Contains(got, want) {
+			t.Errorf("expected context block %q, got:\n%s", want, got)
+		}
+	})
+
+	t.Run("Separate groups are divided by --", func(t *testing.T) {
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": "^func", "path": filepath.Join(dir, "main.go"), "after": float64(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "main.go-5-\trun()\n--\n") {
+			t.Errorf("expected -- between groups, got:\n%s", got)
+		}
+	})
+
+	t.Run("Multiline", func(t *testing.T) {
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": `func run\(\) \{.*?\}`, "path": dir, "multiline": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		main := filepath.Join(dir, "main.go")
+		for _, want := range []string{main + ":8:func run() {", main + ":9:\t// todo: lower case", main + ":10:}"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("expected %q in multiline output, got:\n%s", want, got)
+			}
+		}
+		if !strings.HasPrefix(got, "Found 1 matches in 1 files:") {
+			t.Errorf("a multiline match counts once, got:\n%s", got)
+		}
+	})
+
+	t.Run("Files and count modes", func(t *testing.T) {
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": "func", "path": dir, "output_mode": "files"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, filepath.Join(dir, "main.go")+"\n") || strings.Contains(got, ":func") {
+			t.Errorf("files mode should list paths only, got:\n%s", got)
+		}
+
+		got, err = executeToolWith("grep", map[string]interface{}{"pattern": "func", "path": dir, "output_mode": "count"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, filepath.Join(dir, "main.go")+":2\n") || !strings.Contains(got, filepath.Join(dir, "util.go")+":1\n") {
+			t.Errorf("count mode output wrong, got:\n%s", got)
+		}
+
+		if _, err := executeToolWith("grep", map[string]interface{}{"pattern": "func", "path": dir, "output_mode": "lines"}); err == nil {
+			t.Error("expected error for unknown output_mode")
+		}
+	})
+
+	t.Run("max_results reports what was left out", func(t *testing.T) {
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": "func", "path": dir, "max_results": float64(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "... 2 more matches not shown") {
+			t.Errorf("expected truncation note, got:\n%s", got)
+		}
+	})
+
+	t.Run("Invalid regex is searched literally", func(t *testing.T) {
+		got, err := executeGrep("run(", dir, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, ":5:\trun()") || !strings.Contains(got, "searched for it literally") {
+			t.Errorf("expected literal match with note, got:\n%s", got)
+		}
+	})
+
+	t.Run("Long lines are cut on a character boundary", func(t *testing.T) {
+		long := t.TempDir()
+		os.WriteFile(filepath.Join(long, "wide.txt"), []byte("needle "+strings.Repeat("é", 600)+"\n"), 0644)
+		got, err := executeGrep("needle", long, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utf8.ValidString(got) || !strings.Contains(got, ":1:needle "+strings.Repeat("é", 493)+"…") {
+			t.Errorf("got:\n%s", got)
+		}
+	})
+
+	t.Run("Files too large to read are skipped with a note", func(t *testing.T) {
+		big := t.TempDir()
+		os.WriteFile(filepath.Join(big, "small.log"), []byte("needle\n"), 0644)
+		os.WriteFile(filepath.Join(big, "huge.log"), []byte("needle\n"+strings.Repeat("x", 10<<20)), 0644)
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": "needle", "path": big, "no_ignore": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "Found 1 matches in 1 files:") || !strings.Contains(got, "1 files over 10 MB were not searched: "+filepath.Join(big, "huge.log")) {
+			t.Errorf("got:\n%s", got)
+		}
+	})
+
+	t.Run("file_pattern with a directory glob", func(t *testing.T) {
+		got, err := executeToolWith("grep", map[string]interface{}{"pattern": "TODO", "path": dir, "file_pattern": "**/*.md"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "Found 1 matches in 1 files:") || !strings.Contains(got, "notes.md") {
+			t.Errorf("got:\n%s", got)
+		}
+	})
+}
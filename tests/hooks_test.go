@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/hooks"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+// TestHooks drives hooks through HandleMessage with a scripted server.
+func TestHooks(t *testing.T) {
+	work := t.TempDir()
+	newAgent := func(t *testing.T, config string, diagnostics *[]string, script ...[]providers.ContentBlock) *agent.Agent {
+		t.Helper()
+		h, err := hooks.Parse([]byte(config), work)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := startScriptedServer(t, script...)
+		return agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test",
+			agent.WithHooks(h),
+			agent.WithDiagnosticCallback(func(msg string) { *diagnostics = append(*diagnostics, msg) }),
+		)
+	}
+
+	t.Run("PreToolUse blocks a command", func(t *testing.T) {
+		var diagnostics []string
+		a := newAgent(t, `{"PreToolUse": [{"matcher": "run_bash", "command": "grep -q 'git push' && { echo 'git push is not allowed; ask the user to push' >&2; exit 2; }; exit 0"}]}`,
+			&diagnostics, toolCall("toolu_1", "run_bash", map[string]interface{}{"command": "git push origin main"}))
+		if _, err := a.HandleMessage("ship it"); err != nil {
+			t.Fatal(err)
+		}
+		result := lastToolResult(t, a)
+		if !result.IsError || result.Content != "Blocked by a PreToolUse hook: git push is not allowed; ask the user to push" {
+			t.Errorf("result = %+v", result)
+		}
+		if len(diagnostics) < 2 || !strings.HasPrefix(diagnostics[1], `🪝 PreToolUse hook "grep -q 'git push'`) {
+			t.Errorf("diagnostics = %q", diagnostics)
+		}
+	})
+
+	t.Run("PreToolUse rewrites input and approves, PostToolUse adds context", func(t *testing.T) {
+		var diagnostics []string
+		target := filepath.Join(work, "out.txt")
+		config := `{
+		  "PreToolUse": [{"matcher": "write_file", "command": "echo '{\"decision\": \"approve\", \"tool_input\": {\"path\": \"` + target + `\", \"content\": \"rewritten\\n\"}}'"}],
+		  "PostToolUse": [{"matcher": "write_file", "command": "grep -q '\"is_error\"' || echo '{\"additional_context\": \"formatted by hook\"}'"}]
+		}`
+		a := newAgent(t, config, &diagnostics, toolCall("toolu_1", "write_file", map[string]interface{}{
+			"path": filepath.Join(work, "other.txt"), "content": "original\n",
+		}))
+		if _, err := a.HandleMessage("write it"); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(target); string(data) != "rewritten\n" {
+			t.Errorf("target = %q", data)
+		}
+		if _, err := os.Stat(filepath.Join(work, "other.txt")); err == nil {
+			t.Error("original path should not be written")
+		}
+		result := lastToolResult(t, a)
+		if result.IsError || !strings.HasSuffix(result.Content.(string), "\n\nformatted by hook") {
+			t.Errorf("result = %+v", result)
+		}
+		// The history shows the call as it was actually made
+		call := a.GetHistory()[1].Content.([]providers.ContentBlock)[0]
+		if call.Input["path"] != target {
+			t.Errorf("history tool_use input = %v", call.Input)
+		}
+	})
+
+	t.Run("PostToolUse block marks the result as an error", func(t *testing.T) {
+		var diagnostics []string
+		a := newAgent(t, `{"PostToolUse": [{"command": "echo 'lint failed: unused variable x' >&2; exit 2"}]}`,
+			&diagnostics, toolCall("toolu_1", "list_files", map[string]interface{}{"path": work}))
+		a.HandleMessage("list")
+		result := lastToolResult(t, a)
+		if !result.IsError || !strings.HasSuffix(result.Content.(string), "\n\nPostToolUse hook feedback: lint failed: unused variable x") {
+			t.Errorf("result = %+v", result)
+		}
+	})
+
+	t.Run("UserPromptSubmit", func(t *testing.T) {
+		var diagnostics []string
+		a := newAgent(t, `{"UserPromptSubmit": [{"command": "grep -q DROP && { echo 'no SQL in prompts' >&2; exit 2; }; echo '{\"additional_context\": \"on-call: alice\"}'"}]}`, &diagnostics)
+		if _, err := a.HandleMessage("DROP TABLE users"); err == nil || !strings.Contains(err.Error(), "no SQL in prompts") {
+			t.Errorf("expected a blocked prompt, got %v", err)
+		}
+		if len(a.GetHistory()) != 0 {
+			t.Errorf("blocked prompt reached the history: %v", a.GetHistory())
+		}
+		if _, err := a.HandleMessage("who is on call?"); err != nil {
+			t.Fatal(err)
+		}
+		if got := a.GetHistory()[0].Content; got != "who is on call?\n\n<hook_context>\non-call: alice\n</hook_context>" {
+			t.Errorf("user message = %q", got)
+		}
+	})
+
+	t.Run("UserPromptSubmit sees queued messages", func(t *testing.T) {
+		var diagnostics []string
+		h, err := hooks.Parse([]byte(`{"UserPromptSubmit": [{"command": "in=$(cat); echo \"$in\" | grep -q DROP && { echo 'no SQL in prompts' >&2; exit 2; }; echo \"$in\" | grep -q README && echo '{\"prompt\": \"also update the README and CHANGELOG\"}'; exit 0"}]}`), work)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server, requests := startTaskServer(t,
+			toolCall("toolu_1", "list_files", map[string]interface{}{"path": work}),
+			[]providers.ContentBlock{{Type: "text", Text: "done"}},
+		)
+		var a *agent.Agent
+		var delivered []string
+		a = agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test",
+			agent.WithHooks(h),
+			agent.WithDiagnosticCallback(func(msg string) { diagnostics = append(diagnostics, msg) }),
+			agent.WithProgressCallback(func(string, string) {
+				a.Queue("DROP TABLE users")
+				a.Queue("also update the README")
+			}),
+			agent.WithQueueCallback(func(d, _ []string) { delivered = append(delivered, d...) }),
+		)
+		if _, err := a.HandleMessage("list the files"); err != nil {
+			t.Fatal(err)
+		}
+		second := (*requests)[1].Messages
+		last := string(second[len(second)-1])
+		if strings.Contains(last, "DROP") || !strings.HasSuffix(last, `{"type":"text","text":"also update the README and CHANGELOG"}]}`) {
+			t.Errorf("tool results message = %s", last)
+		}
+		if len(delivered) != 1 || delivered[0] != "also update the README and CHANGELOG" {
+			t.Errorf("delivered = %q", delivered)
+		}
+		if !strings.Contains(strings.Join(diagnostics, "\n"), "🪝 Queued message blocked by a UserPromptSubmit hook: no SQL in prompts") {
+			t.Errorf("diagnostics = %q", diagnostics)
+		}
+	})
+
+	t.Run("Stop sends the turn back once", func(t *testing.T) {
+		var diagnostics []string
+		a := newAgent(t, `{"Stop": [{"command": "grep -q '\"stop_hook_active\":true' && exit 0; echo '{\"decision\": \"block\", \"reason\": \"run the tests first\"}'"}]}`,
+			&diagnostics,
+			[]providers.ContentBlock{{Type: "text", Text: "all done"}},
+			[]providers.ContentBlock{{Type: "text", Text: "tests pass, done"}},
+		)
+		response, err := a.HandleMessage("fix the bug")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response != "tests pass, done" {
+			t.Errorf("response = %q", response)
+		}
+		history := a.GetHistory()
+		if len(history) != 4 || history[2].Content != "A Stop hook did not let you finish yet: run the tests first" {
+			t.Errorf("history = %+v", history)
+		}
+	})
+
+	t.Run("Stop blocking forever is capped", func(t *testing.T) {
+		var diagnostics []string
+		a := newAgent(t, `{"Stop": [{"command": "exit 2"}]}`, &diagnostics)
+		if _, err := a.HandleMessage("hi"); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(a.GetHistory()); got != 12 {
+			t.Errorf("history has %d messages, want 12 (5 continuations)", got)
+		}
+		if last := diagnostics[len(diagnostics)-1]; last != "🪝 Stop hooks blocked 6 times this turn; ending it anyway" {
+			t.Errorf("last diagnostic = %q", last)
+		}
+	})
+
+	t.Run("PreCompact can skip compaction", func(t *testing.T) {
+		var diagnostics []string
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			calls++
+		}))
+		defer server.Close()
+		h, _ := hooks.Parse([]byte(`{"PreCompact": [{"command": "echo 'keeping full history while debugging' >&2; exit 2"}]}`), work)
+		a := agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test", agent.WithHooks(h),
+			agent.WithDiagnosticCallback(func(msg string) { diagnostics = append(diagnostics, msg) }))
+		var history []providers.Message
+		for i := 0; i < 10; i++ {
+			role := []string{"user", "assistant"}[i%2]
+			history = append(history, providers.Message{Role: role, Content: strings.Repeat("x", 100)})
+		}
+		a.SetHistory(history)
+		if err := a.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		if len(a.GetHistory()) != 10 || calls != 0 {
+			t.Errorf("compaction ran: %d messages, %d API calls", len(a.GetHistory()), calls)
+		}
+		data, _ := json.Marshal(diagnostics)
+		if !strings.Contains(string(data), "Compaction skipped by a PreCompact hook: keeping full history while debugging") {
+			t.Errorf("diagnostics = %s", data)
+		}
+	})
+}
+
+// TestHooks_Trust verifies that project hooks run only once the user has
+// approved the current content of .clyde/hooks.json.
+func TestHooks_Trust(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := sandboxProject(t, `{}`)
+	config := filepath.Join(dir, ".clyde", "hooks.json")
+	os.WriteFile(config, []byte(`{"UserPromptSubmit": [{"command": "echo '{\"additional_context\": \"hooked\"}'"}]}`), 0644)
+
+	// run handles one message, approving with approve (nil = no user to
+	// ask), and returns the requests asked and the diagnostics.
+	run := func(t *testing.T, approve agent.PermissionCallback) (asked, diagnostics []string) {
+		t.Helper()
+		server := startScriptedServer(t)
+		opts := []agent.AgentOption{agent.WithDiagnosticCallback(func(msg string) { diagnostics = append(diagnostics, msg) })}
+		if approve != nil {
+			opts = append(opts, agent.WithPermissionCallback(func(toolName, request string) bool {
+				asked = append(asked, toolName+": "+request)
+				return approve(toolName, request)
+			}))
+		}
+		a := agent.New(agent.Config{APIKey: "fake", APIURL: server.URL, ModelID: "m", MaxTokens: 1000, NoThink: true}, opts...)
+		defer a.Close()
+		if _, err := a.HandleMessage("hi"); err != nil {
+			t.Fatal(err)
+		}
+		return asked, diagnostics
+	}
+	hooked := func(diagnostics []string) bool {
+		return strings.Contains(strings.Join(diagnostics, "\n"), "🪝 UserPromptSubmit hook")
+	}
+
+	asked, diagnostics := run(t, func(string, string) bool { return false })
+	if len(asked) != 1 || !strings.HasPrefix(asked[0], "hooks: Enable the hooks in "+config) || !strings.Contains(asked[0], "\n  UserPromptSubmit: echo") {
+		t.Errorf("asked = %q", asked)
+	}
+	if hooked(diagnostics) || !strings.Contains(strings.Join(diagnostics, "\n"), "🪝 Hooks disabled: "+config+" is not approved") {
+		t.Errorf("denied hooks should not run: %q", diagnostics)
+	}
+
+	_, diagnostics = run(t, nil)
+	if hooked(diagnostics) {
+		t.Errorf("hooks should not run without approval: %q", diagnostics)
+	}
+
+	asked, diagnostics = run(t, func(string, string) bool { return true })
+	if len(asked) != 1 || !hooked(diagnostics) {
+		t.Errorf("approved hooks should run: asked %q, diagnostics %q", asked, diagnostics)
+	}
+
+	// Remembered until the file changes
+	_, diagnostics = run(t, nil)
+	if !hooked(diagnostics) {
+		t.Errorf("approved hooks should run without asking again: %q", diagnostics)
+	}
+	os.WriteFile(config, []byte(`{"UserPromptSubmit": [{"command": "echo changed"}]}`), 0644)
+	_, diagnostics = run(t, nil)
+	if hooked(diagnostics) {
+		t.Errorf("changed hooks need a new approval: %q", diagnostics)
+	}
+}
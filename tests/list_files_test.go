@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// treeFixture creates a small repository with ignored, vendored and
+// crowded directories.
+func treeFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		".git/HEAD":                 "ref: refs/heads/main\n",
+		".gitignore":                "*.log\ndist/\n",
+		"main.go":                   "package main\n\nfunc main() {}\n",
+		"go.mod":                    "module example\n",
+		"debug.log":                 "noise\n",
+		"dist/app.js":               "built\n",
+		"node_modules/dep/index.js": "dep\n",
+		"vendor/lib/lib.go":         "package lib\n",
+		"cmd/tool/main.go":          "package main\n",
+		"cmd/tool/deep/x.go":        "package deep\n",
+		"pkg/util.go":               "package pkg\n\nfunc Util() {}",
+		"assets/logo.png":           "\x89PNG\x00\x00\x00",
+	}
+	for i := 0; i < 45; i++ {
+		files[fmt.Sprintf("testdata/case%02d.txt", i)] = "x\n"
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestListFilesTree(t *testing.T) {
+	dir := treeFixture(t)
+
+	t.Run("Default is still ls -la", func(t *testing.T) {
+		got, err := executeListFiles(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "total") || !strings.Contains(got, "debug.log") {
+			t.Errorf("expected ls -la output, got:\n%s", got)
+		}
+	})
+
+	t.Run("Tree skips ignored and vendored directories", func(t *testing.T) {
+		got, err := executeToolWith("list_files", map[string]interface{}{"path": dir, "tree": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"  cmd/\n    tool/\n      deep/ (1 entry)\n      main.go\n",
+			"  pkg/\n    util.go\n",
+			"  main.go\n",
+			"  .gitignore\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("expected %q in tree, got:\n%s", want, got)
+			}
+		}
+		for _, hidden := range []string{"debug.log", "dist", "node_modules", "vendor", ".git/"} {
+			if strings.Contains(got, hidden) {
+				t.Errorf("expected %s to be hidden, got:\n%s", hidden, got)
+			}
+		}
+		if !strings.Contains(got, "directories, ") || !strings.Contains(got, "ignored files hidden") {
+			t.Errorf("expected summary line, got:\n%s", got)
+		}
+	})
+
+	t.Run("Tree accepts a trailing slash and ./", func(t *testing.T) {
+		oldDir, _ := os.Getwd()
+		defer os.Chdir(oldDir)
+		os.Chdir(filepath.Dir(dir))
+		for _, path := range []string{dir + "/", "./" + filepath.Base(dir), "./" + filepath.Base(dir) + "/"} {
+			got, err := executeToolWith("list_files", map[string]interface{}{"path": path, "tree": true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, "  pkg/\n    util.go\n") || strings.Contains(got, "0 directories, 0 files") {
+				t.Errorf("path %q: expected the full tree, got:\n%s", path, got)
+			}
+		}
+	})
+
+	t.Run("Crowded directories are collapsed", func(t *testing.T) {
+		got, err := executeToolWith("list_files", map[string]interface{}{"path": dir, "tree": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "    case29.txt\n    (+15 files)\n") || strings.Contains(got, "case30.txt") {
+			t.Errorf("expected testdata to collapse after 30 files, got:\n%s", got)
+		}
+	})
+
+	t.Run("Depth limits descent", func(t *testing.T) {
+		got, err := executeToolWith("list_files", map[string]interface{}{"path": dir, "depth": float64(1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "  cmd/ (1 entry)\n") || strings.Contains(got, "tool/") {
+			t.Errorf("expected only top-level entries, got:\n%s", got)
+		}
+	})
+
+	t.Run("Sizes and line counts", func(t *testing.T) {
+		got, err := executeToolWith("list_files", map[string]interface{}{"path": dir, "tree": true, "sizes": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"  main.go (29 bytes, 3 lines)\n",
+			"    util.go (27 bytes, 3 lines)\n",
+			"    logo.png (7 bytes, binary)\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("expected %q, got:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("ignore false shows everything", func(t *testing.T) {
+		got, err := executeToolWith("list_files", map[string]interface{}{"path": dir, "tree": true, "ignore": false})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{"debug.log", "dist/", "node_modules/", "vendor/", ".git/"} {
+			if !strings.Contains(got, want) {
+				t.Errorf("expected %s with ignore=false, got:\n%s", want, got)
+			}
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := executeToolWith("list_files", map[string]interface{}{"path": filepath.Join(dir, "nope"), "tree": true}); err == nil {
+			t.Error("expected error for missing directory")
+		}
+		if _, err := executeToolWith("list_files", map[string]interface{}{"path": filepath.Join(dir, "main.go"), "tree": true}); err == nil {
+			t.Error("expected error for a file path")
+		}
+		if _, err := executeToolWith("list_files", map[string]interface{}{"path": dir, "depth": float64(0)}); err == nil {
+			t.Error("expected error for depth 0")
+		}
+	})
+}
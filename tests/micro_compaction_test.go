@@ -0,0 +1,434 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/config"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+)
+
+// microHistory builds a conversation where each turn is one assistant
+// tool_use followed by its tool_result. bodies are tool result contents.
+func microHistory(calls []providers.ContentBlock, bodies []string) []providers.Message {
+	history := []providers.Message{{Role: "user", Content: "Refactor the project"}}
+	for i, call := range calls {
+		history = append(history,
+			providers.Message{Role: "assistant", Content: []providers.ContentBlock{call}},
+			providers.Message{Role: "user", Content: []providers.ContentBlock{
+				{Type: "tool_result", ToolUseID: call.ID, Content: bodies[i]},
+			}},
+		)
+	}
+	return history
+}
+
+// toolResultText returns the content of the tool_result with the given ID.
+func toolResultText(t *testing.T, history []providers.Message, id string) string {
+	t.Helper()
+	for _, msg := range history {
+		blocks, ok := msg.Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+		for _, b := range blocks {
+			if b.Type == "tool_result" && b.ToolUseID == id {
+				s, _ := b.Content.(string)
+				return s
+			}
+		}
+	}
+	t.Fatalf("tool_result %s not found", id)
+	return ""
+}
+
+func bigOutput(lines int) string {
+	var sb strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&sb, "line %d of some fairly verbose tool output\n", i+1)
+	}
+	return sb.String()
+}
+
+// TestMicroCompact_SupersededRead verifies an older read_file result is elided
+// when the same path is read again later, and the newer read is kept.
+func TestMicroCompact_SupersededRead(t *testing.T) {
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test")
+
+	calls := []providers.ContentBlock{
+		{Type: "tool_use", ID: "toolu_r1", Name: "read_file", Input: map[string]interface{}{"path": "main.go"}},
+		{Type: "tool_use", ID: "toolu_r2", Name: "read_file", Input: map[string]interface{}{"path": "./main.go"}},
+	}
+	a.SetHistory(microHistory(calls, []string{bigOutput(412), bigOutput(415)}))
+
+	if n := a.MicroCompact(); n != 1 {
+		t.Fatalf("MicroCompact() = %d, want 1", n)
+	}
+
+	old := toolResultText(t, a.GetHistory(), "toolu_r1")
+	want := "[elided: read_file main.go, 412 lines; re-read if needed]"
+	if old != want {
+		t.Errorf("old read = %q, want %q", old, want)
+	}
+	if recent := toolResultText(t, a.GetHistory(), "toolu_r2"); strings.HasPrefix(recent, "[elided:") {
+		t.Errorf("most recent read should be kept verbatim, got %q", recent)
+	}
+}
+
+// TestMicroCompact_PagedReads verifies reading different line ranges of the
+// same file does not mark the earlier page stale, while re-reading the same
+// range does.
+func TestMicroCompact_PagedReads(t *testing.T) {
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test")
+
+	page := func(id string, offset float64) providers.ContentBlock {
+		return providers.ContentBlock{Type: "tool_use", ID: id, Name: "read_file",
+			Input: map[string]interface{}{"path": "big.log", "offset": offset, "limit": float64(2000)}}
+	}
+	calls := []providers.ContentBlock{page("toolu_p1", 1), page("toolu_p2", 2001), page("toolu_p3", 2001)}
+	a.SetHistory(microHistory(calls, []string{bigOutput(2000), bigOutput(2000), bigOutput(2000)}))
+
+	if n := a.MicroCompact(); n != 1 {
+		t.Fatalf("MicroCompact() = %d, want 1", n)
+	}
+	if got := toolResultText(t, a.GetHistory(), "toolu_p1"); strings.HasPrefix(got, "[elided:") {
+		t.Error("first page should be kept: no later read covers it")
+	}
+	if got := toolResultText(t, a.GetHistory(), "toolu_p2"); !strings.HasPrefix(got, "[elided: read_file big.log") {
+		t.Errorf("re-read page should be elided, got %q", got[:40])
+	}
+}
+
+// TestMicroCompact_OldResults verifies results older than the keep window are
+// elided while recent ones survive.
+func TestMicroCompact_OldResults(t *testing.T) {
+	a := agent.New(agent.Config{
+		APIKey:                "fake",
+		APIURL:                "http://localhost",
+		ModelID:               "m",
+		MaxTokens:             1000,
+		MicroCompactKeepTurns: 2,
+	})
+
+	var calls []providers.ContentBlock
+	var bodies []string
+	for i := 1; i <= 4; i++ {
+		calls = append(calls, providers.ContentBlock{
+			Type: "tool_use", ID: fmt.Sprintf("toolu_b%d", i), Name: "run_bash",
+			Input: map[string]interface{}{"command": fmt.Sprintf("go test ./pkg%d/...", i)},
+		})
+		bodies = append(bodies, bigOutput(50))
+	}
+	a.SetHistory(microHistory(calls, bodies))
+
+	if n := a.MicroCompact(); n != 2 {
+		t.Fatalf("MicroCompact() = %d, want 2", n)
+	}
+
+	// With 4 turns and a window of 2, turn 3 is the oldest kept and turn 2,
+	// just outside the window, the newest elided.
+	for _, id := range []string{"toolu_b1", "toolu_b2"} {
+		got := toolResultText(t, a.GetHistory(), id)
+		if !strings.HasPrefix(got, "[elided: run_bash go test") || !strings.Contains(got, "re-run if needed") {
+			t.Errorf("%s should be elided, got %q", id, got)
+		}
+	}
+	for _, id := range []string{"toolu_b3", "toolu_b4"} {
+		if got := toolResultText(t, a.GetHistory(), id); strings.HasPrefix(got, "[elided:") {
+			t.Errorf("%s is within the keep window and should be kept", id)
+		}
+	}
+
+	// Idempotent: a second pass finds nothing new to elide.
+	if n := a.MicroCompact(); n != 0 {
+		t.Errorf("second MicroCompact() = %d, want 0", n)
+	}
+
+	// One more turn moves the window: turn 3 is now just outside it.
+	history := append(a.GetHistory(),
+		providers.Message{Role: "assistant", Content: []providers.ContentBlock{{Type: "text", Text: "checking"}}},
+	)
+	a.SetHistory(history)
+	if n := a.MicroCompact(); n != 1 {
+		t.Fatalf("MicroCompact() after another turn = %d, want 1", n)
+	}
+	if got := toolResultText(t, a.GetHistory(), "toolu_b3"); !strings.HasPrefix(got, "[elided:") {
+		t.Errorf("toolu_b3 left the keep window and should be elided, got %q", got)
+	}
+	if got := toolResultText(t, a.GetHistory(), "toolu_b4"); strings.HasPrefix(got, "[elided:") {
+		t.Error("toolu_b4 is the oldest turn in the keep window and should be kept")
+	}
+}
+
+// TestMicroCompact_KeepsVerbatimTools verifies old run_tests summaries are
+// left for compaction to keep verbatim.
+func TestMicroCompact_KeepsVerbatimTools(t *testing.T) {
+	a := agent.New(agent.Config{
+		APIKey:                "fake",
+		APIURL:                "http://localhost",
+		ModelID:               "m",
+		MaxTokens:             1000,
+		MicroCompactKeepTurns: 1,
+	})
+	calls := []providers.ContentBlock{
+		{Type: "tool_use", ID: "toolu_tests", Name: "run_tests", Input: map[string]interface{}{"packages": "./..."}},
+		{Type: "tool_use", ID: "toolu_bash", Name: "run_bash", Input: map[string]interface{}{"command": "go vet ./..."}},
+		{Type: "tool_use", ID: "toolu_last", Name: "list_files", Input: map[string]interface{}{"path": "."}},
+	}
+	a.SetHistory(microHistory(calls, []string{bigOutput(30), bigOutput(30), "a.go"}))
+
+	if n := a.MicroCompact(); n != 1 {
+		t.Fatalf("MicroCompact() = %d, want 1", n)
+	}
+	if got := toolResultText(t, a.GetHistory(), "toolu_tests"); strings.HasPrefix(got, "[elided:") {
+		t.Error("run_tests summary should be kept")
+	}
+	if got := toolResultText(t, a.GetHistory(), "toolu_bash"); !strings.HasPrefix(got, "[elided: run_bash") {
+		t.Errorf("old run_bash result should be elided, got %q", got)
+	}
+}
+
+// TestMicroCompact_PreservesPairing verifies tool_use/tool_result structure
+// (roles, IDs, block counts) is untouched and small results are left alone.
+func TestMicroCompact_PreservesPairing(t *testing.T) {
+	a := agent.New(agent.Config{
+		APIKey:                "fake",
+		APIURL:                "http://localhost",
+		ModelID:               "m",
+		MaxTokens:             1000,
+		MicroCompactKeepTurns: 1,
+	})
+
+	calls := []providers.ContentBlock{
+		{Type: "tool_use", ID: "toolu_small", Name: "list_files", Input: map[string]interface{}{"path": "."}},
+		{Type: "tool_use", ID: "toolu_big", Name: "grep", Input: map[string]interface{}{"pattern": "TODO"}},
+		{Type: "tool_use", ID: "toolu_last", Name: "read_file", Input: map[string]interface{}{"path": "a.go"}},
+	}
+	history := microHistory(calls, []string{"a.go\nb.go\n", bigOutput(30), bigOutput(30)})
+	a.SetHistory(append([]providers.Message(nil), history...))
+
+	before := len(a.GetHistory())
+	a.MicroCompact()
+	after := a.GetHistory()
+
+	if len(after) != before {
+		t.Fatalf("history length changed: %d → %d", before, len(after))
+	}
+	for i, msg := range after {
+		if msg.Role != history[i].Role {
+			t.Errorf("message %d role changed: %s → %s", i, history[i].Role, msg.Role)
+		}
+		blocks, ok := msg.Content.([]providers.ContentBlock)
+		if !ok {
+			continue
+		}
+		orig := history[i].Content.([]providers.ContentBlock)
+		if len(blocks) != len(orig) {
+			t.Errorf("message %d block count changed", i)
+			continue
+		}
+		for j := range blocks {
+			if blocks[j].Type != orig[j].Type || blocks[j].ID != orig[j].ID || blocks[j].ToolUseID != orig[j].ToolUseID {
+				t.Errorf("message %d block %d identity changed", i, j)
+			}
+		}
+	}
+
+	if got := toolResultText(t, after, "toolu_small"); got != "a.go\nb.go\n" {
+		t.Errorf("small result should be untouched, got %q", got)
+	}
+	if got := toolResultText(t, after, "toolu_big"); !strings.HasPrefix(got, "[elided: grep TODO, 30 lines") {
+		t.Errorf("old grep result should be elided, got %q", got)
+	}
+}
+
+// TestShouldMicroCompact_FreshAgent verifies no pruning happens before the
+// first API response or without a context window.
+func TestShouldMicroCompact_FreshAgent(t *testing.T) {
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test", agent.WithContextWindowSize(200000))
+	if a.ShouldMicroCompact() {
+		t.Error("fresh agent should not trigger micro-compaction")
+	}
+	b := agent.NewAgent(client, "test")
+	if b.ShouldMicroCompact() {
+		t.Error("agent without context window should not trigger micro-compaction")
+	}
+}
+
+// TestMicroCompact_RunsBeforeFullCompaction drives HandleMessage against a mock
+// API that reports usage above both thresholds. The stale read must be pruned
+// first; full compaction then runs only if the estimate is still over the
+// threshold (184000 tokens; pruning frees about 1100).
+func TestMicroCompact_RunsBeforeFullCompaction(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		inputTokens int
+		wantCompact bool
+	}{
+		{"pruning is enough", 184500, false},
+		{"still over", 195000, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			var compactionCalls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&calls, 1)
+				w.Header().Set("Content-Type", "application/json")
+				if n == 1 {
+					// Tool call; usage above the full compaction threshold.
+					fmt.Fprintf(w, `{
+						"content": [{"type": "tool_use", "id": "toolu_new", "name": "list_files", "input": {"path": "."}}],
+						"usage": {"input_tokens": %d, "output_tokens": 10}
+					}`, tc.inputTokens)
+					return
+				}
+				body := make([]byte, r.ContentLength)
+				r.Body.Read(body)
+				if strings.Contains(string(body), "Original Mission") {
+					atomic.AddInt32(&compactionCalls, 1)
+				}
+				fmt.Fprint(w, `{
+					"content": [{"type": "text", "text": "done"}],
+					"usage": {"input_tokens": 1000, "output_tokens": 10}
+				}`)
+			}))
+			defer server.Close()
+
+			client := providers.NewClient("fake", server.URL, "m", 1000)
+			var diagnostics []string
+			a := agent.NewAgent(client, "test",
+				agent.WithContextWindowSize(200000),
+				agent.WithDiagnosticCallback(func(msg string) { diagnostics = append(diagnostics, msg) }),
+			)
+
+			calls1 := []providers.ContentBlock{
+				{Type: "tool_use", ID: "toolu_r1", Name: "read_file", Input: map[string]interface{}{"path": "big.go"}},
+				{Type: "tool_use", ID: "toolu_r2", Name: "read_file", Input: map[string]interface{}{"path": "big.go"}},
+			}
+			history := microHistory(calls1, []string{bigOutput(100), bigOutput(100)})
+			history = append(history, providers.Message{Role: "assistant", Content: "Read it twice."})
+			a.SetHistory(history)
+
+			if _, err := a.HandleMessage("list the files"); err != nil {
+				t.Fatalf("HandleMessage: %v", err)
+			}
+
+			found := false
+			for _, d := range diagnostics {
+				if strings.Contains(d, "Micro-compaction: elided 1") {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("expected micro-compaction diagnostic, got %v", diagnostics)
+			}
+			if got := compactionCalls > 0; got != tc.wantCompact {
+				t.Errorf("full compaction ran %d phase calls, want compaction = %v", compactionCalls, tc.wantCompact)
+			}
+			if !tc.wantCompact {
+				if got := toolResultText(t, a.GetHistory(), "toolu_r1"); !strings.HasPrefix(got, "[elided: read_file big.go") {
+					t.Errorf("superseded read should be elided, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+// TestToolCallSubject_Runes verifies elided stubs shorten long arguments on
+// a rune boundary.
+func TestToolCallSubject_Runes(t *testing.T) {
+	a := agent.New(agent.Config{
+		APIKey:                "fake",
+		APIURL:                "http://localhost",
+		ModelID:               "m",
+		MaxTokens:             1000,
+		MicroCompactKeepTurns: 1,
+	})
+	calls := []providers.ContentBlock{
+		{Type: "tool_use", ID: "toolu_old", Name: "grep", Input: map[string]interface{}{"pattern": strings.Repeat("é", 100)}},
+		{Type: "tool_use", ID: "toolu_a", Name: "list_files", Input: map[string]interface{}{"path": "."}},
+	}
+	a.SetHistory(microHistory(calls, []string{bigOutput(30), "a.go"}))
+	a.MicroCompact()
+	got := toolResultText(t, a.GetHistory(), "toolu_old")
+	if !utf8.ValidString(got) || !strings.Contains(got, strings.Repeat("é", 77)+"...") {
+		t.Errorf("stub = %q", got)
+	}
+}
+
+// TestMicroCompact_Config verifies MICRO_COMPACT_PERCENT and
+// MICRO_COMPACT_KEEP_TURNS are parsed and validated.
+func TestMicroCompact_Config(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	subtests := []struct {
+		name        string
+		content     string
+		wantPercent int
+		wantKeep    int
+		wantErr     bool
+	}{
+		{
+			name:        "valid",
+			content:     "TS_AGENT_API_KEY=sk-test\nMICRO_COMPACT_PERCENT=50\nMICRO_COMPACT_KEEP_TURNS=4\n",
+			wantPercent: 50,
+			wantKeep:    4,
+		},
+		{
+			name:    "not_set_uses_default",
+			content: "TS_AGENT_API_KEY=sk-test\n",
+		},
+		{
+			name:    "percent_out_of_range",
+			content: "TS_AGENT_API_KEY=sk-test\nMICRO_COMPACT_PERCENT=99\n",
+			wantErr: true,
+		},
+		{
+			name:    "keep_turns_zero",
+			content: "TS_AGENT_API_KEY=sk-test\nMICRO_COMPACT_KEEP_TURNS=0\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range subtests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Unsetenv("MICRO_COMPACT_PERCENT")
+			os.Unsetenv("MICRO_COMPACT_KEEP_TURNS")
+			os.Unsetenv("TS_AGENT_API_KEY")
+			defer os.Unsetenv("MICRO_COMPACT_PERCENT")
+			defer os.Unsetenv("MICRO_COMPACT_KEEP_TURNS")
+			defer os.Unsetenv("TS_AGENT_API_KEY")
+
+			testConfigPath := filepath.Join(tmpDir, tc.name+"_config")
+			os.WriteFile(testConfigPath, []byte(tc.content), 0644)
+
+			cfg, err := config.LoadFromFile(testConfigPath)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.MicroCompactPercent != tc.wantPercent {
+				t.Errorf("MicroCompactPercent = %d, want %d", cfg.MicroCompactPercent, tc.wantPercent)
+			}
+			if cfg.MicroCompactKeepTurns != tc.wantKeep {
+				t.Errorf("MicroCompactKeepTurns = %d, want %d", cfg.MicroCompactKeepTurns, tc.wantKeep)
+			}
+		})
+	}
+}
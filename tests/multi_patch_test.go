@@ -9,23 +9,16 @@ import (
 
 // Unit tests for executeMultiPatch
 func TestExecuteMultiPatch(t *testing.T) {
-	// Create a temporary test directory with git repo
+	// A plain temp directory: multi_patch must not depend on git
 	tmpDir := t.TempDir()
 	oldDir, _ := os.Getwd()
 	defer os.Chdir(oldDir)
 	os.Chdir(tmpDir)
 
-	// Initialize git repo
-	exec.Command("git", "init").Run()
-	exec.Command("git", "config", "user.email", "test@example.com").Run()
-	exec.Command("git", "config", "user.name", "Test User").Run()
-
 	t.Run("Apply single patch successfully", func(t *testing.T) {
 		// Create test file
 		content := "line 1\nline 2\nline 3\n"
 		os.WriteFile("test1.txt", []byte(content), 0644)
-		exec.Command("git", "add", ".").Run()
-		exec.Command("git", "commit", "-m", "initial").Run()
 
 		patches := []interface{}{
 			map[string]interface{}{
@@ -55,8 +48,6 @@ func TestExecuteMultiPatch(t *testing.T) {
 		// Create test files
 		os.WriteFile("file1.txt", []byte("foo bar baz"), 0644)
 		os.WriteFile("file2.txt", []byte("hello world"), 0644)
-		exec.Command("git", "add", ".").Run()
-		exec.Command("git", "commit", "-m", "multi files").Run()
 
 		patches := []interface{}{
 			map[string]interface{}{
@@ -96,8 +87,6 @@ func TestExecuteMultiPatch(t *testing.T) {
 		// Create test files
 		os.WriteFile("rollback1.txt", []byte("alpha beta gamma"), 0644)
 		os.WriteFile("rollback2.txt", []byte("one two three"), 0644)
-		exec.Command("git", "add", ".").Run()
-		exec.Command("git", "commit", "-m", "rollback test").Run()
 
 		patches := []interface{}{
 			map[string]interface{}{
@@ -122,17 +111,110 @@ func TestExecuteMultiPatch(t *testing.T) {
 			t.Errorf("Expected failure message, got: %s", errMsg)
 		}
 
-		if !strings.Contains(errMsg, "rollback") || !strings.Contains(errMsg, "Rolling back") {
-			t.Errorf("Expected rollback message, got: %s", errMsg)
+		if !strings.Contains(errMsg, "No files were modified") {
+			t.Errorf("Expected 'No files were modified', got: %s", errMsg)
 		}
 
-		// Verify first file was rolled back
+		// Per-patch status: the first patch was valid, the second was not
+		if !strings.Contains(errMsg, "✓ Patch 1/2: rollback1.txt") {
+			t.Errorf("Expected status for valid patch, got: %s", errMsg)
+		}
+		if !strings.Contains(errMsg, "Patch 2/2: rollback2.txt FAILED") || !strings.Contains(errMsg, "not found") {
+			t.Errorf("Expected failure status for second patch, got: %s", errMsg)
+		}
+
+		// Neither file was touched
 		content, _ := os.ReadFile("rollback1.txt")
-		if strings.Contains(string(content), "BETA") {
-			t.Errorf("Expected file to be rolled back to 'beta', but found 'BETA': %s", string(content))
+		if string(content) != "alpha beta gamma" {
+			t.Errorf("Expected rollback1.txt unchanged, got: %s", string(content))
 		}
-		if !strings.Contains(string(content), "beta") {
-			t.Errorf("Expected original 'beta' after rollback, got: %s", string(content))
+		content, _ = os.ReadFile("rollback2.txt")
+		if string(content) != "one two three" {
+			t.Errorf("Expected rollback2.txt unchanged, got: %s", string(content))
+		}
+	})
+
+	t.Run("Multiple ordered edits to one file", func(t *testing.T) {
+		os.WriteFile("ordered.go", []byte("func oldName() {}\n\nfunc caller() { oldName() }\n"), 0644)
+
+		patches := []interface{}{
+			map[string]interface{}{
+				"path":     "ordered.go",
+				"old_text": "func oldName() {}",
+				"new_text": "func newName() {}",
+			},
+			// oldName now appears only once, thanks to the first edit
+			map[string]interface{}{
+				"path":     "ordered.go",
+				"old_text": "oldName()",
+				"new_text": "newName()",
+			},
+		}
+
+		result, err := executeMultiPatch(patches)
+		if err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if !strings.Contains(result, "Successfully applied all 2 patches to 1 files") {
+			t.Errorf("Expected success message, got: %s", result)
+		}
+
+		content, _ := os.ReadFile("ordered.go")
+		want := "func newName() {}\n\nfunc caller() { newName() }\n"
+		if string(content) != want {
+			t.Errorf("Expected %q, got %q", want, string(content))
+		}
+	})
+
+	t.Run("Later edit skipped after earlier failure in same file", func(t *testing.T) {
+		os.WriteFile("skip.txt", []byte("a b c"), 0644)
+
+		patches := []interface{}{
+			map[string]interface{}{"path": "skip.txt", "old_text": "missing", "new_text": "x"},
+			map[string]interface{}{"path": "skip.txt", "old_text": "b", "new_text": "B"},
+		}
+
+		_, err := executeMultiPatch(patches)
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		if !strings.Contains(err.Error(), "Patch 2/2: skip.txt: skipped") {
+			t.Errorf("Expected second patch to be reported as skipped, got: %v", err)
+		}
+	})
+
+	t.Run("Ambiguous match reports count", func(t *testing.T) {
+		os.WriteFile("dup.txt", []byte("x x"), 0644)
+
+		patches := []interface{}{
+			map[string]interface{}{"path": "dup.txt", "old_text": "x", "new_text": "y"},
+		}
+
+		_, err := executeMultiPatch(patches)
+		if err == nil || !strings.Contains(err.Error(), "appears 2 times") {
+			t.Errorf("Expected 'appears 2 times' error, got: %v", err)
+		}
+	})
+
+	t.Run("Preserves file mode and leaves no temp files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := dir + "/script.sh"
+		os.WriteFile(path, []byte("echo hi\n"), 0755)
+
+		patches := []interface{}{
+			map[string]interface{}{"path": path, "old_text": "hi", "new_text": "there"},
+		}
+		if _, err := executeMultiPatch(patches); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+
+		info, _ := os.Stat(path)
+		if info.Mode().Perm() != 0755 {
+			t.Errorf("Expected mode 0755, got %v", info.Mode().Perm())
+		}
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("Expected only script.sh in directory, found %d entries", len(entries))
 		}
 	})
 
@@ -186,8 +268,9 @@ func TestExecuteMultiPatch(t *testing.T) {
 		}
 	})
 
-	t.Run("Warn about uncommitted changes", func(t *testing.T) {
-		// Make uncommitted changes
+	t.Run("Applies in a directory with uncommitted changes", func(t *testing.T) {
+		// Uncommitted work is no reason to refuse: nothing outside the
+		// patched text is touched.
 		os.WriteFile("dirty.txt", []byte("uncommitted content"), 0644)
 
 		patches := []interface{}{
@@ -199,20 +282,62 @@ func TestExecuteMultiPatch(t *testing.T) {
 		}
 
 		result, err := executeMultiPatch(patches)
-		// Should not error, but should return warning
 		if err != nil {
-			t.Fatalf("Expected warning, not error: %v", err)
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if !strings.Contains(result, "Successfully applied") {
+			t.Errorf("Expected success message, got: %s", result)
 		}
 
-		t.Logf("Result: %s", result)
+		content, _ := os.ReadFile("dirty.txt")
+		if string(content) != "UNCOMMITTED content" {
+			t.Errorf("Expected patched content, got: %s", string(content))
+		}
+	})
+
+	t.Run("Edits to one file under different spellings share a buffer", func(t *testing.T) {
+		os.MkdirAll("sub", 0755)
+		os.WriteFile("same.txt", []byte("alpha beta gamma"), 0644)
 
-		if !strings.Contains(result, "uncommitted changes") && !strings.Contains(result, "commit") {
-			t.Errorf("Expected warning about uncommitted changes, got: %s", result)
+		patches := []interface{}{
+			map[string]interface{}{"path": "same.txt", "old_text": "alpha", "new_text": "ALPHA"},
+			map[string]interface{}{"path": "./same.txt", "old_text": "beta", "new_text": "BETA"},
+			map[string]interface{}{"path": "sub/../same.txt", "old_text": "ALPHA BETA", "new_text": "A B"},
 		}
 
-		// Clean up
-		exec.Command("git", "checkout", "--", "dirty.txt").Run()
-		os.Remove("dirty.txt")
+		result, err := executeMultiPatch(patches)
+		if err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+		if !strings.Contains(result, "to 1 files") {
+			t.Errorf("Expected one target file, got: %s", result)
+		}
+		content, _ := os.ReadFile("same.txt")
+		if string(content) != "A B gamma" {
+			t.Errorf("Expected every edit applied, got: %s", string(content))
+		}
+	})
+
+	t.Run("Editing a symlink changes its target and keeps the link", func(t *testing.T) {
+		os.WriteFile("real.txt", []byte("hello world"), 0644)
+		if err := os.Symlink("real.txt", "link.txt"); err != nil {
+			t.Fatal(err)
+		}
+
+		patches := []interface{}{
+			map[string]interface{}{"path": "link.txt", "old_text": "world", "new_text": "there"},
+		}
+		if _, err := executeMultiPatch(patches); err != nil {
+			t.Fatalf("Expected success, got error: %v", err)
+		}
+
+		content, _ := os.ReadFile("real.txt")
+		if string(content) != "hello there" {
+			t.Errorf("Expected the target patched, got: %s", string(content))
+		}
+		if info, err := os.Lstat("link.txt"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("link.txt should still be a symlink: %v, %v", info, err)
+		}
 	})
 }
 
@@ -315,7 +440,7 @@ func TestMultiPatchIntegration(t *testing.T) {
 		}
 	})
 
-	t.Run("Handle uncommitted changes warning", func(t *testing.T) {
+	t.Run("Patch an uncommitted file", func(t *testing.T) {
 		// Make uncommitted changes
 		os.WriteFile("uncommitted.txt", []byte("test content"), 0644)
 
@@ -331,21 +456,9 @@ func TestMultiPatchIntegration(t *testing.T) {
 
 		t.Logf("Response: %s", response)
 
-		// Look for warning about uncommitted changes in tool result
-		for _, msg := range updatedHistory {
-			if msg.Role == "user" {
-				if contentBlocks, ok := msg.Content.([]ContentBlock); ok {
-					for _, block := range contentBlocks {
-						if block.Type == "tool_result" {
-							if content, ok := block.Content.(string); ok {
-								if strings.Contains(content, "uncommitted") || strings.Contains(content, "commit") {
-									t.Logf("✓ Warning about uncommitted changes detected")
-								}
-							}
-						}
-					}
-				}
-			}
+		_ = updatedHistory
+		if content, _ := os.ReadFile("uncommitted.txt"); strings.Contains(string(content), "TEST") {
+			t.Logf("✓ Uncommitted file was patched")
 		}
 
 		// Clean up
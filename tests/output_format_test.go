@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/cli/loglevel"
+)
+
+// TestParseFlags_Formats parses --output-format and --input-format in both
+// forms, leaving the prompt.
+func TestParseFlags_Formats(t *testing.T) {
+	result := loglevel.ParseFlagsExt([]string{"--output-format", "json", "--input-format=stream-json", "-q", "Hello"})
+	if result.OutputFormat != "json" || result.InputFormat != "stream-json" || result.Level != loglevel.Quiet {
+		t.Errorf("result = %+v", result)
+	}
+	if len(result.Args) != 1 || result.Args[0] != "Hello" {
+		t.Errorf("args = %q", result.Args)
+	}
+	result = loglevel.ParseFlagsExt([]string{"--output-format=stream-json", "Hello"})
+	if result.OutputFormat != "stream-json" || result.InputFormat != "" {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+// cliResult is the json output, as documented in the README.
+type cliResult struct {
+	Type       string   `json:"type"`
+	Result     string   `json:"result"`
+	StopReason string   `json:"stop_reason"`
+	IsError    bool     `json:"is_error"`
+	Error      string   `json:"error"`
+	NumTurns   int      `json:"num_turns"`
+	CostUSD    *float64 `json:"cost_usd"`
+	SessionDir string   `json:"session_dir"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// TestCLIMode_OutputFormats runs CLI mode with each non-text format.
+func TestCLIMode_OutputFormats(t *testing.T) {
+	binaryPath := buildTestBinary(t)
+	defer os.Remove(binaryPath)
+
+	tmpDir := t.TempDir()
+	configDir := filepath.Join(tmpDir, ".clyde")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	createTestConfig(t, filepath.Join(configDir, "config"))
+
+	t.Run("json", func(t *testing.T) {
+		cmd := exec.Command(binaryPath, "--output-format", "json", "What is 2+2? Answer with the number only.")
+		cmd.Env = append(os.Environ(), "HOME="+tmpDir)
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("CLI mode failed: %v\nOutput: %s", err, output)
+		}
+		var r cliResult
+		if err := json.Unmarshal(output, &r); err != nil {
+			t.Fatalf("stdout is not one JSON object: %v\n%s", err, output)
+		}
+		if r.Type != "result" || r.IsError || !strings.Contains(r.Result, "4") || r.StopReason != "end_turn" || r.NumTurns != 1 {
+			t.Errorf("result = %+v", r)
+		}
+		if r.Usage.InputTokens == 0 || r.Usage.OutputTokens == 0 || r.SessionDir == "" {
+			t.Errorf("usage = %+v, session dir = %q", r.Usage, r.SessionDir)
+		}
+	})
+
+	t.Run("stream-json in and out", func(t *testing.T) {
+		cmd := exec.Command(binaryPath, "--input-format", "stream-json", "--output-format", "stream-json")
+		cmd.Env = append(os.Environ(), "HOME="+tmpDir)
+		cmd.Stdin = strings.NewReader(`{"type":"user","text":"Remember the number 7. Reply OK."}` + "\n\n" +
+			`{"type":"user","text":"What number did I ask you to remember? Answer with the number only."}` + "\n")
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("CLI mode failed: %v\nOutput: %s", err, output)
+		}
+
+		var types []string
+		var results []cliResult
+		scanner := bufio.NewScanner(bytes.NewReader(output))
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			var line struct {
+				Type string `json:"type"`
+				ID   string `json:"id"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+				t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+			}
+			types = append(types, line.Type)
+			if line.Type == "result" {
+				var r cliResult
+				json.Unmarshal(scanner.Bytes(), &r)
+				results = append(results, r)
+			} else if line.ID == "" {
+				t.Errorf("event without ID: %s", scanner.Text())
+			}
+		}
+		joined := " " + strings.Join(types, " ") + " "
+		for _, want := range []string{" turn_start user api_request usage ", " assistant turn_end result "} {
+			if strings.Count(joined, want) != 2 {
+				t.Errorf("want %q twice in %s", want, joined)
+			}
+		}
+		if len(results) != 2 || results[1].NumTurns != 2 || !strings.Contains(results[1].Result, "7") {
+			t.Errorf("results = %+v", results)
+		}
+	})
+
+	t.Run("invalid format", func(t *testing.T) {
+		cmd := exec.Command(binaryPath, "--output-format", "xml", "Hello")
+		cmd.Env = append(os.Environ(), "HOME="+tmpDir)
+		output, err := cmd.CombinedOutput()
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			t.Errorf("err = %v, want exit code 1", err)
+		}
+		if !strings.Contains(string(output), `unknown output format "xml"`) {
+			t.Errorf("output = %s", output)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatchFileLayeredMatching(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "code.go")
+
+	t.Run("Exact match has no note", func(t *testing.T) {
+		os.WriteFile(path, []byte("a := 1\nb := 2\n"), 0644)
+		result, err := executePatchFile(path, "b := 2", "b := 3")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if strings.Contains(result, "Note:") {
+			t.Errorf("Exact match should not carry a note: %s", result)
+		}
+	})
+
+	t.Run("CRLF file with LF old_text", func(t *testing.T) {
+		os.WriteFile(path, []byte("one\r\ntwo\r\nthree\r\n"), 0644)
+		result, err := executePatchFile(path, "one\ntwo\n", "ONE\nTWO\n")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(result, "matched lines 1-2 ignoring trailing whitespace and line endings") {
+			t.Errorf("Expected note about normalization, got: %s", result)
+		}
+		if got, _ := os.ReadFile(path); string(got) != "ONE\r\nTWO\r\nthree\r\n" {
+			t.Errorf("content = %q, want CRLF preserved", got)
+		}
+	})
+
+	t.Run("Trailing whitespace in file", func(t *testing.T) {
+		os.WriteFile(path, []byte("func f() {   \n\treturn\n}\n"), 0644)
+		_, err := executePatchFile(path, "func f() {\n\treturn", "func f() {\n\treturn // done")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got, _ := os.ReadFile(path); string(got) != "func f() {\n\treturn // done\n}\n" {
+			t.Errorf("content = %q", got)
+		}
+	})
+
+	t.Run("Indentation-relative match re-indents new_text", func(t *testing.T) {
+		os.WriteFile(path, []byte("func f() {\n\tfor {\n\t\tif x {\n\t\t\tbreak\n\t\t}\n\t}\n}\n"), 0644)
+		result, err := executePatchFile(path,
+			"if x {\n\tbreak\n}",
+			"if x {\n\ty()\n\tbreak\n}")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(result, "ignoring a difference in indentation") ||
+			!strings.Contains(result, "re-indented from no indentation to 2 tabs") {
+			t.Errorf("Expected indentation note, got: %s", result)
+		}
+		want := "func f() {\n\tfor {\n\t\tif x {\n\t\t\ty()\n\t\t\tbreak\n\t\t}\n\t}\n}\n"
+		if got, _ := os.ReadFile(path); string(got) != want {
+			t.Errorf("content = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Not found lists closest candidates", func(t *testing.T) {
+		os.WriteFile(path, []byte("package x\n\nfunc Alpha() int { return 1 }\nfunc Beta() int { return 2 }\n"), 0644)
+		_, err := executePatchFile(path, "func Alpha() int { return 10 }", "x")
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		msg := err.Error()
+		if !strings.Contains(msg, "not found") || !strings.Contains(msg, "Closest candidates:") {
+			t.Errorf("Expected candidates, got: %s", msg)
+		}
+		if !strings.Contains(msg, "lines 3-3 (") || !strings.Contains(msg, "% similar") {
+			t.Errorf("Expected line numbers and similarity, got: %s", msg)
+		}
+	})
+
+	t.Run("Ambiguous exact match lists locations", func(t *testing.T) {
+		os.WriteFile(path, []byte("x := 1\ny := 2\nx := 1\n"), 0644)
+		_, err := executePatchFile(path, "x := 1", "x := 3")
+		if err == nil {
+			t.Fatal("Expected error")
+		}
+		msg := err.Error()
+		if !strings.Contains(msg, "appears 2 times") || !strings.Contains(msg, "lines 1-1") || !strings.Contains(msg, "lines 3-3") {
+			t.Errorf("Expected both locations, got: %s", msg)
+		}
+	})
+
+	t.Run("Ambiguous fuzzy match is rejected", func(t *testing.T) {
+		os.WriteFile(path, []byte("\tdone()  \n\n\tdone() \n"), 0644)
+		_, err := executePatchFile(path, "\tdone()\n", "\tfinish()\n")
+		if err == nil || !strings.Contains(err.Error(), "matches 2 places") {
+			t.Errorf("Expected ambiguity error, got: %v", err)
+		}
+	})
+}
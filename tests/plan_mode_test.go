@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/session"
+	"github.com/this-is-alpha-iota/clyde/cli/loglevel"
+)
+
+// TestPlanMode explores with read-only tools, submits a plan, approves it
+// and implements it with every tool.
+func TestPlanMode(t *testing.T) {
+	work := t.TempDir()
+	planInput := map[string]interface{}{
+		"title":   "Add a greeting",
+		"summary": "main.go prints nothing yet.",
+		"steps":   []interface{}{"Print hello in main"},
+		"files":   []interface{}{"main.go"},
+	}
+	server, requests := startTaskServer(t,
+		toolCall("toolu_1", "write_file", map[string]interface{}{"path": filepath.Join(work, "main.go"), "content": "x"}),
+		toolCall("toolu_2", "submit_plan", planInput),
+		[]providers.ContentBlock{{Type: "text", Text: "Plan submitted."}},
+		// After approval
+		[]providers.ContentBlock{{Type: "text", Text: "Done."}},
+	)
+	type planEvent struct {
+		title    string
+		approved bool
+	}
+	var events []planEvent
+	sess := &session.Session{Dir: t.TempDir()}
+	a := agent.New(agent.Config{
+		APIKey:         "fake",
+		APIURL:         server.URL,
+		ModelID:        "m",
+		MaxTokens:      1000,
+		NoThink:        true,
+		PlanMode:       true,
+		WorkspaceRoots: []string{work},
+	}, agent.WithPlanCallback(func(p agent.Plan, approved bool) {
+		events = append(events, planEvent{p.Title, approved})
+		sess.WriteMessage(session.TypePlan, session.FormatPlan(p.Markdown(), approved))
+	}))
+
+	if _, err := a.ApprovePlan(); err == nil {
+		t.Error("ApprovePlan() without a plan should fail")
+	}
+	if _, err := a.HandleMessage("add a greeting"); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := *requests
+	planning := reqs[0]
+	if !strings.Contains(planning.System, "PLAN MODE IS ON") {
+		t.Errorf("plan mode system prompt = %s", planning.System)
+	}
+	for _, name := range []string{"read_file", "grep", "ask_user", "submit_plan"} {
+		if !hasTool(planning.Tools, name) {
+			t.Errorf("plan mode is missing %s: %v", name, planning.Tools)
+		}
+	}
+	for _, name := range []string{"write_file", "run_bash", "patch_file", "task"} {
+		if hasTool(planning.Tools, name) {
+			t.Errorf("plan mode offers %s: %v", name, planning.Tools)
+		}
+	}
+	if !strings.Contains(string(reqs[1].Messages[2]), "write_file is not available here") {
+		t.Errorf("write_file result = %s", reqs[1].Messages[2])
+	}
+	if _, err := os.Stat(filepath.Join(work, "main.go")); err == nil {
+		t.Error("write_file ran in plan mode")
+	}
+
+	pending := a.PendingPlan()
+	if pending == nil || pending.Title != "Add a greeting" || !a.PlanMode() {
+		t.Fatalf("pending plan = %+v, plan mode = %v", pending, a.PlanMode())
+	}
+
+	// Approval turns plan mode off and pins the plan in the history
+	if _, err := a.ApprovePlan(); err != nil {
+		t.Fatal(err)
+	}
+	if a.PlanMode() || a.PendingPlan() != nil {
+		t.Errorf("after approval: plan mode = %v, pending = %v", a.PlanMode(), a.PendingPlan())
+	}
+	history := a.GetHistory()
+	pinned := history[len(history)-2].Content.(string)
+	if !strings.HasPrefix(pinned, agent.ApprovedPlanPrefix+"\n\n# Plan: Add a greeting\n") || !strings.Contains(pinned, "1. Print hello in main") {
+		t.Errorf("pinned plan = %q", pinned)
+	}
+
+	if _, err := a.HandleMessage("Implement the approved plan."); err != nil {
+		t.Fatal(err)
+	}
+	implementing := (*requests)[len(*requests)-1]
+	if strings.Contains(implementing.System, "PLAN MODE IS ON") {
+		t.Error("the planning prompt is still in the system prompt after approval")
+	}
+	if !hasTool(implementing.Tools, "write_file") || hasTool(implementing.Tools, "submit_plan") {
+		t.Errorf("tools after approval = %v", implementing.Tools)
+	}
+	if len(events) != 2 || events[0] != (planEvent{"Add a greeting", false}) || !events[1].approved {
+		t.Errorf("plan events = %+v", events)
+	}
+
+	// Both plans are saved; only the approved one is restored on resume
+	files, _ := filepath.Glob(filepath.Join(sess.Dir, "*_plan.md"))
+	if len(files) != 2 {
+		t.Fatalf("plan files = %v", files)
+	}
+	restored, _, err := session.ReconstructHistory(sess.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 || restored[0].Content != pinned || restored[1].Role != "assistant" {
+		t.Errorf("restored history = %+v", restored)
+	}
+
+	if !loglevel.ParseFlagsExt([]string{"--plan", "-q", "explore"}).Plan {
+		t.Error("--plan was not parsed")
+	}
+}
+
+// TestCompact_KeepsApprovedPlan checks that an approved plan in the
+// summarized part of the history stays pinned, verbatim, after compaction.
+func TestCompact_KeepsApprovedPlan(t *testing.T) {
+	ts := startMockCompactionServer(t, func(body string) string { return "Phase output" })
+	defer ts.Close()
+
+	plan := agent.ApprovedPlanPrefix + "\n\n# Plan: Add a greeting\n\nSummary\n\n## Steps\n\n1. Print hello"
+	history := []providers.Message{
+		{Role: "user", Content: "add a greeting"},
+		{Role: "assistant", Content: "Plan submitted."},
+		{Role: "user", Content: plan},
+		{Role: "assistant", Content: "The plan is approved. I'll implement it step by step."},
+	}
+	for i := 0; i < 8; i++ {
+		history = append(history, providers.Message{Role: []string{"user", "assistant"}[i%2], Content: "message"})
+	}
+	a := agent.NewAgent(providers.NewClient("fake-key", ts.URL, "m", 4096), "test", agent.WithContextWindowSize(200000))
+	a.SetHistory(history)
+	if err := a.Compact(); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+
+	compacted := a.GetHistory()
+	found := 0
+	for i, msg := range compacted {
+		if msg.Content == plan {
+			found++
+			if i != 4 || compacted[i+1].Role != "assistant" {
+				t.Errorf("pinned plan at %d in %+v", i, compacted)
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("compacted history has the plan %d times: %+v", found, compacted)
+	}
+}
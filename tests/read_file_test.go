@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/this-is-alpha-iota/clyde/agent/config"
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+// numberedLines returns "line 1\nline 2\n...line n\n".
+func numberedLines(n int) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, "line %d\n", i)
+	}
+	return b.String()
+}
+
+func TestReadFilePaging(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.txt")
+	big := filepath.Join(dir, "big.log")
+	os.WriteFile(small, []byte(numberedLines(10)), 0644)
+	os.WriteFile(big, []byte(numberedLines(2500)), 0644)
+
+	t.Run("Small file is returned verbatim", func(t *testing.T) {
+		got, err := executeReadFile(small)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != numberedLines(10) {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("Offset and limit", func(t *testing.T) {
+		got, err := executeToolWith("read_file", map[string]interface{}{"path": small, "offset": float64(3), "limit": float64(2)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "line 3\nline 4\n\n[Showing lines 3-4. File has 10 lines; use offset=5 to continue.]"
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Line number gutter", func(t *testing.T) {
+		got, err := executeToolWith("read_file", map[string]interface{}{"path": small, "offset": float64(9), "line_numbers": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "   9 | line 9\n  10 | line 10\n") {
+			t.Errorf("got %q", got)
+		}
+		if !strings.Contains(got, "Showing lines 9-10. File has 10 lines.") {
+			t.Errorf("expected range note without continuation, got %q", got)
+		}
+	})
+
+	t.Run("Default cap on large files", func(t *testing.T) {
+		got, err := executeReadFile(big)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "line 2000\n") || strings.Contains(got, "line 2001\n") {
+			t.Error("expected exactly the first 2000 lines")
+		}
+		if !strings.HasSuffix(got, "[Showing lines 1-2000. File has 2500 lines; use offset=2001 to continue.]") {
+			t.Errorf("unexpected footer: %q", got[len(got)-100:])
+		}
+	})
+
+	t.Run("Configured cap applies when the call gives no limit", func(t *testing.T) {
+		tools.SetReadFileMaxLines(5)
+		defer tools.SetReadFileMaxLines(0)
+		got, err := executeReadFile(small)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(got, "[Showing lines 1-5. File has 10 lines; use offset=6 to continue.]") {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("Files over 1 MB can be paged", func(t *testing.T) {
+		huge := filepath.Join(dir, "huge.log")
+		os.WriteFile(huge, []byte(strings.Repeat(strings.Repeat("x", 99)+"\n", 20000)), 0644)
+		got, err := executeToolWith("read_file", map[string]interface{}{"path": huge, "offset": float64(19999)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "Showing lines 19999-20000. File has 20000 lines.") {
+			t.Errorf("unexpected result: %q", got)
+		}
+	})
+
+	t.Run("Offset past end of file", func(t *testing.T) {
+		_, err := executeToolWith("read_file", map[string]interface{}{"path": small, "offset": float64(11)})
+		if err == nil || !strings.Contains(err.Error(), "has 10 lines") {
+			t.Errorf("expected past-end error, got %v", err)
+		}
+	})
+
+	t.Run("Binary files are described, not returned", func(t *testing.T) {
+		bin := filepath.Join(dir, "image.png")
+		os.WriteFile(bin, append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), make([]byte, 100)...), 0644)
+		out, err := executeReadFile(bin)
+		if err == nil {
+			t.Fatalf("expected binary error, got output %q", out)
+		}
+		if !strings.Contains(err.Error(), "binary file") || !strings.Contains(err.Error(), "image/png") {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("Very long lines are truncated", func(t *testing.T) {
+		minified := filepath.Join(dir, "app.min.js")
+		os.WriteFile(minified, []byte(strings.Repeat("a", 5000)+"\n"), 0644)
+		got, err := executeReadFile(minified)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) > 2200 || !strings.Contains(got, "[line truncated, 5000 chars]") {
+			t.Errorf("expected truncated line, got %d bytes", len(got))
+		}
+	})
+
+	t.Run("Long lines are truncated on a rune boundary", func(t *testing.T) {
+		wide := filepath.Join(dir, "wide.txt")
+		os.WriteFile(wide, []byte("a"+strings.Repeat("日本", 1500)+"\n"), 0644)
+		got, err := executeReadFile(wide)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !utf8.ValidString(got) || !strings.Contains(got, "[line truncated, 3001 chars]") {
+			t.Errorf("expected valid truncated line, got %q", got[len(got)-80:])
+		}
+	})
+}
+
+// TestReadFile_Config verifies READ_FILE_MAX_LINES is parsed and validated.
+func TestReadFile_Config(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	subtests := []struct {
+		name      string
+		content   string
+		wantLines int
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			content:   "TS_AGENT_API_KEY=sk-test\nREAD_FILE_MAX_LINES=500\n",
+			wantLines: 500,
+		},
+		{
+			name:    "not_set_uses_default",
+			content: "TS_AGENT_API_KEY=sk-test\n",
+		},
+		{
+			name:    "zero",
+			content: "TS_AGENT_API_KEY=sk-test\nREAD_FILE_MAX_LINES=0\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range subtests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Unsetenv("READ_FILE_MAX_LINES")
+			os.Unsetenv("TS_AGENT_API_KEY")
+			defer os.Unsetenv("READ_FILE_MAX_LINES")
+			defer os.Unsetenv("TS_AGENT_API_KEY")
+
+			testConfigPath := filepath.Join(tmpDir, tc.name+"_config")
+			os.WriteFile(testConfigPath, []byte(tc.content), 0644)
+
+			cfg, err := config.LoadFromFile(testConfigPath)
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.ReadFileMaxLines != tc.wantLines {
+				t.Errorf("ReadFileMaxLines = %d, want %d", cfg.ReadFileMaxLines, tc.wantLines)
+			}
+		})
+	}
+}
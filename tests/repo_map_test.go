@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/config"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+// repoMapFixture creates a small git repository with two Go packages.
+func repoMapFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		".git/HEAD": "ref: refs/heads/main\n",
+		"go.mod":    "module example\n",
+		"main.go":   "package main\n\nimport \"example/greet\"\n\nfunc main() { greet.Hello(\"world\") }\n",
+		"greet/greet.go": "package greet\n\n// Greeter greets people.\ntype Greeter struct{}\n\n" +
+			"// Hello returns a greeting.\nfunc Hello(name string) string { return \"hello \" + name }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func executeRepoMap(input map[string]interface{}) (string, error) {
+	reg, _ := tools.GetTool("repo_map")
+	return reg.Execute(input, nil, nil)
+}
+
+func TestRepoMapTool(t *testing.T) {
+	dir := repoMapFixture(t)
+
+	t.Run("Outlines the repository", func(t *testing.T) {
+		got, err := executeRepoMap(map[string]interface{}{"path": dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"2 source files",
+			"greet/greet.go (package greet)\n  4: type Greeter struct\n  7: func Hello(name string) string",
+			"main.go (package main)\n  5: func main()",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("missing %q in:\n%s", want, got)
+			}
+		}
+		// greet is referenced by main, so it comes first.
+		if strings.Index(got, "greet/greet.go") > strings.Index(got, "main.go (package") {
+			t.Errorf("referenced package should rank first:\n%s", got)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".clyde", "repomap.json")); err != nil {
+			t.Errorf("map was not cached: %v", err)
+		}
+	})
+
+	t.Run("Path narrows the map", func(t *testing.T) {
+		got, err := executeRepoMap(map[string]interface{}{"path": filepath.Join(dir, "greet")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "Repository map of greet: 1 source file") || strings.Contains(got, "main.go") {
+			t.Errorf("unexpected map:\n%s", got)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		if _, err := executeRepoMap(map[string]interface{}{"path": filepath.Join(dir, "missing")}); err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("expected missing path error, got %v", err)
+		}
+		if _, err := executeRepoMap(map[string]interface{}{"path": dir, "max_tokens": float64(10)}); err == nil || !strings.Contains(err.Error(), "at least 100") {
+			t.Errorf("expected max_tokens error, got %v", err)
+		}
+	})
+
+	t.Run("Display", func(t *testing.T) {
+		reg, _ := tools.GetTool("repo_map")
+		if got := reg.Display(map[string]interface{}{}); got != "→ Mapping repository: . (current directory)" {
+			t.Errorf("display = %q", got)
+		}
+	})
+}
+
+// TestRepoMap_SystemPrompt verifies the map is added to the system prompt,
+// built once, and kept out of the history and the session.
+func TestRepoMap_SystemPrompt(t *testing.T) {
+	dir := repoMapFixture(t)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var systems []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			System string `json:"system"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		systems = append(systems, req.System)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"content": [{"type": "text", "text": "ok"}], "usage": {"input_tokens": 10, "output_tokens": 1}}`)
+	}))
+	defer server.Close()
+
+	var persisted, diagnostics []string
+	client := providers.NewClient("fake", server.URL, "m", 1000)
+	a := agent.NewAgent(client, "test",
+		agent.WithRepoMap(1000),
+		agent.WithUserMessageCallback(func(text string) { persisted = append(persisted, text) }),
+		agent.WithDiagnosticCallback(func(msg string) { diagnostics = append(diagnostics, msg) }),
+	)
+	a.HandleMessage("fix the greeting")
+	a.HandleMessage("thanks")
+
+	if len(systems) != 2 {
+		t.Fatalf("got %d requests, want 2", len(systems))
+	}
+	for i, system := range systems {
+		if !strings.HasPrefix(system, "test\n\n<repository_map>\nRepository map of the repository") ||
+			!strings.Contains(system, "func Hello(name string) string") ||
+			!strings.HasSuffix(system, "</repository_map>") {
+			t.Errorf("request %d system prompt should carry the map, got:\n%s", i+1, system)
+		}
+	}
+	history := a.GetHistory()
+	if first, _ := history[0].Content.(string); first != "fix the greeting" {
+		t.Errorf("first message = %q, want it as typed", first)
+	}
+	if strings.Join(persisted, "|") != "fix the greeting|thanks" {
+		t.Errorf("session should see the messages as typed, got %q", persisted)
+	}
+	built := 0
+	for _, d := range diagnostics {
+		if strings.HasPrefix(d, "🗺️ Repo map:") {
+			built++
+		}
+	}
+	if built != 1 {
+		t.Errorf("map built %d times, want once", built)
+	}
+}
+
+func TestRepoMap_Config(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, tc := range []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"2000", 2000, false},
+		{"0", 0, false},
+		{"100", 0, true},
+		{"lots", 0, true},
+	} {
+		os.Unsetenv("REPO_MAP_TOKENS")
+		os.Unsetenv("TS_AGENT_API_KEY")
+		content := "TS_AGENT_API_KEY=sk-test\n"
+		if tc.value != "" {
+			content += "REPO_MAP_TOKENS=" + tc.value + "\n"
+		}
+		path := filepath.Join(tmpDir, "config_"+tc.value)
+		os.WriteFile(path, []byte(content), 0644)
+
+		cfg, err := config.LoadFromFile(path)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("REPO_MAP_TOKENS=%s: expected error", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("REPO_MAP_TOKENS=%s: %v", tc.value, err)
+		}
+		if cfg.RepoMapTokens != tc.want {
+			t.Errorf("REPO_MAP_TOKENS=%s: got %d, want %d", tc.value, cfg.RepoMapTokens, tc.want)
+		}
+	}
+	os.Unsetenv("REPO_MAP_TOKENS")
+	os.Unsetenv("TS_AGENT_API_KEY")
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/session"
+)
+
+// rewindHistory is a three-turn conversation with a tool call in turn two and
+// a compaction summary (which is not a real user turn) before turn three.
+func rewindHistory() []providers.Message {
+	return []providers.Message{
+		{Role: "user", Content: "first task"},
+		{Role: "assistant", Content: "done"},
+		{Role: "user", Content: "second task"},
+		{Role: "assistant", Content: []providers.ContentBlock{
+			{Type: "tool_use", ID: "toolu_1", Name: "list_files", Input: map[string]interface{}{"path": "."}},
+		}},
+		{Role: "user", Content: []providers.ContentBlock{
+			{Type: "tool_result", ToolUseID: "toolu_1", Content: "a.go"},
+		}},
+		{Role: "assistant", Content: "listed"},
+		{Role: "user", Content: "[System: Compaction Summary]\n\nstuff"},
+		{Role: "assistant", Content: "ok"},
+		{Role: "user", Content: "third task"},
+		{Role: "assistant", Content: "done again"},
+	}
+}
+
+// TestRewindPoints verifies only real user turns are offered as rewind targets.
+func TestRewindPoints(t *testing.T) {
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test")
+	a.SetHistory(rewindHistory())
+
+	points := a.RewindPoints()
+	want := []agent.RewindPoint{
+		{Index: 0, Text: "first task"},
+		{Index: 2, Text: "second task"},
+		{Index: 8, Text: "third task"},
+	}
+	if len(points) != len(want) {
+		t.Fatalf("got %d points, want %d: %+v", len(points), len(want), points)
+	}
+	for i := range want {
+		if points[i] != want[i] {
+			t.Errorf("point %d = %+v, want %+v", i, points[i], want[i])
+		}
+	}
+}
+
+// TestRewindTo verifies history is truncated before the chosen user turn and
+// the removed tail is returned.
+func TestRewindTo(t *testing.T) {
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test")
+	a.SetHistory(rewindHistory())
+
+	removed, err := a.RewindTo(2)
+	if err != nil {
+		t.Fatalf("RewindTo: %v", err)
+	}
+	if got := len(a.GetHistory()); got != 2 {
+		t.Errorf("history length = %d, want 2", got)
+	}
+	if len(removed) != 8 || removed[0].Content != "second task" {
+		t.Errorf("removed = %d messages starting %v, want 8 starting \"second task\"", len(removed), removed[0].Content)
+	}
+	if a.LastUsage() != (agent.Usage{}) {
+		t.Error("usage should be reset after rewind")
+	}
+
+	// Appending after a rewind must not clobber the returned removed slice.
+	a.SetHistory(append(a.GetHistory(), providers.Message{Role: "user", Content: "retry"}))
+	if removed[0].Content != "second task" {
+		t.Error("removed messages were overwritten by later appends")
+	}
+}
+
+// TestRewindTo_Todos verifies rewinding past a todo_write restores the list
+// set before it, and clears the list when none was set.
+func TestRewindTo_Todos(t *testing.T) {
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test")
+	todoTurn := func(text, id string, todos ...interface{}) []providers.Message {
+		return []providers.Message{
+			{Role: "user", Content: text},
+			{Role: "assistant", Content: []providers.ContentBlock{
+				{Type: "tool_use", ID: id, Name: "todo_write", Input: map[string]interface{}{"todos": todos}},
+			}},
+			{Role: "user", Content: []providers.ContentBlock{
+				{Type: "tool_result", ToolUseID: id, Content: "Todo list updated."},
+			}},
+			{Role: "assistant", Content: "ok"},
+		}
+	}
+	step := func(id, status string) interface{} {
+		return map[string]interface{}{"id": id, "content": "step " + id, "status": status}
+	}
+	var history []providers.Message
+	history = append(history, todoTurn("plan", "toolu_1", step("1", "pending"))...)
+	history = append(history, todoTurn("work", "toolu_2", step("1", "done"), step("2", "in_progress"))...)
+	a.SetHistory(history)
+	a.SetTodos([]agent.TodoItem{{ID: "1", Content: "step 1", Status: "done"}, {ID: "2", Content: "step 2", Status: "in_progress"}})
+
+	if _, err := a.RewindTo(4); err != nil {
+		t.Fatalf("RewindTo: %v", err)
+	}
+	if got := a.Todos(); len(got) != 1 || got[0].Status != "pending" {
+		t.Errorf("todos after rewinding one turn = %+v, want step 1 pending", got)
+	}
+
+	if _, err := a.RewindTo(0); err != nil {
+		t.Fatalf("RewindTo: %v", err)
+	}
+	if got := a.Todos(); len(got) != 0 {
+		t.Errorf("todos after rewinding to the start = %+v, want none", got)
+	}
+}
+
+// TestRewindTo_InvalidIndex verifies non-user-turn targets are rejected and
+// history is left untouched.
+func TestRewindTo_InvalidIndex(t *testing.T) {
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test")
+	a.SetHistory(rewindHistory())
+
+	for _, idx := range []int{-1, 1, 4, 6, 99} {
+		if _, err := a.RewindTo(idx); err == nil {
+			t.Errorf("RewindTo(%d) should fail", idx)
+		}
+	}
+	if got := len(a.GetHistory()); got != 10 {
+		t.Errorf("history length = %d after failed rewinds, want 10", got)
+	}
+}
+
+// editTurn builds an assistant tool call and its successful result.
+func editTurn(id, name string, input map[string]interface{}, result string) []providers.Message {
+	return []providers.Message{
+		{Role: "assistant", Content: []providers.ContentBlock{
+			{Type: "tool_use", ID: id, Name: name, Input: input},
+		}},
+		{Role: "user", Content: []providers.ContentBlock{
+			{Type: "tool_result", ToolUseID: id, Content: result},
+		}},
+	}
+}
+
+// TestRestoreFiles verifies patch_file, multi_patch and write_file edits are
+// undone newest first, and unsafe reversals are skipped and reported.
+func TestRestoreFiles(t *testing.T) {
+	dir := t.TempDir()
+	main := filepath.Join(dir, "main.go")
+	util := filepath.Join(dir, "util.go")
+	created := filepath.Join(dir, "new.go")
+	overwritten := filepath.Join(dir, "README.md")
+
+	// Final on-disk state after the edits below.
+	os.WriteFile(main, []byte("func run() { start(); finish() }\n"), 0644)
+	os.WriteFile(util, []byte("// helpers v2\n"), 0644)
+	os.WriteFile(created, []byte("package x\n"), 0644)
+	os.WriteFile(overwritten, []byte("new readme\n"), 0644)
+
+	removed := []providers.Message{{Role: "user", Content: "refactor"}}
+	removed = append(removed, editTurn("t1", "patch_file", map[string]interface{}{
+		"path": main, "old_text": "go()", "new_text": "start()",
+	}, "Successfully patched")...)
+	removed = append(removed, editTurn("t2", "multi_patch", map[string]interface{}{
+		"patches": []interface{}{
+			map[string]interface{}{"path": main, "old_text": "stop()", "new_text": "finish()"},
+			map[string]interface{}{"path": util, "old_text": "v1", "new_text": "v2"},
+		},
+	}, "Successfully applied all 2 patches")...)
+	removed = append(removed, editTurn("t3", "write_file", map[string]interface{}{
+		"path": created, "content": "package x\n",
+	}, "Successfully created "+created+" (10 bytes written)")...)
+	removed = append(removed, editTurn("t4", "write_file", map[string]interface{}{
+		"path": overwritten, "content": "new readme\n",
+	}, "Successfully replaced contents of "+overwritten)...)
+	removed = append(removed, editTurn("t5", "run_bash", map[string]interface{}{
+		"command": "go generate",
+	}, "ok")...)
+
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test")
+	report := a.RestoreFiles(removed)
+
+	if got, _ := os.ReadFile(main); string(got) != "func run() { go(); stop() }\n" {
+		t.Errorf("main.go = %q", got)
+	}
+	if got, _ := os.ReadFile(util); string(got) != "// helpers v1\n" {
+		t.Errorf("util.go = %q", got)
+	}
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Error("file created by write_file should be removed")
+	}
+	if got, _ := os.ReadFile(overwritten); string(got) != "new readme\n" {
+		t.Error("overwritten file without recorded content should be left alone")
+	}
+
+	if len(report.Restored) != 3 {
+		t.Errorf("Restored = %v, want main.go, util.go, new.go", report.Restored)
+	}
+	skipped := strings.Join(report.Skipped, "\n")
+	if !strings.Contains(skipped, "README.md: overwritten") {
+		t.Errorf("expected README.md to be reported as skipped, got %q", skipped)
+	}
+	if !strings.Contains(skipped, "run_bash") {
+		t.Errorf("expected run_bash to be reported as skipped, got %q", skipped)
+	}
+}
+
+// TestRestoreFiles_ChangedSince verifies a patch is not reverted when the
+// edited text is no longer in the file.
+func TestRestoreFiles_ChangedSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.go")
+	os.WriteFile(path, []byte("hand-edited\n"), 0644)
+
+	removed := editTurn("t1", "patch_file", map[string]interface{}{
+		"path": path, "old_text": "old", "new_text": "new",
+	}, "Successfully patched")
+
+	client := providers.NewClient("fake", "http://localhost", "m", 1000)
+	a := agent.NewAgent(client, "test")
+	report := a.RestoreFiles(removed)
+
+	if len(report.Restored) != 0 || len(report.Skipped) != 1 {
+		t.Fatalf("report = %+v, want one skipped edit", report)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "hand-edited\n" {
+		t.Errorf("file should be untouched, got %q", got)
+	}
+}
+
+// TestSessionCopyUntil verifies only files strictly before the cutoff are
+// copied into the fork and the source is untouched.
+func TestSessionCopyUntil(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "2026-07-15T10-00-00_aj")
+	os.MkdirAll(src, 0755)
+	writeFile(t, src, "2026-07-15T10-00-00.000_user.md", "**You:**\n\nfirst\n")
+	writeFile(t, src, "2026-07-15T10-00-05.000_assistant.md", "**Claude:**\n\nOK\n")
+	writeFile(t, src, "2026-07-15T10-01-00.000_user.md", "**You:**\n\nsecond\n")
+	writeFile(t, src, "2026-07-15T10-01-05.000_assistant.md", "**Claude:**\n\nOK again\n")
+
+	msgs, err := session.ListUserMessages(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[1].Text != "second" {
+		t.Fatalf("ListUserMessages = %+v", msgs)
+	}
+
+	newDir, err := session.CopyUntil(src, root, "aj", msgs[1].Timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(filepath.Base(newDir), "_aj_from_2026-07-15T10-00-00_aj") {
+		t.Errorf("fork dir should record provenance, got %s", filepath.Base(newDir))
+	}
+
+	entries, _ := os.ReadDir(newDir)
+	if len(entries) != 2 {
+		t.Fatalf("fork has %d files, want 2", len(entries))
+	}
+	history, _, err := session.ReconstructHistory(newDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Content != "first" {
+		t.Errorf("fork history = %+v, want first turn only", history)
+	}
+
+	if entries, _ := os.ReadDir(src); len(entries) != 4 {
+		t.Errorf("source should keep all 4 files, has %d", len(entries))
+	}
+
+	// A second fork in the same second must not reuse the first fork's directory.
+	again, err := session.CopyUntil(src, root, "aj", msgs[1].Timestamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == newDir {
+		t.Error("second fork reused the first fork's directory")
+	}
+}
+
+// TestSessionFork verifies a forked session writes new messages to the fork.
+func TestSessionFork(t *testing.T) {
+	root := t.TempDir()
+	src := filepath.Join(root, "2026-07-15T10-00-00_aj")
+	os.MkdirAll(src, 0755)
+	writeFile(t, src, "2026-07-15T10-00-00.000_user.md", "**You:**\n\nfirst\n")
+	writeFile(t, src, "2026-07-15T10-01-00.000_user.md", "**You:**\n\nsecond\n")
+
+	sess, err := session.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cutoff, _ := session.ParseTimestampFromFilename("2026-07-15T10-01-00.000_user.md")
+	if err := sess.Fork(cutoff); err != nil {
+		t.Fatal(err)
+	}
+	if sess.Dir == src {
+		t.Fatal("session should point at the fork")
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	if err := sess.WriteMessage(session.TypeUser, "**You:**\n\nretry\n"); err != nil {
+		t.Fatal(err)
+	}
+	msgs, _ := session.ListUserMessages(sess.Dir)
+	if len(msgs) != 2 || msgs[0].Text != "first" || msgs[1].Text != "retry" {
+		t.Errorf("fork user messages = %+v, want [first retry]", msgs)
+	}
+	if orig, _ := session.ListUserMessages(src); len(orig) != 2 || orig[1].Text != "second" {
+		t.Errorf("original session changed: %+v", orig)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+// testModuleFixture creates a Go module with passing, skipped, failing,
+// panicking and non-compiling tests, plus a package without tests.
+func testModuleFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example\n\ngo 1.21\n",
+		"ok/ok_test.go": `package ok
+
+import "testing"
+
+func TestA(t *testing.T)    {}
+func TestSkip(t *testing.T) { t.Skip("not today") }
+`,
+		"bad/bad_test.go": `package bad
+
+import "testing"
+
+func TestTable(t *testing.T) {
+	t.Run("good", func(t *testing.T) {})
+	t.Run("broken case", func(t *testing.T) {
+		t.Errorf("got %d, want %d", 1, 2)
+	})
+}
+
+func TestPanic(t *testing.T) {
+	var m map[string]int
+	m["x"] = 1
+}
+`,
+		"nobuild/nobuild_test.go": "package nobuild\n\nimport \"testing\"\n\nfunc TestX(t *testing.T) { undefined() }\n",
+		"empty/empty.go":          "package empty\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func executeRunTests(input map[string]interface{}) (string, error) {
+	reg, _ := tools.GetTool("run_tests")
+	return reg.Execute(input, nil, nil)
+}
+
+func TestRunTests(t *testing.T) {
+	dir := testModuleFixture(t)
+
+	t.Run("Summarizes a failing suite", func(t *testing.T) {
+		got, err := executeRunTests(map[string]interface{}{"path": dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range []string{
+			"FAIL: 2 passed, 3 failed, 1 skipped (",
+			"Packages: 1 ok, 2 failed, 1 without tests",
+			"--- Build failed: example/nobuild",
+			"nobuild_test.go:5:28: undefined: undefined",
+			"--- FAIL: TestTable/broken_case (example/bad, ",
+			"    at bad_test.go:8\n    bad_test.go:8: got 1, want 2",
+			"--- FAIL: TestPanic (example/bad, ",
+			"panic: assignment to entry in nil map",
+			"example/bad.TestPanic(",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("missing %q in:\n%s", want, got)
+			}
+		}
+		// Parents of failing subtests, go test framing and runtime frames are left out.
+		for _, unwanted := range []string{"--- FAIL: TestTable (", "=== RUN", "testing.tRunner"} {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("unexpected %q in:\n%s", unwanted, got)
+			}
+		}
+	})
+
+	t.Run("Package and run filters", func(t *testing.T) {
+		got, err := executeRunTests(map[string]interface{}{"path": dir, "packages": "./ok ./bad", "run": "TestA|TestTable/good"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "PASS: 3 passed, 0 failed, 0 skipped (") || !strings.Contains(got, "Packages: 2 ok") {
+			t.Errorf("unexpected summary:\n%s", got)
+		}
+	})
+
+	t.Run("No tests matched", func(t *testing.T) {
+		got, err := executeRunTests(map[string]interface{}{"path": dir, "packages": "./ok", "run": "TestNothing", "no_cache": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "NO TESTS RUN: 0 passed") {
+			t.Errorf("unexpected summary:\n%s", got)
+		}
+	})
+
+	t.Run("Bad package pattern", func(t *testing.T) {
+		got, err := executeRunTests(map[string]interface{}{"path": dir, "packages": "./missing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(got, "FAIL:") || !strings.Contains(got, "missing") {
+			t.Errorf("unexpected summary:\n%s", got)
+		}
+	})
+
+	t.Run("Input errors", func(t *testing.T) {
+		if _, err := executeRunTests(map[string]interface{}{"path": filepath.Join(dir, "nope")}); err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("expected missing directory error, got %v", err)
+		}
+		if _, err := executeRunTests(map[string]interface{}{"path": dir, "run": "Test("}); err == nil || !strings.Contains(err.Error(), "not a valid regular expression") {
+			t.Errorf("expected regexp error, got %v", err)
+		}
+		if _, err := executeRunTests(map[string]interface{}{"path": dir, "timeout": float64(0)}); err == nil || !strings.Contains(err.Error(), "at least 1 second") {
+			t.Errorf("expected timeout error, got %v", err)
+		}
+		for _, flag := range []string{"-exec=sh -c 'touch pwned'", "./... -toolexec=/bin/true"} {
+			if _, err := executeRunTests(map[string]interface{}{"path": dir, "packages": flag}); err == nil || !strings.Contains(err.Error(), "got flag") {
+				t.Errorf("packages %q: expected flag error, got %v", flag, err)
+			}
+		}
+	})
+
+	t.Run("Display", func(t *testing.T) {
+		reg, _ := tools.GetTool("run_tests")
+		if got := reg.Display(map[string]interface{}{}); got != "→ Running tests: ./..." {
+			t.Errorf("display = %q", got)
+		}
+		got := reg.Display(map[string]interface{}{"packages": "./agent/...", "run": "TestFoo", "path": "sub"})
+		if got != "→ Running tests: ./agent/... (run: TestFoo) in sub" {
+			t.Errorf("display = %q", got)
+		}
+	})
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/customtools"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/sandbox"
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+)
+
+// sandboxProject creates a git repository with the given sandbox.json,
+// makes it the working directory for the rest of the test and loads its
+// sandbox configuration, as the agent does when it starts.
+func sandboxProject(t *testing.T, config string) string {
+	t.Helper()
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.MkdirAll(filepath.Join(dir, ".clyde"), 0755)
+	if err := os.WriteFile(filepath.Join(dir, ".clyde", "sandbox.json"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	tools.LoadSandbox(".")
+	t.Cleanup(func() {
+		os.Chdir(wd)
+		tools.LoadSandbox(".")
+	})
+	return dir
+}
+
+func TestRunBash_Sandbox(t *testing.T) {
+	// A file next to the tests, outside the sandboxed project.
+	outside, _ := filepath.Abs("sandbox-outside.txt")
+	defer os.Remove(outside)
+
+	dir := sandboxProject(t, `{"enabled": true}`)
+	if _, err := sandbox.New(sandbox.Config{Enabled: true}, dir); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	reg, _ := tools.GetTool("run_bash")
+
+	t.Run("Workspace is writable", func(t *testing.T) {
+		out, err := reg.Execute(map[string]interface{}{"command": "echo hi > inside.txt && cat inside.txt"}, nil, nil)
+		if err != nil || out != "hi\n" {
+			t.Fatalf("got %q, %v", out, err)
+		}
+	})
+
+	t.Run("Writes outside are blocked and explained", func(t *testing.T) {
+		_, err := reg.Execute(map[string]interface{}{"command": "echo x > " + outside}, nil, nil)
+		if err == nil {
+			t.Fatal("expected the write to fail")
+		}
+		for _, want := range []string{"Read-only file system", "Sandbox: the command tried to write outside the writable paths", "unsandboxed: true"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("missing %q in:\n%v", want, err)
+			}
+		}
+		if _, statErr := os.Stat(outside); statErr == nil {
+			t.Error("file was written outside the workspace")
+		}
+	})
+
+	t.Run("The configuration cannot be changed from inside", func(t *testing.T) {
+		_, err := reg.Execute(map[string]interface{}{"command": `echo '{"enabled": false}' > .clyde/sandbox.json`}, nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "Read-only file system") {
+			t.Errorf("expected the write to fail, got %v", err)
+		}
+		// Even when changed by other means, it is only read at startup.
+		os.WriteFile(filepath.Join(dir, ".clyde", "sandbox.json"), []byte(`{"enabled": false}`), 0644)
+		defer os.WriteFile(filepath.Join(dir, ".clyde", "sandbox.json"), []byte(`{"enabled": true}`), 0644)
+		if _, err := reg.Execute(map[string]interface{}{"command": "echo x > " + outside}, nil, nil); err == nil {
+			t.Error("the sandbox should stay enabled until the next start")
+		}
+	})
+
+	t.Run("Unsandboxed runs unconfined", func(t *testing.T) {
+		// The agent asks for approval first; the executor trusts its input.
+		_, err := reg.Execute(map[string]interface{}{"command": "echo x > " + outside, "unsandboxed": true}, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, statErr := os.Stat(outside); statErr != nil {
+			t.Error("unsandboxed command should write outside the workspace")
+		}
+	})
+}
+
+func TestRunBash_Permission(t *testing.T) {
+	reg, _ := tools.GetTool("run_bash")
+	unsandboxed := map[string]interface{}{"command": "make install", "unsandboxed": true}
+
+	sandboxProject(t, `{"enabled": false}`)
+	if got := reg.Permission(unsandboxed); got != "" {
+		t.Errorf("no approval needed without an enabled sandbox, got %q", got)
+	}
+
+	sandboxProject(t, `{"enabled": true}`)
+	if got := reg.Permission(map[string]interface{}{"command": "make install"}); got != "" {
+		t.Errorf("sandboxed commands need no approval, got %q", got)
+	}
+	if got := reg.Permission(unsandboxed); !strings.Contains(got, "outside the sandbox") || !strings.Contains(got, "make install") {
+		t.Errorf("unexpected request %q", got)
+	}
+	if got := reg.Display(unsandboxed); got != "→ Running bash (unsandboxed): make install" {
+		t.Errorf("display = %q", got)
+	}
+}
+
+// TestPermissionCallback verifies that tool calls needing approval run only
+// when the permission callback approves them.
+func TestPermissionCallback(t *testing.T) {
+	sandboxProject(t, `{"enabled": true}`)
+
+	newServer := func() *httptest.Server {
+		calls := 0
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.Header().Set("Content-Type", "application/json")
+			if calls == 1 {
+				fmt.Fprint(w, `{"content": [{"type": "tool_use", "id": "toolu_1", "name": "run_bash", "input": {"command": "echo escaped > marker.txt", "unsandboxed": true}}], "stop_reason": "tool_use", "usage": {"input_tokens": 10, "output_tokens": 1}}`)
+				return
+			}
+			fmt.Fprint(w, `{"content": [{"type": "text", "text": "done"}], "usage": {"input_tokens": 10, "output_tokens": 1}}`)
+		}))
+	}
+	toolResult := func(a *agent.Agent) providers.ContentBlock {
+		blocks, _ := a.GetHistory()[2].Content.([]providers.ContentBlock)
+		if len(blocks) != 1 {
+			t.Fatalf("expected one tool result, got %+v", a.GetHistory()[2].Content)
+		}
+		return blocks[0]
+	}
+
+	for _, tc := range []struct {
+		name     string
+		callback agent.PermissionCallback
+		approved bool
+		decision string
+	}{
+		{"No callback", nil, false, "🔐 Permission denied (no user to ask) for run_bash"},
+		{"Denied", func(string, string) bool { return false }, false, "🔐 Permission denied for run_bash"},
+		{"Approved", func(string, string) bool { return true }, true, "🔐 Permission approved for run_bash"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Remove("marker.txt")
+			server := newServer()
+			defer server.Close()
+
+			var asked []string
+			var diagnostics []string
+			opts := []agent.AgentOption{
+				agent.WithDiagnosticCallback(func(msg string) { diagnostics = append(diagnostics, msg) }),
+			}
+			if tc.callback != nil {
+				opts = append(opts, agent.WithPermissionCallback(func(toolName, request string) bool {
+					asked = append(asked, toolName+": "+request)
+					return tc.callback(toolName, request)
+				}))
+			}
+			a := agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test", opts...)
+			if _, err := a.HandleMessage("install it"); err != nil {
+				t.Fatal(err)
+			}
+
+			result := toolResult(a)
+			_, statErr := os.Stat("marker.txt")
+			if tc.approved {
+				if result.IsError || statErr != nil {
+					t.Errorf("approved call should run: %+v", result)
+				}
+			} else {
+				if !result.IsError || !strings.HasPrefix(result.Content.(string), "Permission denied") || statErr == nil {
+					t.Errorf("denied call should not run: %+v", result)
+				}
+			}
+			if tc.callback != nil && (len(asked) != 1 || !strings.Contains(asked[0], "run_bash: Run this command outside the sandbox")) {
+				t.Errorf("asked = %q", asked)
+			}
+			if !strings.Contains(strings.Join(diagnostics, "\n"), tc.decision) {
+				t.Errorf("missing %q in diagnostics %q", tc.decision, diagnostics)
+			}
+		})
+	}
+}
+
+// TestSandboxConfig_Protected verifies that file tools cannot rewrite the
+// sandbox configuration.
+func TestSandboxConfig_Protected(t *testing.T) {
+	dir := sandboxProject(t, `{"enabled": true}`)
+	server := startScriptedServer(t, toolCall("toolu_1", "write_file", map[string]interface{}{
+		"path": ".clyde/sandbox.json", "content": `{"enabled": false}`,
+	}))
+	a := agent.New(agent.Config{APIKey: "fake", APIURL: server.URL, ModelID: "m", MaxTokens: 1000, NoThink: true})
+	if _, err := a.HandleMessage("go"); err != nil {
+		t.Fatal(err)
+	}
+	result := lastToolResult(t, a)
+	if !result.IsError || !strings.Contains(result.Content.(string), "only the user may change it") {
+		t.Errorf("write should be denied: %+v", result)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, ".clyde", "sandbox.json")); string(data) != `{"enabled": true}` {
+		t.Errorf("config was changed to %q", data)
+	}
+}
+
+// TestRunTests_Sandbox verifies that go test runs inside an enabled
+// sandbox: tests can write to the workspace but nowhere else.
+func TestRunTests_Sandbox(t *testing.T) {
+	outside, _ := filepath.Abs("sandbox-outside.txt")
+	defer os.Remove(outside)
+	out, err := exec.Command("go", "env", "GOCACHE", "GOMODCACHE").Output()
+	if err != nil {
+		t.Skipf("go env: %v", err)
+	}
+	caches, _ := json.Marshal(strings.Fields(string(out)))
+	dir := sandboxProject(t, `{"enabled": true, "writable": `+string(caches)+`}`)
+	if _, err := sandbox.New(sandbox.Config{Enabled: true}, dir); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example\n\ngo 1.21\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "write_test.go"), []byte(`package example
+
+import (
+	"os"
+	"testing"
+)
+
+func TestInside(t *testing.T) {
+	if err := os.WriteFile("inside.txt", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutside(t *testing.T) {
+	if err := os.WriteFile(`+strconv.Quote(outside)+`, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+`), 0644)
+
+	got, err := executeRunTests(map[string]interface{}{"no_cache": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"1 passed, 1 failed", "--- FAIL: TestOutside", "read-only file system", "Sandbox: the command tried to write outside the writable paths"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if _, err := os.Stat(outside); err == nil {
+		t.Error("test wrote outside the workspace")
+	}
+}
+
+// TestCustomTools_Sandbox verifies that custom tools run inside an enabled
+// sandbox.
+func TestCustomTools_Sandbox(t *testing.T) {
+	outside, _ := filepath.Abs("sandbox-outside.txt")
+	defer os.Remove(outside)
+	dir := sandboxProject(t, `{"enabled": true}`)
+	if _, err := sandbox.New(sandbox.Config{Enabled: true}, dir); err != nil {
+		t.Skipf("sandbox unavailable: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "touch.yaml")
+	os.WriteFile(path, []byte("name: customtools_touch\ndescription: x\ninput_schema:\n  type: object\n  properties:\n    file: {type: string}\ncommand: echo x > {{file}}\n"), 0644)
+	def, err := customtools.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	customtools.Register([]*customtools.Definition{def})
+	defer customtools.Register(nil)
+	reg, _ := tools.GetTool("customtools_touch")
+
+	if _, err := reg.Execute(map[string]interface{}{"file": "inside.txt"}, nil, nil); err != nil {
+		t.Errorf("writing the workspace should work: %v", err)
+	}
+	_, err = reg.Execute(map[string]interface{}{"file": outside}, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "Sandbox: the command tried to write outside the writable paths") {
+		t.Errorf("expected a sandbox error, got %v", err)
+	}
+	if _, statErr := os.Stat(outside); statErr == nil {
+		t.Error("custom tool wrote outside the workspace")
+	}
+}
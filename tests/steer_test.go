@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/session"
+	"github.com/this-is-alpha-iota/clyde/cli/input"
+	"github.com/this-is-alpha-iota/clyde/cli/spinner"
+)
+
+// TestQueue_SteersTurn queues messages while a turn runs: one goes out with
+// the next tool results, one typed after them is held for the next turn.
+func TestQueue_SteersTurn(t *testing.T) {
+	work := t.TempDir()
+	server, requests := startTaskServer(t,
+		toolCall("toolu_1", "list_files", map[string]interface{}{"path": work}),
+		[]providers.ContentBlock{{Type: "text", Text: "Listed, and I will update the README too."}},
+	)
+	sess := &session.Session{Dir: t.TempDir()}
+	var a *agent.Agent
+	type queueEvent struct {
+		delivered string
+		queued    int
+	}
+	var events []queueEvent
+	a = agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test",
+		agent.WithUserMessageCallback(func(text string) { sess.WriteMessage(session.TypeUser, "**You:**\n\n"+text+"\n") }),
+		agent.WithAssistantMessageCallback(func(text string) {
+			sess.WriteMessage(session.TypeAssistant, "**Claude:**\n\n"+text+"\n")
+			// Typed after the last tool results: held
+			a.Queue("and bump the version")
+		}),
+		agent.WithToolUseCallback(func(displayMsg, toolName, toolUseID string, input map[string]interface{}) {
+			sess.WriteMessage(session.TypeToolUse, displayMsg+" ["+toolUseID+"]\nname: "+toolName+"\ninput: {}\n")
+		}),
+		agent.WithOutputCallback(func(output, toolUseID string) {
+			sess.WriteMessage(session.TypeToolResult, "["+toolUseID+"]\n```\n"+output+"\n```\n")
+		}),
+		agent.WithProgressCallback(func(msg, _ string) {
+			// Typed while list_files runs
+			a.Queue("also update the README")
+		}),
+		agent.WithQueueCallback(func(delivered, queued []string) {
+			events = append(events, queueEvent{strings.Join(delivered, ","), len(queued)})
+		}),
+	)
+	if _, err := a.HandleMessage("list the files"); err != nil {
+		t.Fatal(err)
+	}
+
+	second := (*requests)[1].Messages
+	last := string(second[len(second)-1])
+	if !strings.Contains(last, `"tool_result"`) || !strings.HasSuffix(last, `{"type":"text","text":"also update the README"}]}`) {
+		t.Errorf("tool results message = %s", last)
+	}
+	want := []queueEvent{{"", 1}, {"also update the README", 0}, {"", 1}}
+	if len(events) != len(want) {
+		t.Fatalf("queue events = %+v", events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Errorf("queue event %d = %+v, want %+v", i, events[i], want[i])
+		}
+	}
+	if held := a.TakeQueued(); len(held) != 1 || held[0] != "and bump the version" || len(a.Queued()) != 0 {
+		t.Errorf("held = %q, queued = %q", held, a.Queued())
+	}
+
+	// On resume the delivered message is part of the tool results again
+	history, _, err := session.ReconstructHistory(sess.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("reconstructed %d messages, want 4: %+v", len(history), history)
+	}
+	blocks := history[2].Content.([]providers.ContentBlock)
+	if len(blocks) != 2 || blocks[0].Type != "tool_result" || blocks[1].Text != "also update the README" {
+		t.Errorf("reconstructed tool results = %+v", blocks)
+	}
+}
+
+// TestTypeahead reads lines typed while the agent works, and leaves the
+// unsubmitted rest for the next prompt.
+func TestTypeahead(t *testing.T) {
+	r, err := input.New(input.Config{
+		HistoryFile: filepath.Join(t.TempDir(), "history"),
+		Stdin:       newMockStdin("also\x7f\x7f\x7f\x7f\rstop using sed\rre\x15rerun it"),
+		Stdout:      io.Discard,
+		Stderr:      io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var lines []string
+	typed := make(chan struct{})
+	ta, err := r.StartTypeahead("", func(partial string) {
+		if partial == "rerun it" {
+			close(typed)
+		}
+	}, func(line string) { lines = append(lines, line) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-typed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("typeahead did not read the input")
+	}
+	rest := ta.Stop()
+	if strings.Join(lines, "|") != "stop using sed" {
+		t.Errorf("lines = %q", lines)
+	}
+	if rest != "rerun it" {
+		t.Errorf("rest = %q", rest)
+	}
+
+	// The rest starts the next prompt
+	next, err := input.New(input.Config{
+		HistoryFile: filepath.Join(t.TempDir(), "history"),
+		Stdin:       newMockStdin(" now\r"),
+		Stdout:      io.Discard,
+		Stderr:      io.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer next.Close()
+	next.Prefill(rest)
+	if line, err := next.ReadLine(); err != nil || line != "rerun it now" {
+		t.Errorf("ReadLine() = %q, %v", line, err)
+	}
+}
+
+// TestSpinnerStatus shows the status after the message, across restarts.
+func TestSpinnerStatus(t *testing.T) {
+	var buf bytes.Buffer
+	s := spinner.NewWithWriter(&buf)
+	s.SetStatus("[1 queued]")
+	s.Start("Thinking...")
+	time.Sleep(50 * time.Millisecond)
+	s.Stop()
+	if !strings.Contains(buf.String(), "Thinking...  [1 queued]") {
+		t.Errorf("spinner output = %q", buf.String())
+	}
+	if s.Status() != "[1 queued]" {
+		t.Errorf("status after Stop = %q", s.Status())
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/session"
+)
+
+// taskRequest is what the scripted task server saw in one API request.
+type taskRequest struct {
+	Model    string
+	System   string
+	Tools    []string
+	Messages []json.RawMessage
+}
+
+// startTaskServer answers requests from script in order, like
+// startScriptedServer, and records each request.
+func startTaskServer(t *testing.T, script ...[]providers.ContentBlock) (*httptest.Server, *[]taskRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []taskRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req struct {
+			Model    string            `json:"model"`
+			System   json.RawMessage   `json:"system"`
+			Tools    []providers.Tool  `json:"tools"`
+			Messages []json.RawMessage `json:"messages"`
+		}
+		json.Unmarshal(body, &req)
+		seen := taskRequest{Model: req.Model, System: string(req.System), Messages: req.Messages}
+		for _, tool := range req.Tools {
+			seen.Tools = append(seen.Tools, tool.Name)
+		}
+		sort.Strings(seen.Tools)
+
+		mu.Lock()
+		content := []providers.ContentBlock{{Type: "text", Text: "done"}}
+		if len(requests) < len(script) {
+			content = script[len(requests)]
+		}
+		requests = append(requests, seen)
+		mu.Unlock()
+
+		stopReason := "end_turn"
+		for _, block := range content {
+			if block.Type == "tool_use" {
+				stopReason = "tool_use"
+			}
+		}
+		data, _ := json.Marshal(content)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"content": %s, "stop_reason": %q, "usage": {"input_tokens": 100, "output_tokens": 10}}`, data, stopReason)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// TestTask delegates work to a sub-agent through the task tool.
+func TestTask(t *testing.T) {
+	work := t.TempDir()
+	os.WriteFile(filepath.Join(work, "main.go"), []byte("package main\n"), 0644)
+
+	t.Run("Sub-agent reports back with read-only tools", func(t *testing.T) {
+		server, requests := startTaskServer(t,
+			toolCall("toolu_task", "task", map[string]interface{}{
+				"description": "Find callers",
+				"prompt":      "Find every caller of main.",
+				"model":       "small-model",
+			}),
+			// Sub-agent
+			toolCall("toolu_c1", "run_bash", map[string]interface{}{"command": "rm -rf /"}),
+			toolCall("toolu_c2", "list_files", map[string]interface{}{"path": work}),
+			[]providers.ContentBlock{{Type: "text", Text: "main is called from nowhere (main.go:1)."}},
+			// Parent
+			[]providers.ContentBlock{{Type: "text", Text: "Nobody calls main."}},
+		)
+		var progress []string
+		sess := &session.Session{Dir: t.TempDir()}
+		a := agent.NewAgent(providers.NewClient("fake", server.URL, "big-model", 1000), "base prompt",
+			agent.WithProgressCallback(func(msg, _ string) { progress = append(progress, msg) }),
+			agent.WithSubAgentCallback(func(toolUseID, description string) []agent.AgentOption {
+				child, err := sess.Child(filepath.Join("tasks", toolUseID))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return []agent.AgentOption{
+					agent.WithUserMessageCallback(func(text string) { child.WriteMessage(session.TypeUser, "**You:**\n\n"+text+"\n") }),
+					agent.WithAssistantMessageCallback(func(text string) { child.WriteMessage(session.TypeAssistant, "**Claude:**\n\n"+text+"\n") }),
+				}
+			}),
+		)
+		response, err := a.HandleMessage("who calls main?")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response != "Nobody calls main." {
+			t.Errorf("response = %q", response)
+		}
+
+		// The parent only sees the report
+		history := a.GetHistory()
+		if len(history) != 4 {
+			t.Fatalf("parent history has %d messages, want 4", len(history))
+		}
+		result := lastToolResult(t, a)
+		if result.IsError || result.Content != "main is called from nowhere (main.go:1)." {
+			t.Errorf("task result = %+v", result)
+		}
+
+		reqs := *requests
+		if len(reqs) != 5 {
+			t.Fatalf("%d API requests, want 5", len(reqs))
+		}
+		child := reqs[1]
+		if child.Model != "small-model" || reqs[0].Model != "big-model" || reqs[4].Model != "big-model" {
+			t.Errorf("models = %q, %q, %q", reqs[0].Model, child.Model, reqs[4].Model)
+		}
+		if len(child.Messages) != 1 || !strings.Contains(string(child.Messages[0]), "Find every caller of main.") {
+			t.Errorf("sub-agent started with %d messages: %s", len(child.Messages), child.Messages)
+		}
+		if !strings.Contains(child.System, "base prompt") || !strings.Contains(child.System, "sub-agent") {
+			t.Errorf("sub-agent system prompt = %s", child.System)
+		}
+		for _, name := range []string{"read_file", "grep", "list_files"} {
+			if !hasTool(child.Tools, name) {
+				t.Errorf("sub-agent is missing %s: %v", name, child.Tools)
+			}
+		}
+		for _, name := range []string{"task", "run_bash", "write_file"} {
+			if hasTool(child.Tools, name) {
+				t.Errorf("sub-agent has %s: %v", name, child.Tools)
+			}
+		}
+		if !hasTool(reqs[0].Tools, "task") {
+			t.Errorf("parent tools = %v", reqs[0].Tools)
+		}
+		if !strings.Contains(string(reqs[2].Messages[2]), "run_bash is not available here") {
+			t.Errorf("run_bash result = %s", reqs[2].Messages[2])
+		}
+
+		want := []string{"→ Delegating task: Find callers", "→ ↳ Listing files: " + work}
+		if strings.Join(progress, "\n") != strings.Join(want, "\n") {
+			t.Errorf("progress = %q, want %q", progress, want)
+		}
+
+		// The sub-agent's conversation is saved in its own directory, and
+		// left out of the parent's history
+		files, _ := filepath.Glob(filepath.Join(sess.Dir, "tasks", "toolu_task", "*.md"))
+		if len(files) != 2 {
+			t.Errorf("task session files = %v", files)
+		}
+		if history, _, err := session.ReconstructHistory(sess.Dir); err != nil || len(history) != 0 {
+			t.Errorf("parent session history = %v, %v", history, err)
+		}
+	})
+
+	t.Run("Budget and tool validation", func(t *testing.T) {
+		server, requests := startTaskServer(t,
+			toolCall("toolu_1", "task", map[string]interface{}{
+				"description": "Recurse", "prompt": "x", "tools": []interface{}{"read_file", "task"},
+			}),
+			toolCall("toolu_2", "task", map[string]interface{}{
+				"description": "Loop", "prompt": "keep looking", "max_turns": float64(2), "tools": []interface{}{"list_files"},
+			}),
+			toolCall("toolu_c1", "list_files", map[string]interface{}{"path": work}),
+			toolCall("toolu_c2", "list_files", map[string]interface{}{"path": work}),
+		)
+		a := agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test")
+		if _, err := a.HandleMessage("go"); err != nil {
+			t.Fatal(err)
+		}
+		history := a.GetHistory()
+		recursive := history[2].Content.([]providers.ContentBlock)[0]
+		if !recursive.IsError || !strings.Contains(recursive.Content.(string), "cannot start tasks of its own") {
+			t.Errorf("recursive task = %+v", recursive)
+		}
+		exhausted := history[4].Content.([]providers.ContentBlock)[0]
+		if !exhausted.IsError || !strings.Contains(exhausted.Content.(string), `the sub-agent for "Loop" failed: stopped after 2 turns`) {
+			t.Errorf("exhausted task = %+v", exhausted)
+		}
+		// The last allowed call asks for the report
+		if last := (*requests)[3].Messages; !strings.Contains(string(last[len(last)-1]), "You have one turn left") {
+			t.Errorf("last sub-agent request = %s", last[len(last)-1])
+		}
+	})
+}
+
+func hasTool(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
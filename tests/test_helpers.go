@@ -35,6 +35,13 @@ func executeReadFile(path string) (string, error) {
 	return reg.Execute(input, nil, nil)
 }
 
+// executeToolWith calls the named tool with input as the model would send
+// it, e.g. with numbers as float64.
+func executeToolWith(name string, input map[string]interface{}) (string, error) {
+	reg, _ := tools.GetTool(name)
+	return reg.Execute(input, nil, nil)
+}
+
 func executePatchFile(path, oldText, newText string) (string, error) {
 	reg, _ := tools.GetTool("patch_file")
 	input := map[string]interface{}{
@@ -116,6 +123,15 @@ func executeMultiPatch(patches []interface{}) (string, error) {
 	return reg.Execute(input, nil, nil)
 }
 
+func executeApplyPatch(patch string, fuzz int) (string, error) {
+	reg, _ := tools.GetTool("apply_patch")
+	input := map[string]interface{}{
+		"patch": patch,
+		"fuzz":  float64(fuzz),
+	}
+	return reg.Execute(input, nil, nil)
+}
+
 func callClaude(apiKey string, messages []Message) (*Response, error) {
 	cfg := &config.Config{
 		APIKey:    apiKey,
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/session"
+)
+
+// TestTodos drives todo_write and todo_read through HandleMessage and saves
+// the list in a session.
+func TestTodos(t *testing.T) {
+	todos := []interface{}{
+		map[string]interface{}{"id": "1", "content": "Read the config loader", "status": "done"},
+		map[string]interface{}{"id": "2", "content": "Add  the TASK_MODEL\nkey", "status": "in_progress"},
+		map[string]interface{}{"id": "3", "content": "Update the README", "status": "pending"},
+	}
+	server := startScriptedServer(t,
+		toolCall("toolu_1", "todo_read", map[string]interface{}{}),
+		toolCall("toolu_2", "todo_write", map[string]interface{}{"todos": todos}),
+		toolCall("toolu_3", "todo_write", map[string]interface{}{"todos": []interface{}{
+			map[string]interface{}{"id": "1", "content": "a", "status": "in_progress"},
+			map[string]interface{}{"id": "2", "content": "b", "status": "in_progress"},
+		}}),
+		toolCall("toolu_4", "todo_read", map[string]interface{}{}),
+	)
+	sess := &session.Session{Dir: t.TempDir()}
+	var updates [][]agent.TodoItem
+	var progress []string
+	a := agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test",
+		agent.WithProgressCallback(func(msg, _ string) { progress = append(progress, msg) }),
+		agent.WithTodoCallback(func(todos []agent.TodoItem) {
+			updates = append(updates, todos)
+			sess.WriteMessage(session.TypeTodo, session.FormatTodos(todos))
+		}),
+	)
+	if _, err := a.HandleMessage("add a TASK_MODEL setting"); err != nil {
+		t.Fatal(err)
+	}
+
+	var results []providers.ContentBlock
+	for _, msg := range a.GetHistory() {
+		if blocks, ok := msg.Content.([]providers.ContentBlock); ok && msg.Role == "user" {
+			results = append(results, blocks[0])
+		}
+	}
+	if len(results) != 4 {
+		t.Fatalf("got %d tool results, want 4", len(results))
+	}
+	if results[0].Content != "The todo list is empty. Use todo_write to plan work with several steps." {
+		t.Errorf("empty read = %q", results[0].Content)
+	}
+	if results[1].IsError || results[1].Content != "Todo list updated: 1/3 done. In progress: 2: Add the TASK_MODEL key" {
+		t.Errorf("write = %+v", results[1])
+	}
+	if !results[2].IsError || !strings.Contains(results[2].Content.(string), `todos "1" and "2" are both in_progress`) {
+		t.Errorf("invalid write = %+v", results[2])
+	}
+	checklist := "- [x] 1: Read the config loader\n- [~] 2: Add the TASK_MODEL key\n- [ ] 3: Update the README"
+	if results[3].Content != "Todo list (1/3 done):\n"+checklist {
+		t.Errorf("read = %q", results[3].Content)
+	}
+	if len(updates) != 1 || len(a.Todos()) != 3 {
+		t.Errorf("updates = %v, todos = %v", updates, a.Todos())
+	}
+	if want := "→ Reading todos,→ Updating todos: 1/3 done,→ Updating todos,→ Reading todos"; strings.Join(progress, ",") != want {
+		t.Errorf("progress = %q", progress)
+	}
+
+	// The saved list is readable, restorable and not part of the history
+	files, _ := filepath.Glob(filepath.Join(sess.Dir, "*_todo.md"))
+	if len(files) != 1 {
+		t.Fatalf("todo files = %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.HasPrefix(string(data), "📋 Todos: 1/3 done\n"+checklist+"\ntodos: [") {
+		t.Errorf("todo file =\n%s", data)
+	}
+	restored, err := session.LatestTodos(sess.Dir)
+	if err != nil || len(restored) != 3 || restored[1] != a.Todos()[1] {
+		t.Errorf("LatestTodos = %v, %v", restored, err)
+	}
+	if history, warnings, _ := session.ReconstructHistory(sess.Dir); len(history) != 0 || len(warnings) != 0 {
+		t.Errorf("history = %v, warnings = %v", history, warnings)
+	}
+	if todos, err := session.LatestTodos(t.TempDir()); todos != nil || err != nil {
+		t.Errorf("LatestTodos without a list = %v, %v", todos, err)
+	}
+}
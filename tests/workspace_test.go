@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/this-is-alpha-iota/clyde/agent"
+	"github.com/this-is-alpha-iota/clyde/agent/config"
+	"github.com/this-is-alpha-iota/clyde/agent/providers"
+	"github.com/this-is-alpha-iota/clyde/agent/tools"
+	"github.com/this-is-alpha-iota/clyde/agent/workspace"
+)
+
+// lastToolResult returns the tool_result of the agent's only tool call.
+func lastToolResult(t *testing.T, a *agent.Agent) providers.ContentBlock {
+	t.Helper()
+	for _, msg := range a.GetHistory() {
+		if blocks, ok := msg.Content.([]providers.ContentBlock); ok && msg.Role == "user" {
+			for _, b := range blocks {
+				if b.Type == "tool_result" {
+					return b
+				}
+			}
+		}
+	}
+	t.Fatal("no tool result in history")
+	return providers.ContentBlock{}
+}
+
+// TestWorkspacePolicy drives file tools through the agent with the
+// workspace limited to one temporary directory.
+func TestWorkspacePolicy(t *testing.T) {
+	base, _ := filepath.EvalSymlinks(t.TempDir())
+	ws := filepath.Join(base, "ws")
+	outside := filepath.Join(base, "outside")
+	os.MkdirAll(ws, 0755)
+	os.MkdirAll(outside, 0755)
+	secret := filepath.Join(outside, "id_rsa")
+	os.WriteFile(secret, []byte("private key material\n"), 0644)
+	os.Symlink(outside, filepath.Join(ws, "link"))
+
+	run := func(t *testing.T, policy *workspace.Policy, permission agent.PermissionCallback, call []providers.ContentBlock) providers.ContentBlock {
+		t.Helper()
+		server := startScriptedServer(t, call)
+		opts := []agent.AgentOption{agent.WithWorkspacePolicy(policy)}
+		if permission != nil {
+			opts = append(opts, agent.WithPermissionCallback(permission))
+		}
+		a := agent.NewAgent(providers.NewClient("fake", server.URL, "m", 1000), "test", opts...)
+		if _, err := a.HandleMessage("go"); err != nil {
+			t.Fatal(err)
+		}
+		return lastToolResult(t, a)
+	}
+	ask, _ := workspace.New(ws, nil, workspace.ReadsAsk)
+
+	t.Run("Writes inside are allowed", func(t *testing.T) {
+		result := run(t, ask, nil, toolCall("toolu_1", "write_file", map[string]interface{}{
+			"path": filepath.Join(ws, "notes.txt"), "content": "hi\n",
+		}))
+		if result.IsError {
+			t.Errorf("unexpected error: %v", result.Content)
+		}
+	})
+
+	t.Run("Writes outside are denied, including through symlinks", func(t *testing.T) {
+		for _, path := range []string{filepath.Join(outside, "new.txt"), filepath.Join(ws, "link", "new.txt")} {
+			result := run(t, ask, func(string, string) bool { return true }, toolCall("toolu_1", "write_file", map[string]interface{}{
+				"path": path, "content": "x\n",
+			}))
+			if !result.IsError || !strings.HasPrefix(result.Content.(string), "Write denied: "+path) {
+				t.Errorf("write to %s: %+v", path, result)
+			}
+			if _, err := os.Stat(filepath.Join(outside, "new.txt")); err == nil {
+				t.Fatal("file written outside the workspace")
+			}
+		}
+	})
+
+	t.Run("Reads outside need approval", func(t *testing.T) {
+		call := toolCall("toolu_1", "read_file", map[string]interface{}{"path": secret})
+
+		result := run(t, ask, nil, call)
+		if !result.IsError || !strings.HasPrefix(result.Content.(string), "Read denied: "+secret) {
+			t.Errorf("read without a permission callback: %+v", result)
+		}
+
+		var asked string
+		result = run(t, ask, func(toolName, request string) bool {
+			asked = toolName + ": " + request
+			return false
+		}, call)
+		if !result.IsError || asked != "read_file: Read "+secret+", outside the workspace ("+ws+")?" {
+			t.Errorf("denied read: asked %q, result %+v", asked, result)
+		}
+
+		result = run(t, ask, func(string, string) bool { return true }, call)
+		if result.IsError || !strings.Contains(result.Content.(string), "private key material") {
+			t.Errorf("approved read: %+v", result)
+		}
+
+		allow, _ := workspace.New(ws, nil, workspace.ReadsAllow)
+		result = run(t, allow, nil, toolCall("toolu_1", "list_files", map[string]interface{}{"path": outside}))
+		if result.IsError {
+			t.Errorf("reads outside should be allowed: %+v", result)
+		}
+	})
+
+	t.Run("Read paths", func(t *testing.T) {
+		for name, want := range map[string]string{"read_file": secret, "list_files": ".", "grep": ".", "glob": ".", "repo_map": "."} {
+			reg, _ := tools.GetTool(name)
+			input := map[string]interface{}{}
+			if name == "read_file" {
+				input["path"] = secret
+			}
+			if got := reg.ReadPaths(input); len(got) != 1 || got[0] != want {
+				t.Errorf("%s read paths = %q, want %q", name, got, want)
+			}
+		}
+		reg, _ := tools.GetTool("glob")
+		for pattern, want := range map[string]string{
+			"../outside/*.go":       "../outside",
+			"./{cmd,../other}/**/*": "cmd|../other",
+			"*.go":                  ".",
+		} {
+			if got := reg.ReadPaths(map[string]interface{}{"pattern": pattern}); strings.Join(got, "|") != want {
+				t.Errorf("glob %q read paths = %q, want %q", pattern, got, want)
+			}
+		}
+		if got := reg.ReadPaths(map[string]interface{}{"path": ws, "pattern": "../outside/*"}); len(got) != 1 || got[0] != outside {
+			t.Errorf("glob read paths = %q, want %q", got, outside)
+		}
+		reg, _ = tools.GetTool("include_file")
+		if got := reg.ReadPaths(map[string]interface{}{"path": "https://example.com/a.png"}); len(got) != 0 {
+			t.Errorf("include_file URL read paths = %q", got)
+		}
+	})
+}
+
+func TestWorkspacePolicy_Config(t *testing.T) {
+	defer os.Unsetenv("WORKSPACE_ROOTS")
+	defer os.Unsetenv("OUTSIDE_READS")
+	defer os.Unsetenv("TS_AGENT_API_KEY")
+	os.Unsetenv("TS_AGENT_API_KEY")
+
+	path := filepath.Join(t.TempDir(), "config")
+	os.WriteFile(path, []byte("TS_AGENT_API_KEY=sk-test\nWORKSPACE_ROOTS=/srv/data,~/notes\nOUTSIDE_READS=allow\n"), 0644)
+	cfg, err := config.LoadFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(cfg.WorkspaceRoots, "|") != "/srv/data|~/notes" || cfg.OutsideReads != "allow" {
+		t.Errorf("got roots %q, outside reads %q", cfg.WorkspaceRoots, cfg.OutsideReads)
+	}
+
+	os.Unsetenv("WORKSPACE_ROOTS")
+	os.Unsetenv("OUTSIDE_READS")
+	os.WriteFile(path, []byte("TS_AGENT_API_KEY=sk-test\nOUTSIDE_READS=never\n"), 0644)
+	if _, err := config.LoadFromFile(path); err == nil || !strings.Contains(err.Error(), "OUTSIDE_READS") {
+		t.Errorf("expected an OUTSIDE_READS error, got %v", err)
+	}
+}